@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/veltahq/kiv/engine"
+)
+
+var errReadOnly = errors.New("database is opened read-only")
+
+type cli struct {
+	db       *engine.NewDatabase
+	out      io.Writer
+	format   string
+	readonly bool
+	dirty    bool
+}
+
+func main() {
+	dbPath := flag.String("db", "kiv.db", "database directory to open or create")
+	script := flag.String("f", "", "read commands from `file` instead of stdin")
+	format := flag.String("format", "table", "output format: table, csv or json")
+	readonly := flag.Bool("readonly", false, "reject commands that modify the database")
+	flag.Parse()
+
+	switch *format {
+	case "table", "csv", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "kiv: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	db, err := engine.Open(*dbPath)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kiv: %v\n", err)
+		os.Exit(1)
+	}
+
+	in := os.Stdin
+	interactive := isTerminal(in)
+	if *script != "" {
+		f, err := os.Open(*script)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "kiv: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		in = f
+		interactive = false
+	}
+
+	c := &cli{
+		db:       db,
+		out:      os.Stdout,
+		format:   *format,
+		readonly: *readonly,
+	}
+
+	status := c.run(in, interactive)
+
+	if c.dirty {
+		if err := db.SaveToDisk(); err != nil {
+			fmt.Fprintf(os.Stderr, "kiv: %v\n", err)
+			status = 1
+		}
+	}
+
+	os.Exit(status)
+}
+
+func (c *cli) run(in io.Reader, interactive bool) int {
+	scanner := bufio.NewScanner(in)
+	status := 0
+
+	for {
+		if interactive {
+			fmt.Fprint(c.out, "kiv> ")
+		}
+
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+
+		if line == ".quit" || line == ".exit" {
+			break
+		}
+
+		if err := c.execute(line); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			if !interactive {
+				return 1
+			}
+			status = 1
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "kiv: %v\n", err)
+		return 1
+	}
+
+	if interactive {
+		return 0
+	}
+	return status
+}
+
+func (c *cli) execute(line string) error {
+	if !strings.HasPrefix(line, ".") {
+		return fmt.Errorf("%w: unrecognized command %q", engine.ErrInvalidQuery, line)
+	}
+
+	cmd, rest, _ := strings.Cut(line, " ")
+	args := strings.Fields(rest)
+
+	switch cmd {
+	case ".tables":
+		return c.tables()
+	case ".schema":
+		if len(args) != 1 {
+			return errors.New("usage: .schema TABLE")
+		}
+		return c.schema(args[0])
+	case ".import":
+		if len(args) != 2 {
+			return errors.New("usage: .import FILE TABLE")
+		}
+		return c.importCSV(args[0], args[1])
+	case ".dump":
+		return c.dump(args)
+	case ".query":
+		return c.query(strings.TrimSpace(rest))
+	case ".help":
+		fmt.Fprintln(c.out, ".tables | .schema TABLE | .import FILE TABLE | .dump [TABLE...] | .query JSON | .quit")
+		return nil
+	default:
+		return fmt.Errorf("unknown command %s", cmd)
+	}
+}
+
+func (c *cli) tables() error {
+	var rows [][]interface{}
+	for _, name := range c.db.ListTables() {
+		rows = append(rows, []interface{}{name})
+	}
+	return c.print([]string{"table"}, rows)
+}
+
+func (c *cli) schema(tableName string) error {
+	schema, err := c.db.DescribeTable(tableName)
+
+	if err != nil {
+		return err
+	}
+
+	var rows [][]interface{}
+	for _, col := range schema.Columns {
+		rows = append(rows, []interface{}{col.Name, col.DataType.String(), col.Nullable, ""})
+	}
+	for _, idx := range schema.Indexes {
+		rows = append(rows, []interface{}{idx.Name, "index", idx.Unique, strings.Join(idx.Columns, ",")})
+	}
+
+	return c.print([]string{"name", "type", "nullable/unique", "columns"}, rows)
+}
+
+func (c *cli) importCSV(path, tableName string) error {
+	if c.readonly {
+		return errReadOnly
+	}
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+
+	if err != nil {
+		return err
+	}
+
+	schema, err := c.db.DescribeTable(tableName)
+
+	if errors.Is(err, engine.ErrTableNotFound) {
+		var columns []engine.Column
+		for _, name := range header {
+			if name != "id" {
+				columns = append(columns, engine.Column{Name: name, DataType: engine.String, Nullable: true})
+			}
+		}
+		if err := c.db.CreateTable(tableName, columns, nil); err != nil {
+			return err
+		}
+		c.dirty = true
+		schema, err = c.db.DescribeTable(tableName)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]engine.Column, len(schema.Columns))
+	for _, col := range schema.Columns {
+		columns[col.Name] = col
+	}
+
+	var rows []engine.Row
+	for line := 2; ; line++ {
+		record, err := r.Read()
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		row := engine.Row{Columns: make(map[string]interface{}, len(header))}
+		for i, name := range header {
+			col, typed := columns[name]
+			if name == "id" {
+				row.Columns[name] = record[i]
+				continue
+			}
+			if !typed {
+				col = engine.Column{DataType: engine.String}
+			}
+			val, err := parseValue(record[i], col)
+
+			if err != nil {
+				return fmt.Errorf("%s line %d column %s: %w", path, line, name, err)
+			}
+			row.Columns[name] = val
+		}
+		rows = append(rows, row)
+	}
+
+	if err := c.db.BulkLoad(tableName, rows); err != nil {
+		return err
+	}
+
+	c.dirty = true
+	fmt.Fprintf(os.Stderr, "imported %d rows into %s\n", len(rows), tableName)
+	return nil
+}
+
+func (c *cli) dump(tableNames []string) error {
+	if len(tableNames) == 0 {
+		tableNames = c.db.ListTables()
+	}
+
+	for _, name := range tableNames {
+		rows, err := c.db.GetAllRows(name)
+
+		if err != nil {
+			return err
+		}
+
+		columns := columnNames(rows)
+		if c.format == "table" {
+			fmt.Fprintf(c.out, "-- %s\n", name)
+		}
+		if err := c.printRows(columns, rows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) query(body string) error {
+	var query engine.Query
+
+	if err := json.Unmarshal([]byte(body), &query); err != nil {
+		return fmt.Errorf("%w: %v", engine.ErrInvalidQuery, err)
+	}
+
+	result, err := c.db.ExecuteQuery(query)
+
+	if err != nil {
+		return err
+	}
+
+	columns := result.Columns
+	if len(columns) == 0 {
+		columns = columnNames(result.Rows)
+	}
+
+	return c.printRows(columns, result.Rows)
+}
+
+func (c *cli) printRows(columns []string, rows []engine.Row) error {
+	values := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		record := make([]interface{}, len(columns))
+		for i, col := range columns {
+			record[i] = row.Columns[col]
+		}
+		values = append(values, record)
+	}
+	return c.print(columns, values)
+}
+
+func (c *cli) print(columns []string, rows [][]interface{}) error {
+	switch c.format {
+	case "csv":
+		w := csv.NewWriter(c.out)
+		w.Write(columns)
+		for _, row := range rows {
+			record := make([]string, len(row))
+			for i, val := range row {
+				record[i] = csvField(val)
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		return w.Error()
+	case "json":
+		objects := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			obj := make(map[string]interface{}, len(columns))
+			for i, col := range columns {
+				obj[col] = row[i]
+			}
+			objects = append(objects, obj)
+		}
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objects)
+	default:
+		w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+		for _, row := range rows {
+			record := make([]string, len(row))
+			for i, val := range row {
+				record[i] = formatValue(val)
+			}
+			fmt.Fprintln(w, strings.Join(record, "\t"))
+		}
+		return w.Flush()
+	}
+}
+
+func columnNames(rows []engine.Row) []string {
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		for col := range row.Columns {
+			seen[col] = true
+		}
+	}
+
+	columns := make([]string, 0, len(seen))
+	for col := range seen {
+		if col != "id" {
+			columns = append(columns, col)
+		}
+	}
+	sort.Strings(columns)
+
+	if seen["id"] {
+		columns = append([]string{"id"}, columns...)
+	}
+	return columns
+}
+
+// nullField is the CSV field that stands for NULL. csvField writes it for
+// NULL, and doubles the leading backslash of any value that starts with
+// one, so that no value is written as \N; parseValue undoes both.
+const nullField = `\N`
+
+// csvField formats val as a CSV field that parseValue reads back as val.
+func csvField(val interface{}) string {
+	if val == nil {
+		return nullField
+	}
+	text := formatValue(val)
+	if strings.HasPrefix(text, `\`) {
+		return `\` + text
+	}
+	return text
+}
+
+// parseValue reads a CSV field written by csvField as a value of col. \N
+// is NULL, and so is an empty field unless col holds text, where it is the
+// empty string. Ints are read as int64, as the engine stores them, arrays
+// are written as JSON arrays, such as ["a","b"] or [1,2], and JSON values
+// as JSON.
+func parseValue(s string, col engine.Column) (interface{}, error) {
+	switch {
+	case s == nullField:
+		return nil, nil
+	case strings.HasPrefix(s, `\\`):
+		s = s[1:]
+	case s == "" && col.DataType != engine.String && col.DataType != engine.Enum:
+		return nil, nil
+	}
+
+	switch col.DataType {
+	case engine.Int:
+		return strconv.ParseInt(s, 10, 64)
+	case engine.Float:
+		return strconv.ParseFloat(s, 64)
+	case engine.Bool:
+		return strconv.ParseBool(s)
+	case engine.DateTime:
+		return time.Parse(time.RFC3339Nano, s)
+	case engine.Decimal:
+		return engine.ParseDecimal(s)
+	case engine.Array:
+		var items []interface{}
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		if err := dec.Decode(&items); err != nil {
+			return nil, fmt.Errorf("array %s: %w", s, err)
+		}
+		for i, item := range items {
+			n, ok := item.(json.Number)
+			if !ok {
+				continue
+			}
+			var err error
+			if col.ElementType == engine.Float {
+				items[i], err = n.Float64()
+			} else {
+				items[i], err = n.Int64()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("array %s: %w", s, err)
+			}
+		}
+		return items, nil
+	case engine.JSON:
+		var val interface{}
+		if err := json.Unmarshal([]byte(s), &val); err != nil {
+			return nil, fmt.Errorf("JSON %s: %w", s, err)
+		}
+		return val, nil
+	default:
+		return s, nil
+	}
+}
+
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []interface{}, map[string]interface{}:
+		text, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(text)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
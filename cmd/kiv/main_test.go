@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/veltahq/kiv/engine"
+)
+
+func newTestCLI(t *testing.T, format string) (*cli, *bytes.Buffer) {
+	t.Helper()
+	out := new(bytes.Buffer)
+	db := &engine.NewDatabase{Name: "test", Tables: make(map[string]engine.Table)}
+	return &cli{db: db, out: out, format: format}, out
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	c, out := newTestCLI(t, "csv")
+	columns := []engine.Column{
+		{Name: "n", DataType: engine.Int, Nullable: true},
+		{Name: "name", DataType: engine.String, Nullable: true},
+		{Name: "note", DataType: engine.String},
+	}
+	if err := c.db.CreateTable("src", columns, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]interface{}{
+		"a": {"n": int64(1) << 40, "name": "x", "note": ""},
+		"b": {"n": nil, "name": nil, "note": `\N`},
+		"c": {"n": int64(0), "name": "", "note": `\\x`},
+	}
+	for id, data := range want {
+		if err := c.db.InsertRow("src", id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.dump([]string{"src"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "src.csv")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.db.CreateTable("dst", columns, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.importCSV(path, "dst"); err != nil {
+		t.Fatalf(".import of the dump: %v\n%s", err, out)
+	}
+
+	for id, data := range want {
+		row, err := c.db.GetRowByID("dst", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for col, val := range data {
+			if row.Columns[col] != val {
+				t.Errorf("row %s column %s = %#v, want %#v\n%s", id, col, row.Columns[col], val, out)
+			}
+		}
+	}
+}
+
+func TestCSVRoundTripJSON(t *testing.T) {
+	c, out := newTestCLI(t, "csv")
+	columns := []engine.Column{{Name: "doc", DataType: engine.JSON, Nullable: true}}
+	if err := c.db.CreateTable("src", columns, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": map[string]interface{}{"x": 1.0, "tags": []interface{}{"p", "q"}, "nested": map[string]interface{}{"ok": true, "none": nil}},
+		"b": []interface{}{1.5, "two", map[string]interface{}{"three": 3.0}},
+		"c": nil,
+	}
+	for id, doc := range want {
+		if err := c.db.InsertRow("src", id, map[string]interface{}{"doc": doc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.dump([]string{"src"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "src.csv")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.db.CreateTable("dst", columns, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.importCSV(path, "dst"); err != nil {
+		t.Fatalf(".import of the dump: %v\n%s", err, out)
+	}
+
+	for id, doc := range want {
+		row, err := c.db.GetRowByID("dst", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(row.Columns["doc"], doc) {
+			t.Errorf("row %s doc = %#v, want %#v\n%s", id, row.Columns["doc"], doc, out)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		col  engine.Column
+		want interface{}
+	}{
+		{"", engine.Column{DataType: engine.Int}, nil},
+		{`\N`, engine.Column{DataType: engine.Int}, nil},
+		{`\N`, engine.Column{DataType: engine.String}, nil},
+		{"", engine.Column{DataType: engine.String}, ""},
+		{`\\N`, engine.Column{DataType: engine.String}, `\N`},
+		{"42", engine.Column{DataType: engine.Int}, int64(42)},
+		{"9000000000", engine.Column{DataType: engine.Int}, int64(9000000000)},
+		{"1.5", engine.Column{DataType: engine.Float}, 1.5},
+		{"true", engine.Column{DataType: engine.Bool}, true},
+		{"hello", engine.Column{DataType: engine.String}, "hello"},
+	}
+	for _, tt := range tests {
+		got, err := parseValue(tt.in, tt.col)
+		if err != nil {
+			t.Errorf("parseValue(%q, %s): %v", tt.in, tt.col.DataType, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseValue(%q, %s) = %#v, want %#v", tt.in, tt.col.DataType, got, tt.want)
+		}
+	}
+
+	if _, err := parseValue("1.5", engine.Column{DataType: engine.Int}); err == nil {
+		t.Error("parseValue(1.5, INT) succeeded")
+	}
+}
+
+func TestReadOnlyRejectsImport(t *testing.T) {
+	c, _ := newTestCLI(t, "table")
+	c.readonly = true
+	if err := c.execute(".import missing.csv t"); err != errReadOnly {
+		t.Fatalf(".import with --readonly = %v, want errReadOnly", err)
+	}
+}
+
+func TestScriptStopsOnError(t *testing.T) {
+	c, out := newTestCLI(t, "table")
+	script := ".tables\n.nosuchcommand\n.tables\n"
+	if status := c.run(strings.NewReader(script), false); status != 1 {
+		t.Fatalf("run = %d, want 1", status)
+	}
+	if n := strings.Count(out.String(), "table\n"); n != 1 {
+		t.Errorf("ran .tables %d times, want once before the error", n)
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AggregateQuery returns agg over the rows of tableName that match filter,
+// or over all of them if filter is empty. COUNT gives an int64 and SUM,
+// AVG, MIN and MAX a float64, or nil if no row has a value for the column.
+// MIN and MAX of a column that is not numeric fail with ErrInvalidCast.
+func (db *NewDatabase) AggregateQuery(tableName string, agg AggregateExpr, filter string) (interface{}, error) {
+	name := strings.ToUpper(agg.Func)
+	if !isAggregateName(name) {
+		return nil, fmt.Errorf("%w: unknown aggregate %q", ErrInvalidQuery, agg.Func)
+	}
+	if agg.Column == "" && name != "COUNT" {
+		return nil, fmt.Errorf("%w: %s needs a column", ErrInvalidQuery, name)
+	}
+
+	item := agg.String()
+	result, err := db.ExecuteQuery(Query{Select: []string{item}, From: tableName, Where: filter})
+
+	if err != nil {
+		return nil, err
+	}
+
+	val := result.Rows[0].Columns[item]
+	switch {
+	case name == "COUNT":
+		return toInt64(val), nil
+	case val == nil:
+		return nil, nil
+	case valueKind(val) != kindNumber:
+		return nil, fmt.Errorf("%w: %s is %T, not a number", ErrInvalidCast, item, val)
+	}
+	return toFloat(val), nil
+}
+
+// CountWhere returns the number of rows of tableName that match filter.
+func (db *NewDatabase) CountWhere(tableName, filter string) (int64, error) {
+	val, err := db.AggregateQuery(tableName, AggregateExpr{Func: "COUNT"}, filter)
+
+	if err != nil {
+		return 0, err
+	}
+	return val.(int64), nil
+}
+
+// SumWhere returns the sum of column over the rows of tableName that match
+// filter. It is 0 if no row has a value for column.
+func (db *NewDatabase) SumWhere(tableName, column, filter string) (float64, error) {
+	return db.aggregateFloat(tableName, "SUM", column, filter)
+}
+
+// MinWhere is SumWhere for MIN.
+func (db *NewDatabase) MinWhere(tableName, column, filter string) (float64, error) {
+	return db.aggregateFloat(tableName, "MIN", column, filter)
+}
+
+// MaxWhere is SumWhere for MAX.
+func (db *NewDatabase) MaxWhere(tableName, column, filter string) (float64, error) {
+	return db.aggregateFloat(tableName, "MAX", column, filter)
+}
+
+// AvgWhere is SumWhere for AVG.
+func (db *NewDatabase) AvgWhere(tableName, column, filter string) (float64, error) {
+	return db.aggregateFloat(tableName, "AVG", column, filter)
+}
+
+func (db *NewDatabase) aggregateFloat(tableName, name, column, filter string) (float64, error) {
+	val, err := db.AggregateQuery(tableName, AggregateExpr{Func: name, Column: column}, filter)
+
+	if err != nil || val == nil {
+		return 0, err
+	}
+	return val.(float64), nil
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func aggregateTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "sales", []Column{
+		{Name: "region", DataType: String},
+		{Name: "amount", DataType: Float, Nullable: true},
+		{Name: "units", DataType: Int},
+	}, nil)
+	for id, row := range map[string][3]interface{}{
+		"a": {"north", 10.5, 1},
+		"b": {"north", 4.0, 3},
+		"c": {"south", 20.0, 2},
+		"d": {"south", nil, 7},
+		"e": {"east", -2.5, 5},
+	} {
+		mustInsert(t, db, "sales", id, map[string]interface{}{"region": row[0], "amount": row[1], "units": row[2]})
+	}
+	return db
+}
+
+func TestAggregateWhere(t *testing.T) {
+	db := aggregateTestDB(t)
+
+	tests := []struct {
+		name   string
+		run    func(filter string) (float64, error)
+		filter string
+		want   float64
+	}{
+		{"SumWhere", func(f string) (float64, error) { return db.SumWhere("sales", "amount", f) }, "", 32},
+		{"SumWhere", func(f string) (float64, error) { return db.SumWhere("sales", "units", f) }, "region = 'south'", 9},
+		{"AvgWhere", func(f string) (float64, error) { return db.AvgWhere("sales", "amount", f) }, "", 8},
+		{"AvgWhere", func(f string) (float64, error) { return db.AvgWhere("sales", "units", f) }, "region <> 'east'", 3.25},
+		{"MinWhere", func(f string) (float64, error) { return db.MinWhere("sales", "amount", f) }, "", -2.5},
+		{"MinWhere", func(f string) (float64, error) { return db.MinWhere("sales", "amount", f) }, "region = 'north'", 4},
+		{"MaxWhere", func(f string) (float64, error) { return db.MaxWhere("sales", "amount", f) }, "", 20},
+		{"MaxWhere", func(f string) (float64, error) { return db.MaxWhere("sales", "units", f) }, "amount IS NULL", 7},
+		// No matching rows, or none with a value, give 0.
+		{"SumWhere", func(f string) (float64, error) { return db.SumWhere("sales", "amount", f) }, "region = 'west'", 0},
+		{"MaxWhere", func(f string) (float64, error) { return db.MaxWhere("sales", "amount", f) }, "amount IS NULL", 0},
+	}
+	for _, tt := range tests {
+		got, err := tt.run(tt.filter)
+		if err != nil {
+			t.Errorf("%s(%q): %v", tt.name, tt.filter, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s(%q) = %v, want %v", tt.name, tt.filter, got, tt.want)
+		}
+	}
+
+	for filter, want := range map[string]int64{"": 5, "region = 'north'": 2, "amount > 100": 0, "amount IS NULL": 1} {
+		if got, err := db.CountWhere("sales", filter); err != nil || got != want {
+			t.Errorf("CountWhere(%q) = %d, %v, want %d", filter, got, err, want)
+		}
+	}
+}
+
+func TestAggregateQuery(t *testing.T) {
+	db := aggregateTestDB(t)
+
+	tests := []struct {
+		agg  AggregateExpr
+		want interface{}
+	}{
+		{AggregateExpr{Func: "COUNT"}, int64(5)},
+		{AggregateExpr{Func: "count", Column: "amount"}, int64(4)},
+		{AggregateExpr{Func: "SUM", Column: "units"}, 18.0},
+		{AggregateExpr{Func: "avg", Column: "amount"}, 8.0},
+	}
+	for _, tt := range tests {
+		got, err := db.AggregateQuery("sales", tt.agg, "")
+		if err != nil || got != tt.want {
+			t.Errorf("AggregateQuery(%+v) = %#v, %v, want %#v", tt.agg, got, err, tt.want)
+		}
+	}
+
+	if got, err := db.AggregateQuery("sales", AggregateExpr{Func: "MIN", Column: "amount"}, "amount IS NULL"); err != nil || got != nil {
+		t.Errorf("MIN over only NULLs = %#v, %v, want nil", got, err)
+	}
+
+	errTests := []struct {
+		table string
+		agg   AggregateExpr
+		want  error
+	}{
+		{"sales", AggregateExpr{Func: "MEDIAN", Column: "amount"}, ErrInvalidQuery},
+		{"sales", AggregateExpr{Func: "SUM"}, ErrInvalidQuery},
+		{"sales", AggregateExpr{Func: "MIN", Column: "region"}, ErrInvalidCast},
+		{"missing", AggregateExpr{Func: "COUNT"}, ErrTableNotFound},
+	}
+	for _, tt := range errTests {
+		if _, err := db.AggregateQuery(tt.table, tt.agg, ""); !errors.Is(err, tt.want) {
+			t.Errorf("AggregateQuery(%s, %+v) = %v, want %v", tt.table, tt.agg, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package engine
+
+import "fmt"
+
+// AlterColumn changes the type of columnName to newType and converts every
+// stored value, soft-deleted rows included, with migrateFn, or as CAST
+// would if migrateFn is nil; NULLs stay NULL. Each converted row must then
+// pass the table's checks as a write would, and the indexes are rebuilt
+// from the converted values. If any value fails to convert or any check
+// fails the table is left unchanged.
+//
+// The partition column, a column another column's foreign key references,
+// and a column whose Default the new type cannot hold cannot be altered.
+func (db *NewDatabase) AlterColumn(tableName, columnName string, newType DataType, migrateFn func(interface{}) (interface{}, error)) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	altered, err := db.alteredTable(tableName, AlterOp{Column: columnName, NewType: newType, Migrate: migrateFn})
+
+	if err != nil {
+		return err
+	}
+
+	db.Tables[tableName] = altered
+	db.replicateTable(tableName)
+	return nil
+}
+
+// alteredTable returns tableName as op would leave it, as AlterColumn
+// describes, without storing it. The caller must hold db.mu for writing.
+func (db *NewDatabase) alteredTable(tableName string, op AlterOp) (Table, error) {
+	columnName, newType, migrateFn := op.Column, op.NewType, op.Migrate
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return Table{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	pos := -1
+	for i, col := range table.Columns {
+		if col.Name == columnName {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return Table{}, fmt.Errorf("%w: table %s has no column %s", ErrInvalidSchema, tableName, columnName)
+	}
+	if columnName == table.PartitionColumn {
+		return Table{}, fmt.Errorf("%w: %s is the partition column of table %s", ErrInvalidSchema, columnName, tableName)
+	}
+	for name, other := range db.Tables {
+		for _, col := range other.Columns {
+			if fk := col.ForeignKey; fk != nil && fk.Table == tableName && fk.Column == columnName {
+				return Table{}, fmt.Errorf("%w: column %s of table %s is referenced by %s.%s", ErrForeignKey, columnName, tableName, name, col.Name)
+			}
+		}
+	}
+
+	columns := append([]Column(nil), table.Columns...)
+	columns[pos].DataType = newType
+	if err := validateSchema(columns, table.Indexes); err != nil {
+		return Table{}, fmt.Errorf("table %s: %w", tableName, err)
+	}
+
+	if migrateFn == nil {
+		migrateFn = func(val interface{}) (interface{}, error) {
+			return castValue(val, newType)
+		}
+	}
+
+	table.ensureIndexes()
+	candidate := table.cloneStorage()
+	candidate.Columns = columns
+	candidate.checks = nil
+
+	convert := func(row Row) (Row, error) {
+		if row.Columns[columnName] == nil {
+			return row, nil
+		}
+
+		row, err := db.openRow(&candidate, row)
+
+		if err != nil {
+			return Row{}, fmt.Errorf("converting row %s: %w", rowID(row), err)
+		}
+
+		converted, err := migrateFn(row.Columns[columnName])
+
+		if err != nil {
+			return Row{}, fmt.Errorf("converting row %s: %w", rowID(row), err)
+		}
+		row = copyRow(row)
+		row.Columns[columnName] = converted
+		if err := candidate.validateRow(row); err != nil {
+			return Row{}, fmt.Errorf("converting row %s: %w", rowID(row), err)
+		}
+		return db.sealRow(&candidate, row)
+	}
+
+	var err error
+	if candidate.kv != nil {
+		for id, row := range candidate.kv.rows {
+			if candidate.kv.rows[id], err = convert(row); err != nil {
+				return Table{}, err
+			}
+		}
+		candidate.kv.invalidate()
+	} else {
+		for i, row := range candidate.Rows {
+			if candidate.Rows[i], err = convert(row); err != nil {
+				return Table{}, err
+			}
+		}
+	}
+
+	if bad, err := candidate.rebuildIndexes(); err != nil {
+		return Table{}, fmt.Errorf("converting row %s: %w", bad, err)
+	}
+	if columns[pos].ForeignKey != nil {
+		for _, row := range candidate.scanRows(true) {
+			if err := db.checkForeignKeys(&candidate, row, nil, nil); err != nil {
+				return Table{}, fmt.Errorf("converting row %s: %w", rowID(row), err)
+			}
+		}
+	}
+
+	return candidate, nil
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func alterTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "parts", []Column{
+		{Name: "code", DataType: String, Nullable: true},
+		{Name: "name", DataType: String},
+	}, []Index{{Name: "by_code", Columns: []string{"code"}, Unique: true}})
+	mustInsertRows(t, db, "parts", map[string]map[string]interface{}{
+		"a": {"code": "10", "name": "bolt"},
+		"b": {"code": "7", "name": "nut"},
+		"c": {"code": nil, "name": "washer"},
+	})
+	return db
+}
+
+func TestAlterColumnMigrates(t *testing.T) {
+	db := alterTestDB(t)
+
+	if err := db.AlterColumn("parts", "code", Int, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id", "code"}, From: "parts", OrderBy: "code"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"b", "a", "c"}) {
+		t.Errorf("ORDER BY code = %v, want [b a c], ordered as numbers", got)
+	}
+	if code := result.Rows[1].Columns["code"]; toInt64(code) != 10 || valueKind(code) != kindNumber {
+		t.Errorf("code of a = %#v, want 10", code)
+	}
+	if code := result.Rows[2].Columns["code"]; code != nil {
+		t.Errorf("code of c = %#v, want NULL", code)
+	}
+
+	// New writes are checked against the new type.
+	if err := db.InsertRow("parts", "d", map[string]interface{}{"code": "x", "name": "pin"}); err == nil {
+		t.Error("InsertRow of a String into the altered Int column succeeded")
+	}
+
+	if err := db.AlterColumn("parts", "code", Float, func(v interface{}) (interface{}, error) {
+		return float64(toInt64(v)) / 2, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	row, err := db.GetRowByID("parts", "b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := row.Columns["code"]; code != 3.5 {
+		t.Errorf("code after migrateFn = %#v, want 3.5", code)
+	}
+}
+
+func TestAlterColumnRollsBack(t *testing.T) {
+	db := alterTestDB(t)
+	mustInsert(t, db, "parts", "d", map[string]interface{}{"code": "x9", "name": "pin"})
+	before, err := db.GetAllRows("parts")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a converts, d does not.
+	if err := db.AlterColumn("parts", "code", Int, nil); !errors.Is(err, ErrInvalidCast) {
+		t.Fatalf("AlterColumn = %v, want ErrInvalidCast", err)
+	}
+
+	errBad := errors.New("bad value")
+	err = db.AlterColumn("parts", "code", String, func(v interface{}) (interface{}, error) {
+		if v == "x9" {
+			return nil, errBad
+		}
+		return v, nil
+	})
+	if !errors.Is(err, errBad) {
+		t.Fatalf("AlterColumn with a failing migrateFn = %v, want its error", err)
+	}
+
+	// Codes that convert to the same value break the unique index.
+	err = db.AlterColumn("parts", "code", String, func(v interface{}) (interface{}, error) {
+		return "same", nil
+	})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("AlterColumn making codes equal = %v, want ErrUniqueViolation", err)
+	}
+
+	after, err := db.GetAllRows("parts")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("failed AlterColumn changed the rows: %v", after)
+	}
+	if col := db.Tables["parts"].Columns[0]; col.DataType != String {
+		t.Errorf("failed AlterColumn changed the type to %v", col.DataType)
+	}
+}
+
+func TestAlterColumnRebuildsIndexes(t *testing.T) {
+	db := alterTestDB(t)
+	for i := 0; i < 50; i++ {
+		mustInsert(t, db, "parts", fmt.Sprintf("p%d", i), map[string]interface{}{"code": fmt.Sprint(100 + i), "name": "spring"})
+	}
+
+	if err := db.AlterColumn("parts", "code", Int, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	table := db.Tables["parts"]
+	for val, want := range map[interface{}]string{7: "b", int64(120): "p20", "7": "", "120": ""} {
+		var ids []string
+		for _, row := range table.probe("by_code", "code", val) {
+			ids = append(ids, rowID(row))
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Errorf("by_code holds %s for %#v, want %q", got, val, want)
+		}
+	}
+	for where, want := range map[string]string{"code = 7": "b", "code = 120": "p20", "code = '7'": ""} {
+		got := strings.Join(resultIDs(mustQuery(t, db, Query{Select: []string{"id"}, From: "parts", Where: where})), ",")
+		if got != want {
+			t.Errorf("WHERE %s = %q, want %q", where, got, want)
+		}
+	}
+
+	if err := db.InsertRow("parts", "dup", map[string]interface{}{"code": 7, "name": "nut"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("InsertRow of a duplicate code = %v, want ErrUniqueViolation", err)
+	}
+}
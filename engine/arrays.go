@@ -0,0 +1,439 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// anyOperand is ANY(array) as parsed; it is only meaningful as one side of
+// a comparison, where the parser turns it into an anyExpr.
+type anyOperand struct {
+	x expr
+}
+
+// anyExpr is ANY(array) op x or x op ANY(array): true if the comparison
+// holds for some element. As with IN, it is NULL rather than false when no
+// element matches but one of them is NULL, and NULL for a NULL array.
+type anyExpr struct {
+	op         string
+	array, x   expr
+	arrayFirst bool
+}
+
+func (p *exprParser) parseAny(name token) (expr, error) {
+	args, err := p.parseList()
+
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return nil, p.errorf(name, "ANY takes 1 argument, got %d", len(args))
+	}
+	return anyOperand{x: args[0]}, nil
+}
+
+func (p *exprParser) anyComparison(tok token, op string, array anyOperand, x expr, arrayFirst bool) (expr, error) {
+	if _, ok := x.(anyOperand); ok {
+		return nil, p.errorf(tok, "ANY on both sides of %s", op)
+	}
+	return anyExpr{op: op, array: array.x, x: x, arrayFirst: arrayFirst}, nil
+}
+
+func (e anyOperand) eval(Row) (interface{}, error) {
+	return nil, fmt.Errorf("%w: ANY(%s) must be compared with a value", ErrInvalidQuery, e.x)
+}
+
+func (e anyOperand) String() string {
+	return "ANY(" + e.x.String() + ")"
+}
+
+func (e anyExpr) eval(row Row) (interface{}, error) {
+	arrayVal, err := e.array.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := e.x.eval(row)
+
+	if err != nil || arrayVal == nil || val == nil {
+		return nil, err
+	}
+
+	items, ok := arrayVal.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: ANY requires an array, got %T", ErrInvalidQuery, arrayVal)
+	}
+
+	sawNull := false
+	for _, item := range items {
+		if item == nil {
+			sawNull = true
+			continue
+		}
+
+		left, right := val, item
+		if e.arrayFirst {
+			left, right = item, val
+		}
+
+		match, err := compareOp(e.op, left, right)
+
+		if err != nil {
+			return nil, err
+		}
+		if match == true {
+			return true, nil
+		}
+	}
+
+	if sawNull {
+		return nil, nil
+	}
+	return false, nil
+}
+
+func (e anyExpr) String() string {
+	array := anyOperand{x: e.array}.String()
+	if e.arrayFirst {
+		return "(" + array + " " + e.op + " " + e.x.String() + ")"
+	}
+	return "(" + e.x.String() + " " + e.op + " " + array + ")"
+}
+
+// containsExpr is x CONTAINS v, x CONTAINS ANY (v, ...) or x CONTAINS ALL
+// (v, ...), where x is an array: true if x holds v, any of the values or
+// all of them. An array among the values stands for its elements, so
+// tags CONTAINS ANY ($1) takes a list as its parameter. As with IN, an
+// array that does not hold a value but has a NULL element may hold it,
+// and a NULL array or value makes the result NULL unless the others
+// decide it.
+type containsExpr struct {
+	x    expr
+	list []expr
+	mode string
+	not  bool
+}
+
+func (p *exprParser) parseContains(left expr, not bool) (expr, error) {
+	e := containsExpr{x: left, not: not}
+	switch {
+	case p.acceptKeyword("ANY"):
+		e.mode = "ANY"
+	case p.acceptKeyword("ALL"):
+		e.mode = "ALL"
+	}
+
+	if e.mode == "" {
+		value, err := p.parseAdditive()
+
+		if err != nil {
+			return nil, err
+		}
+		e.list = []expr{value}
+		return e, nil
+	}
+
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	list, err := p.parseList()
+
+	if err != nil {
+		return nil, err
+	}
+	e.list = list
+	return e, nil
+}
+
+func (e containsExpr) eval(row Row) (interface{}, error) {
+	arrayVal, err := e.x.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := e.values(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var items []interface{}
+	if arrayVal != nil {
+		var ok bool
+		if items, ok = arrayVal.([]interface{}); !ok {
+			return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, "CONTAINS", "CONTAINS requires an array, got %T", arrayVal)
+		}
+	}
+
+	// Combine the answer for each value as OR does for CONTAINS and
+	// CONTAINS ANY, and as AND does for CONTAINS ALL.
+	decided := e.mode != "ALL"
+	var result interface{} = !decided
+	for _, val := range values {
+		var holds interface{}
+		if arrayVal != nil && val != nil {
+			holds = arrayHolds(items, val)
+		}
+		if holds == decided {
+			result = decided
+			break
+		}
+		if holds == nil {
+			result = nil
+		}
+	}
+
+	if b, ok := result.(bool); ok && e.not {
+		return !b, nil
+	}
+	return result, nil
+}
+
+// values evaluates the list, replacing arrays by their elements.
+func (e containsExpr) values(row Row) ([]interface{}, error) {
+	var values []interface{}
+	for _, item := range e.list {
+		val, err := item.eval(row)
+
+		if err != nil {
+			return nil, err
+		}
+		if items, ok := val.([]interface{}); ok {
+			values = append(values, items...)
+		} else {
+			values = append(values, val)
+		}
+	}
+	return values, nil
+}
+
+// arrayHolds reports whether items has an element equal to val: true, or
+// NULL rather than false if it has a NULL element.
+func arrayHolds(items []interface{}, val interface{}) interface{} {
+	sawNull := false
+	for _, item := range items {
+		if item == nil {
+			sawNull = true
+			continue
+		}
+		if a, b := timeOperands(val, item); sameValue(a, b) {
+			return true
+		}
+	}
+	if sawNull {
+		return nil
+	}
+	return false
+}
+
+func (e containsExpr) String() string {
+	op := " CONTAINS "
+	if e.not {
+		op = " NOT CONTAINS "
+	}
+	if e.mode == "" {
+		return e.x.String() + op + e.list[0].String()
+	}
+	items := make([]string, len(e.list))
+	for i, item := range e.list {
+		items[i] = item.String()
+	}
+	return e.x.String() + op + e.mode + " (" + strings.Join(items, ", ") + ")"
+}
+
+// containsLookup returns the ids of the rows that may satisfy filter's
+// CONTAINS conjuncts on columns with an inverted index and constant
+// values; ok is false if it has none.
+func (t *Table) containsLookup(filter expr) (map[string]bool, bool) {
+	if filter == nil || t.indexData == nil {
+		return nil, false
+	}
+
+	var result map[string]bool
+	for _, c := range conjuncts(filter) {
+		e, isContains := c.(containsExpr)
+		col, isColumn := e.x.(columnExpr)
+		if !isContains || !isColumn || e.not || (e.mode == "ALL" && len(e.list) == 0) {
+			continue
+		}
+		idx, elemType, ok := t.invertedIndex(col.name)
+		constant := true
+		for _, item := range e.list {
+			constant = constant && isConstant(item)
+		}
+		if !ok || !constant {
+			continue
+		}
+
+		values, err := e.values(Row{})
+
+		if err != nil {
+			continue
+		}
+
+		var ids map[string]bool
+		for i, val := range values {
+			matches := make(map[string]bool)
+			if val != nil {
+				if s, ok := val.(string); ok && elemType == DateTime {
+					if parsed, ok := parseDateTime(s); ok {
+						val = parsed
+					}
+				}
+				for _, key := range lookupKeys(val) {
+					for _, id := range t.indexData[idx][key] {
+						matches[id] = true
+					}
+				}
+			}
+			switch {
+			case i == 0:
+				ids = matches
+			case e.mode == "ALL":
+				ids = intersectIDs(ids, matches)
+			default:
+				for id := range matches {
+					ids[id] = true
+				}
+			}
+		}
+		if ids == nil {
+			ids = map[string]bool{}
+		}
+
+		if result == nil {
+			result = ids
+		} else {
+			result = intersectIDs(result, ids)
+		}
+	}
+	return result, result != nil
+}
+
+// invertedIndex returns the name of an inverted index on column and the
+// column's element type.
+func (t *Table) invertedIndex(column string) (string, DataType, bool) {
+	for _, idx := range t.Indexes {
+		if !idx.Inverted || idx.Columns[0] != column {
+			continue
+		}
+		for _, col := range t.Columns {
+			if col.Name == column {
+				return idx.Name, col.ElementType, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+func intersectIDs(a, b map[string]bool) map[string]bool {
+	both := make(map[string]bool)
+	for id := range a {
+		if b[id] {
+			both[id] = true
+		}
+	}
+	return both
+}
+
+// cloneArray returns a copy of val if it is an array, and val otherwise, so
+// that a query result never shares an array with a stored row.
+func cloneArray(val interface{}) interface{} {
+	if items, ok := val.([]interface{}); ok {
+		out := make([]interface{}, len(items))
+		copy(out, items)
+		return out
+	}
+	return val
+}
+
+// arrayArg returns argument i as an array; ok is false if it is NULL.
+func arrayArg(name string, args []interface{}, i int) ([]interface{}, bool, error) {
+	switch v := args[i].(type) {
+	case nil:
+		return nil, false, nil
+	case []interface{}:
+		return v, true, nil
+	default:
+		return nil, false, fmt.Errorf("%w: %s requires an array, got %T", ErrInvalidQuery, name, v)
+	}
+}
+
+// sameValue reports whether two non-nil values are equal as with =.
+func sameValue(a, b interface{}) bool {
+	return valueKind(a) == valueKind(b) && compareOrdered(a, b) == 0
+}
+
+func arrayLength(args []interface{}) (interface{}, error) {
+	if err := checkArgs("ARRAY_LENGTH", args, 1); err != nil {
+		return nil, err
+	}
+
+	items, ok, err := arrayArg("ARRAY_LENGTH", args, 0)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+	return int64(len(items)), nil
+}
+
+func arrayContains(args []interface{}) (interface{}, error) {
+	if err := checkArgs("ARRAY_CONTAINS", args, 2); err != nil {
+		return nil, err
+	}
+
+	items, ok, err := arrayArg("ARRAY_CONTAINS", args, 0)
+
+	if err != nil || !ok || args[1] == nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item != nil && sameValue(item, args[1]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// arrayAppend returns a new array with the value added at the end; the
+// argument array is never modified.
+func arrayAppend(args []interface{}) (interface{}, error) {
+	if err := checkArgs("ARRAY_APPEND", args, 2); err != nil {
+		return nil, err
+	}
+
+	items, ok, err := arrayArg("ARRAY_APPEND", args, 0)
+
+	if err != nil || !ok || args[1] == nil {
+		return nil, err
+	}
+
+	out := make([]interface{}, len(items), len(items)+1)
+	copy(out, items)
+	return append(out, args[1]), nil
+}
+
+// arrayRemove returns a new array without any element equal to the value.
+func arrayRemove(args []interface{}) (interface{}, error) {
+	if err := checkArgs("ARRAY_REMOVE", args, 2); err != nil {
+		return nil, err
+	}
+
+	items, ok, err := arrayArg("ARRAY_REMOVE", args, 0)
+
+	if err != nil || !ok || args[1] == nil {
+		return nil, err
+	}
+
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if item == nil || !sameValue(item, args[1]) {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func arrayTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "contacts", []Column{
+		{Name: "phones", DataType: Array, ElementType: String, Nullable: true},
+		{Name: "scores", DataType: Array, ElementType: Int, Nullable: true},
+	}, nil)
+	mustInsertRows(t, db, "contacts", map[string]map[string]interface{}{
+		"a": {"phones": []interface{}{"555-1", "555-2"}, "scores": []interface{}{int64(3), int64(7)}},
+		"b": {"phones": []interface{}{}, "scores": []interface{}{int64(9)}},
+		"c": {"phones": nil, "scores": nil},
+	})
+	return db
+}
+
+func TestArrayInsertValidation(t *testing.T) {
+	db := arrayTestDB(t)
+
+	for _, data := range []map[string]interface{}{
+		{"phones": []interface{}{"555-3", int64(4)}},
+		{"scores": []interface{}{"1"}},
+		{"scores": []interface{}{1.5}},
+		{"phones": "555-3"},
+	} {
+		if err := db.InsertRow("contacts", "x", data); !errors.Is(err, ErrSchemaViolation) {
+			t.Errorf("InsertRow(%v) = %v, want ErrSchemaViolation", data, err)
+		}
+	}
+
+	row, err := db.GetRowByID("contacts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"555-1", "555-2"}; !reflect.DeepEqual(row.Columns["phones"], want) {
+		t.Errorf("phones = %#v, want %#v", row.Columns["phones"], want)
+	}
+}
+
+func TestArrayFunctions(t *testing.T) {
+	items := []interface{}{"a", "b", "a"}
+	tests := []struct {
+		name string
+		args []interface{}
+		want interface{}
+	}{
+		{"ARRAY_LENGTH", []interface{}{items}, int64(3)},
+		{"ARRAY_LENGTH", []interface{}{[]interface{}{}}, int64(0)},
+		{"ARRAY_LENGTH", []interface{}{nil}, nil},
+		{"ARRAY_CONTAINS", []interface{}{items, "b"}, true},
+		{"ARRAY_CONTAINS", []interface{}{items, "z"}, false},
+		{"ARRAY_CONTAINS", []interface{}{[]interface{}{int64(1)}, 1.0}, true},
+		{"ARRAY_CONTAINS", []interface{}{nil, "a"}, nil},
+		{"ARRAY_APPEND", []interface{}{items, "c"}, []interface{}{"a", "b", "a", "c"}},
+		{"ARRAY_REMOVE", []interface{}{items, "a"}, []interface{}{"b"}},
+		{"ARRAY_REMOVE", []interface{}{items, "z"}, []interface{}{"a", "b", "a"}},
+	}
+	for _, tt := range tests {
+		got, err := callScalar(t, tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("%s%v: %v", tt.name, tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s%v = %#v, want %#v", tt.name, tt.args, got, tt.want)
+		}
+	}
+	if want := []interface{}{"a", "b", "a"}; !reflect.DeepEqual(items, want) {
+		t.Errorf("the functions modified their argument: %v", items)
+	}
+
+	if _, err := callScalar(t, "ARRAY_LENGTH", "abc"); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("ARRAY_LENGTH of a string = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestArrayQueries(t *testing.T) {
+	db := arrayTestDB(t)
+
+	tests := []struct {
+		where string
+		want  []string
+	}{
+		{"ANY(phones) = '555-2'", []string{"a"}},
+		{"'555-1' = ANY(phones)", []string{"a"}},
+		{"ANY(scores) > 5", []string{"a", "b"}},
+		{"ANY(scores) > 100", []string{}},
+		{"ARRAY_LENGTH(phones) = 0", []string{"b"}},
+		{"ARRAY_CONTAINS(scores, 9)", []string{"b"}},
+		{"ARRAY_LENGTH(ARRAY_APPEND(scores, 1)) = 3", []string{"a"}},
+	}
+	for _, tt := range tests {
+		result := mustQuery(t, db, Query{Select: []string{"id"}, From: "contacts", Where: tt.where, OrderBy: "id"})
+		if got := resultIDs(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WHERE %s = %v, want %v", tt.where, got, tt.want)
+		}
+	}
+
+	// A result's arrays are copies; changing one leaves the stored row.
+	result := mustQuery(t, db, Query{Select: []string{"phones"}, From: "contacts", Where: "id = 'a'"})
+	result.Rows[0].Columns["phones"].([]interface{})[0] = "changed"
+	row, err := db.GetRowByID("contacts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Columns["phones"].([]interface{})[0] != "555-1" {
+		t.Fatal("changing a query result's array changed the stored row")
+	}
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+// AsOf returns the table as it stood at at, rebuilt from its current rows by
+// undoing, newest first, every change in its audit log made after at. The
+// table must be audited and at must be no earlier than its AuditFrom;
+// otherwise the changes needed are not retained and AsOf fails with
+// ErrHistoryUnavailable. How far back it can go is set by the table's
+// AuditOptions: a Retention of a day, say, keeps a day of history.
+//
+// Soft-deleted rows come back as they were, tombstones included. Schema
+// changes are not in the audit log, so the copy has the current columns.
+func (db *NewDatabase) AsOf(tableName string, at time.Time) (HistoricalTable, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return HistoricalTable{}, err
+	}
+	defer done()
+
+	db.mu.RLock()
+	table, ok := db.Tables[tableName]
+	if ok {
+		table = copyTable(table)
+	}
+	keys := db.keys
+	db.mu.RUnlock()
+
+	if !ok {
+		return HistoricalTable{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	if !table.AuditEnabled {
+		return HistoricalTable{}, fmt.Errorf("%w: table %s is not audited", ErrHistoryUnavailable, tableName)
+	}
+	if at.Before(table.AuditFrom) {
+		return HistoricalTable{}, fmt.Errorf("%w: table %s has history from %s only", ErrHistoryUnavailable, tableName, table.AuditFrom.Format(time.RFC3339Nano))
+	}
+
+	rows := make(map[string]Row, len(table.Rows))
+	order := make([]string, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		id := rowID(row)
+		rows[id] = row
+		order = append(order, id)
+	}
+
+	keep := len(table.AuditLog)
+	for keep > 0 && table.AuditLog[keep-1].Timestamp.After(at) {
+		keep--
+		record := table.AuditLog[keep]
+		id := record.rowID()
+		if record.OldRow.Columns == nil {
+			delete(rows, id)
+			continue
+		}
+		if _, ok := rows[id]; !ok {
+			order = append(order, id)
+		}
+		rows[id] = copyRow(record.OldRow)
+	}
+
+	table.Rows = table.Rows[:0]
+	for _, id := range order {
+		if row, ok := rows[id]; ok {
+			table.Rows = append(table.Rows, row)
+			delete(rows, id)
+		}
+	}
+	table.AuditLog = table.AuditLog[:keep]
+	table.ensureIndexes()
+
+	past := &NewDatabase{
+		Name:   db.Name,
+		Tables: map[string]Table{tableName: table},
+		keys:   keys,
+	}
+	return HistoricalTable{At: at, db: past, table: tableName}, nil
+}
+
+// GetRowAtTime returns the version of the row id of tableName that was
+// current at at, as AsOf would see it. It fails with ErrIDNotFound if the
+// row did not exist then.
+func (db *NewDatabase) GetRowAtTime(tableName, id string, at time.Time) (Row, error) {
+	past, err := db.AsOf(tableName, at)
+
+	if err != nil {
+		return Row{}, err
+	}
+	return past.Get(id)
+}
+
+// Get returns the row with the given id as it was at h.At.
+func (h HistoricalTable) Get(id string) (Row, error) {
+	return h.db.GetRowByID(h.table, id)
+}
+
+// Rows returns every row the table had at h.At.
+func (h HistoricalTable) Rows() ([]Row, error) {
+	return h.db.GetAllRows(h.table)
+}
+
+// Count returns the number of rows the table had at h.At.
+func (h HistoricalTable) Count() (int, error) {
+	return h.db.CountRows(h.table)
+}
+
+// Query runs query against the table as it was at h.At. An empty From means
+// the table; no other table can be read, so joins fail with
+// ErrTableNotFound.
+func (h HistoricalTable) Query(query Query) (QueryResult, error) {
+	if query.From == "" {
+		query.From = h.table
+	}
+	return h.db.ExecuteQuery(query)
+}
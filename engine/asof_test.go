@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// tick returns the current time between two writes, so that each write
+// falls on a different side of it.
+func tick() time.Time {
+	time.Sleep(time.Millisecond)
+	at := time.Now()
+	time.Sleep(time.Millisecond)
+	return at
+}
+
+func TestAsOf(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "prices", []Column{{Name: "price", DataType: Int}}, nil)
+	if err := db.EnableAudit("prices"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "prices", "a", map[string]interface{}{"price": 10})
+	mustInsert(t, db, "prices", "b", map[string]interface{}{"price": 20})
+	before := tick()
+	if err := db.UpdateRow("prices", "a", map[string]interface{}{"price": 11}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRow("prices", "b"); err != nil {
+		t.Fatal(err)
+	}
+	mustInsert(t, db, "prices", "c", map[string]interface{}{"price": 30})
+
+	past, err := db.AsOf("prices", before)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := past.Get("a")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price := toInt64(row.Columns["price"]); price != 10 {
+		t.Errorf("price of a before the update = %d, want 10", price)
+	}
+	result, err := past.Query(Query{Select: []string{"id"}, OrderBy: "id"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("rows before the update = %v, want [a b]", got)
+	}
+
+	// The view is a copy: later writes do not change it.
+	if err := db.UpdateRow("prices", "a", map[string]interface{}{"price": 12}); err != nil {
+		t.Fatal(err)
+	}
+	if row, _ := past.Get("a"); toInt64(row.Columns["price"]) != 10 {
+		t.Error("a later write changed the AsOf view")
+	}
+
+	now, err := db.AsOf("prices", time.Now())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := now.Count(); n != 2 {
+		t.Errorf("AsOf now has %d rows, want 2", n)
+	}
+	if _, err := db.GetRowAtTime("prices", "c", before); !errors.Is(err, ErrIDNotFound) {
+		t.Errorf("GetRowAtTime of a later row = %v, want ErrIDNotFound", err)
+	}
+}
+
+func TestAsOfHistoryBounds(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "prices", []Column{{Name: "price", DataType: Int}}, nil)
+	mustInsert(t, db, "prices", "a", map[string]interface{}{"price": 10})
+
+	if _, err := db.AsOf("prices", time.Now()); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("AsOf of an unaudited table = %v, want ErrHistoryUnavailable", err)
+	}
+
+	early := tick()
+	if err := db.EnableAuditWithOptions("prices", AuditOptions{MaxEntries: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AsOf("prices", early); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("AsOf before auditing began = %v, want ErrHistoryUnavailable", err)
+	}
+
+	var times []time.Time
+	for price := 11; price <= 14; price++ {
+		times = append(times, tick())
+		if err := db.UpdateRow("prices", "a", map[string]interface{}{"price": price}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the last two updates are kept, so the table can be rebuilt as
+	// it was before the third but not before the second.
+	if _, err := db.AsOf("prices", times[1]); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("AsOf beyond the retained history = %v, want ErrHistoryUnavailable", err)
+	}
+	row, err := db.GetRowAtTime("prices", "a", times[2])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price := toInt64(row.Columns["price"]); price != 12 {
+		t.Errorf("price before the third update = %d, want 12", price)
+	}
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// autoColumns are columns AssertTableEquals ignores unless expected rows
+// give them, as are columns that default to a DefaultFunc such as Now().
+// "version" stands for the row's Version.
+var autoColumns = map[string]bool{"created_at": true, "updated_at": true, "version": true}
+
+// AssertTableEquals reports, through t.Errorf, any difference between the
+// rows of tableName and expected, matched by "id": rows missing or not
+// expected, and columns whose values differ or that only one side has. A
+// column left out counts as NULL. Values compare as = does, so an int
+// matches an equal int64 or float64, and a string matches a DateTime it
+// parses as.
+func (db *NewDatabase) AssertTableEquals(t TestingT, tableName string, expected []map[string]interface{}) {
+	t.Helper()
+
+	actual, err := db.GetAllRows(tableName)
+
+	if err != nil {
+		t.Errorf("AssertTableEquals: %v", err)
+		return
+	}
+
+	schema, err := db.DescribeTable(tableName)
+
+	if err != nil {
+		t.Errorf("AssertTableEquals: %v", err)
+		return
+	}
+
+	auto := make(map[string]bool, len(autoColumns))
+	for name := range autoColumns {
+		auto[name] = true
+	}
+	for _, col := range schema.Columns {
+		if _, ok := col.Default.(DefaultFunc); ok {
+			auto[col.Name] = true
+		}
+	}
+	// Rows are reported by id, so formatAssertRow leaves it out too.
+	auto["id"] = true
+
+	want := make(map[string]map[string]interface{}, len(expected))
+	for i, row := range expected {
+		id, ok := row["id"]
+		if !ok {
+			t.Errorf("AssertTableEquals: expected row %d has no id", i)
+			return
+		}
+		want[fmt.Sprint(id)] = row
+	}
+
+	got := make(map[string]map[string]interface{}, len(actual))
+	for _, row := range actual {
+		columns := make(map[string]interface{}, len(row.Columns)+1)
+		for name, val := range row.Columns {
+			columns[name] = val
+		}
+		if _, ok := columns["version"]; !ok {
+			columns["version"] = row.Version
+		}
+		got[rowID(row)] = columns
+	}
+
+	ids := make([]string, 0, len(want)+len(got))
+	for id := range want {
+		ids = append(ids, id)
+	}
+	for id := range got {
+		if _, ok := want[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var diffs []string
+	for _, id := range ids {
+		w, inWant := want[id]
+		g, inGot := got[id]
+		switch {
+		case !inGot:
+			diffs = append(diffs, fmt.Sprintf("row %s: missing, want %s", id, formatAssertRow(w, map[string]bool{"id": true})))
+			continue
+		case !inWant:
+			diffs = append(diffs, fmt.Sprintf("row %s: unexpected %s", id, formatAssertRow(g, auto)))
+			continue
+		}
+
+		names := make([]string, 0, len(w)+len(g))
+		for name := range w {
+			names = append(names, name)
+		}
+		for name := range g {
+			if _, ok := w[name]; !ok && !auto[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if name == "id" {
+				continue
+			}
+			wv, wok := w[name]
+			gv, gok := g[name]
+			switch {
+			case !gok && wv == nil, !wok && gv == nil:
+			case !gok:
+				diffs = append(diffs, fmt.Sprintf("row %s: %s: missing, want %s", id, name, formatAssertValue(wv)))
+			case !wok:
+				diffs = append(diffs, fmt.Sprintf("row %s: %s: got %s, not expected", id, name, formatAssertValue(gv)))
+			case !assertValuesEqual(gv, wv):
+				diffs = append(diffs, fmt.Sprintf("row %s: %s: got %s, want %s", id, name, formatAssertValue(gv), formatAssertValue(wv)))
+			}
+		}
+	}
+
+	if len(diffs) > 0 {
+		t.Errorf("table %s differs from expected:\n\t%s", tableName, strings.Join(diffs, "\n\t"))
+	}
+}
+
+// assertValuesEqual reports whether a and b are equal as = finds them,
+// with NULL equal to NULL.
+func assertValuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	a, b = timeOperands(a, b)
+	if valueKind(a) != valueKind(b) {
+		return false
+	}
+	if c, err := compareValues(a, b); err == nil {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// formatAssertRow formats a row's columns in name order, leaving out those
+// in skip.
+func formatAssertRow(row map[string]interface{}, skip map[string]bool) string {
+	names := make([]string, 0, len(row))
+	for name := range row {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = name + ": " + formatAssertValue(row[name])
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+func formatAssertValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v (%T)", v, v)
+	}
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingT is a TestingT that keeps what is reported to it.
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Helper() {}
+
+func assertTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "users", []Column{
+		{Name: "name", DataType: String},
+		{Name: "age", DataType: Int, Nullable: true},
+		{Name: "born", DataType: DateTime, Nullable: true},
+		{Name: "created_at", DataType: DateTime, Default: Now()},
+	}, nil)
+	mustInsert(t, db, "users", "u2", map[string]interface{}{"name": "Bob", "age": nil})
+	mustInsert(t, db, "users", "u1", map[string]interface{}{"name": "Ann", "age": 30, "born": time.Date(1994, 5, 1, 0, 0, 0, 0, time.UTC)})
+	return db
+}
+
+func TestAssertTableEqualsPasses(t *testing.T) {
+	db := assertTestDB(t)
+
+	r := &recordingT{}
+	db.AssertTableEquals(r, "users", []map[string]interface{}{
+		{"id": "u1", "name": "Ann", "age": int64(30), "born": "1994-05-01"},
+		{"id": "u2", "name": "Bob"},
+	})
+	if len(r.errors) > 0 {
+		t.Errorf("AssertTableEquals reported a match as different:\n%s", strings.Join(r.errors, "\n"))
+	}
+
+	// Auto columns are compared when expected gives them.
+	r = &recordingT{}
+	db.AssertTableEquals(r, "users", []map[string]interface{}{
+		{"id": "u1", "name": "Ann", "age": 30.0, "born": "1994-05-01", "version": 1},
+		{"id": "u2", "name": "Bob", "age": nil, "version": 2},
+	})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], `row u2: version: got 1 (int), want 2 (int)`) {
+		t.Errorf("AssertTableEquals with a wrong version reported %q", r.errors)
+	}
+}
+
+func TestAssertTableEqualsReportsDifferences(t *testing.T) {
+	db := assertTestDB(t)
+
+	r := &recordingT{}
+	db.AssertTableEquals(r, "users", []map[string]interface{}{
+		{"id": "u1", "name": "Anne", "age": 30, "born": nil},
+		{"id": "u3", "name": "Cy"},
+	})
+	if len(r.errors) != 1 {
+		t.Fatalf("AssertTableEquals reported %d errors, want one with every difference: %q", len(r.errors), r.errors)
+	}
+
+	want := []string{
+		"table users differs from expected:",
+		`row u1: born: got 1994-05-01 00:00:00 +0000 UTC (time.Time), want NULL`,
+		`row u1: name: got "Ann", want "Anne"`,
+		`row u2: unexpected {age: NULL, name: "Bob"}`,
+		`row u3: missing, want {name: "Cy"}`,
+	}
+	if got := r.errors[0]; got != strings.Join(want, "\n\t") {
+		t.Errorf("AssertTableEquals reported\n%s\nwant\n%s", got, strings.Join(want, "\n\t"))
+	}
+
+	r = &recordingT{}
+	db.AssertTableEquals(r, "missing", nil)
+	if len(r.errors) != 1 {
+		t.Errorf("AssertTableEquals of a missing table reported %q", r.errors)
+	}
+}
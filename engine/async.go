@@ -0,0 +1,83 @@
+package engine
+
+import "context"
+
+// ExecuteQueryAsync is ExecuteQueryAsyncContext without a context.
+func (db *NewDatabase) ExecuteQueryAsync(query Query) (<-chan QueryResult, <-chan error) {
+	return db.ExecuteQueryAsyncContext(context.Background(), query)
+}
+
+// ExecuteQueryAsyncContext starts query on its own goroutine and returns at
+// once. The result, the same ExecuteQuery would return, is sent on the
+// first channel, or the error on the second, and both are then closed.
+// Cancelling ctx stops the query at its next checkpoint, and the error then
+// wraps ctx's error, such as context.Canceled.
+func (db *NewDatabase) ExecuteQueryAsyncContext(ctx context.Context, query Query) (<-chan QueryResult, <-chan error) {
+	return db.ExecuteQueryAsyncWithOptions(ctx, query, AsyncOptions{})
+}
+
+// ExecuteQueryAsyncWithOptions is ExecuteQueryAsyncContext with the result
+// streamed in pages of opts.PageSize rows, in order, so that they can be
+// processed before the last one arrives. query's Limit and Offset still
+// bound the rows sent, as they bound ExecuteQuery's result. Each page is
+// read by its own run of query, with Limit and Offset narrowed to the page,
+// when the one before has been received, so only one page is held at a
+// time; as with PaginateQuery, pages can disagree if the tables change in
+// between. Each page holds the result's Columns and ColumnTypes, and a
+// result with no rows is still sent as one empty page.
+func (db *NewDatabase) ExecuteQueryAsyncWithOptions(ctx context.Context, query Query, opts AsyncOptions) (<-chan QueryResult, <-chan error) {
+	results := make(chan QueryResult)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(results)
+		defer close(errs)
+
+		send := func(result QueryResult) bool {
+			select {
+			case results <- result:
+				return true
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return false
+			}
+		}
+
+		if opts.PageSize <= 0 {
+			result, err := db.ExecuteQueryContext(ctx, query)
+			if err != nil {
+				errs <- err
+				return
+			}
+			send(result)
+			return
+		}
+
+		for sent := 0; query.Limit <= 0 || sent < query.Limit; {
+			page := query
+			page.Offset = query.Offset + sent
+			page.Limit = opts.PageSize
+			if query.Limit > 0 {
+				page.Limit = min(page.Limit, query.Limit-sent)
+			}
+
+			result, err := db.ExecuteQueryContext(ctx, page)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(result.Rows) == 0 && sent > 0 {
+				return
+			}
+			if !send(result) {
+				return
+			}
+			sent += len(result.Rows)
+			if len(result.Rows) < page.Limit {
+				return
+			}
+		}
+	}()
+
+	return results, errs
+}
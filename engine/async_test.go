@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// asyncPages drains the channels ExecuteQueryAsyncWithOptions returns into
+// the size of each page and the ids of every row, in order.
+func asyncPages(t *testing.T, results <-chan QueryResult, errs <-chan error) (sizes, ids string) {
+	t.Helper()
+	var sizeList, idList []string
+	for page := range results {
+		sizeList = append(sizeList, fmt.Sprint(len(page.Rows)))
+		idList = append(idList, resultIDs(page)...)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(sizeList, ","), strings.Join(idList, ",")
+}
+
+func TestExecuteQueryAsyncPages(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	for i := 0; i < 10; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%d", i), map[string]interface{}{"n": i})
+	}
+	query := Query{Select: []string{"id"}, From: "items", OrderBy: "n"}
+
+	tests := []struct {
+		name          string
+		limit, offset int
+		pageSize      int
+		sizes, ids    string
+	}{
+		{"whole", 0, 0, 0, "10", "i0,i1,i2,i3,i4,i5,i6,i7,i8,i9"},
+		{"limit without pages", 4, 0, 0, "4", "i0,i1,i2,i3"},
+		{"pages", 0, 0, 3, "3,3,3,1", "i0,i1,i2,i3,i4,i5,i6,i7,i8,i9"},
+		{"pages dividing evenly", 0, 0, 5, "5,5", "i0,i1,i2,i3,i4,i5,i6,i7,i8,i9"},
+		{"pages within limit and offset", 7, 1, 3, "3,3,1", "i1,i2,i3,i4,i5,i6,i7"},
+		{"offset past the end", 0, 20, 3, "0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := query
+			q.Limit, q.Offset = tt.limit, tt.offset
+			results, errs := db.ExecuteQueryAsyncWithOptions(context.Background(), q, AsyncOptions{PageSize: tt.pageSize})
+			sizes, ids := asyncPages(t, results, errs)
+			if sizes != tt.sizes || ids != tt.ids {
+				t.Errorf("pages %s of %s, want %s of %s", sizes, ids, tt.sizes, tt.ids)
+			}
+
+			want := strings.Join(resultIDs(mustQuery(t, db, q)), ",")
+			if ids != want {
+				t.Errorf("streamed %s, ExecuteQuery returned %s", ids, want)
+			}
+		})
+	}
+}
+
+func TestExecuteQueryAsyncCancel(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "big", []Column{{Name: "n", DataType: Int}}, nil)
+	rows := make([]Row, 200000)
+	for i := range rows {
+		rows[i] = Row{Columns: map[string]interface{}{"id": fmt.Sprint(i), "n": i}}
+	}
+	if err := db.BulkLoad("big", rows); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results, errs := db.ExecuteQueryAsyncContext(ctx, Query{Select: []string{"id"}, From: "big", Where: "n % 7 = 3", NoCache: true})
+	cancel()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("query did not stop after cancel")
+	}
+	if _, ok := <-results; ok {
+		t.Error("a result was sent after cancel")
+	}
+}
@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	AuditInsert = "insert"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+func (db *NewDatabase) EnableAudit(tableName string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	if !table.AuditEnabled {
+		table.AuditFrom = time.Now()
+	}
+	table.AuditEnabled = true
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+
+	return nil
+}
+
+// EnableAuditWithOptions turns on auditing for tableName with the given
+// retention limits. Calling it again changes the limits.
+func (db *NewDatabase) EnableAuditWithOptions(tableName string, opts AuditOptions) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	if !table.AuditEnabled {
+		table.AuditFrom = time.Now()
+	}
+	table.AuditEnabled = true
+	table.AuditOptions = opts
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+
+	return nil
+}
+
+// AuditLog returns the audit records matching filter across all audited
+// tables, oldest first.
+func (db *NewDatabase) AuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	names := make([]string, 0, len(db.Tables))
+	if filter.TableName != "" {
+		if _, ok := db.Tables[filter.TableName]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTableNotFound, filter.TableName)
+		}
+		names = append(names, filter.TableName)
+	} else {
+		for name := range db.Tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var entries []AuditEntry
+	for _, name := range names {
+		for _, record := range db.Tables[name].AuditLog {
+			id := record.rowID()
+			switch {
+			case filter.RowID != "" && id != filter.RowID,
+				filter.Op != "" && record.Op != filter.Op,
+				filter.Actor != "" && record.Actor != filter.Actor,
+				!filter.Since.IsZero() && record.Timestamp.Before(filter.Since),
+				!filter.Until.IsZero() && record.Timestamp.After(filter.Until):
+				continue
+			}
+			entries = append(entries, AuditEntry{TableName: name, RowID: id, AuditRecord: record})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	return entries, nil
+}
+
+func (db *NewDatabase) GetRowHistory(tableName, id string) ([]AuditRecord, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	var history []AuditRecord
+	for _, record := range table.AuditLog {
+		if record.rowID() == id {
+			history = append(history, record)
+		}
+	}
+
+	return history, nil
+}
+
+// EnableRowVersioning keeps every version of tableName's rows from now
+// on, for GetRowVersions and GetRowAtTime. The versions are kept in the
+// audit log: it turns on auditing, as EnableAudit does. Retention limits
+// already set with EnableAuditWithOptions are kept, and bound which
+// versions remain.
+func (db *NewDatabase) EnableRowVersioning(tableName string) error {
+	return db.EnableAudit(tableName)
+}
+
+// GetRowVersions returns every version of the row id of tableName that
+// the audit log holds, oldest first: the row as it was when the log starts
+// if it existed then, and as each insert or update left it. A version that
+// was replaced or deleted has a superseded_at column holding when; the
+// current one has none. The table must be audited, as EnableRowVersioning
+// arranges.
+func (db *NewDatabase) GetRowVersions(tableName, id string) ([]Row, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	if !table.AuditEnabled {
+		return nil, fmt.Errorf("%w: table %s is not audited", ErrHistoryUnavailable, tableName)
+	}
+
+	var versions []Row
+	add := func(row Row) error {
+		row, err := db.openRow(&table, row)
+
+		if err != nil {
+			return err
+		}
+		versions = append(versions, copyRow(row))
+		return nil
+	}
+
+	for _, record := range table.AuditLog {
+		if record.rowID() != id {
+			continue
+		}
+
+		if len(versions) == 0 && record.OldRow.Columns != nil {
+			if err := add(record.OldRow); err != nil {
+				return nil, err
+			}
+		}
+		if n := len(versions); n > 0 && versions[n-1].Columns["superseded_at"] == nil {
+			versions[n-1].Columns["superseded_at"] = record.Timestamp
+		}
+		if record.NewRow.Columns != nil {
+			if err := add(record.NewRow); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return versions, nil
+}
+
+func (db *NewDatabase) ClearAuditLog(tableName string, before time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	kept := table.AuditLog[:0]
+	for _, record := range table.AuditLog {
+		if !record.Timestamp.Before(before) {
+			kept = append(kept, record)
+		}
+	}
+	table.AuditLog = kept
+	if before.After(table.AuditFrom) {
+		table.AuditFrom = before
+	}
+	db.Tables[tableName] = table
+
+	return nil
+}
+
+// writeOrigin identifies who made a write, for the audit log.
+type writeOrigin struct {
+	actor string
+	txID  int64
+}
+
+// audit records a change in the table's audit log, if enabled, and applies
+// the log's retention limits. It is called on the same table value that is
+// being changed, so the record is installed together with the change.
+func (t *Table) audit(op string, oldRow, newRow Row, origin writeOrigin) {
+	if !t.AuditEnabled {
+		return
+	}
+
+	now := time.Now()
+	t.AuditLog = append(t.AuditLog, AuditRecord{
+		TxID:      origin.txID,
+		Actor:     origin.actor,
+		Op:        op,
+		OldRow:    oldRow,
+		NewRow:    newRow,
+		Timestamp: now,
+	})
+
+	drop := 0
+	if t.AuditOptions.Retention > 0 {
+		cutoff := now.Add(-t.AuditOptions.Retention)
+		for drop < len(t.AuditLog) && t.AuditLog[drop].Timestamp.Before(cutoff) {
+			drop++
+		}
+	}
+	if limit := t.AuditOptions.MaxEntries; limit > 0 && len(t.AuditLog)-drop > limit {
+		drop = len(t.AuditLog) - limit
+	}
+	if drop > 0 {
+		t.AuditFrom = t.AuditLog[drop-1].Timestamp
+		t.AuditLog = append([]AuditRecord(nil), t.AuditLog[drop:]...)
+	}
+}
+
+func (r AuditRecord) rowID() string {
+	if id, ok := r.NewRow.Columns["id"].(string); ok {
+		return id
+	}
+	id, _ := r.OldRow.Columns["id"].(string)
+	return id
+}
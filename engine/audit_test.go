@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetRowHistory(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "qty", DataType: Int}}, nil)
+	if err := db.EnableAudit("items"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "items", "a", map[string]interface{}{"qty": 1})
+	mustInsert(t, db, "items", "b", map[string]interface{}{"qty": 100})
+	if err := db.UpdateRow("items", "a", map[string]interface{}{"qty": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRow("items", "a", map[string]interface{}{"qty": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRow("items", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := db.GetRowHistory("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		op       string
+		old, new interface{}
+	}{
+		{AuditInsert, nil, 1},
+		{AuditUpdate, 1, 2},
+		{AuditUpdate, 2, 3},
+		{AuditDelete, 3, nil},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d records, want %d: %+v", len(history), len(want), history)
+	}
+	for i, w := range want {
+		record := history[i]
+		if record.Op != w.op {
+			t.Errorf("record %d op = %s, want %s", i, record.Op, w.op)
+		}
+		if got := record.OldRow.Columns["qty"]; w.old != nil && toInt64(got) != toInt64(w.old) {
+			t.Errorf("record %d old qty = %v, want %v", i, got, w.old)
+		}
+		if got := record.NewRow.Columns["qty"]; w.new != nil && toInt64(got) != toInt64(w.new) {
+			t.Errorf("record %d new qty = %v, want %v", i, got, w.new)
+		}
+		if i > 0 && record.Timestamp.Before(history[i-1].Timestamp) {
+			t.Errorf("record %d is older than record %d", i, i-1)
+		}
+	}
+
+	if insert := history[0].OldRow; len(insert.Columns) != 0 {
+		t.Errorf("insert OldRow = %+v, want an empty row", insert)
+	}
+
+	other, err := db.GetRowHistory("items", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 1 || other[0].Op != AuditInsert {
+		t.Errorf("history of b = %+v, want one insert", other)
+	}
+}
+
+func TestAuditRecordsTransactionID(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "qty", DataType: Int}}, nil)
+	if err := db.EnableAudit("items"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(tx, "items", "a", map[string]interface{}{"qty": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := db.GetRowHistory("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].TxID != int64(tx.ID) {
+		t.Fatalf("history = %+v, want one record with TxID %d", history, tx.ID)
+	}
+}
+
+func TestAuditRecordsActorOfBulkWrites(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "qty", DataType: Int}}, nil)
+	if err := db.EnableAudit("items"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []Row{{Columns: map[string]interface{}{"id": "a", "qty": 1}}, {Columns: map[string]interface{}{"id": "b", "qty": 2}}}
+	if err := db.BulkLoadWithOptions("items", rows, WriteOptions{Actor: "loader"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DeleteWhereWithOptions("items", "qty = 1", WriteOptions{Actor: "cleaner"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string][]string{"a": {"loader", "cleaner"}, "b": {"loader"}} {
+		history, err := db.GetRowHistory("items", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != len(want) {
+			t.Fatalf("history of %s = %+v, want %d records", id, history, len(want))
+		}
+		for i, actor := range want {
+			if history[i].Actor != actor {
+				t.Errorf("record %d of %s has actor %q, want %q", i, id, history[i].Actor, actor)
+			}
+		}
+	}
+}
+
+func TestAuditDisabledByDefault(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "qty", DataType: Int}}, nil)
+	mustInsert(t, db, "items", "a", map[string]interface{}{"qty": 1})
+
+	history, err := db.GetRowHistory("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("history without audit = %+v, want none", history)
+	}
+	if _, err := db.GetRowHistory("missing", "a"); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("GetRowHistory(missing) = %v, want ErrTableNotFound", err)
+	}
+}
+
+func TestClearAuditLog(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "qty", DataType: Int}}, nil)
+	if err := db.EnableAudit("items"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "items", "a", map[string]interface{}{"qty": 1})
+	time.Sleep(time.Millisecond)
+	cutoff := time.Now()
+	if err := db.UpdateRow("items", "a", map[string]interface{}{"qty": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ClearAuditLog("items", cutoff); err != nil {
+		t.Fatal(err)
+	}
+	history, err := db.GetRowHistory("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Op != AuditUpdate {
+		t.Fatalf("history after ClearAuditLog = %+v, want only the update", history)
+	}
+}
+
+func TestGetRowVersions(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "qty", DataType: Int}}, nil)
+	if _, err := db.GetRowVersions("items", "a"); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Fatalf("GetRowVersions of an unversioned table = %v, want ErrHistoryUnavailable", err)
+	}
+	if err := db.EnableRowVersioning("items"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "items", "a", map[string]interface{}{"qty": 1})
+	inserted := tick()
+	if err := db.UpdateRow("items", "a", map[string]interface{}{"qty": 2}); err != nil {
+		t.Fatal(err)
+	}
+	updated := tick()
+	if err := db.DeleteRow("items", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := db.GetRowVersions("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("versions = %+v, want 2", versions)
+	}
+	for i, want := range []int64{1, 2} {
+		if qty := toInt64(versions[i].Columns["qty"]); qty != want {
+			t.Errorf("version %d has qty %d, want %d", i, qty, want)
+		}
+		if _, ok := versions[i].Columns["superseded_at"].(time.Time); !ok {
+			t.Errorf("version %d has no superseded_at", i)
+		}
+	}
+
+	for at, want := range map[time.Time]int64{inserted: 1, updated: 2} {
+		row, err := db.GetRowAtTime("items", "a", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if qty := toInt64(row.Columns["qty"]); qty != want {
+			t.Errorf("GetRowAtTime = qty %d, want %d", qty, want)
+		}
+	}
+	if _, err := db.GetRowAtTime("items", "a", time.Now()); !errors.Is(err, ErrIDNotFound) {
+		t.Errorf("GetRowAtTime after the delete = %v, want ErrIDNotFound", err)
+	}
+}
+
+func TestEnableRowVersioningKeepsAuditOptions(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "qty", DataType: Int}}, nil)
+	opts := AuditOptions{Retention: time.Hour, MaxEntries: 2}
+	if err := db.EnableAuditWithOptions("items", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableRowVersioning("items"); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Tables["items"].AuditOptions; got != opts {
+		t.Fatalf("AuditOptions after EnableRowVersioning = %+v, want %+v", got, opts)
+	}
+
+	mustInsert(t, db, "items", "a", map[string]interface{}{"qty": 1})
+	for qty := 2; qty <= 4; qty++ {
+		if err := db.UpdateRow("items", "a", map[string]interface{}{"qty": qty}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := db.GetRowVersions("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || toInt64(versions[2].Columns["qty"]) != 4 {
+		t.Fatalf("versions = %+v, want the 3 that the last 2 records hold", versions)
+	}
+}
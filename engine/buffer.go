@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type writeBuffer struct {
+	mu  sync.Mutex
+	ops []PendingOperation
+
+	// dropped is set, under db.mu, once the table is dropped, after which
+	// nothing queued in the buffer is applied.
+	dropped bool
+
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// CreateEventualConsistencyBuffer makes InsertRow, UpdateRow and DeleteRow
+// on tableName return as soon as the write is queued. Queued writes are
+// applied in order every flushInterval by a background goroutine, or on
+// FlushBuffer. Reads see only flushed writes, and a write that fails when it
+// is flushed (a duplicate id, a constraint violation, a vetoing hook) is
+// dropped without reaching the caller that made it; FlushBuffer reports such
+// failures. Transactional writes and BulkLoad are not buffered. Dropping
+// the table removes the buffer and discards the writes it holds.
+func (db *NewDatabase) CreateEventualConsistencyBuffer(tableName string, flushInterval time.Duration) error {
+	if flushInterval <= 0 {
+		return fmt.Errorf("%w: flush interval must be positive", ErrInvalidQuery)
+	}
+
+	db.mu.RLock()
+	_, ok := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	db.bufferMu.Lock()
+	defer db.bufferMu.Unlock()
+
+	if _, exists := db.buffers[tableName]; exists {
+		return fmt.Errorf("%w: table %s is already buffered", ErrInvalidQuery, tableName)
+	}
+
+	buf := &writeBuffer{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if db.buffers == nil {
+		db.buffers = make(map[string]*writeBuffer)
+	}
+	db.buffers[tableName] = buf
+
+	go func() {
+		defer close(buf.done)
+
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				db.flush(tableName, buf)
+			case <-buf.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// FlushBuffer applies every write queued for tableName and returns the
+// errors of those that failed.
+func (db *NewDatabase) FlushBuffer(tableName string) error {
+	db.bufferMu.Lock()
+	buf, ok := db.buffers[tableName]
+	db.bufferMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: table %s is not buffered", ErrInvalidQuery, tableName)
+	}
+
+	return db.flush(tableName, buf)
+}
+
+// RemoveEventualConsistencyBuffer stops buffering writes to tableName after
+// flushing what is queued, and returns the errors of queued writes that
+// failed.
+func (db *NewDatabase) RemoveEventualConsistencyBuffer(tableName string) error {
+	db.bufferMu.Lock()
+	buf, ok := db.buffers[tableName]
+	delete(db.buffers, tableName)
+	db.bufferMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: table %s is not buffered", ErrInvalidQuery, tableName)
+	}
+
+	close(buf.stop)
+	<-buf.done
+
+	return db.flush(tableName, buf)
+}
+
+// bufferWrite queues op if its table exists and is buffered, and reports
+// whether it did.
+func (db *NewDatabase) bufferWrite(op PendingOperation) bool {
+	// Holding db.mu keeps the table from being dropped, and its buffer
+	// discarded, between the check and the append.
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok := db.Tables[op.TableName]; !ok {
+		return false
+	}
+
+	db.bufferMu.Lock()
+	buf, ok := db.buffers[op.TableName]
+	db.bufferMu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	data := make(map[string]interface{}, len(op.Data))
+	for key, value := range op.Data {
+		data[key] = value
+	}
+	op.Data = data
+
+	buf.mu.Lock()
+	buf.ops = append(buf.ops, op)
+	buf.mu.Unlock()
+
+	db.lagRates.add(time.Now(), rowSize(Row{Columns: op.Data}), 0)
+	return true
+}
+
+// forgetBuffer removes the buffer of tableName, which is being dropped,
+// discarding the writes it holds, and stops its goroutine without waiting
+// for it to exit. The caller must hold db.mu for writing.
+func (db *NewDatabase) forgetBuffer(tableName string) {
+	db.bufferMu.Lock()
+	buf, ok := db.buffers[tableName]
+	delete(db.buffers, tableName)
+	db.bufferMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	buf.dropped = true
+	close(buf.stop)
+
+	buf.mu.Lock()
+	var size int64
+	for _, op := range buf.ops {
+		size += rowSize(Row{Columns: op.Data})
+	}
+	buf.ops = nil
+	buf.mu.Unlock()
+
+	if size > 0 {
+		db.lagRates.add(time.Now(), 0, size)
+		db.logf("table %s dropped with %d bytes of buffered writes unflushed", tableName, size)
+	}
+}
+
+// flush applies the writes queued in buf in order. Each write takes the same
+// row lock its unbuffered form would; writes that fail are skipped.
+func (db *NewDatabase) flush(tableName string, buf *writeBuffer) error {
+	buf.flushMu.Lock()
+	defer buf.flushMu.Unlock()
+
+	buf.mu.Lock()
+	ops := buf.ops
+	buf.ops = nil
+	buf.mu.Unlock()
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	var size int64
+	for _, op := range ops {
+		size += rowSize(Row{Columns: op.Data})
+	}
+	db.lagRates.add(time.Now(), 0, size)
+
+	var errs []error
+	failed := make(map[int]bool)
+
+	var ids []string
+	for _, op := range ops {
+		if op.Op != ChangeInsert && !containsString(ids, op.RowID) {
+			ids = append(ids, op.RowID)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		unlock, err := db.acquireRowLock(nil, tableName, id, true)
+
+		if err != nil {
+			for i, op := range ops {
+				if op.RowID == id && op.Op != ChangeInsert {
+					failed[i] = true
+					errs = append(errs, fmt.Errorf("buffered write %d: %w", i, err))
+				}
+			}
+			continue
+		}
+		defer unlock()
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if buf.dropped {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	current, ok := db.Tables[tableName]
+
+	if !ok || db.matViews[tableName] != nil {
+		return db.notWritable(tableName)
+	}
+
+	table := current.cloneStorage()
+	table.ensureIndexes()
+	table.rebuildIndexes()
+	staged := map[string]*Table{tableName: &table}
+
+	var applied []appliedChange
+	for i, op := range ops {
+		if failed[i] {
+			continue
+		}
+
+		change, err := db.applyOp(&table, op, true, true, staged)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("buffered write %d: %w", i, err))
+			continue
+		}
+		applied = append(applied, change)
+	}
+
+	db.Tables[tableName] = table
+	for _, change := range applied {
+		db.publishApplied(change)
+	}
+
+	for _, change := range applied {
+		if err := db.runHooks(HookAfter, change.hookContext()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBufferedWritesFlush(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "b", []Column{{Name: "n", DataType: Int}}, nil)
+	if err := db.CreateEventualConsistencyBuffer("b", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer db.RemoveEventualConsistencyBuffer("b")
+
+	mustInsert(t, db, "b", "r1", map[string]interface{}{"n": 1})
+	if n, _ := db.CountRows("b"); n != 0 {
+		t.Fatalf("%d rows before flushing, want 0", n)
+	}
+	if err := db.FlushBuffer("b"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.CountRows("b"); n != 1 {
+		t.Fatalf("%d rows after flushing, want 1", n)
+	}
+}
+
+func TestDropTableDiscardsBuffer(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "b", []Column{{Name: "n", DataType: Int}}, nil)
+	if err := db.CreateEventualConsistencyBuffer("b", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	db.bufferMu.Lock()
+	buf := db.buffers["b"]
+	db.bufferMu.Unlock()
+
+	mustInsert(t, db, "b", "queued", map[string]interface{}{"n": 1})
+	if err := db.DropTable("b"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-buf.done:
+	case <-time.After(time.Second):
+		t.Fatal("flush goroutine still running after DropTable")
+	}
+
+	if err := db.InsertRow("b", "late", map[string]interface{}{"n": 2}); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("InsertRow into the dropped table = %v, want ErrTableNotFound", err)
+	}
+	if err := db.FlushBuffer("b"); err == nil {
+		t.Fatal("FlushBuffer of the dropped table's buffer succeeded")
+	}
+
+	// A flush of the old buffer that was already under way, holding a
+	// write queued just before the drop, must not apply it to a new table
+	// of the same name.
+	mustCreateTable(t, db, "b", []Column{{Name: "n", DataType: Int}}, nil)
+	buf.ops = []PendingOperation{{Op: ChangeInsert, TableName: "b", RowID: "stale", Data: map[string]interface{}{"n": 3}}}
+	if err := db.flush("b", buf); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("flushing the old buffer = %v, want ErrTableNotFound", err)
+	}
+	if n, _ := db.CountRows("b"); n != 0 {
+		t.Fatalf("re-created table has %d rows, want none of the discarded writes", n)
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryBuilder builds a Query a clause at a time:
+//
+//	query, err := Select("name", "age").From("users").Where("age > 30").
+//		OrderBy("age DESC").Limit(10).Build()
+//
+// Each method sets its field of the Query and returns the builder; Join
+// and Args add to theirs.
+type QueryBuilder struct {
+	query Query
+}
+
+// Select starts a builder for a query of columns.
+func Select(columns ...string) *QueryBuilder {
+	return &QueryBuilder{query: Query{Select: append([]string(nil), columns...)}}
+}
+
+func (b *QueryBuilder) From(table string) *QueryBuilder {
+	b.query.From = table
+	return b
+}
+
+func (b *QueryBuilder) Join(table, on string) *QueryBuilder {
+	b.query.Joins = append(b.query.Joins, Join{Table: table, On: on})
+	return b
+}
+
+func (b *QueryBuilder) Where(condition string) *QueryBuilder {
+	b.query.Where = condition
+	return b
+}
+
+func (b *QueryBuilder) OrderBy(order string) *QueryBuilder {
+	b.query.OrderBy = order
+	return b
+}
+
+func (b *QueryBuilder) Limit(n int) *QueryBuilder {
+	b.query.Limit = n
+	return b
+}
+
+func (b *QueryBuilder) IncludeDeleted() *QueryBuilder {
+	b.query.IncludeDeleted = true
+	return b
+}
+
+func (b *QueryBuilder) NoCache() *QueryBuilder {
+	b.query.NoCache = true
+	return b
+}
+
+func (b *QueryBuilder) Args(args ...interface{}) *QueryBuilder {
+	b.query.Args = append(b.query.Args, args...)
+	return b
+}
+
+// Build returns the query, or ErrInvalidQuery if it has no From, no
+// SELECT items or a negative Limit. Other mistakes surface when the query
+// is run.
+func (b *QueryBuilder) Build() (Query, error) {
+	query := b.query
+	switch {
+	case strings.TrimSpace(query.From) == "":
+		return Query{}, fmt.Errorf("%w: query builder needs From", ErrInvalidQuery)
+	case len(query.Select) == 0:
+		return Query{}, fmt.Errorf("%w: query builder needs at least one SELECT item", ErrInvalidQuery)
+	case query.Limit < 0:
+		return Query{}, fmt.Errorf("%w: negative LIMIT %d", ErrInvalidQuery, query.Limit)
+	}
+
+	query.Select = append([]string(nil), query.Select...)
+	query.Joins = append([]Join(nil), query.Joins...)
+	query.Args = append([]interface{}(nil), query.Args...)
+	return query, nil
+}
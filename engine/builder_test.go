@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	tests := []struct {
+		builder *QueryBuilder
+		want    Query
+	}{
+		{
+			Select("name", "age").From("users").Where("age > 30").OrderBy("age DESC").Limit(10),
+			Query{Select: []string{"name", "age"}, From: "users", Where: "age > 30", OrderBy: "age DESC", Limit: 10},
+		},
+		{
+			Select("*").From("users"),
+			Query{Select: []string{"*"}, From: "users"},
+		},
+		{
+			Select("users.name", "orders.total").From("users").
+				Join("orders", "orders.user_id = users.id").
+				Join("items", "items.order_id = orders.id").
+				Where("orders.total > $1").Args(100).Args("x").
+				IncludeDeleted().NoCache(),
+			Query{
+				Select: []string{"users.name", "orders.total"},
+				From:   "users",
+				Joins: []Join{
+					{Table: "orders", On: "orders.user_id = users.id"},
+					{Table: "items", On: "items.order_id = orders.id"},
+				},
+				Where:          "orders.total > $1",
+				Args:           []interface{}{100, "x"},
+				IncludeDeleted: true,
+				NoCache:        true,
+			},
+		},
+		// Later calls replace earlier ones.
+		{
+			Select("id").From("a").From("b").Where("x = 1").Where("y = 2").Limit(5).Limit(0),
+			Query{Select: []string{"id"}, From: "b", Where: "y = 2"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.builder.Build()
+		if err != nil {
+			t.Errorf("Build of %+v: %v", tt.want, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Build = %+v, want %+v", got, tt.want)
+		}
+	}
+}
+
+func TestQueryBuilderRuns(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "users", []Column{{Name: "age", DataType: Int}}, nil)
+	for id, age := range map[string]int{"a": 25, "b": 35, "c": 45, "d": 55} {
+		mustInsert(t, db, "users", id, map[string]interface{}{"age": age})
+	}
+
+	query, err := Select("id").From("users").Where("age > $1").Args(30).OrderBy("age DESC").Limit(2).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	built := mustQuery(t, db, query)
+	written := mustQuery(t, db, Query{Select: []string{"id"}, From: "users", Where: "age > 30", OrderBy: "age DESC", Limit: 2})
+	if !reflect.DeepEqual(resultIDs(built), resultIDs(written)) || len(built.Rows) != 2 {
+		t.Errorf("built query = %v, hand-written = %v", resultIDs(built), resultIDs(written))
+	}
+}
+
+func TestQueryBuilderBuildErrors(t *testing.T) {
+	for name, b := range map[string]*QueryBuilder{
+		"no From":        Select("id"),
+		"blank From":     Select("id").From("  "),
+		"no SELECT":      Select().From("users"),
+		"negative LIMIT": Select("id").From("users").Limit(-1),
+	} {
+		if _, err := b.Build(); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: Build = %v, want ErrInvalidQuery", name, err)
+		}
+	}
+}
+
+func TestQueryBuilderBuildCopies(t *testing.T) {
+	b := Select("id").From("users").Args(1)
+	first, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Select[0] = "changed"
+	first.Args[0] = "changed"
+
+	second, err := b.Args(2).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Query{Select: []string{"id"}, From: "users", Args: []interface{}{1, 2}}); !reflect.DeepEqual(second, want) {
+		t.Errorf("second Build = %+v, want %+v", second, want)
+	}
+}
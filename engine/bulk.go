@@ -0,0 +1,85 @@
+package engine
+
+import "fmt"
+
+// BulkLoad appends rows to the table and rebuilds its indexes once at the
+// end instead of maintaining them per row. Every row must carry a string
+// "id" column. If any row fails validation the table is left unchanged and
+// the error names the first offending row.
+func (db *NewDatabase) BulkLoad(tableName string, rows []Row) error {
+	return db.BulkLoadWithOptions(tableName, rows, WriteOptions{})
+}
+
+func (db *NewDatabase) BulkLoadWithOptions(tableName string, rows []Row, opts WriteOptions) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok || db.matViews[tableName] != nil {
+		return db.notWritable(tableName)
+	}
+	table.ensureIndexes()
+
+	seen := make(map[string]bool, len(rows))
+	loaded := make([]Row, 0, len(rows))
+	for i, row := range rows {
+		id, ok := row.Columns["id"].(string)
+		if !ok || id == "" {
+			return fmt.Errorf("bulk load row %d: %w: missing string id", i, ErrSchemaViolation)
+		}
+		_, exists := table.getRow(id)
+		if exists || seen[id] {
+			return fmt.Errorf("bulk load row %d: %w: %s in table %s", i, ErrIDExists, id, tableName)
+		}
+		row = copyRow(row)
+		if err := table.applyDefaults(row); err != nil {
+			return fmt.Errorf("bulk load row %d: %w", i, err)
+		}
+		if err := db.coerceRow(&table, row); err != nil {
+			return fmt.Errorf("bulk load row %d: %w", i, err)
+		}
+		if err := table.validateRow(row); err != nil {
+			return fmt.Errorf("bulk load row %d: %w", i, err)
+		}
+		seen[id] = true
+		row.Version = 1
+		loaded = append(loaded, row)
+	}
+
+	candidate := table.cloneStorage()
+	candidate.appendRows(loaded)
+
+	candidate.rebuildIndexes()
+
+	if db.memoryLimit > 0 && db.memoryUsage(map[string]*Table{tableName: &candidate}) > db.memoryLimit {
+		return fmt.Errorf("%w: bulk load of %d rows into table %s", ErrMemoryLimitExceeded, len(loaded), tableName)
+	}
+
+	for i, row := range loaded {
+		if err := candidate.checkUnique(row, rowID(row)); err != nil {
+			return fmt.Errorf("bulk load row %d: %w", i, err)
+		}
+		if err := db.checkForeignKeys(&candidate, row, nil, nil); err != nil {
+			return fmt.Errorf("bulk load row %d: %w", i, err)
+		}
+	}
+
+	for _, row := range loaded {
+		candidate.audit(AuditInsert, Row{}, row, writeOrigin{actor: opts.Actor})
+	}
+
+	db.Tables[tableName] = candidate
+	for _, row := range loaded {
+		db.publishChange(ChangeInsert, tableName, rowID(row), Row{}, row)
+	}
+
+	return nil
+}
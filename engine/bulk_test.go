@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func bulkRows(n int) []Row {
+	rows := make([]Row, n)
+	for i := range rows {
+		rows[i] = Row{Columns: map[string]interface{}{
+			"id":    fmt.Sprintf("u%05d", i),
+			"email": fmt.Sprintf("user%d@example.com", i),
+			"team":  fmt.Sprint(i % 7),
+		}}
+	}
+	return rows
+}
+
+func bulkTable(t testing.TB, db *NewDatabase) {
+	mustCreateTable(t, db, "users", []Column{
+		{Name: "email", DataType: String},
+		{Name: "team", DataType: String},
+	}, []Index{
+		{Name: "users_email", Columns: []string{"email"}, Unique: true},
+		{Name: "users_team", Columns: []string{"team"}},
+	})
+}
+
+func TestBulkLoadBuildsIndexes(t *testing.T) {
+	db := newTestDB(t)
+	bulkTable(t, db)
+	mustInsert(t, db, "users", "existing", map[string]interface{}{"email": "old@example.com", "team": "3"})
+
+	if err := db.BulkLoad("users", bulkRows(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	table := db.Tables["users"]
+	for _, row := range table.scanRows(false) {
+		for _, index := range table.Indexes {
+			key, _ := table.indexKey(row, index.Columns)
+			if !containsString(table.indexData[index.Name][key], rowID(row)) {
+				t.Errorf("index %s has no entry for row %s under %v", index.Name, rowID(row), key)
+			}
+		}
+	}
+
+	for team := 0; team < 7; team++ {
+		var want []string
+		for _, row := range table.scanRows(false) {
+			if row.Columns["team"] == fmt.Sprint(team) {
+				want = append(want, rowID(row))
+			}
+		}
+		key, _ := table.indexKey(Row{Columns: map[string]interface{}{"team": fmt.Sprint(team)}}, []string{"team"})
+		got := append([]string(nil), table.indexData["users_team"][key]...)
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("users_team[%d] = %v, want %v", team, got, want)
+		}
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "users", Where: "email = 'user42@example.com'"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"u00042"}) {
+		t.Errorf("lookup by email = %v, want [u00042]", ids)
+	}
+
+	// The unique index is live: later inserts are checked against it.
+	err := db.InsertRow("users", "dup", map[string]interface{}{"email": "user7@example.com", "team": "1"})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("InsertRow with a loaded email = %v, want ErrUniqueViolation", err)
+	}
+}
+
+func TestBulkLoadRejectsBadRow(t *testing.T) {
+	db := newTestDB(t)
+	bulkTable(t, db)
+
+	rows := bulkRows(10)
+	rows[6].Columns["email"] = rows[2].Columns["email"]
+
+	err := db.BulkLoad("users", rows)
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("BulkLoad with a duplicate email = %v, want ErrUniqueViolation", err)
+	}
+	if !strings.Contains(err.Error(), "row ") {
+		t.Errorf("error %q does not name the offending row", err)
+	}
+	if all, _ := db.GetAllRows("users"); len(all) != 0 {
+		t.Fatalf("table has %d rows after a failed load, want 0", len(all))
+	}
+
+	rows = bulkRows(3)
+	rows[1].Columns["team"] = 5
+	if err := db.BulkLoad("users", rows); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("BulkLoad with an Int in a String column = %v, want ErrSchemaViolation", err)
+	}
+	if err := db.BulkLoad("users", []Row{{Columns: map[string]interface{}{"email": "x"}}}); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("BulkLoad without an id = %v, want ErrSchemaViolation", err)
+	}
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	rows := bulkRows(10000)
+	for i := 0; i < b.N; i++ {
+		db := newTestDB(b)
+		bulkTable(b, db)
+		if err := db.BulkLoad("users", rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsertRowLoad(b *testing.B) {
+	rows := bulkRows(10000)
+	for i := 0; i < b.N; i++ {
+		db := newTestDB(b)
+		bulkTable(b, db)
+		for _, row := range rows {
+			if err := db.InsertRow("users", rowID(row), row.Columns); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
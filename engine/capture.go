@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/veltahq/kiv/storage"
+)
+
+// CaptureQuery runs query and records it with its result, or the error it
+// failed with, and the schema of the tables it reads, for Replay to check
+// later runs against.
+func (db *NewDatabase) CaptureQuery(query Query) QueryCapture {
+	capture := QueryCapture{Query: query, Schema: db.schemaOf(queryTables(query))}
+	if plan, err := db.estimatedPlan(query); err == nil {
+		capture.Plan = plan
+	}
+
+	result, err := db.ExecuteQuery(query)
+
+	capture.ResultAt = time.Now()
+	if err != nil {
+		capture.Err = err.Error()
+		return capture
+	}
+	result.Unlock = nil
+	capture.Result = result
+	return capture
+}
+
+// schemaOf describes the tables of names that exist.
+func (db *NewDatabase) schemaOf(names []string) SchemaDefinition {
+	var schema SchemaDefinition
+	for _, name := range names {
+		if table, err := db.DescribeTable(name); err == nil {
+			schema.Tables = append(schema.Tables, table)
+		}
+	}
+	sort.Slice(schema.Tables, func(i, j int) bool {
+		return schema.Tables[i].Name < schema.Tables[j].Name
+	})
+	return schema
+}
+
+// Save writes c to path.
+func (c *QueryCapture) Save(path string) error {
+	return storage.WriteFile(path, c)
+}
+
+// LoadQueryCapture reads a capture written by Save.
+func LoadQueryCapture(path string) (*QueryCapture, error) {
+	var c QueryCapture
+	if err := storage.ReadFile(path, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Replay runs the captured query against db and returns its result. If
+// the query fails as it did when captured, the error is not returned. If
+// the result differs from the captured result, or the query now fails or
+// succeeds where it did not, the error wraps ErrReplayMismatch and lists
+// the differences, followed by any changes to the schema of the tables
+// read. Rows are compared in order if the query has an OrderBy, and
+// otherwise as a multiset; values compare as = does.
+func (c *QueryCapture) Replay(db *NewDatabase) (QueryResult, error) {
+	result, err := db.ExecuteQuery(c.Query)
+
+	var diffs []string
+	switch {
+	case err != nil && c.Err == "":
+		diffs = append(diffs, fmt.Sprintf("query failed: %v", err))
+	case err != nil && err.Error() != c.Err:
+		diffs = append(diffs, fmt.Sprintf("error: got %q, want %q", err.Error(), c.Err))
+	case err == nil && c.Err != "":
+		diffs = append(diffs, fmt.Sprintf("query succeeded, want error %q", c.Err))
+	case err == nil:
+		diffs = diffResults(result, c.Result, c.Query.OrderBy != "")
+	}
+
+	if len(diffs) == 0 {
+		return result, nil
+	}
+	diffs = append(diffs, diffSchemas(db.schemaOf(queryTables(c.Query)), c.Schema)...)
+	return result, fmt.Errorf("%w:\n\t%s", ErrReplayMismatch, strings.Join(diffs, "\n\t"))
+}
+
+// planSelectivityTolerance is the factor by which a filter's estimated
+// selectivity may change before PlanReplay reports its plan as changed.
+const planSelectivityTolerance = 2
+
+// PlanReplay plans the captured query against db and reports whether the
+// plan differs from the one it was captured with: in the planner mode, in
+// the number, kind or arguments of its operations, in the strategy of a
+// join, in the order the conjuncts of a filter are applied or by more than
+// a factor of two in a filter's estimated selectivity. The last two follow
+// from the indexes and row counts of the tables read, so a change to them
+// can change the plan without any change to the schema.
+func (db *NewDatabase) PlanReplay(capture QueryCapture) (ExecutionPlan, bool, error) {
+	if len(capture.Plan.Operations) == 0 {
+		return ExecutionPlan{}, false, fmt.Errorf("%w: capture has no plan", ErrInvalidQuery)
+	}
+
+	plan, err := db.estimatedPlan(capture.Query)
+
+	if err != nil {
+		return ExecutionPlan{}, false, err
+	}
+	return plan, plansDiffer(plan, capture.Plan), nil
+}
+
+// estimatedPlan plans query as executeplan would run it now, with the
+// conjuncts of each filter in the order it would apply them, and estimates
+// each filter's selectivity. Operations are not linked to each other, so
+// that the plan can be saved.
+func (db *NewDatabase) estimatedPlan(query Query) (ExecutionPlan, error) {
+	plan, err := db.planQuery(query)
+
+	if err != nil {
+		return ExecutionPlan{}, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var names joinNames
+	if plan.hasJoins() {
+		names, err = db.joinNames(plan)
+
+		if err != nil {
+			return ExecutionPlan{}, err
+		}
+	}
+	plan = plan.bindEnums(db.columnEnums(plan, names))
+	plan = plan.bindCollations(db.columnCollations(plan, names))
+	distinct := db.columnDistinct(plan, names)
+	plan = plan.reorderFilters(db.columnTypes(plan, names), distinct)
+
+	ops := make([]Operation, len(plan.Operations))
+	for i, op := range plan.Operations {
+		op.Parent, op.Children, op.Result = nil, nil, nil
+		if op.Type == Filter {
+			op.Filter = op.filterExpr.String()
+			op.Selectivity = selectivity(op.filterExpr, distinct)
+		}
+		ops[i] = op
+	}
+	plan.Operations = ops
+	return plan, nil
+}
+
+// plansDiffer reports whether got differs materially from want, as
+// PlanReplay describes.
+func plansDiffer(got, want ExecutionPlan) bool {
+	if got.Mode != want.Mode || got.ParallelScans != want.ParallelScans || len(got.Operations) != len(want.Operations) {
+		return true
+	}
+	for i, g := range got.Operations {
+		w := want.Operations[i]
+		if g.Type != w.Type || g.Table != w.Table || g.Filter != w.Filter || g.Order != w.Order ||
+			g.Limit != w.Limit || g.Offset != w.Offset || g.Strategy != w.Strategy || strings.Join(g.Columns, "\x00") != strings.Join(w.Columns, "\x00") {
+			return true
+		}
+		if g.Selectivity > w.Selectivity*planSelectivityTolerance || w.Selectivity > g.Selectivity*planSelectivityTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// diffResults lists the differences between got and want.
+func diffResults(got, want QueryResult, ordered bool) []string {
+	var diffs []string
+	if !reflect.DeepEqual(got.Columns, want.Columns) {
+		diffs = append(diffs, fmt.Sprintf("columns: got %v, want %v", got.Columns, want.Columns))
+	}
+
+	if ordered {
+		for i := 0; i < len(got.Rows) || i < len(want.Rows); i++ {
+			switch {
+			case i >= len(want.Rows):
+				diffs = append(diffs, fmt.Sprintf("row %d: unexpected %s", i, formatAssertRow(got.Rows[i].Columns, nil)))
+			case i >= len(got.Rows):
+				diffs = append(diffs, fmt.Sprintf("row %d: missing, want %s", i, formatAssertRow(want.Rows[i].Columns, nil)))
+			case !rowsEqual(got.Rows[i], want.Rows[i]):
+				diffs = append(diffs, fmt.Sprintf("row %d: got %s, want %s", i, formatAssertRow(got.Rows[i].Columns, nil), formatAssertRow(want.Rows[i].Columns, nil)))
+			}
+		}
+		return diffs
+	}
+
+	matched := make([]bool, len(got.Rows))
+	for _, w := range want.Rows {
+		found := false
+		for i, g := range got.Rows {
+			if !matched[i] && rowsEqual(g, w) {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			diffs = append(diffs, fmt.Sprintf("missing row %s", formatAssertRow(w.Columns, nil)))
+		}
+	}
+	for i, g := range got.Rows {
+		if !matched[i] {
+			diffs = append(diffs, fmt.Sprintf("unexpected row %s", formatAssertRow(g.Columns, nil)))
+		}
+	}
+	return diffs
+}
+
+// rowsEqual reports whether a and b have the same columns with values
+// equal as assertValuesEqual finds them.
+func rowsEqual(a, b Row) bool {
+	if len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for name, av := range a.Columns {
+		bv, ok := b.Columns[name]
+		if !ok || !assertValuesEqual(av, bv) {
+			return false
+		}
+	}
+	return true
+}
+
+// diffSchemas lists the tables of want that got lacks or defines
+// differently, ignoring row counts.
+func diffSchemas(got, want SchemaDefinition) []string {
+	current := make(map[string]TableSchema, len(got.Tables))
+	for _, table := range got.Tables {
+		current[table.Name] = table
+	}
+
+	var diffs []string
+	for _, w := range want.Tables {
+		g, ok := current[w.Name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("schema: table %s no longer exists", w.Name))
+		case !reflect.DeepEqual(g.Columns, w.Columns):
+			diffs = append(diffs, fmt.Sprintf("schema: columns of table %s have changed", w.Name))
+		case !reflect.DeepEqual(g.Indexes, w.Indexes):
+			diffs = append(diffs, fmt.Sprintf("schema: indexes of table %s have changed", w.Name))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureTestDB returns a database with an events table whose columns
+// are of the types that a saved capture must bring back intact.
+func captureTestDB(t *testing.T) *NewDatabase {
+	t.Helper()
+	db := newTestDB(t)
+	mustCreateTable(t, db, "events", []Column{
+		{Name: "at", DataType: DateTime},
+		{Name: "amt", DataType: Decimal, Precision: 10, Scale: 2},
+		{Name: "meta", DataType: JSON, Nullable: true},
+		{Name: "tags", DataType: Array, ElementType: String, Nullable: true},
+	}, nil)
+	mustInsertRows(t, db, "events", map[string]map[string]interface{}{
+		"e1": {
+			"at":   time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+			"amt":  "19.99",
+			"meta": map[string]interface{}{"source": "web", "retries": 2.0},
+			"tags": []interface{}{"new", "paid"},
+		},
+		"e2": {
+			"at":   time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC),
+			"amt":  "-0.50",
+			"meta": []interface{}{1.0, "two"},
+			"tags": []interface{}{},
+		},
+		"e3": {"at": time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), "amt": "0"},
+	})
+	return db
+}
+
+// saveAndLoad saves capture to a file and reads it back.
+func saveAndLoad(t *testing.T, capture QueryCapture) *QueryCapture {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture")
+	if err := capture.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadQueryCapture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestQueryCaptureRoundTrip(t *testing.T) {
+	for _, orderBy := range []string{"", "at DESC"} {
+		t.Run(fmt.Sprintf("OrderBy %q", orderBy), func(t *testing.T) {
+			db := captureTestDB(t)
+			capture := db.CaptureQuery(Query{Select: []string{"id", "at", "amt", "meta", "tags"}, From: "events", OrderBy: orderBy})
+			if capture.Err != "" {
+				t.Fatal(capture.Err)
+			}
+
+			loaded := saveAndLoad(t, capture)
+			result, err := loaded.Replay(db)
+			if err != nil {
+				t.Fatalf("Replay of an unchanged table: %v", err)
+			}
+			if len(result.Rows) != 3 {
+				t.Fatalf("Replay returned %d rows, want 3", len(result.Rows))
+			}
+			if diffs := diffResults(loaded.Result, capture.Result, true); len(diffs) > 0 {
+				t.Errorf("loaded result differs from captured: %v", diffs)
+			}
+
+			for _, row := range loaded.Result.Rows {
+				if row.Columns["id"] != "e1" {
+					continue
+				}
+				if at, ok := row.Columns["at"].(time.Time); !ok || !at.Equal(time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)) {
+					t.Errorf("loaded at = %#v, want the captured time", row.Columns["at"])
+				}
+				if amt, ok := row.Columns["amt"].(DecimalValue); !ok || amt.String() != "19.99" {
+					t.Errorf("loaded amt = %#v, want decimal 19.99", row.Columns["amt"])
+				}
+				if meta, ok := row.Columns["meta"].(map[string]interface{}); !ok || meta["source"] != "web" {
+					t.Errorf("loaded meta = %#v, want the captured object", row.Columns["meta"])
+				}
+				if tags, ok := row.Columns["tags"].([]interface{}); !ok || len(tags) != 2 || tags[1] != "paid" {
+					t.Errorf("loaded tags = %#v, want [new paid]", row.Columns["tags"])
+				}
+			}
+		})
+	}
+}
+
+func TestQueryCaptureReplayMismatch(t *testing.T) {
+	db := captureTestDB(t)
+	capture := saveAndLoad(t, db.CaptureQuery(Query{Select: []string{"id", "amt", "tags"}, From: "events", OrderBy: "id"}))
+
+	if err := db.UpdateRow("events", "e1", map[string]interface{}{"amt": "20.00"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := capture.Replay(db)
+	if !errors.Is(err, ErrReplayMismatch) {
+		t.Fatalf("Replay after an update = %v, want ErrReplayMismatch", err)
+	}
+	if !strings.Contains(err.Error(), "row 0") || strings.Contains(err.Error(), "row 1") {
+		t.Errorf("Replay error %q, want a difference in row 0 only", err)
+	}
+
+	if err := db.DropTable("events"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = capture.Replay(db)
+	if !errors.Is(err, ErrReplayMismatch) {
+		t.Fatalf("Replay after DropTable = %v, want ErrReplayMismatch", err)
+	}
+	for _, want := range []string{"query failed", "table events no longer exists"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Replay error %q does not say %q", err, want)
+		}
+	}
+
+	// A query that failed when captured replays cleanly if it fails alike.
+	failed := db.CaptureQuery(Query{Select: []string{"id"}, From: "events"})
+	if failed.Err == "" {
+		t.Fatal("capture of a query on a missing table has no error")
+	}
+	if _, err := saveAndLoad(t, failed).Replay(db); err != nil {
+		t.Errorf("Replay of a query failing alike = %v, want nil", err)
+	}
+}
+
+func TestPlanReplay(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, []Index{{Name: "by_n", Columns: []string{"n"}}})
+	for i := 0; i < 20; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%02d", i), map[string]interface{}{"n": i % 4})
+	}
+	capture := *saveAndLoad(t, db.CaptureQuery(Query{Select: []string{"id"}, From: "items", Where: "n = 3"}))
+
+	if _, changed, err := db.PlanReplay(capture); err != nil || changed {
+		t.Fatalf("PlanReplay of an unchanged table = %v, %v, want unchanged", changed, err)
+	}
+
+	// More rows with the same values leave n = 3 as selective as it was.
+	for i := 20; i < 40; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%02d", i), map[string]interface{}{"n": i % 4})
+	}
+	if _, changed, err := db.PlanReplay(capture); err != nil || changed {
+		t.Fatalf("PlanReplay after inserting like rows = %v, %v, want unchanged", changed, err)
+	}
+
+	// Many new distinct values make it far more selective.
+	for i := 40; i < 80; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%02d", i), map[string]interface{}{"n": i})
+	}
+	plan, changed, err := db.PlanReplay(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatalf("PlanReplay after adding distinct values reports no change: %+v", plan.Operations)
+	}
+
+	if _, _, err := db.PlanReplay(QueryCapture{Query: capture.Query}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("PlanReplay of a capture without a plan = %v, want ErrInvalidQuery", err)
+	}
+}
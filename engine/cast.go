@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// castExpr converts the value of x to another type, as in CAST(x AS type).
+type castExpr struct {
+	x  expr
+	to DataType
+}
+
+// castTypes maps the type names accepted by CAST to data types.
+var castTypes = map[string]DataType{
+	"INT":       Int,
+	"INTEGER":   Int,
+	"BIGINT":    Int,
+	"FLOAT":     Float,
+	"REAL":      Float,
+	"DOUBLE":    Float,
+	"STRING":    String,
+	"TEXT":      String,
+	"VARCHAR":   String,
+	"DATETIME":  DateTime,
+	"TIMESTAMP": DateTime,
+	"BOOL":      Bool,
+	"BOOLEAN":   Bool,
+	"DECIMAL":   Decimal,
+	"NUMERIC":   Decimal,
+}
+
+func (e castExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil || val == nil {
+		return nil, err
+	}
+
+	return castValue(val, e.to)
+}
+
+func (e castExpr) String() string {
+	return "CAST(" + e.x.String() + " AS " + strings.ToUpper(e.to.String()) + ")"
+}
+
+// castValue converts val to dataType. Numbers convert to and from strings
+// and to each other (floats truncate towards zero); booleans convert to and
+// from 0/1 and "true"/"false"; date-times convert to and from RFC 3339
+// strings and Unix seconds; decimals convert to and from strings and
+// other numbers, floats by their shortest text. Anything else, including
+// a string that does not parse, fails with ErrInvalidCast.
+func castValue(val interface{}, dataType DataType) (interface{}, error) {
+	if valueMatchesType(val, dataType) {
+		return val, nil
+	}
+
+	switch v := val.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		switch dataType {
+		case Int:
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n, nil
+			}
+		case Float:
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f, nil
+			}
+		case DateTime:
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t, nil
+			}
+		case Decimal:
+			return ParseDecimal(s)
+		case Bool:
+			switch strings.ToLower(s) {
+			case "true":
+				return true, nil
+			case "false":
+				return false, nil
+			}
+		}
+	case bool:
+		switch dataType {
+		case Int:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case String:
+			return strconv.FormatBool(v), nil
+		}
+	case time.Time:
+		switch dataType {
+		case String:
+			return v.Format(time.RFC3339Nano), nil
+		case Int:
+			return v.Unix(), nil
+		}
+	case DecimalValue:
+		switch dataType {
+		case Int:
+			return toInt64(v), nil
+		case Float:
+			return v.Float64(), nil
+		case String:
+			return v.String(), nil
+		}
+	default:
+		if valueKind(val) != kindNumber {
+			break
+		}
+		switch dataType {
+		case Int:
+			return toInt64(val), nil
+		case Float:
+			return toFloat(val), nil
+		case String:
+			if isFloat(val) {
+				return strconv.FormatFloat(toFloat(val), 'g', -1, 64), nil
+			}
+			return strconv.FormatInt(toInt64(val), 10), nil
+		case Bool:
+			if isFloat(val) {
+				break
+			}
+			switch toInt64(val) {
+			case 0:
+				return false, nil
+			case 1:
+				return true, nil
+			}
+		case DateTime:
+			if !isFloat(val) {
+				return time.Unix(toInt64(val), 0).UTC(), nil
+			}
+		case Decimal:
+			if isFloat(val) {
+				return ParseDecimal(strconv.FormatFloat(toFloat(val), 'f', -1, 64))
+			}
+			return toDecimal(val)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: cannot cast %T %v to %s", ErrInvalidCast, val, val, dataType)
+}
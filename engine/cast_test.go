@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCastValue(t *testing.T) {
+	when := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		in   interface{}
+		to   DataType
+		want interface{}
+	}{
+		{int64(42), Float, 42.0},
+		{int64(42), String, "42"},
+		{int64(1), Bool, true},
+		{int64(0), Bool, false},
+		{int64(42), Int, int64(42)},
+		{3.9, Int, int64(3)},
+		{-3.9, Int, int64(-3)},
+		{2.5, String, "2.5"},
+		{"42", Int, int64(42)},
+		{" 42 ", Int, int64(42)},
+		{"2.5", Float, 2.5},
+		{"true", Bool, true},
+		{"FALSE", Bool, false},
+		{"2024-03-01T12:30:00Z", DateTime, when},
+		{when, String, "2024-03-01T12:30:00Z"},
+		{when, Int, when.Unix()},
+		{when.Unix(), DateTime, when},
+		{true, Int, int64(1)},
+		{false, Int, int64(0)},
+		{true, String, "true"},
+		{false, String, "false"},
+	}
+	for _, tt := range tests {
+		got, err := castValue(tt.in, tt.to)
+		if err != nil {
+			t.Errorf("castValue(%#v, %s): %v", tt.in, tt.to, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("castValue(%#v, %s) = %#v, want %#v", tt.in, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestCastValueInvalid(t *testing.T) {
+	tests := []struct {
+		in interface{}
+		to DataType
+	}{
+		{"abc", Int},
+		{"1.5x", Float},
+		{"yes", Bool},
+		{"yesterday", DateTime},
+		{int64(2), Bool},
+		{1.0, Bool},
+		{2.5, DateTime},
+		{true, Float},
+		{true, DateTime},
+		{time.Now(), Bool},
+	}
+	for _, tt := range tests {
+		if got, err := castValue(tt.in, tt.to); !errors.Is(err, ErrInvalidCast) {
+			t.Errorf("castValue(%#v, %s) = %#v, %v, want ErrInvalidCast", tt.in, tt.to, got, err)
+		}
+	}
+}
+
+func TestCastInQuery(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{
+		{Name: "price", DataType: Float},
+		{Name: "code", DataType: String, Nullable: true},
+	}, nil)
+	mustInsert(t, db, "items", "a", map[string]interface{}{"price": 9.75, "code": "7"})
+	mustInsert(t, db, "items", "b", map[string]interface{}{"price": 12.5, "code": nil})
+
+	result := mustQuery(t, db, Query{Select: []string{"id", "CAST(price AS INT)"}, From: "items", OrderBy: "id"})
+	if len(result.Rows) != 2 {
+		t.Fatalf("rows = %v", result.Rows)
+	}
+	column := result.Columns[1]
+	if got := result.Rows[0].Columns[column]; got != int64(9) {
+		t.Errorf("CAST(9.75 AS INT) = %#v, want 9", got)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "items", Where: "CAST(code AS INT) = 7"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("WHERE CAST(code AS INT) = 7 matched %v, want [a]", ids)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "items", Where: "CAST(price AS STRING) = '12.5'"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Errorf("WHERE CAST(price AS STRING) = '12.5' matched %v, want [b]", ids)
+	}
+
+	mustInsert(t, db, "items", "c", map[string]interface{}{"price": 1.0, "code": "x"})
+	if _, err := db.ExecuteQuery(Query{Select: []string{"CAST(code AS INT)"}, From: "items"}); !errors.Is(err, ErrInvalidCast) {
+		t.Errorf("CAST('x' AS INT) = %v, want ErrInvalidCast", err)
+	}
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxExactFloat is the largest magnitude below which every integer is
+// exactly representable as a float64.
+const maxExactFloat = 1 << 53
+
+// SetCoercionMode sets which values writes convert to the type of their
+// column, as CoercionMode describes. The default is StrictCoercion.
+func (db *NewDatabase) SetCoercionMode(mode CoercionMode) error {
+	switch mode {
+	case StrictCoercion, LenientCoercion:
+	default:
+		return fmt.Errorf("%w: unknown coercion mode %d", ErrInvalidQuery, mode)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.coercion = mode
+	return nil
+}
+
+// GetCoercionMode returns the mode SetCoercionMode set.
+func (db *NewDatabase) GetCoercionMode() CoercionMode {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.coercion
+}
+
+// coerceRow converts the values of row to the types of t's columns in
+// place, as the database's CoercionMode allows. The caller must hold
+// db.mu.
+func (db *NewDatabase) coerceRow(t *Table, row Row) error {
+	for _, col := range t.Columns {
+		val, ok := row.Columns[col.Name]
+		if !ok || val == nil {
+			continue
+		}
+
+		coerced, err := coerceValue(val, col.DataType, col.ElementType, db.coercion)
+
+		if err != nil {
+			return fmt.Errorf("%w: column %s in table %s: %w", ErrSchemaViolation, col.Name, t.Name, err)
+		}
+		row.Columns[col.Name] = coerced
+	}
+	return nil
+}
+
+// coerceValue returns val converted to dataType, or val itself if it
+// already matches or is not a value mode converts to dataType. It returns
+// an error if val would convert only with a loss or is ambiguous.
+func coerceValue(val interface{}, dataType, elementType DataType, mode CoercionMode) (interface{}, error) {
+	if dataType != Array && valueMatchesType(val, dataType) {
+		return val, nil
+	}
+
+	switch dataType {
+	case Int:
+		switch v := val.(type) {
+		case float64:
+			if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+				return nil, fmt.Errorf("%v cannot be stored as Int without loss", v)
+			}
+			return int64(v), nil
+		case string:
+			if mode != LenientCoercion {
+				return val, nil
+			}
+
+			n, err := strconv.ParseInt(v, 10, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an Int", v)
+			}
+			return n, nil
+		}
+	case Float:
+		if valueMatchesType(val, Int) {
+			if _, huge := hugeUint(val); huge {
+				return nil, fmt.Errorf("%v cannot be stored as Float without loss", val)
+			}
+			n := toInt64(val)
+			if n > maxExactFloat || n < -maxExactFloat {
+				return nil, fmt.Errorf("%v cannot be stored as Float without loss", val)
+			}
+			return float64(n), nil
+		}
+		if s, ok := val.(string); ok && mode == LenientCoercion {
+			// ParseFloat also reads hexadecimal, NaN and Inf.
+			f, err := strconv.ParseFloat(s, 64)
+
+			if err != nil || strings.ContainsAny(s, "xXnNiI") {
+				return nil, fmt.Errorf("%q is not a Float", s)
+			}
+			return f, nil
+		}
+	case Decimal:
+		switch v := val.(type) {
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%v is not a Decimal", v)
+			}
+
+			d, err := ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+
+			if err != nil {
+				return nil, err
+			}
+			return d, nil
+		case string:
+			d, err := ParseDecimal(v)
+
+			if err != nil {
+				return nil, err
+			}
+			return d, nil
+		}
+		if valueMatchesType(val, Int) {
+			d, err := toDecimal(val)
+
+			if err != nil {
+				return nil, err
+			}
+			return d, nil
+		}
+	case DateTime:
+		if s, ok := val.(string); ok {
+			if t, ok := parseDateTime(s); ok {
+				return t, nil
+			}
+		}
+	case Bool:
+		if s, ok := val.(string); ok && mode == LenientCoercion {
+			switch s {
+			case "true":
+				return true, nil
+			case "false":
+				return false, nil
+			}
+			return nil, fmt.Errorf("%q is not a Bool", s)
+		}
+	case Array:
+		items, ok := val.([]interface{})
+		if !ok {
+			return val, nil
+		}
+
+		coerced := make([]interface{}, len(items))
+		changed := false
+		for i, item := range items {
+			c, err := coerceValue(item, elementType, 0, mode)
+
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			coerced[i] = c
+			changed = changed || !valueMatchesType(item, elementType)
+		}
+		if !changed {
+			return val, nil
+		}
+		return coerced, nil
+	}
+	return val, nil
+}
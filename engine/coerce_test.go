@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rejectedValue marks a coercion test case whose write must fail with
+// ErrSchemaViolation.
+type rejectedValue struct{}
+
+var rejected = rejectedValue{}
+
+func TestCoercionRules(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	stamp := time.Date(2024, 1, 2, 15, 4, 5, 0, time.FixedZone("", 2*3600))
+
+	tests := []struct {
+		column string
+		input  interface{}
+		strict interface{}
+		// lenient is the result under LenientCoercion, if it differs.
+		lenient interface{}
+	}{
+		// Int
+		{"i", 42, 42, nil},
+		{"i", 42.0, int64(42), nil},
+		{"i", -3.0, int64(-3), nil},
+		{"i", 1.5, rejected, nil},
+		{"i", 1e20, rejected, nil},
+		{"i", math.NaN(), rejected, nil},
+		{"i", "42", rejected, int64(42)},
+		{"i", "-7", rejected, int64(-7)},
+		{"i", " 42", rejected, nil},
+		{"i", "1.0", rejected, nil},
+		{"i", "0x10", rejected, nil},
+		{"i", true, rejected, nil},
+
+		// Float
+		{"f", 1.5, 1.5, nil},
+		{"f", 3, 3.0, nil},
+		{"f", int64(1 << 53), float64(1 << 53), nil},
+		{"f", int64(1<<53 + 1), rejected, nil},
+		{"f", uint64(math.MaxUint64), rejected, nil},
+		{"f", "1.5", rejected, 1.5},
+		{"f", "-2e3", rejected, -2000.0},
+		{"f", "NaN", rejected, nil},
+		{"f", "Inf", rejected, nil},
+		{"f", "0x1p4", rejected, nil},
+
+		// Decimal
+		{"d", "19.99", DecimalValue{Units: 1999, Scale: 2}, nil},
+		{"d", 19.99, DecimalValue{Units: 1999, Scale: 2}, nil},
+		{"d", 7, DecimalValue{Units: 700, Scale: 2}, nil},
+		{"d", "1.005", rejected, nil},
+		{"d", math.Inf(1), rejected, nil},
+		{"d", "abc", rejected, nil},
+
+		// DateTime
+		{"t", "2024-01-02", day, nil},
+		{"t", "2024-01-02T15:04:05+02:00", stamp, nil},
+		{"t", "yesterday", rejected, nil},
+		{"t", 1704153600, rejected, nil},
+
+		// Bool
+		{"b", true, true, nil},
+		{"b", "true", rejected, true},
+		{"b", "false", rejected, false},
+		{"b", "TRUE", rejected, nil},
+		{"b", "1", rejected, nil},
+		{"b", 1, rejected, nil},
+
+		// Array of Int
+		{"a", []interface{}{1.0, 2.0}, []interface{}{int64(1), int64(2)}, nil},
+		{"a", []interface{}{1, 2}, []interface{}{1, 2}, nil},
+		{"a", []interface{}{1.0, "2"}, rejected, []interface{}{int64(1), int64(2)}},
+		{"a", []interface{}{1.5}, rejected, nil},
+
+		// String columns take only strings, in either mode.
+		{"s", "42", "42", nil},
+		{"s", 42, rejected, nil},
+	}
+
+	for _, mode := range []CoercionMode{StrictCoercion, LenientCoercion} {
+		db := newTestDB(t)
+		if err := db.SetCoercionMode(mode); err != nil {
+			t.Fatal(err)
+		}
+		mustCreateTable(t, db, "values", []Column{
+			{Name: "i", DataType: Int, Nullable: true},
+			{Name: "f", DataType: Float, Nullable: true},
+			{Name: "d", DataType: Decimal, Scale: 2, Nullable: true},
+			{Name: "t", DataType: DateTime, Nullable: true},
+			{Name: "b", DataType: Bool, Nullable: true},
+			{Name: "a", DataType: Array, ElementType: Int, Nullable: true},
+			{Name: "s", DataType: String, Nullable: true},
+		}, nil)
+
+		for i, tt := range tests {
+			want := tt.strict
+			if mode == LenientCoercion && tt.lenient != nil {
+				want = tt.lenient
+			}
+
+			// Each value is checked on insert and on update.
+			id := fmt.Sprint(i)
+			insertErr := db.InsertRow("values", id, map[string]interface{}{tt.column: tt.input})
+			if err := db.InsertRow("values", id+"u", nil); err != nil {
+				t.Fatal(err)
+			}
+			updateErr := db.UpdateRow("values", id+"u", map[string]interface{}{tt.column: tt.input})
+
+			for op, err := range map[string]error{"insert": insertErr, "update": updateErr} {
+				if want == rejected {
+					if !errors.Is(err, ErrSchemaViolation) {
+						t.Errorf("%s: %s of %#v into %s = %v, want ErrSchemaViolation", mode, op, tt.input, tt.column, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s: %s of %#v into %s: %v", mode, op, tt.input, tt.column, err)
+					continue
+				}
+
+				rowID := id
+				if op == "update" {
+					rowID += "u"
+				}
+				row, err := db.GetRowByID("values", rowID)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := row.Columns[tt.column]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: %s of %#v into %s stored %#v, want %#v", mode, op, tt.input, tt.column, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSetCoercionMode(t *testing.T) {
+	db := newTestDB(t)
+	if mode := db.GetCoercionMode(); mode != StrictCoercion {
+		t.Errorf("default mode = %s, want StrictCoercion", mode)
+	}
+	if err := db.SetCoercionMode(LenientCoercion); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetCoercionMode(CoercionMode(9)); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("SetCoercionMode(9) = %v, want ErrInvalidQuery", err)
+	}
+	if mode := db.GetCoercionMode(); mode != LenientCoercion {
+		t.Errorf("mode = %s, want LenientCoercion", mode)
+	}
+}
@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// collateExpr reads the value of x as its key under collation, so that
+// comparing two collateExprs follows the collation.
+type collateExpr struct {
+	x         expr
+	collation Collation
+}
+
+func (e collateExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+	return e.collation.key(val), nil
+}
+
+func (e collateExpr) String() string {
+	return e.x.String()
+}
+
+// key returns the value val compares as under c: for a string, one that
+// is equal for exactly the strings c finds equal. Other values are left
+// as they are.
+func (c Collation) key(val interface{}) interface{} {
+	s, ok := val.(string)
+	if !ok {
+		return val
+	}
+
+	switch c {
+	case CaseInsensitiveCollation:
+		return foldCase(s)
+	case NaturalCollation:
+		return naturalKey(s)
+	}
+	return val
+}
+
+// foldCase maps each rune of s to the least rune of its Unicode simple case
+// folding orbit, as strings.EqualFold compares them.
+func foldCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		least := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < least {
+				least = f
+			}
+		}
+		return least
+	}, s)
+}
+
+// naturalKey returns a string that sorts bytewise as s does under
+// NaturalCollation: each run of digits, without its leading zeros, is
+// written as a '0', its length in ten digits and the digits, so that a
+// shorter number sorts first and numbers still sort before letters, as
+// digits do. s itself follows a NUL, so that only equal strings have
+// equal keys.
+func naturalKey(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] < '0' || s[i] > '9' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		digits := strings.TrimLeft(s[start:i], "0")
+		fmt.Fprintf(&b, "0%010d%s", len(digits), digits)
+	}
+	b.WriteByte(0)
+	b.WriteString(s)
+	return b.String()
+}
+
+// parseCollation reads the name of a collation in COLLATE.
+func parseCollation(name string) (Collation, bool) {
+	switch strings.ToUpper(name) {
+	case "BINARY":
+		return BinaryCollation, true
+	case "NOCASE":
+		return CaseInsensitiveCollation, true
+	case "NATURAL":
+		return NaturalCollation, true
+	}
+	return 0, false
+}
+
+// collation returns the collation of t's column name; the id and unknown
+// columns are binary.
+func (t *Table) collation(name string) Collation {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return col.Collation
+		}
+	}
+	return BinaryCollation
+}
+
+// columnCollations maps the names columnTypes gives String columns to
+// their collations, for the columns that are not binary. The caller must
+// hold db.mu.
+func (db *NewDatabase) columnCollations(plan ExecutionPlan, names joinNames) map[string]Collation {
+	collations := make(map[string]Collation)
+	joined := plan.hasJoins()
+
+	for _, op := range plan.Operations {
+		if (op.Type != Scan && op.Type != JoinOp) || op.series != nil {
+			continue
+		}
+
+		table, _ := db.queryTable(op.Table)
+		for _, col := range table.Columns {
+			if col.Collation == BinaryCollation {
+				continue
+			}
+			if !joined {
+				collations[col.Name] = col.Collation
+				continue
+			}
+			collations[table.Name+"."+col.Name] = col.Collation
+			if !names.ambiguous[col.Name] {
+				collations[col.Name] = col.Collation
+			}
+		}
+	}
+	return collations
+}
+
+// bindCollations returns plan with its filters and sort keys comparing the
+// columns in collations by their collation. Join conditions compare
+// binary.
+func (plan ExecutionPlan) bindCollations(collations map[string]Collation) ExecutionPlan {
+	if len(collations) == 0 {
+		return plan
+	}
+
+	ops := append([]Operation(nil), plan.Operations...)
+	for i, op := range ops {
+		switch op.Type {
+		case Filter:
+			ops[i].filterExpr = bindCollationExpr(op.filterExpr, collations)
+		case Sort:
+			keys := append([]orderKey(nil), op.orderKeys...)
+			for j, key := range keys {
+				if !key.collated {
+					keys[j].collation = collations[key.col.name]
+				}
+			}
+			ops[i].orderKeys = keys
+		}
+	}
+	plan.Operations = ops
+	return plan
+}
+
+// bindCollationExpr wraps the operands of each comparison, BETWEEN and IN
+// that involve a collated column in collateExprs, and matches a LIKE on a
+// case-insensitive one without regard to case.
+func bindCollationExpr(e expr, collations map[string]Collation) expr {
+	collationOf := func(xs ...expr) Collation {
+		for _, x := range xs {
+			if col, ok := x.(columnExpr); ok && collations[col.name] != BinaryCollation {
+				return collations[col.name]
+			}
+		}
+		return BinaryCollation
+	}
+	wrap := func(c Collation, xs ...*expr) {
+		for _, x := range xs {
+			*x = collateExpr{x: *x, collation: c}
+		}
+	}
+
+	bound, _ := rewriteExpr(e, func(e expr) (expr, error) {
+		switch e := e.(type) {
+		case binaryExpr:
+			switch e.op {
+			case "=", "!=", "<", "<=", ">", ">=":
+			default:
+				return e, nil
+			}
+			if c := collationOf(e.left, e.right); c != BinaryCollation {
+				wrap(c, &e.left, &e.right)
+			}
+			return e, nil
+		case betweenExpr:
+			if c := collationOf(e.x); c != BinaryCollation {
+				wrap(c, &e.x, &e.lo, &e.hi)
+			}
+			return e, nil
+		case inExpr:
+			if c := collationOf(e.x); c != BinaryCollation {
+				e.list = append([]expr(nil), e.list...)
+				wrap(c, &e.x)
+				for i := range e.list {
+					wrap(c, &e.list[i])
+				}
+			}
+			return e, nil
+		case likeExpr:
+			// Patterns match natural keys no differently from binary ones.
+			c := collationOf(e.x)
+			if c != CaseInsensitiveCollation {
+				return e, nil
+			}
+			pattern, _ := c.key(e.pattern).(string)
+			re, err := likePattern(pattern)
+
+			if err != nil {
+				return e, nil
+			}
+			wrap(c, &e.x)
+			e.re = re
+			return e, nil
+		}
+		return e, nil
+	})
+	return bound
+}
+
+// AlterColumnCollation changes the collation of the String column
+// columnName and rebuilds the table's indexes, whose keys follow it. It
+// fails with ErrUniqueViolation, leaving the table unchanged, if two rows
+// a unique index holds would become equal.
+func (db *NewDatabase) AlterColumnCollation(tableName, columnName string, collation Collation) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	columns := append([]Column(nil), table.Columns...)
+	pos := -1
+	for i, col := range columns {
+		if col.Name == columnName {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return fmt.Errorf("%w: table %s has no column %s", ErrInvalidSchema, tableName, columnName)
+	}
+	columns[pos].Collation = collation
+	if err := validateSchema(columns, table.Indexes); err != nil {
+		return fmt.Errorf("table %s: %w", tableName, err)
+	}
+
+	candidate := table.cloneStorage()
+	candidate.Columns = columns
+
+	if bad, err := candidate.rebuildIndexes(); err != nil {
+		return fmt.Errorf("row %s: %w", bad, err)
+	}
+
+	db.Tables[tableName] = candidate
+	db.replicateTable(tableName)
+	return nil
+}
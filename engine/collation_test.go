@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func collationTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "files", []Column{
+		{Name: "name", DataType: String},
+		{Name: "label", DataType: String, Collation: CaseInsensitiveCollation},
+		{Name: "version", DataType: String, Collation: NaturalCollation},
+	}, nil)
+	for id, row := range map[string][3]string{
+		"a": {"item10", "banana", "v1.10"},
+		"b": {"item2", "Apple", "v1.2"},
+		"c": {"Item3", "cherry", "v1.02.1"},
+		"d": {"item1", "apple pie", "v10"},
+		"e": {"item02", "BANANA!", "v9"},
+	} {
+		mustInsert(t, db, "files", id, map[string]interface{}{"name": row[0], "label": row[1], "version": row[2]})
+	}
+	return db
+}
+
+func TestCollationOrderBy(t *testing.T) {
+	db := collationTestDB(t)
+
+	tests := []struct {
+		orderBy string
+		want    []string
+	}{
+		// Binary: upper case first, digits by byte.
+		{"name", []string{"c", "e", "d", "a", "b"}},
+		// The column's collations.
+		{"label", []string{"b", "d", "a", "e", "c"}},
+		{"version DESC", []string{"d", "e", "a", "c", "b"}},
+		// COLLATE overrides them.
+		{"name COLLATE NOCASE", []string{"e", "d", "a", "b", "c"}},
+		{"name COLLATE NATURAL", []string{"c", "d", "e", "b", "a"}},
+		{"label COLLATE BINARY", []string{"b", "e", "d", "a", "c"}},
+		{"name collate natural desc", []string{"a", "b", "e", "d", "c"}},
+	}
+	for _, tt := range tests {
+		result := mustQuery(t, db, Query{Select: []string{"id"}, From: "files", OrderBy: tt.orderBy + ", id"})
+		if got := resultIDs(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ORDER BY %s = %v, want %v", tt.orderBy, got, tt.want)
+		}
+	}
+}
+
+func TestCollationFilters(t *testing.T) {
+	db := collationTestDB(t)
+
+	for where, want := range map[string][]string{
+		"label = 'APPLE'":               {"b"},
+		"label LIKE 'apple%'":           {"b", "d"},
+		"label IN ('Cherry')":           {"c"},
+		"name = 'ITEM3'":                nil,
+		"version < 'v2'":                {"a", "b", "c"},
+		"version BETWEEN 'v2' AND 'v9'": {"e"},
+	} {
+		result := mustQuery(t, db, Query{Select: []string{"id"}, From: "files", Where: where, OrderBy: "id"})
+		if got := resultIDs(result); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("WHERE %s = %v, want %v", where, got, want)
+		}
+	}
+}
+
+func TestAlterColumnCollation(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "users", []Column{{Name: "email", DataType: String}},
+		[]Index{{Name: "by_email", Columns: []string{"email"}, Unique: true}})
+	mustInsert(t, db, "users", "a", map[string]interface{}{"email": "ann@example.com"})
+	mustInsert(t, db, "users", "b", map[string]interface{}{"email": "Ann@Example.com"})
+
+	if err := db.AlterColumnCollation("users", "email", CaseInsensitiveCollation); !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("AlterColumnCollation = %v, want ErrUniqueViolation", err)
+	}
+	if col := db.Tables["users"].Columns[0]; col.Collation != BinaryCollation {
+		t.Errorf("failed AlterColumnCollation left collation %d", col.Collation)
+	}
+
+	if err := db.DeleteRow("users", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AlterColumnCollation("users", "email", CaseInsensitiveCollation); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("users", "c", map[string]interface{}{"email": "ANN@EXAMPLE.COM"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("InsertRow of an email equal but for case = %v, want ErrUniqueViolation", err)
+	}
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "users", Where: "email = 'ANN@example.COM'"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("case-insensitive lookup = %v, want [a]", got)
+	}
+}
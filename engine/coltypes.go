@@ -0,0 +1,203 @@
+package engine
+
+// columnTypes maps every column name a query's rows can hold to its type:
+// "id" and the schema columns of the scanned table, and with joins the
+// qualified and unambiguous bare names of every joined table. The caller
+// must hold db.mu.
+func (db *NewDatabase) columnTypes(plan ExecutionPlan, names joinNames) map[string]DataType {
+	types := make(map[string]DataType)
+	joined := plan.hasJoins()
+
+	for _, op := range plan.Operations {
+		if op.Type != Scan && op.Type != JoinOp {
+			continue
+		}
+
+		if op.series != nil {
+			dataType, _ := op.series.dataType()
+			types[seriesTableName+"."+seriesColumn] = dataType
+			if !joined || !names.ambiguous[seriesColumn] {
+				types[seriesColumn] = dataType
+			}
+			continue
+		}
+
+		table, _ := db.queryTable(op.Table)
+		add := func(name string, dataType DataType) {
+			if !joined {
+				types[name] = dataType
+				return
+			}
+			types[table.Name+"."+name] = dataType
+			if !names.ambiguous[name] {
+				types[name] = dataType
+			}
+		}
+
+		add("id", String)
+		for _, col := range table.Columns {
+			add(col.Name, col.DataType)
+		}
+	}
+	return types
+}
+
+// resultTypes works out the type of each output column: from types for
+// column references, from the expression for computed and aggregate
+// columns, and otherwise from the first non-NULL value in rows. A column
+// whose type cannot be told, such as one that is always NULL, is reported
+// as String.
+func resultTypes(projections []projection, types map[string]DataType, rows []Row) []DataType {
+	result := make([]DataType, len(projections))
+	for i, p := range projections {
+		if dataType, ok := exprType(p.expr, types); ok {
+			result[i] = dataType
+			continue
+		}
+
+		result[i] = String
+		for _, row := range rows {
+			if dataType, ok := valueType(row.Columns[p.name]); ok {
+				result[i] = dataType
+				break
+			}
+		}
+	}
+	return result
+}
+
+// exprType returns the type e evaluates to, if it can be told without
+// evaluating it.
+func exprType(e expr, types map[string]DataType) (DataType, bool) {
+	switch e := e.(type) {
+	case columnExpr:
+		dataType, ok := types[e.name]
+		return dataType, ok
+	case literalExpr:
+		return valueType(e.value)
+	case castExpr:
+		return e.to, true
+	case isNullExpr, inExpr, betweenExpr, likeExpr, anyExpr, containsExpr, matchExpr:
+		return Bool, true
+	case unaryExpr:
+		if e.op == "-" {
+			return exprType(e.x, types)
+		}
+		return Bool, true
+	case binaryExpr:
+		switch e.op {
+		case "+", "-", "*":
+			return numericType(types, e.left, e.right)
+		case "/", "%":
+			return floatForDecimal(numericType(types, e.left, e.right))
+		}
+		return Bool, true
+	case aggExpr:
+		switch {
+		case e.name == "COUNT":
+			return Int, true
+		case e.arg == nil:
+			return 0, false
+		case e.name == "AVG":
+			if dataType, ok := numericType(types, e.arg); ok && dataType == Decimal {
+				return Decimal, true
+			}
+			return Float, true
+		case e.name == "SUM":
+			return numericType(types, e.arg)
+		default:
+			return exprType(e.arg, types)
+		}
+	case funcExpr:
+		return funcType(e, types)
+	}
+	return 0, false
+}
+
+func funcType(e funcExpr, types map[string]DataType) (DataType, bool) {
+	switch e.name {
+	case "YEAR", "MONTH", "DAY", "HOUR", "DATE_DIFF", "LENGTH", "ARRAY_LENGTH":
+		return Int, true
+	case "ARRAY_CONTAINS", "JSON_CONTAINS":
+		return Bool, true
+	case "ARRAY_APPEND", "ARRAY_REMOVE":
+		return Array, true
+	case "DATE_ADD":
+		return DateTime, true
+	case "UPPER", "LOWER", "TRIM", "LTRIM", "RTRIM", "CONCAT", "SUBSTRING", "REPLACE":
+		return String, true
+	case "SQRT", "POW":
+		return Float, true
+	case "ABS", "CEIL", "FLOOR", "ROUND":
+		if len(e.args) > 0 {
+			return floatForDecimal(numericType(types, e.args[0]))
+		}
+	case "MOD":
+		return floatForDecimal(numericType(types, e.args...))
+	}
+	return 0, false
+}
+
+// numericType is Int if every operand is an Int, Float if any is a Float
+// and otherwise Decimal if any is a Decimal.
+func numericType(types map[string]DataType, operands ...expr) (DataType, bool) {
+	result := Int
+	for _, operand := range operands {
+		dataType, ok := exprType(operand, types)
+
+		if !ok {
+			return 0, false
+		}
+		switch dataType {
+		case Float:
+			result = Float
+		case Decimal:
+			if result == Int {
+				result = Decimal
+			}
+		case Int:
+		default:
+			return 0, false
+		}
+	}
+	return result, true
+}
+
+// floatForDecimal is for division and the math functions, which take
+// decimals as floats.
+func floatForDecimal(dataType DataType, ok bool) (DataType, bool) {
+	if dataType == Decimal {
+		return Float, ok
+	}
+	return dataType, ok
+}
+
+func valueType(v interface{}) (DataType, bool) {
+	switch {
+	case v == nil:
+		return 0, false
+	case isFloat(v):
+		return Float, true
+	}
+
+	switch v.(type) {
+	case []interface{}:
+		return Array, true
+	case map[string]interface{}:
+		return JSON, true
+	case DecimalValue:
+		return Decimal, true
+	}
+
+	switch valueKind(v) {
+	case kindNumber:
+		return Int, true
+	case kindString:
+		return String, true
+	case kindBool:
+		return Bool, true
+	case kindTime:
+		return DateTime, true
+	}
+	return 0, false
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func colTypesTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "orders", []Column{
+		{Name: "customer", DataType: String},
+		{Name: "qty", DataType: Int},
+		{Name: "price", DataType: Float},
+		{Name: "paid", DataType: Bool},
+		{Name: "placed_at", DataType: DateTime},
+	}, nil)
+	mustInsert(t, db, "orders", "1", map[string]interface{}{"customer": "a", "qty": 2, "price": 1.5, "paid": true, "placed_at": time.Now()})
+	mustInsert(t, db, "orders", "2", map[string]interface{}{"customer": "b", "qty": 5, "price": 3.0, "paid": false, "placed_at": time.Now()})
+	return db
+}
+
+func TestColumnTypesPassthroughAndComputed(t *testing.T) {
+	db := colTypesTestDB(t)
+
+	result := mustQuery(t, db, Query{
+		Select: []string{"id", "customer", "qty", "price", "paid", "placed_at", "qty * 2", "qty * price", "CAST(qty AS STRING)", "qty > 3", "YEAR(placed_at)"},
+		From:   "orders",
+	})
+	want := []DataType{String, String, Int, Float, Bool, DateTime, Int, Float, String, Bool, Int}
+	if !reflect.DeepEqual(result.ColumnTypes, want) {
+		t.Fatalf("ColumnTypes = %v, want %v", result.ColumnTypes, want)
+	}
+	if len(result.ColumnTypes) != len(result.Columns) {
+		t.Fatalf("%d ColumnTypes for %d Columns", len(result.ColumnTypes), len(result.Columns))
+	}
+}
+
+func TestColumnTypesAggregates(t *testing.T) {
+	db := colTypesTestDB(t)
+
+	result := mustQuery(t, db, Query{
+		Select: []string{"COUNT(*)", "SUM(qty)", "AVG(qty)", "MIN(price)", "MAX(placed_at)", "SUM(price)"},
+		From:   "orders",
+	})
+	want := []DataType{Int, Int, Float, Float, DateTime, Float}
+	if !reflect.DeepEqual(result.ColumnTypes, want) {
+		t.Fatalf("ColumnTypes = %v, want %v", result.ColumnTypes, want)
+	}
+
+	// The types do not depend on there being rows to look at.
+	empty := mustQuery(t, db, Query{Select: []string{"COUNT(*)", "SUM(qty)", "AVG(qty)"}, From: "orders", Where: "qty > 100"})
+	if want := []DataType{Int, Int, Float}; !reflect.DeepEqual(empty.ColumnTypes, want) {
+		t.Fatalf("ColumnTypes of an empty result = %v, want %v", empty.ColumnTypes, want)
+	}
+}
@@ -0,0 +1,133 @@
+package engine
+
+import "fmt"
+
+const (
+	defaultCompactThreshold = 0.5
+	compactMinDeleted       = 1000
+	compactAttempts         = 3
+
+	// rowHeaderBytes is the size of a Row value in a table's row slice.
+	rowHeaderBytes = 16
+)
+
+// SetCompactionThreshold sets the fraction of a table's rows that must have
+// been deleted since it was last compacted before it is compacted
+// automatically. Tables with fewer than 1000 deletions are never compacted
+// automatically. Zero restores the default of 0.5, and 1 or more disables
+// automatic compaction.
+func (db *NewDatabase) SetCompactionThreshold(fraction float64) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.compactThreshold = fraction
+}
+
+// Compact rebuilds a table's row storage, per-row maps and indexes at their
+// current size, so that memory held on behalf of deleted rows is returned.
+// The new structures are built from a copy taken under the read lock and
+// swapped in under the write lock; if the table is written to in between,
+// the copy is retaken, and after a few such attempts Compact builds under
+// the write lock instead.
+func (db *NewDatabase) Compact(tableName string) error {
+	for attempt := 1; ; attempt++ {
+		final := attempt == compactAttempts
+
+		if final {
+			db.mu.Lock()
+		} else {
+			db.mu.RLock()
+		}
+		table, ok := db.Tables[tableName]
+		rows := append([]Row(nil), table.allRows()...)
+		if !final {
+			db.mu.RUnlock()
+		}
+
+		if !ok {
+			if final {
+				db.mu.Unlock()
+			}
+			return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+		}
+
+		compacted := compactStorage(table, rows)
+
+		if !final {
+			db.mu.Lock()
+		}
+		current, ok := db.Tables[tableName]
+		switch {
+		case !ok:
+			db.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+		case current.writes != table.writes:
+			db.mu.Unlock()
+			continue
+		}
+
+		current.Rows = compacted.Rows
+		current.ids = compacted.ids
+		current.kv = compacted.kv
+		current.indexData = compacted.indexData
+		current.partitions = compacted.partitions
+		current.sizeBytes = compacted.sizeBytes
+		current.reclaimedBytes += current.garbageBytes + int64(cap(table.Rows)-len(table.Rows))*rowHeaderBytes
+		current.garbageBytes = 0
+		current.deletedRows = 0
+		db.Tables[tableName] = current
+		delete(db.compacting, tableName)
+		db.mu.Unlock()
+		return nil
+	}
+}
+
+// compactStorage returns freshly built row storage and indexes for t
+// holding copies of rows. It does not read t's storage, so the caller need
+// not hold any lock.
+func compactStorage(t Table, rows []Row) Table {
+	copied := make([]Row, len(rows))
+	for i, row := range rows {
+		copied[i] = copyRow(row)
+	}
+
+	compacted := Table{Name: t.Name, Indexes: t.Indexes, Storage: t.Storage, PartitionColumn: t.PartitionColumn, Partitioning: t.Partitioning}
+	if t.kv != nil {
+		compacted.kv = newKVStore(copied)
+	} else {
+		compacted.Rows = copied
+	}
+	compacted.rebuildIndexes()
+	return compacted
+}
+
+// compactIfNeeded starts compacting tableName in the background if enough
+// of its rows have been deleted. The caller must hold db.mu for writing.
+func (db *NewDatabase) compactIfNeeded(tableName string) {
+	table, ok := db.Tables[tableName]
+	if !ok || table.deletedRows < compactMinDeleted || db.compacting[tableName] {
+		return
+	}
+
+	threshold := db.compactThreshold
+	if threshold == 0 {
+		threshold = defaultCompactThreshold
+	}
+	if float64(table.deletedRows) <= threshold*float64(table.rowCount()+table.deletedRows) {
+		return
+	}
+
+	if db.compacting == nil {
+		db.compacting = make(map[string]bool)
+	}
+	db.compacting[tableName] = true
+
+	go func() {
+		if err := db.Compact(tableName); err != nil {
+			db.mu.Lock()
+			delete(db.compacting, tableName)
+			db.logf("compacting table %s: %v", tableName, err)
+			db.mu.Unlock()
+		}
+	}()
+}
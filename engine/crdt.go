@@ -0,0 +1,350 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const crdtsTable = "_crdts"
+
+// crdtState is the stored state of every CRDT type; each type uses only
+// some of the fields. It is kept as JSON in the _crdts table, so register
+// values come back as JSON values (numbers as float64).
+type crdtState struct {
+	// Per-replica increments and decrements of the counters.
+	P map[string]int64 `json:"p,omitempty"`
+	N map[string]int64 `json:"n,omitempty"`
+
+	// The register's value and the logical timestamp and replica that wrote
+	// it. Ties on Timestamp go to the greater Replica.
+	Value     interface{} `json:"value,omitempty"`
+	Timestamp int64       `json:"ts,omitempty"`
+	Replica   string      `json:"replica,omitempty"`
+
+	// The set's add tags per element, the removed tags, and per-replica
+	// counters used to make new tags unique.
+	Adds    map[string][]string `json:"adds,omitempty"`
+	Removed map[string]bool     `json:"removed,omitempty"`
+	Seq     map[string]int64    `json:"seq,omitempty"`
+}
+
+// CreateCRDT creates an empty CRDT of the given type, stored in the _crdts
+// internal table.
+func (db *NewDatabase) CreateCRDT(name string, crdtType CRDTType) error {
+	if crdtType < GCounter || crdtType > ORSet {
+		return fmt.Errorf("%w: unknown CRDT type %d", ErrInvalidQuery, crdtType)
+	}
+
+	err := db.CreateTable(crdtsTable, []Column{
+		{Name: "type", DataType: Int},
+		{Name: "state", DataType: String},
+	}, nil)
+
+	if err != nil && !errors.Is(err, ErrTableExists) {
+		return err
+	}
+
+	return db.InsertRow(crdtsTable, name, map[string]interface{}{
+		"type":  int64(crdtType),
+		"state": "{}",
+	})
+}
+
+func (db *NewDatabase) GetCRDT(name string) (*CRDT, error) {
+	return db.GetCRDTWithOptions(name, WriteOptions{})
+}
+
+// GetCRDTWithOptions is GetCRDT for a CRDT whose updates the audit log
+// records as made by opts.Actor.
+func (db *NewDatabase) GetCRDTWithOptions(name string, opts WriteOptions) (*CRDT, error) {
+	row, err := db.GetRowByID(crdtsTable, name)
+
+	if err != nil {
+		return nil, fmt.Errorf("CRDT %s: %w", name, err)
+	}
+
+	crdtType, _ := row.Columns["type"].(int64)
+	return &CRDT{Name: name, Type: CRDTType(crdtType), db: db, actor: opts.Actor}, nil
+}
+
+// Increment adds n to a GCounter or PNCounter on behalf of replica. n must
+// not be negative; use Decrement on a PNCounter.
+func (c *CRDT) Increment(replica string, n int64) error {
+	if n < 0 {
+		return fmt.Errorf("%w: cannot increment by %d", ErrInvalidQuery, n)
+	}
+
+	return c.update(func(s *crdtState) error {
+		if err := c.expect(GCounter, PNCounter); err != nil {
+			return err
+		}
+		if s.P == nil {
+			s.P = make(map[string]int64)
+		}
+		s.P[replica] += n
+		return nil
+	})
+}
+
+func (c *CRDT) Decrement(replica string, n int64) error {
+	if n < 0 {
+		return fmt.Errorf("%w: cannot decrement by %d", ErrInvalidQuery, n)
+	}
+
+	return c.update(func(s *crdtState) error {
+		if err := c.expect(PNCounter); err != nil {
+			return err
+		}
+		if s.N == nil {
+			s.N = make(map[string]int64)
+		}
+		s.N[replica] += n
+		return nil
+	})
+}
+
+// Count returns the value of a GCounter or PNCounter.
+func (c *CRDT) Count() (int64, error) {
+	if err := c.expect(GCounter, PNCounter); err != nil {
+		return 0, err
+	}
+
+	s, err := c.load()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, n := range s.P {
+		total += n
+	}
+	for _, n := range s.N {
+		total -= n
+	}
+	return total, nil
+}
+
+// Set writes value to an LWWRegister if timestamp is later than the current
+// write's, or equal with a greater replica.
+func (c *CRDT) Set(replica string, timestamp int64, value interface{}) error {
+	return c.update(func(s *crdtState) error {
+		if err := c.expect(LWWRegister); err != nil {
+			return err
+		}
+		s.setIfNewer(crdtState{Value: value, Timestamp: timestamp, Replica: replica})
+		return nil
+	})
+}
+
+// Get returns the value of an LWWRegister, or nil if it was never set.
+func (c *CRDT) Get() (interface{}, error) {
+	if err := c.expect(LWWRegister); err != nil {
+		return nil, err
+	}
+
+	s, err := c.load()
+
+	if err != nil {
+		return nil, err
+	}
+	return s.Value, nil
+}
+
+// Add adds element to an ORSet on behalf of replica.
+func (c *CRDT) Add(replica, element string) error {
+	return c.update(func(s *crdtState) error {
+		if err := c.expect(ORSet); err != nil {
+			return err
+		}
+		if s.Adds == nil {
+			s.Adds = make(map[string][]string)
+		}
+		if s.Seq == nil {
+			s.Seq = make(map[string]int64)
+		}
+		s.Seq[replica]++
+		tag := replica + ":" + strconv.FormatInt(s.Seq[replica], 10)
+		s.Adds[element] = append(s.Adds[element], tag)
+		return nil
+	})
+}
+
+// Remove removes element from an ORSet. Only the adds this replica has
+// observed are removed, so a concurrent add elsewhere survives a merge.
+func (c *CRDT) Remove(element string) error {
+	return c.update(func(s *crdtState) error {
+		if err := c.expect(ORSet); err != nil {
+			return err
+		}
+		if s.Removed == nil {
+			s.Removed = make(map[string]bool)
+		}
+		for _, tag := range s.Adds[element] {
+			s.Removed[tag] = true
+		}
+		return nil
+	})
+}
+
+// Elements returns the members of an ORSet in sorted order.
+func (c *CRDT) Elements() ([]string, error) {
+	if err := c.expect(ORSet); err != nil {
+		return nil, err
+	}
+
+	s, err := c.load()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var elements []string
+	for element, tags := range s.Adds {
+		for _, tag := range tags {
+			if !s.Removed[tag] {
+				elements = append(elements, element)
+				break
+			}
+		}
+	}
+	sort.Strings(elements)
+	return elements, nil
+}
+
+// Merge folds the state of other, typically the same CRDT on another
+// replica's database, into c. Merging is commutative, associative and
+// idempotent. Both must be of the same type.
+func (c *CRDT) Merge(other *CRDT) error {
+	if other.Type != c.Type {
+		return fmt.Errorf("%w: cannot merge %s %s into %s %s", ErrInvalidQuery, other.Type, other.Name, c.Type, c.Name)
+	}
+
+	theirs, err := other.load()
+
+	if err != nil {
+		return err
+	}
+
+	return c.update(func(s *crdtState) error {
+		s.P = mergeMax(s.P, theirs.P)
+		s.N = mergeMax(s.N, theirs.N)
+		s.Seq = mergeMax(s.Seq, theirs.Seq)
+		s.setIfNewer(theirs)
+
+		for element, tags := range theirs.Adds {
+			if s.Adds == nil {
+				s.Adds = make(map[string][]string)
+			}
+			for _, tag := range tags {
+				if !containsString(s.Adds[element], tag) {
+					s.Adds[element] = append(s.Adds[element], tag)
+				}
+			}
+		}
+		for tag := range theirs.Removed {
+			if s.Removed == nil {
+				s.Removed = make(map[string]bool)
+			}
+			s.Removed[tag] = true
+		}
+		return nil
+	})
+}
+
+func (c *CRDT) expect(types ...CRDTType) error {
+	for _, t := range types {
+		if c.Type == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: operation not supported by %s %s", ErrInvalidQuery, c.Type, c.Name)
+}
+
+func (c *CRDT) load() (crdtState, error) {
+	row, err := c.db.GetRowByID(crdtsTable, c.Name)
+
+	if err != nil {
+		return crdtState{}, fmt.Errorf("CRDT %s: %w", c.Name, err)
+	}
+
+	return decodeCRDTState(row)
+}
+
+// update applies fn to the stored state under the database write lock, so
+// concurrent operations on the same CRDT do not lose updates.
+func (c *CRDT) update(fn func(s *crdtState) error) error {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[crdtsTable]
+
+	if !ok {
+		return fmt.Errorf("CRDT %s: %w: %s", c.Name, ErrTableNotFound, crdtsTable)
+	}
+
+	table.ensureIndexes()
+
+	current, ok := table.getRow(c.Name)
+
+	if !ok {
+		return fmt.Errorf("CRDT %s: %w", c.Name, ErrIDNotFound)
+	}
+
+	s, err := decodeCRDTState(current)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&s); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(s)
+
+	if err != nil {
+		return fmt.Errorf("CRDT %s: %w", c.Name, err)
+	}
+
+	updated := copyRow(current)
+	updated.Columns["state"] = string(encoded)
+	updated = table.putRow(updated)
+	table.audit(AuditUpdate, current, updated, writeOrigin{actor: c.actor})
+	db.Tables[crdtsTable] = table
+	db.publishChange(ChangeUpdate, crdtsTable, c.Name, current, updated)
+
+	return nil
+}
+
+func decodeCRDTState(row Row) (crdtState, error) {
+	var s crdtState
+	encoded, _ := row.Columns["state"].(string)
+
+	if err := json.Unmarshal([]byte(encoded), &s); err != nil {
+		return crdtState{}, fmt.Errorf("CRDT %s: corrupt state: %w", rowID(row), err)
+	}
+	return s, nil
+}
+
+func (s *crdtState) setIfNewer(other crdtState) {
+	if other.Timestamp > s.Timestamp || (other.Timestamp == s.Timestamp && other.Replica > s.Replica) {
+		s.Value, s.Timestamp, s.Replica = other.Value, other.Timestamp, other.Replica
+	}
+}
+
+func mergeMax(ours, theirs map[string]int64) map[string]int64 {
+	for replica, n := range theirs {
+		if ours == nil {
+			ours = make(map[string]int64)
+		}
+		if n > ours[replica] {
+			ours[replica] = n
+		}
+	}
+	return ours
+}
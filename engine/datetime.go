@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultNow is the DefaultFunc returned by Now.
+const defaultNow DefaultFunc = "NOW()"
+
+// A Default is persisted with the schema, so gob must know DefaultFunc.
+func init() {
+	gob.Register(DefaultFunc(""))
+}
+
+// Now returns the Column Default that fills a DateTime column with the
+// time, in UTC, at which the row is inserted, as for a created_at column.
+func Now() DefaultFunc {
+	return defaultNow
+}
+
+func (f DefaultFunc) String() string {
+	return string(f)
+}
+
+// value computes the default for a row being inserted at now.
+func (f DefaultFunc) value(now time.Time) (interface{}, error) {
+	switch f {
+	case defaultNow:
+		return now.UTC(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown default %s", ErrInvalidSchema, f)
+}
+
+// parseDateTime parses an RFC 3339 date-time, with or without fractional
+// seconds, keeping its offset. A bare date such as 2024-01-01 is midnight
+// UTC.
+func parseDateTime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// timeOperands returns a and b with a string compared against a DateTime
+// parsed as one, so that created_at > '2024-01-01T00:00:00Z' compares
+// chronologically. A string that does not parse is left as it is.
+func timeOperands(a, b interface{}) (interface{}, interface{}) {
+	switch x := a.(type) {
+	case time.Time:
+		if s, ok := b.(string); ok {
+			if t, ok := parseDateTime(s); ok {
+				return x, t
+			}
+		}
+	case string:
+		if _, ok := b.(time.Time); ok {
+			if t, ok := parseDateTime(x); ok {
+				return t, b
+			}
+		}
+	}
+	return a, b
+}
+
+// dateTimeArg returns args[i] as a time, or ok=false if it is NULL.
+func dateTimeArg(name string, args []interface{}, i int) (time.Time, bool, error) {
+	switch v := args[i].(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case time.Time:
+		return v, true, nil
+	default:
+		return time.Time{}, false, fmt.Errorf("%w: %s requires a DateTime, got %T", ErrInvalidQuery, name, v)
+	}
+}
+
+func stringArg(name string, args []interface{}, i int) (string, bool, error) {
+	switch v := args[i].(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	default:
+		return "", false, fmt.Errorf("%w: %s requires a string, got %T", ErrInvalidQuery, name, v)
+	}
+}
+
+func checkArgs(name string, args []interface{}, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%w: %s takes %d arguments, got %d", ErrInvalidQuery, name, n, len(args))
+	}
+	return nil
+}
+
+// dateField builds YEAR, MONTH, DAY and HOUR.
+func dateField(name string, field func(time.Time) int) scalarFunc {
+	return func(args []interface{}) (interface{}, error) {
+		if err := checkArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		t, ok, err := dateTimeArg(name, args, 0)
+
+		if err != nil || !ok {
+			return nil, err
+		}
+		return int64(field(t)), nil
+	}
+}
+
+// dateAdd implements DATE_ADD(t, interval). The interval is either a Go
+// duration such as '36h' or '-90m', or a count and a unit such as
+// '3 days', '1 month' or '-2 years'; months and years follow the calendar.
+func dateAdd(args []interface{}) (interface{}, error) {
+	if err := checkArgs("DATE_ADD", args, 2); err != nil {
+		return nil, err
+	}
+
+	t, ok, err := dateTimeArg("DATE_ADD", args, 0)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	interval, ok, err := stringArg("DATE_ADD", args, 1)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	if d, err := time.ParseDuration(interval); err == nil {
+		return t.Add(d), nil
+	}
+
+	fields := strings.Fields(interval)
+	if len(fields) == 2 {
+		n, err := strconv.Atoi(fields[0])
+
+		if err == nil {
+			switch strings.TrimSuffix(strings.ToLower(fields[1]), "s") {
+			case "second":
+				return t.Add(time.Duration(n) * time.Second), nil
+			case "minute":
+				return t.Add(time.Duration(n) * time.Minute), nil
+			case "hour":
+				return t.Add(time.Duration(n) * time.Hour), nil
+			case "day":
+				return t.AddDate(0, 0, n), nil
+			case "month":
+				return t.AddDate(0, n, 0), nil
+			case "year":
+				return t.AddDate(n, 0, 0), nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: DATE_ADD: invalid interval %q", ErrInvalidQuery, interval)
+}
+
+// dateDiff implements DATE_DIFF(a, b, unit): a minus b in whole seconds,
+// minutes, hours or days, truncated towards zero.
+func dateDiff(args []interface{}) (interface{}, error) {
+	if err := checkArgs("DATE_DIFF", args, 3); err != nil {
+		return nil, err
+	}
+
+	a, aok, err := dateTimeArg("DATE_DIFF", args, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, bok, err := dateTimeArg("DATE_DIFF", args, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	unit, uok, err := stringArg("DATE_DIFF", args, 2)
+
+	if err != nil || !aok || !bok || !uok {
+		return nil, err
+	}
+
+	var size time.Duration
+	switch strings.TrimSuffix(strings.ToLower(unit), "s") {
+	case "second":
+		size = time.Second
+	case "minute":
+		size = time.Minute
+	case "hour":
+		size = time.Hour
+	case "day":
+		size = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("%w: DATE_DIFF: unknown unit %q", ErrInvalidQuery, unit)
+	}
+
+	return int64(a.Sub(b) / size), nil
+}
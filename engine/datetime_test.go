@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func callScalar(t *testing.T, name string, args ...interface{}) (interface{}, error) {
+	t.Helper()
+	fn, ok := scalarFuncs[name]
+	if !ok {
+		t.Fatalf("no scalar function %s", name)
+	}
+	return fn(args)
+}
+
+func TestDateFields(t *testing.T) {
+	when := time.Date(2024, 2, 29, 23, 15, 0, 0, time.UTC)
+	for name, want := range map[string]int64{"YEAR": 2024, "MONTH": 2, "DAY": 29, "HOUR": 23} {
+		got, err := callScalar(t, name, when)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s(%v) = %v, want %d", name, when, got, want)
+		}
+	}
+
+	if got, err := callScalar(t, "YEAR", nil); err != nil || got != nil {
+		t.Errorf("YEAR(NULL) = %v, %v, want NULL", got, err)
+	}
+	if _, err := callScalar(t, "YEAR", "2024-01-01"); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("YEAR of a string = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestDateAdd(t *testing.T) {
+	tests := []struct {
+		from     time.Time
+		interval string
+		want     time.Time
+	}{
+		{time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), "1 day", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 12, 31, 22, 0, 0, 0, time.UTC), "3h", time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 11, 15, 0, 0, 0, 0, time.UTC), "2 months", time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), "1 year", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC), "-45 minutes", time.Date(2023, 12, 31, 23, 45, 0, 0, time.UTC)},
+		{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "-1 day", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "90 seconds", time.Date(2024, 1, 1, 0, 1, 30, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := callScalar(t, "DATE_ADD", tt.from, tt.interval)
+		if err != nil {
+			t.Errorf("DATE_ADD(%v, %q): %v", tt.from, tt.interval, err)
+			continue
+		}
+		if !got.(time.Time).Equal(tt.want) {
+			t.Errorf("DATE_ADD(%v, %q) = %v, want %v", tt.from, tt.interval, got, tt.want)
+		}
+	}
+
+	if _, err := callScalar(t, "DATE_ADD", time.Now(), "soon"); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("DATE_ADD with a bad interval = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestDateDiff(t *testing.T) {
+	a := time.Date(2024, 3, 2, 12, 0, 30, 0, time.UTC)
+	b := time.Date(2024, 2, 28, 10, 0, 0, 0, time.UTC)
+
+	for unit, want := range map[string]int64{
+		"seconds": 3*24*3600 + 2*3600 + 30,
+		"minutes": 3*24*60 + 2*60,
+		"hours":   3*24 + 2,
+		"days":    3,
+		"day":     3,
+	} {
+		got, err := callScalar(t, "DATE_DIFF", a, b, unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("DATE_DIFF(a, b, %s) = %v, want %d", unit, got, want)
+		}
+	}
+
+	if got, _ := callScalar(t, "DATE_DIFF", b, a, "days"); got != int64(-3) {
+		t.Errorf("DATE_DIFF(b, a, days) = %v, want -3", got)
+	}
+	if _, err := callScalar(t, "DATE_DIFF", a, b, "weeks"); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("DATE_DIFF in weeks = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestDateFunctionsInQuery(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "events", []Column{
+		{Name: "created_at", DataType: DateTime},
+		{Name: "name", DataType: String},
+	}, nil)
+	mustInsert(t, db, "events", "a", map[string]interface{}{"created_at": time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC), "name": "x"})
+	mustInsert(t, db, "events", "b", map[string]interface{}{"created_at": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "name": "y"})
+	mustInsert(t, db, "events", "c", map[string]interface{}{"created_at": time.Date(2024, 7, 4, 12, 0, 0, 0, time.UTC), "name": "z"})
+
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "events", Where: "YEAR(created_at) = 2024", OrderBy: "id"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"b", "c"}) {
+		t.Errorf("YEAR(created_at) = 2024 matched %v, want [b c]", ids)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"MONTH(DATE_ADD(created_at, '1 day'))"}, From: "events", Where: "id = 'a'"})
+	if got := result.Rows[0].Columns[result.Columns[0]]; got != int64(1) {
+		t.Errorf("MONTH(DATE_ADD(created_at, '1 day')) = %v, want 1", got)
+	}
+
+	if _, err := db.ExecuteQuery(Query{Select: []string{"YEAR(name)"}, From: "events"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("YEAR of a String column = %v, want ErrInvalidQuery", err)
+	}
+}
@@ -0,0 +1,286 @@
+package engine
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalScale is the most digits a DecimalValue keeps after the point,
+// and the most a Decimal column holds in all: every 18-digit number fits
+// in an int64.
+const maxDecimalScale = 18
+
+// Rows are persisted with gob, which must know every concrete type a
+// column value can hold.
+func init() {
+	gob.Register(DecimalValue{})
+}
+
+// ParseDecimal parses a decimal such as "19.99", "-0.5" or "+12". The
+// result keeps every digit written, trailing zeros included, so "1.50"
+// has Scale 2.
+func ParseDecimal(s string) (DecimalValue, error) {
+	text := strings.TrimSpace(s)
+	digits := strings.TrimLeft(text, "+-")
+	if len(text)-len(digits) > 1 {
+		return DecimalValue{}, fmt.Errorf("%w: %q is not a decimal", ErrInvalidCast, s)
+	}
+
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return DecimalValue{}, fmt.Errorf("%w: %q is not a decimal", ErrInvalidCast, s)
+	}
+	if len(frac) > maxDecimalScale {
+		return DecimalValue{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidCast, s, maxDecimalScale)
+	}
+
+	units, err := strconv.ParseInt(text[:len(text)-len(digits)]+whole+frac, 10, 64)
+
+	if err != nil {
+		return DecimalValue{}, fmt.Errorf("%w: %q is out of range for a decimal", ErrInvalidCast, s)
+	}
+	return DecimalValue{Units: units, Scale: len(frac)}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (d DecimalValue) String() string {
+	digits := d.big().Abs(d.big()).String()
+	if d.Scale > 0 {
+		if len(digits) <= d.Scale {
+			digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.Scale] + "." + digits[len(digits)-d.Scale:]
+	}
+	if d.Units < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Float64 returns the float64 nearest to d.
+func (d DecimalValue) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+func (d DecimalValue) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON accepts a decimal written as a string, as MarshalJSON
+// writes it, or as a bare JSON number.
+func (d *DecimalValue) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	parsed, err := ParseDecimal(text)
+
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d DecimalValue) big() *big.Int {
+	return big.NewInt(d.Units)
+}
+
+// digits counts the digits of d's units, leading zeros aside.
+func (d DecimalValue) digits() int {
+	if d.Units == 0 {
+		return 0
+	}
+	return len(d.big().Abs(d.big()).String())
+}
+
+// rescale returns d with exactly scale decimal places. Dropping non-zero
+// digits rounds half away from zero if round is set and fails otherwise.
+func (d DecimalValue) rescale(scale int, round bool) (DecimalValue, error) {
+	if scale == d.Scale {
+		return d, nil
+	}
+
+	units := d.big()
+	if scale > d.Scale {
+		units.Mul(units, pow10(scale-d.Scale))
+		return decimalFromBig(units, scale)
+	}
+
+	quo, rem := new(big.Int).QuoRem(units, pow10(d.Scale-scale), new(big.Int))
+	if rem.Sign() != 0 {
+		if !round {
+			return DecimalValue{}, fmt.Errorf("%w: %s has more than %d decimal places", ErrInvalidCast, d, scale)
+		}
+		if rem.Abs(rem).Lsh(rem, 1).Cmp(pow10(d.Scale-scale)) >= 0 {
+			quo.Add(quo, big.NewInt(int64(units.Sign())))
+		}
+	}
+	return decimalFromBig(quo, scale)
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func decimalFromBig(units *big.Int, scale int) (DecimalValue, error) {
+	if !units.IsInt64() {
+		return DecimalValue{}, fmt.Errorf("%w: decimal out of range", ErrInvalidCast)
+	}
+	return DecimalValue{Units: units.Int64(), Scale: scale}, nil
+}
+
+// toDecimal converts an integer or a DecimalValue to a DecimalValue.
+func toDecimal(v interface{}) (DecimalValue, error) {
+	if d, ok := v.(DecimalValue); ok {
+		return d, nil
+	}
+	if _, huge := hugeUint(v); huge {
+		return DecimalValue{}, fmt.Errorf("%w: %v is out of range for a decimal", ErrInvalidCast, v)
+	}
+	return DecimalValue{Units: toInt64(v)}, nil
+}
+
+// aligned returns the units of a and b at their common scale.
+func aligned(a, b DecimalValue) (*big.Int, *big.Int, int) {
+	x, y := a.big(), b.big()
+	switch {
+	case a.Scale < b.Scale:
+		x.Mul(x, pow10(b.Scale-a.Scale))
+		return x, y, b.Scale
+	case b.Scale < a.Scale:
+		y.Mul(y, pow10(a.Scale-b.Scale))
+	}
+	return x, y, max(a.Scale, b.Scale)
+}
+
+func compareDecimals(a, b DecimalValue) int {
+	x, y, _ := aligned(a, b)
+	return x.Cmp(y)
+}
+
+// decimalArithmetic applies +, - or * exactly. A product with more than
+// maxDecimalScale decimal places is rounded to that many.
+func decimalArithmetic(op string, a, b DecimalValue) (DecimalValue, error) {
+	if op == "*" {
+		units := new(big.Int).Mul(a.big(), b.big())
+		scale := a.Scale + b.Scale
+		if scale > maxDecimalScale {
+			excess := pow10(scale - maxDecimalScale)
+			quo, rem := new(big.Int).QuoRem(units, excess, new(big.Int))
+			if rem.Abs(rem).Lsh(rem, 1).Cmp(excess) >= 0 {
+				quo.Add(quo, big.NewInt(int64(units.Sign())))
+			}
+			units, scale = quo, maxDecimalScale
+		}
+		return decimalFromBig(units, scale)
+	}
+
+	x, y, scale := aligned(a, b)
+	if op == "-" {
+		return decimalFromBig(x.Sub(x, y), scale)
+	}
+	return decimalFromBig(x.Add(x, y), scale)
+}
+
+// exactArithmetic applies op to operands at least one of which is a
+// DecimalValue. ok is false, and the caller falls back to float64, for /
+// and % and for a float operand.
+func exactArithmetic(op string, left, right interface{}) (interface{}, bool, error) {
+	if op == "/" || op == "%" || isFloat(left) || isFloat(right) {
+		return nil, false, nil
+	}
+
+	l, err := toDecimal(left)
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	r, err := toDecimal(right)
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	d, err := decimalArithmetic(op, l, r)
+
+	if err != nil {
+		return nil, true, err
+	}
+	return d, true, nil
+}
+
+// exactLiteral returns val, the value of x, as a DecimalValue if x is a
+// numeric literal with a decimal point, possibly negated, such as 0.1 or
+// -2.50, so that arithmetic with a decimal stays exact. The literal was
+// parsed as a float64, whose shortest form is the number written. Any
+// other val, and one with more than maxDecimalScale places, is returned
+// as it is.
+func exactLiteral(x expr, val interface{}) interface{} {
+	if neg, ok := x.(unaryExpr); ok && neg.op == "-" {
+		x = neg.x
+	}
+	lit, ok := x.(literalExpr)
+	if !ok {
+		return val
+	}
+	if _, ok := lit.value.(float64); !ok || !isFloat(val) {
+		return val
+	}
+
+	d, err := ParseDecimal(strconv.FormatFloat(toFloat(val), 'f', -1, 64))
+	if err != nil {
+		return val
+	}
+	return d
+}
+
+// average divides d, a sum of count values, by count. The result keeps
+// four more decimal places than d, up to maxDecimalScale, and rounds half
+// away from zero.
+func (d DecimalValue) average(count int64) DecimalValue {
+	scale := min(d.Scale+4, maxDecimalScale)
+	units := d.big()
+	units.Mul(units, pow10(scale-d.Scale))
+
+	quo, rem := new(big.Int).QuoRem(units, big.NewInt(count), new(big.Int))
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(big.NewInt(count)) >= 0 {
+		quo.Add(quo, big.NewInt(int64(units.Sign())))
+	}
+	return DecimalValue{Units: quo.Int64(), Scale: scale}
+}
+
+// normalizeDecimal stores val, a value of a Decimal column, at the column's
+// scale and checks it fits the column's precision.
+func (col Column) normalizeDecimal(val DecimalValue) (DecimalValue, error) {
+	d, err := val.rescale(col.Scale, col.RoundDecimals)
+
+	if err != nil {
+		return DecimalValue{}, err
+	}
+	if precision := col.decimalPrecision(); d.digits() > precision {
+		return DecimalValue{}, fmt.Errorf("%w: %s has more than %d digits", ErrInvalidCast, val, precision)
+	}
+	return d, nil
+}
+
+func (col Column) decimalPrecision() int {
+	if col.Precision == 0 {
+		return maxDecimalScale
+	}
+	return col.Precision
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func decimalTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "payments", []Column{{Name: "amt", DataType: Decimal, Precision: 10, Scale: 2}}, nil)
+	mustInsertRows(t, db, "payments", map[string]map[string]interface{}{
+		"p1": {"amt": "0.20"},
+		"p2": {"amt": 19.99},
+		"p3": {"amt": "100"},
+		"p4": {"amt": "-5.5"},
+	})
+	return db
+}
+
+func TestDecimalArithmeticWithLiterals(t *testing.T) {
+	db := decimalTestDB(t)
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"amt + 0.1", "0.30"},
+		{"0.1 + amt", "0.30"},
+		{"amt - 0.05", "0.15"},
+		{"amt + -0.1", "0.10"},
+		{"amt * 1.5", "0.300"},
+		{"amt * 2", "0.40"},
+		{"amt + 1", "1.20"},
+		{"amt + amt", "0.40"},
+	}
+	for _, tt := range tests {
+		result := mustQuery(t, db, Query{Select: []string{tt.expr}, From: "payments", Where: "id = 'p1'"})
+		got, ok := result.Rows[0].Columns[tt.expr].(DecimalValue)
+		if !ok || got.String() != tt.want {
+			t.Errorf("%s = %#v, want decimal %s", tt.expr, result.Rows[0].Columns[tt.expr], tt.want)
+		}
+	}
+
+	// Division is not exact in general, so it still gives a float.
+	result := mustQuery(t, db, Query{Select: []string{"amt / 4"}, From: "payments", Where: "id = 'p1'"})
+	if got := result.Rows[0].Columns["amt / 4"]; got != 0.05 {
+		t.Errorf("amt / 4 = %#v, want 0.05", got)
+	}
+}
+
+func TestDecimalFilterAndOrder(t *testing.T) {
+	db := decimalTestDB(t)
+
+	tests := []struct {
+		where string
+		want  []string
+	}{
+		{"amt = 19.99", []string{"p2"}},
+		{"amt = 0.2", []string{"p1"}},
+		{"amt > 0.1", []string{"p1", "p2", "p3"}},
+		{"amt < 0", []string{"p4"}},
+		{"amt >= 100", []string{"p3"}},
+		{"amt + 0.1 = 0.3", []string{"p1"}},
+	}
+	for _, tt := range tests {
+		result := mustQuery(t, db, Query{Select: []string{"id"}, From: "payments", Where: tt.where, OrderBy: "id"})
+		if got := resultIDs(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WHERE %s = %v, want %v", tt.where, got, tt.want)
+		}
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "payments", OrderBy: "amt DESC"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"p3", "p2", "p1", "p4"}) {
+		t.Errorf("ORDER BY amt DESC = %v, want [p3 p2 p1 p4]", got)
+	}
+}
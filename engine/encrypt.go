@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+)
+
+func init() {
+	gob.Register(sealedValue{})
+}
+
+// sealedValue is how an encrypted column's value is stored: the gob
+// encoding of the value, sealed with AES-256-GCM under the key KeyID, its
+// nonce first. The table name, column name and row id are authenticated
+// with it, so a value cannot be moved to another row or column.
+type sealedValue struct {
+	KeyID string
+	Data  []byte
+}
+
+func (v sealedValue) String() string {
+	return "<encrypted>"
+}
+
+// plainValue wraps a value for gob, which cannot encode a bare interface.
+type plainValue struct {
+	V interface{}
+}
+
+// SetKeyProvider sets where the keys of encrypted columns come from. Values
+// are encrypted as they are written, with the key of their column's
+// EncryptionKeyID, and decrypted as they are read by queries, GetRowByID,
+// GetAllRows and the other reads, so filters and sorts see the original
+// values, as do hooks. Change events and the audit log see them
+// encrypted, as do Table.Rows and the saved files. NULL is stored as NULL.
+// A read or write of an encrypted column whose key the provider cannot
+// give fails with ErrKeyUnavailable.
+func (db *NewDatabase) SetKeyProvider(p KeyProvider) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.keys = p
+}
+
+// aead returns the cipher for keyID. The caller must hold db.mu.
+func (db *NewDatabase) aead(keyID string) (cipher.AEAD, error) {
+	if db.keys == nil {
+		return nil, fmt.Errorf("%w: %q: no key provider", ErrKeyUnavailable, keyID)
+	}
+
+	key, err := db.keys.Key(keyID)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrKeyUnavailable, keyID, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: %q: key is %d bytes, not 32", ErrKeyUnavailable, keyID, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrKeyUnavailable, keyID, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// checkKeys fetches the key of each of t's encrypted columns, so that a
+// read fails up front if one is unavailable. The caller must hold db.mu.
+func (db *NewDatabase) checkKeys(t *Table) error {
+	for _, col := range t.Columns {
+		if !col.Encrypted {
+			continue
+		}
+		if _, err := db.aead(col.EncryptionKeyID); err != nil {
+			return fmt.Errorf("column %s of table %s: %w", col.Name, t.Name, err)
+		}
+	}
+	return nil
+}
+
+func sealedData(t *Table, column string, row Row) []byte {
+	return []byte(t.Name + "\x00" + column + "\x00" + rowID(row))
+}
+
+// sealRow returns row with the values of t's encrypted columns encrypted,
+// copying it if any are. The caller must hold db.mu.
+func (db *NewDatabase) sealRow(t *Table, row Row) (Row, error) {
+	copied := false
+	for _, col := range t.Columns {
+		val := row.Columns[col.Name]
+		if !col.Encrypted || val == nil {
+			continue
+		}
+		if _, ok := val.(sealedValue); ok {
+			continue
+		}
+
+		aead, err := db.aead(col.EncryptionKeyID)
+
+		if err != nil {
+			return Row{}, fmt.Errorf("column %s of table %s: %w", col.Name, t.Name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(plainValue{V: val}); err != nil {
+			return Row{}, fmt.Errorf("column %s of table %s: %w", col.Name, t.Name, err)
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return Row{}, err
+		}
+
+		if !copied {
+			row, copied = copyRow(row), true
+		}
+		row.Columns[col.Name] = sealedValue{
+			KeyID: col.EncryptionKeyID,
+			Data:  aead.Seal(nonce, nonce, buf.Bytes(), sealedData(t, col.Name, row)),
+		}
+	}
+	return row, nil
+}
+
+// openRow reverses sealRow. The caller must hold db.mu.
+func (db *NewDatabase) openRow(t *Table, row Row) (Row, error) {
+	copied := false
+	for _, col := range t.Columns {
+		sealed, ok := row.Columns[col.Name].(sealedValue)
+		if !ok {
+			continue
+		}
+
+		aead, err := db.aead(sealed.KeyID)
+
+		if err != nil {
+			return Row{}, fmt.Errorf("column %s of table %s: %w", col.Name, t.Name, err)
+		}
+		if len(sealed.Data) < aead.NonceSize() {
+			return Row{}, fmt.Errorf("column %s of row %s in table %s: encrypted value is truncated", col.Name, rowID(row), t.Name)
+		}
+
+		nonce, data := sealed.Data[:aead.NonceSize()], sealed.Data[aead.NonceSize():]
+		plain, err := aead.Open(nil, nonce, data, sealedData(t, col.Name, row))
+
+		if err != nil {
+			return Row{}, fmt.Errorf("column %s of row %s in table %s: %w", col.Name, rowID(row), t.Name, err)
+		}
+
+		var v plainValue
+		if err := gob.NewDecoder(bytes.NewReader(plain)).Decode(&v); err != nil {
+			return Row{}, fmt.Errorf("column %s of row %s in table %s: %w", col.Name, rowID(row), t.Name, err)
+		}
+
+		if !copied {
+			row, copied = copyRow(row), true
+		}
+		row.Columns[col.Name] = v.V
+	}
+	return row, nil
+}
+
+// hasEncrypted reports whether t has an encrypted column.
+func (t *Table) hasEncrypted() bool {
+	for _, col := range t.Columns {
+		if col.Encrypted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var encryptTestKey = bytes.Repeat([]byte{7}, 32)
+
+func encryptTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	db.SetKeyProvider(testKeys{"k1": encryptTestKey})
+	mustCreateTable(t, db, "people", []Column{
+		{Name: "name", DataType: String},
+		{Name: "ssn", DataType: String, Nullable: true, Encrypted: true, EncryptionKeyID: "k1"},
+		{Name: "salary", DataType: Int, Encrypted: true, EncryptionKeyID: "k1"},
+		{Name: "hired", DataType: DateTime, Encrypted: true, EncryptionKeyID: "k1"},
+	}, nil)
+	return db
+}
+
+var encryptTestRows = map[string]map[string]interface{}{
+	"a": {"name": "Ann", "ssn": "111-22-3333", "salary": 52000, "hired": time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC)},
+	"b": {"name": "Bob", "ssn": nil, "salary": 48000, "hired": time.Date(2021, 7, 15, 9, 0, 0, 0, time.UTC)},
+	"c": {"name": "Cy", "ssn": "999-88-7777", "salary": 61000, "hired": time.Date(2019, 1, 2, 9, 0, 0, 0, time.UTC)},
+}
+
+func TestEncryptedColumnsRoundTrip(t *testing.T) {
+	db := encryptTestDB(t)
+	for id, data := range encryptTestRows {
+		mustInsert(t, db, "people", id, data)
+	}
+
+	for id, data := range encryptTestRows {
+		row, err := db.GetRowByID("people", id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range data {
+			got := row.Columns[name]
+			if name == "salary" {
+				got, want = toInt64(got), toInt64(want)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("row %s: %s = %#v, want %#v", id, name, got, want)
+			}
+		}
+	}
+
+	// Filters and sorts see the original values.
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: "salary > 50000", OrderBy: "hired"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"c", "a"}) {
+		t.Errorf("salary > 50000 ORDER BY hired = %v, want [c a]", got)
+	}
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: "ssn IS NULL"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("ssn IS NULL = %v, want [b]", got)
+	}
+
+	if err := db.UpdateRow("people", "a", map[string]interface{}{"ssn": "123-45-6789"}); err != nil {
+		t.Fatal(err)
+	}
+	if row, _ := db.GetRowByID("people", "a"); row.Columns["ssn"] != "123-45-6789" {
+		t.Errorf("ssn after UpdateRow = %#v", row.Columns["ssn"])
+	}
+}
+
+func TestEncryptedColumnsStoreNoPlaintext(t *testing.T) {
+	db := encryptTestDB(t)
+	db.path = t.TempDir()
+	for id, data := range encryptTestRows {
+		mustInsert(t, db, "people", id, data)
+	}
+
+	for _, row := range db.Tables["people"].Rows {
+		for _, name := range []string{"ssn", "salary", "hired"} {
+			val := row.Columns[name]
+			if _, ok := val.(sealedValue); !ok && val != nil {
+				t.Errorf("row %s: Table.Rows holds %s as %#v", rowID(row), name, val)
+			}
+		}
+		if row.Columns["name"] == nil {
+			t.Errorf("row %s: unencrypted name is not stored", rowID(row))
+		}
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(db.path, "people"+tableFileExt))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("Ann")) {
+		t.Fatal("saved file does not hold the unencrypted names")
+	}
+	for _, secret := range []string{"111-22-3333", "999-88-7777"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("saved file holds %s in plaintext", secret)
+		}
+	}
+
+	reopened, err := Open(db.path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.SetKeyProvider(testKeys{"k1": encryptTestKey})
+	if row, err := reopened.GetRowByID("people", "c"); err != nil || row.Columns["ssn"] != "999-88-7777" {
+		t.Errorf("reopened ssn = %v, %v, want 999-88-7777", row.Columns["ssn"], err)
+	}
+}
+
+func TestEncryptedColumnsNeedTheKey(t *testing.T) {
+	db := encryptTestDB(t)
+	mustInsert(t, db, "people", "a", encryptTestRows["a"])
+
+	db.SetKeyProvider(testKeys{})
+	if _, err := db.GetRowByID("people", "a"); !errors.Is(err, ErrKeyUnavailable) {
+		t.Errorf("GetRowByID without the key = %v, want ErrKeyUnavailable", err)
+	}
+	if _, err := db.ExecuteQuery(Query{Select: []string{"id"}, From: "people"}); !errors.Is(err, ErrKeyUnavailable) {
+		t.Errorf("query without the key = %v, want ErrKeyUnavailable", err)
+	}
+	if err := db.InsertRow("people", "b", encryptTestRows["b"]); !errors.Is(err, ErrKeyUnavailable) {
+		t.Errorf("InsertRow without the key = %v, want ErrKeyUnavailable", err)
+	}
+
+	// The wrong key does not decrypt either.
+	db.SetKeyProvider(testKeys{"k1": make([]byte, 32)})
+	if _, err := db.GetRowByID("people", "a"); err == nil {
+		t.Error("GetRowByID with the wrong key succeeded")
+	}
+}
+
+func TestEncryptedValueBoundToItsRow(t *testing.T) {
+	db := encryptTestDB(t)
+	mustInsert(t, db, "people", "a", encryptTestRows["a"])
+	mustInsert(t, db, "people", "c", encryptTestRows["c"])
+
+	// Copying a's sealed ssn into c must not pass as c's.
+	table := db.Tables["people"]
+	a, _ := table.getRow("a")
+	for i, row := range table.Rows {
+		if rowID(row) == "c" {
+			table.Rows[i].Columns["ssn"] = a.Columns["ssn"]
+		}
+	}
+	if _, err := db.GetRowByID("people", "c"); err == nil {
+		t.Error("a sealed value moved to another row was decrypted")
+	}
+}
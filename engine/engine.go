@@ -1,75 +1,285 @@
 package engine
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 )
 
 var (
-	ErrTableNotFound     = errors.New("table not found in database")
-	ErrIDNotFound        = errors.New("ID not found in table")
-	ErrIDExists          = errors.New("ID already exists in table")
-	ErrTableExists       = errors.New("table already exists in database")
-	ErrInvalidQuery      = errors.New("invalid query")
-	ErrTransactionFailed = errors.New("transaction failed")
+	ErrTableNotFound       = errors.New("table not found in database")
+	ErrIDNotFound          = errors.New("ID not found in table")
+	ErrIDExists            = errors.New("ID already exists in table")
+	ErrTableExists         = errors.New("table already exists in database")
+	ErrInvalidQuery        = errors.New("invalid query")
+	ErrInvalidCast         = errors.New("invalid type conversion")
+	ErrTransactionFailed   = errors.New("transaction failed")
+	ErrInvalidPlanner      = errors.New("invalid query planner mode")
+	ErrSchemaViolation     = errors.New("row violates table schema")
+	ErrInvalidSchema       = errors.New("invalid table schema")
+	ErrUniqueViolation     = errors.New("unique index violation")
+	ErrNoStoragePath       = errors.New("database has no storage path")
+	ErrLockTimeout         = errors.New("timed out waiting for row lock")
+	ErrCheckViolation      = errors.New("check constraint violated")
+	ErrForeignKey          = errors.New("foreign key violation")
+	ErrVersionConflict     = errors.New("row version does not match")
+	ErrMemoryLimitExceeded = errors.New("memory limit exceeded")
+	ErrDivisionByZero      = errors.New("division by zero")
+	ErrQueryTimeout        = errors.New("query timed out")
+	ErrSequenceNotFound    = errors.New("sequence not found in database")
+	ErrSequenceExists      = errors.New("sequence already exists in database")
+	ErrSequenceNotRead     = errors.New("sequence has not been read with NextVal")
+	ErrSequenceExhausted   = errors.New("sequence reached its limit")
+
+	ErrMigrationAlreadyApplied = errors.New("migration already applied")
+
+	ErrFixtureExists   = errors.New("fixture already exists in database")
+	ErrFixtureNotFound = errors.New("fixture not found in database")
+
+	ErrPolicyExists   = errors.New("policy already exists on table")
+	ErrPolicyNotFound = errors.New("policy not found on table")
+
+	ErrViewReadOnly   = errors.New("view is read-only")
+	ErrViewDependency = errors.New("views depend on it")
+
+	ErrTableGroupExists   = errors.New("table group already exists in database")
+	ErrTableGroupNotFound = errors.New("table group not found in database")
+
+	ErrTriggerExists       = errors.New("trigger already exists on table")
+	ErrConstraintViolation = errors.New("constraint trigger violated")
+
+	ErrKeyUnavailable = errors.New("encryption key unavailable")
+
+	ErrReplicaExists = errors.New("database is already a replica")
+
+	ErrDatabaseClosed  = errors.New("database is shutting down")
+	ErrShutdownTimeout = errors.New("timed out waiting for operations to finish")
+
+	ErrHistoryUnavailable = errors.New("history not retained")
+	ErrReplayMismatch     = errors.New("replayed query result differs from capture")
 )
 
 func (db *NewDatabase) ExecuteQuery(query Query) (QueryResult, error) {
-	plan, err := db.createExecutionPlan(query)
+	return db.ExecuteQueryContext(context.Background(), query)
+}
+
+// ExecuteQueryContext runs query, abandoning it once ctx is done. The
+// query also runs under the timeout set with SetQueryTimeout, if any;
+// running out of either time fails with ErrQueryTimeout.
+func (db *NewDatabase) ExecuteQueryContext(ctx context.Context, query Query) (QueryResult, error) {
+	return db.executeQuery(ctx, query, QueryOptions{})
+}
+
+// runQuery answers query from the result cache, or runs the plan returned
+// by planFn and caches the result.
+func (db *NewDatabase) runQuery(ctx context.Context, query Query, planFn func() (ExecutionPlan, error)) (QueryResult, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return QueryResult{}, err
+	}
+	defer done()
+
+	start := time.Now()
+	result, err := db.answerQuery(ctx, query, planFn)
+	err = asQueryError(err)
+	db.metrics.observe(MetricQuery, start, err, result.scanned)
+	return result, err
+}
+
+func (db *NewDatabase) answerQuery(ctx context.Context, query Query, planFn func() (ExecutionPlan, error)) (QueryResult, error) {
+	// Views are expanded so that the result is cached under, and
+	// invalidated by, the tables the query really reads.
+	query, err := db.expandViews(query)
+
+	if err != nil {
+		return QueryResult{}, err
+	}
+	if err := db.refreshStale(query); err != nil {
+		return QueryResult{}, err
+	}
+
+	if timeout := db.QueryTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	key, stamps, cached, hit := db.cachedResult(query)
+	if hit {
+		return cached, nil
+	}
+
+	plan, err := planFn()
 
 	if err != nil {
 		return QueryResult{}, err
 	}
 
-	result, err := db.executeplan(plan)
+	result, err := db.executeplan(ctx, plan)
 
 	if err != nil {
 		return QueryResult{}, err
 	}
 
+	db.cacheResult(key, stamps, result)
 	return result, nil
 }
 
+// SetQueryPlannerMode sets how queries run from now on are planned. See
+// PlannerMode.
+func (db *NewDatabase) SetQueryPlannerMode(mode PlannerMode) error {
+	switch mode {
+	case RuleBased, CostBased, Heuristic:
+	default:
+		return fmt.Errorf("%w: %d", ErrInvalidPlanner, mode)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.plannerMode = mode
+	return nil
+}
+
+// GetQueryPlannerMode returns the planner mode, RuleBased unless
+// SetQueryPlannerMode has changed it.
+func (db *NewDatabase) GetQueryPlannerMode() PlannerMode {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.plannerMode
+}
+
 func (db *NewDatabase) createExecutionPlan(query Query) (ExecutionPlan, error) {
-	plan := ExecutionPlan{}
+	plan := ExecutionPlan{
+		Mode: db.GetQueryPlannerMode(),
+	}
 
 	scanOp := Operation{
-		Type:  Scan,
-		Table: query.From,
+		Type:           Scan,
+		Table:          query.From,
+		includeDeleted: query.IncludeDeleted,
+		series:         query.GenerateSeries,
+	}
+	if scanOp.series == nil {
+		series, unnest, err := parseSource(query.From)
+
+		if err != nil {
+			return ExecutionPlan{}, inClause("From", err)
+		}
+		scanOp.series, scanOp.unnest = series, unnest
+	}
+	switch {
+	case scanOp.series != nil:
+		scanOp.Table = seriesTableName
+	case scanOp.unnest != nil:
+		scanOp.Table = scanOp.unnest.table
 	}
 	plan.Operations = append(plan.Operations, scanOp)
 
+	// WHERE conjuncts that only read the FROM rows are applied before the
+	// joins, so fewer rows are joined; the rest after them. Join
+	// conditions are applied by the joins themselves.
+	var early, late expr
 	if query.Where != "" {
-		filterOp := Operation{
-			Type:   Filter,
-			Filter: query.Where,
-			Parent: &plan.Operations[len(plan.Operations)-1],
+		filter, err := parseExpr(query.Where)
+
+		if err != nil {
+			return ExecutionPlan{}, inClause("Where", err)
 		}
-		plan.Operations = append(plan.Operations, filterOp)
+
+		early = filter
+		if len(query.Joins) > 0 {
+			early, late = db.splitWhere(filter, query.Joins)
+		}
+	}
+	if early != nil {
+		text := query.Where
+		if late != nil {
+			text = early.String()
+		}
+		plan.Operations = append(plan.Operations, filterOperation(text, early, &plan.Operations[len(plan.Operations)-1]))
+	}
+
+	for _, join := range query.Joins {
+		joinOp, err := db.planJoin(join, plan.Mode)
+
+		if err != nil {
+			return ExecutionPlan{}, inClause("Join", err)
+		}
+		joinOp.Parent = &plan.Operations[len(plan.Operations)-1]
+		plan.Operations = append(plan.Operations, joinOp)
 	}
 
-	projectOp := Operation{
-		Type:    Project,
-		Columns: query.Select,
-		Parent:  &plan.Operations[len(plan.Operations)-1],
+	if late != nil {
+		text := query.Where
+		if early != nil {
+			text = late.String()
+		}
+		plan.Operations = append(plan.Operations, filterOperation(text, late, &plan.Operations[len(plan.Operations)-1]))
 	}
-	plan.Operations = append(plan.Operations, projectOp)
 
 	if query.OrderBy != "" {
+		keys, err := parseOrderBy(query.OrderBy)
+
+		if err != nil {
+			return ExecutionPlan{}, inClause("OrderBy", err)
+		}
+
 		sortOp := Operation{
-			Type:   Sort,
-			Order:  query.OrderBy,
-			Parent: &plan.Operations[len(plan.Operations)-1],
+			Type:      Sort,
+			Order:     query.OrderBy,
+			Parent:    &plan.Operations[len(plan.Operations)-1],
+			orderKeys: keys,
 		}
 		plan.Operations = append(plan.Operations, sortOp)
 	}
 
-	if query.Limit > 0 {
+	projections, aggregate, err := parseProjections(query.Select)
+
+	if err != nil {
+		return ExecutionPlan{}, inClause("Select", err)
+	}
+
+	switch {
+	case isCountOnly(projections) && len(query.Joins) == 0 && scanOp.unnest == nil:
+		countOp := Operation{
+			Type:        CountOp,
+			Columns:     query.Select,
+			Parent:      &plan.Operations[len(plan.Operations)-1],
+			projections: projections,
+		}
+		plan.Operations = append(plan.Operations, countOp)
+	case aggregate:
+		aggregateOp := Operation{
+			Type:        Aggregate,
+			Columns:     query.Select,
+			Parent:      &plan.Operations[len(plan.Operations)-1],
+			projections: projections,
+		}
+		plan.Operations = append(plan.Operations, aggregateOp)
+	default:
+		projectOp := Operation{
+			Type:        Project,
+			Columns:     query.Select,
+			Parent:      &plan.Operations[len(plan.Operations)-1],
+			projections: projections,
+		}
+		plan.Operations = append(plan.Operations, projectOp)
+	}
+
+	if query.Offset < 0 {
+		return ExecutionPlan{}, inClause("Offset", queryError(CodeInvalidArgument, ErrInvalidQuery, "", "negative OFFSET %d", query.Offset))
+	}
+	if query.Limit > 0 || query.Offset > 0 {
 		limitOp := Operation{
 			Type:   LimitOp,
 			Limit:  query.Limit,
+			Offset: query.Offset,
 			Parent: &plan.Operations[len(plan.Operations)-1],
 		}
 		plan.Operations = append(plan.Operations, limitOp)
@@ -78,31 +288,139 @@ func (db *NewDatabase) createExecutionPlan(query Query) (ExecutionPlan, error) {
 	return plan, nil
 }
 
-func (db *NewDatabase) executeplan(plan ExecutionPlan) (QueryResult, error) {
+func filterOperation(text string, filter expr, parent *Operation) Operation {
+	return Operation{
+		Type:       Filter,
+		Filter:     text,
+		Parent:     parent,
+		filterExpr: filter,
+	}
+}
+
+func (db *NewDatabase) executeplan(ctx context.Context, plan ExecutionPlan) (QueryResult, error) {
 	var result QueryResult
 	var rows []Row
 
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	table, ok := db.Tables[plan.Operations[0].Table]
-	if !ok {
-		return result, fmt.Errorf("%w: %s", ErrTableNotFound, plan.Operations[0].Table)
+	table, err := db.sourceTable(plan.Operations[0])
+
+	if err != nil {
+		return result, err
+	}
+
+	if err := db.checkKeys(&table); err != nil {
+		return result, err
+	}
+	// transform is nil unless reads of the table need one, so that the
+	// scan can be counted without copying rows.
+	transform := db.readTransform(ctx, &table)
+
+	var names joinNames
+	if plan.hasJoins() {
+		var err error
+		names, err = db.joinNames(plan)
+
+		if err != nil {
+			return QueryResult{}, err
+		}
+	}
+	plan = plan.bindEnums(db.columnEnums(plan, names))
+	plan = plan.bindCollations(db.columnCollations(plan, names))
+	types := db.columnTypes(plan, names)
+	plan = plan.reorderFilters(types, db.columnDistinct(plan, names))
+
+	// A transformer may change the partition column, so prune only
+	// when the filter sees the stored values.
+	var pruneBy expr
+	if _, ok := db.transformers[table.Name]; !ok {
+		pruneBy = plan.scanFilter()
+	}
+
+	if plan.isCountOnly() && plan.sample == 0 {
+		return countRows(ctx, &table, plan, transform)
 	}
 
-	rows = table.Rows
+	includeDeleted := plan.Operations[0].includeDeleted
+	rows = table.prunedScan(includeDeleted, pruneBy)
+	result.scanned = len(rows)
+	rows = transformRows(transform, rows)
+	if plan.sample > 0 {
+		rows = sampleRows(rows, plan.sample)
+		result.Sampled = true
+	}
+	if source := plan.Operations[0].unnest; source != nil {
+		unnested, err := unnestRows(ctx, rows, source)
+
+		if err != nil {
+			return QueryResult{}, err
+		}
+		rows = unnested
+	}
+
+	if plan.hasJoins() {
+		rows = names.qualifyAll(table.Name, rows)
+	}
 
 	for _, op := range plan.Operations {
+		if err := queryCheckpoint(ctx, 0); err != nil {
+			return QueryResult{}, err
+		}
+
 		switch op.Type {
+		case JoinOp:
+			right, _ := db.queryTable(op.Table)
+			if err := db.checkKeys(&right); err != nil {
+				return QueryResult{}, err
+			}
+			joined, scanned, err := joinRows(ctx, rows, &right, op, names, includeDeleted, db.readTransform(ctx, &right))
+
+			if err != nil {
+				return QueryResult{}, inClause("Join", err)
+			}
+			rows = joined
+			result.scanned += scanned
 		case Filter:
-			rows = filterRows(rows, op.Filter)
+			filtered, err := parallelFilterRows(ctx, rows, op.filterExpr, plan.ParallelScans)
+
+			if err != nil {
+				return QueryResult{}, inClause("Where", err)
+			}
+			rows = scoreRows(filtered, op.filterExpr)
 		case Project:
 			result.Columns = op.Columns
-			rows = projectRows(rows, op.Columns)
+			projected, err := projectRows(ctx, rows, op.projections)
+
+			if err != nil {
+				return QueryResult{}, inClause("Select", err)
+			}
+			rows = projected
+			result.ColumnTypes = resultTypes(op.projections, types, rows)
+		case Aggregate, CountOp:
+			// A CountOp is only reached here for a sampled query; the
+			// sample is counted as any aggregate is, and then scaled.
+			result.Columns = op.Columns
+			aggregated, err := aggregateRows(ctx, rows, op.projections)
+
+			if err != nil {
+				return QueryResult{}, inClause("Select", err)
+			}
+			if plan.sample > 0 {
+				scaleAggregates(aggregated[0], op.projections, plan.sample)
+			}
+			rows = aggregated
+			result.ColumnTypes = resultTypes(op.projections, types, rows)
 		case Sort:
-			sortRows(rows, op.Order)
+			sorted, err := sortRows(rows, op.orderKeys)
+
+			if err != nil {
+				return QueryResult{}, inClause("OrderBy", err)
+			}
+			rows = sorted
 		case LimitOp:
-			if len(rows) > op.Limit {
+			rows = rows[min(op.Offset, len(rows)):]
+			if op.Limit > 0 && len(rows) > op.Limit {
 				rows = rows[:op.Limit]
 			}
 		}
@@ -112,43 +430,39 @@ func (db *NewDatabase) executeplan(plan ExecutionPlan) (QueryResult, error) {
 	return result, nil
 }
 
-func filterRows(rows []Row, filter string) []Row {
+func filterRows(ctx context.Context, rows []Row, filter expr) ([]Row, error) {
 	var filtered []Row
 
-	for _, row := range rows {
-		if evaluateFilter(row, filter) {
+	for i, row := range rows {
+		if err := queryCheckpoint(ctx, i); err != nil {
+			return nil, err
+		}
+
+		matched, err := evaluateFilter(row, filter)
+
+		if err != nil {
+			return nil, err
+		}
+		if matched {
 			filtered = append(filtered, row)
 		}
 	}
 
-	return filtered
+	return filtered, nil
 }
 
-func evaluateFilter(row Row, filter string) bool {
-	return true
+func (db *NewDatabase) BeginTransaction() (*Transaction, error) {
+	return db.BeginTransactionWithOptions(TransactionOptions{})
 }
 
-func projectRows(rows []Row, columns []string) []Row {
-	var projected []Row
-	for _, row := range rows {
-		newRow := Row{Columns: make(map[string]interface{})}
-		for _, col := range columns {
-			if val, ok := row.Columns[col]; ok {
-				newRow.Columns[col] = val
-			}
-		}
-		projected = append(projected, newRow)
-	}
-	return projected
-}
+func (db *NewDatabase) BeginTransactionWithOptions(opts TransactionOptions) (*Transaction, error) {
+	done, err := db.startOp()
 
-func sortRows(rows []Row, _ string) {
-	sort.Slice(rows, func(i, j int) bool {
-		return true
-	})
-}
+	if err != nil {
+		return nil, err
+	}
+	defer done()
 
-func (db *NewDatabase) BeginTransaction() (*Transaction, error) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -156,20 +470,74 @@ func (db *NewDatabase) BeginTransaction() (*Transaction, error) {
 		ID:        generateTransactionID(),
 		Status:    Pending,
 		StartedAt: time.Now(),
+		Options:   opts,
 	}
 
+	db.txMu.Lock()
+	if db.transactions == nil {
+		db.transactions = make(map[*Transaction]struct{})
+	}
+	db.transactions[transaction] = struct{}{}
+	db.txMu.Unlock()
+
+	db.metrics.transaction(MetricBegin)
 	return transaction, nil
 }
 
+// CommitTransaction applies the transaction's pending operations atomically.
+// It first waits for the exclusive lock on each row they write, as
+// UpdateRow does, except that the locks the transaction holds itself do
+// not stop it. If a lock cannot be taken, or any operation or deferred
+// constraint check fails, nothing is applied, the transaction is rolled
+// back and the failure is returned.
 func (db *NewDatabase) CommitTransaction(transaction *Transaction) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	unlockRows, lockErr := db.lockPendingRows(transaction)
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	if transaction.Status != Pending {
+		if lockErr == nil {
+			unlockRows()
+		}
 		return ErrTransactionFailed
 	}
+	if lockErr != nil {
+		db.endTransaction(transaction, RolledBack, 0)
+		return fmt.Errorf("%w: %w", ErrTransactionFailed, lockErr)
+	}
+	defer unlockRows()
+
+	start := time.Now()
+	staged, applied, err := db.stagePending(transaction.PendingOps, transaction.Options.DeferConstraints, true)
+
+	if err != nil {
+		db.endTransaction(transaction, RolledBack, 0)
+		return fmt.Errorf("%w: %w", ErrTransactionFailed, err)
+	}
+
+	for name, table := range staged {
+		db.Tables[name] = *table
+		db.compactIfNeeded(name)
+	}
+	for _, change := range applied {
+		db.publishApplied(change)
+	}
+
+	db.endTransaction(transaction, Committed, time.Since(start))
 
-	transaction.Status = Committed
+	for _, change := range applied {
+		if err := db.runHooks(HookAfter, change.hookContext()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -181,7 +549,7 @@ func (db *NewDatabase) RollbackTransaction(transaction *Transaction) error {
 		return ErrTransactionFailed
 	}
 
-	transaction.Status = RolledBack
+	db.endTransaction(transaction, RolledBack, 0)
 	return nil
 }
 
@@ -189,18 +557,65 @@ func generateTransactionID() int {
 	return time.Now().Nanosecond()
 }
 
+// InsertRow adds a row holding the columns in data. A key with a nil value
+// stores the column as NULL, which a non-nullable column rejects. A column
+// with no key in data is set to its Default, evaluated as the row is
+// inserted, and is otherwise left missing (see Row), which only a nullable
+// column allows. Rows already stored may still miss a column added to the
+// table later; updates leave such columns missing.
 func (db *NewDatabase) InsertRow(tableName, id string, data map[string]interface{}) error {
+	return db.InsertRowWithOptions(tableName, id, data, WriteOptions{})
+}
+
+func (db *NewDatabase) InsertRowWithOptions(tableName, id string, data map[string]interface{}, opts WriteOptions) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	start := time.Now()
+	if !db.bufferWrite(PendingOperation{Op: ChangeInsert, TableName: tableName, RowID: id, Data: data, Actor: opts.Actor}) {
+		_, err = db.insertRow(tableName, id, data, opts)
+	}
+
+	db.metrics.observe(MetricInsert, start, err, 0)
+	return err
+}
+
+// InsertRowReturning is InsertRow, returning the row as stored, with
+// defaults and coercions applied and its Version set. It is never
+// buffered, since the row must be known before it returns.
+func (db *NewDatabase) InsertRowReturning(tableName, id string, data map[string]interface{}) (Row, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return Row{}, err
+	}
+	defer done()
+
+	start := time.Now()
+	row, err := db.insertRow(tableName, id, data, WriteOptions{})
+	db.metrics.observe(MetricInsert, start, err, 0)
+	return row, err
+}
+
+// insertRow inserts the row and returns a copy of it, decrypted.
+func (db *NewDatabase) insertRow(tableName, id string, data map[string]interface{}, opts WriteOptions) (Row, error) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	table, ok := db.Tables[tableName]
 
-	if !ok {
-		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	if !ok || db.matViews[tableName] != nil {
+		return Row{}, db.notWritable(tableName)
 	}
 
-	if rowKeyExists(table.Rows, id) {
-		return fmt.Errorf("%w: %s in table %s", ErrIDExists, id, tableName)
+	table.ensureIndexes()
+
+	if existing, exists := table.getRow(id); exists && !table.revivable(existing) {
+		return Row{}, fmt.Errorf("%w: %s in table %s", ErrIDExists, id, tableName)
 	}
 
 	newRow := Row{
@@ -211,58 +626,469 @@ func (db *NewDatabase) InsertRow(tableName, id string, data map[string]interface
 	for key, value := range data {
 		newRow.Columns[key] = value
 	}
+	if err := table.applyDefaults(newRow); err != nil {
+		return Row{}, err
+	}
+	if err := db.coerceRow(&table, newRow); err != nil {
+		return Row{}, err
+	}
+
+	if err := db.runBeforeHooks(tableName, HookInsert, id, Row{}, newRow); err != nil {
+		return Row{}, err
+	}
+
+	if err := table.validateRow(newRow); err != nil {
+		return Row{}, err
+	}
+
+	if err := table.checkUnique(newRow, id); err != nil {
+		return Row{}, err
+	}
+
+	if err := db.checkForeignKeys(&table, newRow, nil, nil); err != nil {
+		return Row{}, err
+	}
 
-	table.Rows = append(table.Rows, newRow)
+	insert := appliedChange{op: ChangeInsert, tableName: tableName, id: id, newRow: newRow}
+	if err := db.checkTriggers(&table, insert, map[string]map[string]Row{tableName: {id: newRow}}, nil, anyTiming); err != nil {
+		return Row{}, err
+	}
+
+	inserted := copyRow(newRow)
+	newRow, err := db.sealRow(&table, newRow)
+
+	if err != nil {
+		return Row{}, err
+	}
+
+	existing, _ := table.getRow(id)
+	evicted, err := db.reserveMemory(&table, rowSize(newRow)-rowSize(existing), id, writeOrigin{actor: opts.Actor})
+
+	if err != nil {
+		return Row{}, err
+	}
+
+	newRow = table.putRow(newRow)
+	inserted.Version = newRow.Version
+	table.audit(AuditInsert, Row{}, newRow, writeOrigin{actor: opts.Actor})
 	db.Tables[tableName] = table
+	db.publishEvictions(tableName, evicted)
+	db.publishChange(ChangeInsert, tableName, id, Row{}, newRow)
 
-	return nil
+	return inserted, db.runHooks(HookAfter, HookContext{TableName: tableName, Op: HookInsert, RowID: id, NewRow: newRow})
 }
 
+// UpdateRow sets the columns in newData, a nil value setting the column to
+// NULL, and leaves the others as they were.
 func (db *NewDatabase) UpdateRow(tableName, id string, newData map[string]interface{}) error {
+	return db.UpdateRowWithOptions(tableName, id, newData, WriteOptions{})
+}
+
+func (db *NewDatabase) UpdateRowWithOptions(tableName, id string, newData map[string]interface{}, opts WriteOptions) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	start := time.Now()
+	if !db.bufferWrite(PendingOperation{Op: ChangeUpdate, TableName: tableName, RowID: id, Data: newData, Actor: opts.Actor}) {
+		_, err = db.updateRow(tableName, id, newData, opts, anyVersion)
+	}
+
+	db.metrics.observe(MetricUpdate, start, err, 0)
+	return err
+}
+
+// UpdateRowIfVersion updates the row only if its Version is still
+// expectedVersion, and fails with ErrVersionConflict otherwise. A client
+// that read the row, changed it and writes it back this way cannot
+// overwrite a change made in between. It is never buffered, since the
+// check must happen before it returns.
+func (db *NewDatabase) UpdateRowIfVersion(tableName, id string, expectedVersion int, newData map[string]interface{}) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	start := time.Now()
+	_, err = db.updateRow(tableName, id, newData, WriteOptions{}, expectedVersion)
+	db.metrics.observe(MetricUpdate, start, err, 0)
+	return err
+}
+
+// UpdateRowReturning is UpdateRow, returning the row as the update left
+// it: the old columns merged with newData, with its new Version. It is
+// never buffered, since the row must be known before it returns.
+func (db *NewDatabase) UpdateRowReturning(tableName, id string, newData map[string]interface{}) (Row, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return Row{}, err
+	}
+	defer done()
+
+	start := time.Now()
+	row, err := db.updateRow(tableName, id, newData, WriteOptions{}, anyVersion)
+	db.metrics.observe(MetricUpdate, start, err, 0)
+	return row, err
+}
+
+// anyVersion tells updateRow to skip the version check.
+const anyVersion = -1
+
+// updateRow updates the row and returns a copy of it as updated,
+// decrypted.
+func (db *NewDatabase) updateRow(tableName, id string, newData map[string]interface{}, opts WriteOptions, expectedVersion int) (Row, error) {
+	unlockRow, err := db.acquireRowLock(nil, tableName, id, true)
+
+	if err != nil {
+		return Row{}, err
+	}
+	defer unlockRow()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	table, ok := db.Tables[tableName]
 
+	if !ok || db.matViews[tableName] != nil {
+		return Row{}, db.notWritable(tableName)
+	}
+
+	table.ensureIndexes()
+
+	current, ok := table.getLiveRow(id)
+
 	if !ok {
-		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+		return Row{}, fmt.Errorf("%w: %s in table %s", ErrIDNotFound, id, tableName)
 	}
 
-	for i, row := range table.Rows {
-		if val, ok := row.Columns["id"].(string); ok && val == id {
-			for key, value := range newData {
-				table.Rows[i].Columns[key] = value
-			}
-			db.Tables[tableName] = table
-			return nil
-		}
+	if newID, ok := newData["id"]; ok && newID != id {
+		return Row{}, fmt.Errorf("%w: cannot change id of row %s", ErrInvalidQuery, id)
 	}
 
-	return fmt.Errorf("%w: %s in table %s", ErrIDNotFound, id, tableName)
+	if expectedVersion != anyVersion && current.Version != expectedVersion {
+		return Row{}, queryError(CodeWriteConflict, ErrVersionConflict, id, "row %s in table %s is at version %d, not %d", id, tableName, current.Version, expectedVersion)
+	}
+
+	updated, err := db.openRow(&table, current)
+
+	if err != nil {
+		return Row{}, err
+	}
+
+	updated = copyRow(updated)
+	for key, value := range newData {
+		updated.Columns[key] = value
+	}
+	if err := db.coerceRow(&table, updated); err != nil {
+		return Row{}, err
+	}
+
+	if err := db.runBeforeHooks(tableName, HookUpdate, id, current, updated); err != nil {
+		return Row{}, err
+	}
+
+	if err := table.validateRow(updated); err != nil {
+		return Row{}, err
+	}
+
+	if err := table.checkUnique(updated, id); err != nil {
+		return Row{}, err
+	}
+
+	if err := db.checkForeignKeys(&table, updated, nil, nil); err != nil {
+		return Row{}, err
+	}
+
+	pending := map[string]map[string]Row{tableName: {id: updated}}
+	if err := db.checkReferences(&table, []Row{current}, nil, pending); err != nil {
+		return Row{}, err
+	}
+
+	update := appliedChange{op: ChangeUpdate, tableName: tableName, id: id, oldRow: current, newRow: updated}
+	if err := db.checkTriggers(&table, update, pending, nil, anyTiming); err != nil {
+		return Row{}, err
+	}
+
+	result := copyRow(updated)
+	updated, err = db.sealRow(&table, updated)
+
+	if err != nil {
+		return Row{}, err
+	}
+
+	evicted, err := db.reserveMemory(&table, rowSize(updated)-rowSize(current), id, writeOrigin{actor: opts.Actor})
+
+	if err != nil {
+		return Row{}, err
+	}
+
+	updated = table.putRow(updated)
+	result.Version = updated.Version
+	table.audit(AuditUpdate, current, updated, writeOrigin{actor: opts.Actor})
+	db.Tables[tableName] = table
+	db.publishEvictions(tableName, evicted)
+	db.publishChange(ChangeUpdate, tableName, id, current, updated)
+
+	return result, db.runHooks(HookAfter, HookContext{TableName: tableName, Op: HookUpdate, RowID: id, OldRow: current, NewRow: updated})
 }
 
 func (db *NewDatabase) DeleteRow(tableName, id string) error {
+	return db.DeleteRowWithOptions(tableName, id, WriteOptions{})
+}
+
+func (db *NewDatabase) DeleteRowWithOptions(tableName, id string, opts WriteOptions) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	start := time.Now()
+	if !db.bufferWrite(PendingOperation{Op: ChangeDelete, TableName: tableName, RowID: id, Actor: opts.Actor}) {
+		_, err = db.deleteRow(tableName, id, opts)
+	}
+
+	db.metrics.observe(MetricDelete, start, err, 0)
+	return err
+}
+
+// DeleteRowReturning is DeleteRow, returning the row as it was before it
+// was deleted. It is never buffered, since the row must be known before
+// it returns.
+func (db *NewDatabase) DeleteRowReturning(tableName, id string) (Row, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return Row{}, err
+	}
+	defer done()
+
+	start := time.Now()
+	row, err := db.deleteRow(tableName, id, WriteOptions{})
+	db.metrics.observe(MetricDelete, start, err, 0)
+	return row, err
+}
+
+// deleteRow deletes the row and returns a copy of it as it was,
+// decrypted.
+func (db *NewDatabase) deleteRow(tableName, id string, opts WriteOptions) (Row, error) {
+	unlockRow, err := db.acquireRowLock(nil, tableName, id, true)
+
+	if err != nil {
+		return Row{}, err
+	}
+	defer unlockRow()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	table, ok := db.Tables[tableName]
 
+	if !ok || db.matViews[tableName] != nil {
+		return Row{}, db.notWritable(tableName)
+	}
+
+	table.ensureIndexes()
+
+	current, ok := table.getLiveRow(id)
+
 	if !ok {
-		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+		return Row{}, fmt.Errorf("%w: %s in table %s", ErrIDNotFound, id, tableName)
 	}
 
-	for i, row := range table.Rows {
-		if val, ok := row.Columns["id"].(string); ok && val == id {
-			table.Rows = append(table.Rows[:i], table.Rows[i+1:]...)
-			db.Tables[tableName] = table
-			return nil
+	if err := db.runHooks(HookBefore, HookContext{TableName: tableName, Op: HookDelete, RowID: id, OldRow: current}); err != nil {
+		return Row{}, err
+	}
+
+	pending := map[string]map[string]Row{tableName: {id: {}}}
+	if err := db.checkReferences(&table, []Row{current}, nil, pending); err != nil {
+		return Row{}, err
+	}
+
+	remove := appliedChange{op: ChangeDelete, tableName: tableName, id: id, oldRow: current}
+	if err := db.checkTriggers(&table, remove, pending, nil, anyTiming); err != nil {
+		return Row{}, err
+	}
+
+	deleted, err := db.openRow(&table, current)
+
+	if err != nil {
+		return Row{}, err
+	}
+	deleted = copyRow(deleted)
+
+	tombstone := table.removeRow(current)
+	table.audit(AuditDelete, current, tombstone, writeOrigin{actor: opts.Actor})
+	db.Tables[tableName] = table
+	db.publishChange(ChangeDelete, tableName, id, current, Row{})
+	db.compactIfNeeded(tableName)
+
+	return deleted, db.runHooks(HookAfter, HookContext{TableName: tableName, Op: HookDelete, RowID: id, OldRow: current})
+}
+
+// DeleteWhere deletes every row matching where and returns how many were
+// deleted. The matching rows are locked first, as by ForUpdate, and each is
+// checked against where again once locked, so rows changed in between are
+// only deleted if they still match. Before hooks run for every row before
+// any is deleted; a veto deletes nothing.
+func (db *NewDatabase) DeleteWhere(tableName, where string) (int, error) {
+	return db.DeleteWhereWithOptions(tableName, where, WriteOptions{})
+}
+
+func (db *NewDatabase) DeleteWhereWithOptions(tableName, where string, opts WriteOptions) (int, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	if strings.TrimSpace(where) == "" {
+		return 0, fmt.Errorf("%w: DeleteWhere needs a condition", ErrInvalidQuery)
+	}
+
+	filter, err := parseExpr(where)
+
+	if err != nil {
+		return 0, err
+	}
+
+	locked, err := db.ForUpdate(Query{Select: []string{"id"}, From: tableName, Where: where})
+
+	if err != nil {
+		return 0, err
+	}
+	defer locked.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok || db.matViews[tableName] != nil {
+		return 0, db.notWritable(tableName)
+	}
+
+	table.ensureIndexes()
+
+	var matched []Row
+	for _, row := range locked.Rows {
+		current, ok := table.getLiveRow(rowID(row))
+		if !ok {
+			continue
 		}
+
+		plain, err := db.openRow(&table, current)
+
+		if err != nil {
+			return 0, err
+		}
+
+		match, err := evaluateFilter(plain, filter)
+
+		if err != nil {
+			return 0, err
+		}
+		if !match {
+			continue
+		}
+
+		if err := db.runHooks(HookBefore, HookContext{TableName: tableName, Op: HookDelete, RowID: rowID(current), OldRow: current}); err != nil {
+			return 0, err
+		}
+		matched = append(matched, current)
+	}
+
+	removed := make(map[string]Row, len(matched))
+	for _, current := range matched {
+		removed[rowID(current)] = Row{}
+	}
+	pending := map[string]map[string]Row{tableName: removed}
+	if err := db.checkReferences(&table, matched, nil, pending); err != nil {
+		return 0, err
 	}
 
-	return fmt.Errorf("%w: %s in table %s", ErrIDNotFound, id, tableName)
+	if len(table.ConstraintTriggers) > 0 {
+		for _, current := range matched {
+			remove := appliedChange{op: ChangeDelete, tableName: tableName, id: rowID(current), oldRow: current}
+			if err := db.checkTriggers(&table, remove, pending, nil, anyTiming); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for _, current := range matched {
+		tombstone := table.removeRow(current)
+		table.audit(AuditDelete, current, tombstone, writeOrigin{actor: opts.Actor})
+	}
+	db.Tables[tableName] = table
+
+	for _, current := range matched {
+		db.publishChange(ChangeDelete, tableName, rowID(current), current, Row{})
+	}
+	db.compactIfNeeded(tableName)
+
+	for _, current := range matched {
+		if err := db.runHooks(HookAfter, HookContext{TableName: tableName, Op: HookDelete, RowID: rowID(current), OldRow: current}); err != nil {
+			return len(matched), err
+		}
+	}
+
+	return len(matched), nil
+}
+
+func (db *NewDatabase) TableExists(tableName string) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.Tables[tableName]
+	return ok
+}
+
+// RowExists reports whether tableName has a row with the given id. Like
+// GetRowByID it does not see soft-deleted rows.
+func (db *NewDatabase) RowExists(tableName, id string) (bool, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	_, exists := table.getLiveRow(id)
+	return exists, nil
 }
 
 func (db *NewDatabase) GetRowByID(tableName, id string) (Row, error) {
+	return db.GetRowByIDContext(context.Background(), tableName, id)
+}
+
+// GetRowByIDContext is GetRowByID for the principal of ctx: a row its
+// policies hide is reported as not found.
+func (db *NewDatabase) GetRowByIDContext(ctx context.Context, tableName, id string) (Row, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return Row{}, err
+	}
+	defer done()
+
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -272,9 +1098,14 @@ func (db *NewDatabase) GetRowByID(tableName, id string) (Row, error) {
 		return Row{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
 
-	for _, row := range table.Rows {
-		if val, ok := row.Columns["id"].(string); ok && val == id {
-			return row, nil
+	if row, ok := table.getLiveRow(id); ok {
+		row, err := db.openRow(&table, row)
+
+		if err != nil {
+			return Row{}, err
+		}
+		if rows := transformRows(db.readTransform(ctx, &table), []Row{row}); len(rows) > 0 {
+			return rows[0], nil
 		}
 	}
 
@@ -282,6 +1113,19 @@ func (db *NewDatabase) GetRowByID(tableName, id string) (Row, error) {
 }
 
 func (db *NewDatabase) GetAllRows(tableName string) ([]Row, error) {
+	return db.GetAllRowsContext(context.Background(), tableName)
+}
+
+// GetAllRowsContext is GetAllRows for the principal of ctx, returning only
+// the rows its policies allow.
+func (db *NewDatabase) GetAllRowsContext(ctx context.Context, tableName string) ([]Row, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -291,10 +1135,26 @@ func (db *NewDatabase) GetAllRows(tableName string) ([]Row, error) {
 		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
 
-	return table.Rows, nil
+	if err := db.checkKeys(&table); err != nil {
+		return nil, err
+	}
+	return transformRows(db.readTransform(ctx, &table), table.scanRows(false)), nil
 }
 
 func (db *NewDatabase) CountRows(tableName string) (int, error) {
+	return db.CountRowsContext(context.Background(), tableName)
+}
+
+// CountRowsContext is CountRows for the principal of ctx, counting only
+// the rows its policies allow.
+func (db *NewDatabase) CountRowsContext(ctx context.Context, tableName string) (int, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -304,28 +1164,74 @@ func (db *NewDatabase) CountRows(tableName string) (int, error) {
 		return 0, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
 
-	return len(table.Rows), nil
+	if visible := policyFilter(ctx, &table); visible != nil {
+		if err := db.checkKeys(&table); err != nil {
+			return 0, err
+		}
+		return len(db.readTransform(ctx, &table)(table.scanRows(false))), nil
+	}
+	return table.liveCount(), nil
 }
 
 func (db *NewDatabase) CreateTable(tableName string, columns []Column, indexes []Index) error {
+	return db.CreateTableWithOptions(tableName, columns, indexes, TableOptions{})
+}
+
+func (db *NewDatabase) CreateTableWithOptions(tableName string, columns []Column, indexes []Index, opts TableOptions) error {
+	return db.createTable(Table{
+		Name:    tableName,
+		Columns: columns,
+		Indexes: indexes,
+		Storage: opts.Storage,
+	})
+}
+
+// createTable validates and adds table, which must have no rows.
+func (db *NewDatabase) createTable(table Table) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	if _, exists := db.Tables[tableName]; exists {
-		return fmt.Errorf("%w: %s", ErrTableExists, tableName)
+	if _, exists := db.Tables[table.Name]; exists || db.metaTables[table.Name] != nil || db.views[table.Name] != nil {
+		return fmt.Errorf("%w: %s", ErrTableExists, table.Name)
 	}
 
-	db.Tables[tableName] = Table{
-		Name:    tableName,
-		Columns: columns,
-		Indexes: indexes,
-		Rows:    []Row{},
+	if err := validateSchema(table.Columns, table.Indexes); err != nil {
+		return fmt.Errorf("table %s: %w", table.Name, err)
+	}
+
+	checks, err := compileChecks(table.Name, table.Columns)
+
+	if err != nil {
+		return err
 	}
 
+	table.Rows = []Row{}
+	table.checks = checks
+	table.ensureIndexes()
+	db.Tables[table.Name] = table
+	db.replicateTable(table.Name)
+
 	return nil
 }
 
+// DropTable drops tableName. It refuses, with ErrForeignKey, to drop a
+// table that a foreign key in another table references, and with
+// ErrViewDependency one that a view reads; see DropTableCascade.
 func (db *NewDatabase) DropTable(tableName string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -333,15 +1239,127 @@ func (db *NewDatabase) DropTable(tableName string) error {
 		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
 
-	delete(db.Tables, tableName)
+	if refs := db.referencesTo(tableName); len(refs) > 0 {
+		return fmt.Errorf("%w: table %s is referenced by %s", ErrForeignKey, tableName, strings.Join(refs, ", "))
+	}
+	if views := db.viewsOn(tableName); len(views) > 0 {
+		return fmt.Errorf("%w: table %s is read by views %s", ErrViewDependency, tableName, strings.Join(views, ", "))
+	}
+
+	db.dropTableLocked(tableName)
 	return nil
 }
 
-func rowKeyExists(rows []Row, id string) bool {
-	for _, row := range rows {
-		if val, ok := row.Columns["id"].(string); ok && val == id {
-			return true
+// DropTableCascade drops tableName, first removing the foreign keys in
+// other tables that reference it and dropping the views that read it. The
+// referencing columns and their values are kept.
+func (db *NewDatabase) DropTableCascade(tableName string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.Tables[tableName]; !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	for name, table := range db.Tables {
+		if name == tableName {
+			continue
+		}
+
+		var columns []Column
+		for i, col := range table.Columns {
+			if col.ForeignKey == nil || col.ForeignKey.Table != tableName {
+				continue
+			}
+			if columns == nil {
+				columns = append([]Column(nil), table.Columns...)
+			}
+			columns[i].ForeignKey = nil
+		}
+
+		if columns != nil {
+			table.Columns = columns
+			table.touchSchema()
+			db.Tables[name] = table
+			db.replicateTable(name)
 		}
 	}
-	return false
+
+	db.dropViewsOn(tableName)
+	db.dropTableLocked(tableName)
+	return nil
+}
+
+func (db *NewDatabase) dropTableLocked(tableName string) {
+	delete(db.Tables, tableName)
+	delete(db.evictions, tableName)
+	db.leaveTableGroup(tableName)
+	db.forgetMatView(tableName)
+	db.forgetRollups(tableName)
+	db.forgetBuffer(tableName)
+	db.replicateTable(tableName)
+}
+
+// referencesTo lists, as table.column, the foreign keys in other tables
+// that reference tableName. The caller must hold db.mu.
+func (db *NewDatabase) referencesTo(tableName string) []string {
+	var refs []string
+	for name, table := range db.Tables {
+		if name == tableName {
+			continue
+		}
+		for _, col := range table.Columns {
+			if col.ForeignKey != nil && col.ForeignKey.Table == tableName {
+				refs = append(refs, name+"."+col.Name)
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+func (db *NewDatabase) ListTables() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	names := db.userTableNames()
+	if len(db.views) == 0 {
+		return names
+	}
+	for name := range db.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (db *NewDatabase) DescribeTable(tableName string) (TableSchema, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.views[tableName] != nil {
+		return db.describeView(tableName), nil
+	}
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return TableSchema{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	return TableSchema{
+		Name:         table.Name,
+		Columns:      table.Columns,
+		Indexes:      table.Indexes,
+		Storage:      table.Storage,
+		RowCount:     table.liveCount(),
+		Materialized: db.describeMatView(tableName),
+	}, nil
 }
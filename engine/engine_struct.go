@@ -1,6 +1,9 @@
 package engine
 
 import (
+	"fmt"
+	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -9,6 +12,81 @@ type NewDatabase struct {
 	Name   string
 	Tables map[string]Table
 	mu     sync.RWMutex
+
+	path         string
+	plannerMode  PlannerMode
+	rowLockMu    sync.Mutex
+	rowLocks     map[string]*rowLock
+	lockTimeout  time.Duration
+	queryTimeout time.Duration
+	migrateMu    sync.Mutex
+
+	watchMu   sync.Mutex
+	watchers  map[string][]*watcher
+	changeSeq uint64
+
+	hookMu sync.RWMutex
+	hooks  map[string][]*hook
+
+	Sequences map[string]*Sequence
+	seqMu     sync.Mutex
+
+	txMu         sync.Mutex
+	transactions map[*Transaction]struct{}
+	opCost       time.Duration
+
+	bufferMu sync.Mutex
+	buffers  map[string]*writeBuffer
+
+	janitorMu   sync.Mutex
+	janitorStop chan struct{}
+	janitorDone chan struct{}
+
+	logger *log.Logger
+
+	memoryLimit int64
+	evictions   map[string]EvictionPolicy
+
+	compactThreshold float64
+	compacting       map[string]bool
+
+	transformers map[string]func(Row) Row
+	keys         KeyProvider
+	coercion     CoercionMode
+
+	cacheMu sync.Mutex
+	cache   *QueryCache
+
+	rollupMu sync.Mutex
+	rollups  map[string][]*rollup
+
+	replicaMu sync.Mutex
+	replicas  []*replicaLink
+
+	metrics metrics
+
+	metaTables map[string]func(*NewDatabase) Table
+	// views holds the query each view stands for. Guarded by mu.
+	views map[string]*Query
+	// tableGroups holds the member tables of each table group, sorted.
+	// Guarded by mu.
+	tableGroups map[string][]string
+	// matViews holds the materialized views, whose contents are the
+	// tables of the same names. Guarded by mu.
+	matViews map[string]*matView
+
+	// fixtures maps each fixture to the tables it created. Guarded by mu.
+	fixtures map[string][]string
+
+	opsMu     sync.Mutex
+	closing   bool
+	activeOps int
+	drained   chan struct{}
+	opened    time.Time
+
+	// lagRates tracks how fast eventual consistency buffers fill and
+	// drain, for Healthz.
+	lagRates lagRates
 }
 
 type Table struct {
@@ -16,6 +94,209 @@ type Table struct {
 	Columns []Column
 	Indexes []Index
 	Rows    []Row
+	Storage StorageEngine
+
+	AuditEnabled bool
+	AuditLog     []AuditRecord
+	AuditOptions AuditOptions
+	// AuditFrom is when the audit log starts: every change since then is in
+	// AuditLog, and AsOf can go back no further.
+	AuditFrom time.Time
+
+	SoftDelete    bool
+	ReviveDeleted bool
+	HasExpiry     bool
+
+	PartitionColumn string
+	Partitioning    PartitionStrategy
+
+	// Policies limit which rows each principal can read; see CreatePolicy.
+	Policies []RowPolicy
+	// ConstraintTriggers check writes to the table; see
+	// CreateConstraintTrigger.
+	ConstraintTriggers []ConstraintTrigger
+
+	ids        map[string]int
+	partitions []map[string]struct{}
+	kv         *kvStore
+	indexData  map[string]map[string][]string
+	sizeBytes  int64
+	checks     []checkConstraint
+
+	writes         uint64
+	schema         uint64
+	deletedRows    int
+	garbageBytes   int64
+	reclaimedBytes int64
+}
+
+// StorageEngine selects how a table keeps its rows. KeyValueStorage keeps
+// them in a map keyed by id and leaves Table.Rows empty; scans see the rows
+// ordered by id.
+type StorageEngine int
+
+const (
+	SliceStorage StorageEngine = iota
+	KeyValueStorage
+)
+
+type TableOptions struct {
+	Storage StorageEngine
+}
+
+// PartitionStrategy describes how CreatePartitionedTable divides a table.
+// RangePartition uses Bounds, ascending values of the partition column: n
+// bounds make n+1 partitions, partition i holding the values from
+// Bounds[i-1] up to but excluding Bounds[i]. The first partition also holds
+// everything below Bounds[0] and NULLs, and the last everything from
+// Bounds[n-1] up.
+type PartitionStrategy struct {
+	Type   PartitionType
+	Bounds []interface{}
+}
+
+type PartitionType int
+
+const (
+	RangePartition PartitionType = iota
+)
+
+// PartitionInfo describes one partition. Lower and Upper are its bounds,
+// nil where it is unbounded; Rows counts the rows it holds.
+type PartitionInfo struct {
+	Number int
+	Lower  interface{}
+	Upper  interface{}
+	Rows   int
+}
+
+// RowDiff is what an update would do to a row, as previewed by RowDiff.
+// Changed holds the columns whose values would change, Unchanged the
+// names of the row's columns that would keep theirs, and Added the
+// columns the row does not have yet. Checks and UniqueIndexes name the
+// check constraints and unique indexes that read a changed or added
+// column, in schema order.
+type RowDiff struct {
+	Changed       map[string]ColumnChange
+	Unchanged     []string
+	Added         map[string]interface{}
+	Checks        []string
+	UniqueIndexes []string
+}
+
+type ColumnChange struct {
+	Old interface{}
+	New interface{}
+}
+
+type AuditRecord struct {
+	TxID      int64
+	Actor     string
+	Op        string
+	OldRow    Row
+	NewRow    Row
+	Timestamp time.Time
+}
+
+// AuditOptions bounds a table's audit log. Records older than Retention,
+// and the oldest records beyond MaxEntries, are dropped as new ones are
+// written. Zero values mean no limit.
+type AuditOptions struct {
+	Retention  time.Duration
+	MaxEntries int
+}
+
+// AuditFilter selects audit records. Empty fields match everything; Since
+// and Until bound Timestamp inclusively.
+type AuditFilter struct {
+	TableName string
+	RowID     string
+	Op        string
+	Actor     string
+	Since     time.Time
+	Until     time.Time
+}
+
+type AuditEntry struct {
+	TableName string
+	RowID     string
+	AuditRecord
+}
+
+// QueryOptions configures ExecuteQueryWithOptions. Parallelism is the
+// number of goroutines WHERE filtering is split over; the rows returned
+// and their order are the same for every value. Tables too small to
+// benefit are filtered on one goroutine regardless.
+type QueryOptions struct {
+	Parallelism int
+}
+
+// AsyncOptions configures ExecuteQueryAsyncWithOptions. A positive PageSize
+// streams the result as a sequence of QueryResults of at most PageSize rows
+// each; zero sends it whole.
+type AsyncOptions struct {
+	PageSize int
+}
+
+// WriteOptions carries per-write metadata. Actor is recorded in the audit
+// log.
+type WriteOptions struct {
+	Actor string
+}
+
+// SoftDeleteOptions configures EnableSoftDelete. With ReviveOnInsert,
+// inserting the id of a soft-deleted row replaces it with the new row;
+// otherwise the insert fails with ErrIDExists.
+type SoftDeleteOptions struct {
+	ReviveOnInsert bool
+}
+
+// TableSchema describes a table, or a view if View is set to the query it
+// stands for; a view has no indexes or row count. Materialized is set for
+// a materialized view.
+type TableSchema struct {
+	Name         string
+	Columns      []Column
+	Indexes      []Index
+	Storage      StorageEngine
+	RowCount     int
+	View         *Query
+	Materialized *MaterializedView
+}
+
+// MaterializedView describes a materialized view: the query it holds the
+// result of, when that was last computed, and whether a table it reads has
+// changed since.
+type MaterializedView struct {
+	Query       Query
+	Refresh     MatViewRefresh
+	RefreshedAt time.Time
+	Stale       bool
+}
+
+// MatViewOptions configures CreateMaterializedView. Columns names the
+// view's columns, one per SELECT item of its query; by default they are
+// named after the items.
+type MatViewOptions struct {
+	Refresh MatViewRefresh
+	Columns []string
+}
+
+// SchemaDefinition is the schema of a set of tables, in name order.
+type SchemaDefinition struct {
+	Tables []TableSchema
+}
+
+// QueryCapture records a query, its result or error, the plan it ran with
+// and the schema of the tables it read, as CaptureQuery found them at
+// ResultAt.
+type QueryCapture struct {
+	Query    Query
+	ResultAt time.Time
+	Result   QueryResult
+	Err      string
+	Schema   SchemaDefinition
+	Plan     ExecutionPlan
 }
 
 type IndexEntry struct {
@@ -24,14 +305,84 @@ type IndexEntry struct {
 }
 
 type Column struct {
-	Name     string
-	DataType DataType
-	Nullable bool
+	Name       string
+	DataType   DataType
+	Nullable   bool
+	Check      string
+	CheckName  string
+	ForeignKey *ForeignKey
+	// ElementType is the type of every element of an Array column.
+	ElementType DataType
+	// Precision and Scale bound a Decimal column: at most Precision
+	// digits, Scale of them after the decimal point. A Precision of 0
+	// allows the most, 18. Values are stored at exactly Scale digits; one
+	// with more is rounded half away from zero if RoundDecimals is set and
+	// rejected otherwise.
+	Precision     int
+	Scale         int
+	RoundDecimals bool
+	// Default fills the column when an insert leaves it out: a value of
+	// the column's type, or a DefaultFunc such as Now().
+	Default interface{}
+	// EnumValues are the values an Enum column allows, lowest first.
+	// AddEnumValues extends them.
+	EnumValues []string
+	// Encrypted columns are stored encrypted with AES-256-GCM under the
+	// key the database's KeyProvider gives for EncryptionKeyID; see
+	// SetKeyProvider. They cannot be indexed, be a foreign key or be
+	// referenced by one, or partition a table.
+	Encrypted       bool
+	EncryptionKeyID string
+	// Collation is how the values of a String column compare in filters,
+	// ORDER BY and indexes. See AlterColumnCollation. An ORDER BY term
+	// can override it with COLLATE BINARY, NOCASE or NATURAL.
+	Collation Collation
+}
+
+// Collation is a way of comparing strings.
+type Collation int
+
+const (
+	// BinaryCollation compares strings byte by byte.
+	BinaryCollation Collation = iota
+	// CaseInsensitiveCollation compares strings with Unicode simple case
+	// folding, so "Åse", "åse" and "ÅSE" are equal. Strings that differ
+	// only in case sort in no particular order among themselves.
+	CaseInsensitiveCollation
+	// NaturalCollation orders runs of digits by their numeric value and
+	// the rest byte by byte, so "item2" sorts before "item10" and
+	// "item02" next to "item2". Strings are equal only if their bytes are.
+	NaturalCollation
+)
+
+// KeyProvider supplies the 32-byte AES keys of encrypted columns. Key is
+// called with the database's lock held and must not call back into it.
+type KeyProvider interface {
+	Key(id string) ([]byte, error)
+}
+
+// ForeignKey requires every non-NULL value of the column to match Column in
+// some row of Table. An empty Column refers to the id. The rows of Table a
+// value matches cannot all be deleted, or changed, while it is there.
+type ForeignKey struct {
+	Table  string
+	Column string
 }
 
 type Index struct {
 	Name    string
 	Columns []string
+	Unique  bool
+	// Inverted indexes a single Array column by each of its elements, so
+	// that CONTAINS filters on the column look rows up rather than scan
+	// the table. An inverted index cannot be Unique.
+	Inverted bool
+	// FullText indexes a single String column by each of the words
+	// tokenize finds in it, except Stopwords, so that MATCH filters on the
+	// column look rows up rather than scan the table. A full-text index
+	// cannot be Unique.
+	FullText  bool
+	Stopwords []string
 }
 
 type DataType int
@@ -40,26 +391,228 @@ const (
 	Int DataType = iota
 	Float
 	String
+	// DateTime values are time.Time, kept to the nanosecond with their
+	// offset. Writes also accept RFC 3339 strings, and comparing one with
+	// a string such as '2024-01-01T00:00:00Z' reads the string as a
+	// date-time.
 	DateTime
 	Bool
+	// Array values are stored as []interface{} whose elements are all of
+	// the column's ElementType. They encode as JSON arrays, in CSV too.
+	// Filters test them with CONTAINS, CONTAINS ANY (...) and CONTAINS
+	// ALL (...), which an Inverted index can answer.
+	Array
+	// JSON values are objects or arrays as decoded by encoding/json:
+	// map[string]interface{} or []interface{}, nested to any depth, of
+	// bools, numbers, strings and nils. Queries reach into them with paths
+	// such as profile.address.city or items[0].sku; a missing path reads
+	// as NULL.
+	JSON
+	// Decimal values are DecimalValues, held exactly at the column's Scale.
+	// +, - and * with another decimal, an integer or a literal such as 0.1
+	// are exact; / and a Float operand give a float64.
+	Decimal
+	// Enum values are strings drawn from the column's EnumValues. Compared
+	// with each other or with strings in WHERE, and in ORDER BY, they
+	// follow the declared order rather than the text.
+	Enum
 )
 
+func (t DataType) String() string {
+	switch t {
+	case Int:
+		return "Int"
+	case Float:
+		return "Float"
+	case String:
+		return "String"
+	case DateTime:
+		return "DateTime"
+	case Bool:
+		return "Bool"
+	case Array:
+		return "Array"
+	case JSON:
+		return "JSON"
+	case Decimal:
+		return "Decimal"
+	case Enum:
+		return "Enum"
+	default:
+		return fmt.Sprintf("DataType(%d)", int(t))
+	}
+}
+
+// DefaultFunc is a Column Default computed as each row is inserted.
+type DefaultFunc string
+
+// DecimalValue is an exact decimal number, Units divided by 10 to the
+// power Scale: {Units: 1999, Scale: 2} is 19.99. It marshals to JSON as a
+// string so that no digits are lost to float64.
+type DecimalValue struct {
+	Units int64
+	Scale int
+}
+
+// Row is a table row. Version starts at 1 when the row is inserted and
+// increases by one with every change to it; see UpdateRowIfVersion.
+//
+// A column may be NULL, held in Columns with a nil value, or missing, not
+// held at all. Both read as NULL in queries, so IS NULL matches either;
+// the difference shows in Columns and in projected results, where a
+// missing column is left out.
 type Row struct {
 	Columns map[string]interface{}
+	Version int
 }
 
+// Query is a SELECT. From names a table, or one of these table-valued
+// functions:
+//
+//   - generate_series(start, stop[, step]); see GenerateSeriesSpec.
+//   - unnest(table.column) [AS alias], which reads table and yields one row
+//     per element of each row's array in column, holding the row's columns
+//     plus the element as alias (by default unnest). In joins these columns
+//     are qualified by table.
+//
+// Expressions may refer to parameters $1, $2 and so on, which take their
+// values from Args; see also Prepare.
+//
+// Offset skips that many rows of the result before Limit applies; a zero
+// Limit returns all the rest.
+//
+// Without OrderBy, rows come back in scan order, which never depends on map
+// iteration, so the same query over the same rows always returns them in
+// the same order. Scan order is insertion order for SliceStorage tables,
+// where an update keeps the row's place, and id order for KeyValueStorage
+// tables. generate_series counts from start to stop, unnest keeps the
+// table's order and then each array's, and a join keeps the order of the
+// left rows, with each row's matches in the joined table's scan order.
 type Query struct {
-	Select  []string
-	From    string
-	Where   string
-	OrderBy string
-	Limit   int
+	Select         []string
+	From           string
+	Joins          []Join
+	Where          string
+	OrderBy        string
+	Limit          int
+	Offset         int
+	IncludeDeleted bool
+	GenerateSeries *GenerateSeriesSpec
+	NoCache        bool
+	Args           []interface{}
+}
+
+// AlterOp is a change to one column of a table, as AlterColumn makes:
+// Column becomes NewType, its values converted by Migrate or, if Migrate
+// is nil, as CAST would.
+type AlterOp struct {
+	Column  string
+	NewType DataType
+	Migrate func(interface{}) (interface{}, error)
+}
+
+// Page is one page of a query's result, as returned by PaginateQuery.
+// Page numbers start at 1; TotalRows and TotalPages count the whole
+// result.
+type Page struct {
+	Rows       []Row
+	Columns    []string
+	TotalRows  int
+	Page       int
+	PageSize   int
+	TotalPages int
+	HasNext    bool
+	HasPrev    bool
+}
+
+// AggregateExpr is an aggregate for AggregateQuery: Func, one of COUNT,
+// SUM, AVG, MIN and MAX, of Column. A COUNT with no Column counts rows.
+type AggregateExpr struct {
+	Func   string
+	Column string
+}
+
+// GenerateSeriesSpec makes a query read a generated series instead of a
+// table, as does a From of generate_series(start, stop, step). The series
+// has a single column, value; in a query with joins its columns are
+// qualified by generate_series.
+type GenerateSeriesSpec struct {
+	Start interface{}
+	Stop  interface{}
+	Step  interface{}
+}
+
+// Join pairs each row produced so far with the rows of Table for which the
+// On expression holds (an inner join). In a query with joins, every column
+// is available as table.column, and also by its bare name when no other
+// table in the query has a column of that name.
+type Join struct {
+	Table string
+	On    string
 }
 
 type ExecutionPlan struct {
+	Mode       PlannerMode
 	Operations []Operation
+	// ParallelScans is how many goroutines each Filter is split over; 0
+	// or 1 filters on the query's own goroutine.
+	ParallelScans int
+
+	params int
+	sample float64
 }
 
+// PlannerMode says how queries are planned where the planner has a choice
+// to make. The modes differ only in how fast a query runs, never in its
+// result.
+type PlannerMode int
+
+const (
+	// RuleBased applies fixed rules: a join probes an index on its key
+	// whenever there is one, and the ANDed conjuncts of a filter run most
+	// selective first.
+	RuleBased PlannerMode = iota
+	// CostBased estimates costs from the row counts and indexes of the
+	// tables: a join probes an index only when that is cheaper than a
+	// nested loop, and conjuncts run in order of evaluation cost per row
+	// rejected, so that a cheap test goes before a costly one that is
+	// only a little more selective.
+	CostBased
+	// Heuristic picks join strategies as CostBased does and orders
+	// conjuncts as RuleBased does.
+	Heuristic
+)
+
+// CoercionMode says which values a write converts to the type of their
+// column before checking them against the schema. In either mode:
+//
+//   - a float64 with no fractional part and within range becomes an
+//     int64 in an Int column, as JSON numbers decode to float64;
+//   - an integer becomes a float64 in a Float column if it is exactly
+//     representable, that is within ±2^53;
+//   - an integer, a finite float64 or a decimal string such as "19.99"
+//     becomes a DecimalValue in a Decimal column, a float64 by its
+//     shortest decimal text;
+//   - an RFC 3339 string, or a date such as "2024-01-02", becomes a
+//     time.Time in a DateTime column;
+//   - the elements of an Array value are converted to its ElementType in
+//     the same way.
+//
+// LenientCoercion also parses text: a base-10 integer string such as "42"
+// becomes an int64 in an Int column, a decimal number string such as
+// "1.5" or "-2e3" a float64 in a Float column, and exactly "true" or
+// "false" a bool in a Bool column. A value that converts only with a loss
+// (1.5 or 1e20 for an Int, 2^53+1 for a Float) or that is ambiguous (" 42",
+// "1.0" or "0x10" for an Int, "NaN" for a Float, "TRUE" or "1" for a Bool)
+// is rejected with ErrSchemaViolation; any other value is stored as given
+// and must already match its column.
+type CoercionMode int
+
+const (
+	StrictCoercion CoercionMode = iota
+	LenientCoercion
+)
+
 type Operation struct {
 	Type     OperationType
 	Table    string
@@ -67,9 +620,24 @@ type Operation struct {
 	Filter   string
 	Order    string
 	Limit    int
+	Offset   int
 	Parent   *Operation
 	Children []*Operation
 	Result   chan Row
+	Strategy string
+	// Selectivity is, for a Filter in a plan made by CaptureQuery or
+	// PlanReplay, the estimated fraction of its input rows it keeps.
+	Selectivity float64
+
+	orderKeys      []orderKey
+	filterExpr     expr
+	includeDeleted bool
+	series         *GenerateSeriesSpec
+	unnest         *unnestSource
+	joinProbe      expr
+	joinColumn     string
+	joinIndex      string
+	projections    []projection
 }
 
 type OperationType int
@@ -80,14 +648,199 @@ const (
 	Project
 	Sort
 	LimitOp
+	Aggregate
+	CountOp
+	JoinOp
+)
+
+func (c Collation) String() string {
+	switch c {
+	case BinaryCollation:
+		return "binary"
+	case CaseInsensitiveCollation:
+		return "case-insensitive"
+	case NaturalCollation:
+		return "natural"
+	default:
+		return fmt.Sprintf("Collation(%d)", int(c))
+	}
+}
+
+func (m CoercionMode) String() string {
+	switch m {
+	case StrictCoercion:
+		return "strict"
+	case LenientCoercion:
+		return "lenient"
+	default:
+		return fmt.Sprintf("CoercionMode(%d)", int(m))
+	}
+}
+
+func (a AggregateExpr) String() string {
+	if a.Column == "" {
+		return strings.ToUpper(a.Func) + "(*)"
+	}
+	return strings.ToUpper(a.Func) + "(" + a.Column + ")"
+}
+
+func (r MatViewRefresh) String() string {
+	switch r {
+	case RefreshManual:
+		return "manual"
+	case RefreshOnChange:
+		return "on_change"
+	case RefreshOnRead:
+		return "on_read"
+	default:
+		return fmt.Sprintf("MatViewRefresh(%d)", int(r))
+	}
+}
+
+func (t TriggerTiming) String() string {
+	switch t {
+	case TriggerImmediate:
+		return "immediate"
+	case TriggerDeferred:
+		return "deferred"
+	default:
+		return fmt.Sprintf("TriggerTiming(%d)", int(t))
+	}
+}
+
+func (t OperationType) String() string {
+	switch t {
+	case Scan:
+		return "SCAN"
+	case Filter:
+		return "FILTER"
+	case Project:
+		return "PROJECT"
+	case Sort:
+		return "SORT"
+	case LimitOp:
+		return "LIMIT"
+	case Aggregate:
+		return "AGGREGATE"
+	case CountOp:
+		return "COUNT"
+	case JoinOp:
+		return "JOIN"
+	default:
+		return fmt.Sprintf("OperationType(%d)", int(t))
+	}
+}
+
+// Join strategies, as reported in Operation.Strategy.
+const (
+	NestedLoopJoin = "nested loop"
+	IndexJoin      = "index join"
 )
 
 type Transaction struct {
-	ID        int
-	Status    TransactionStatus
-	StartedAt time.Time
+	ID         int
+	Status     TransactionStatus
+	StartedAt  time.Time
+	Locks      []UnlockFunc
+	Options    TransactionOptions
+	PendingOps []PendingOperation
+
+	// pending holds, by table and id, the rows PendingOps leave as
+	// bufferOp checked them, an empty row standing for a deleted one.
+	pending map[string]map[string]Row
+}
+
+// TransactionPlan describes a pending transaction; see ExplainTransaction.
+type TransactionPlan struct {
+	TxID            int
+	Operations      []string
+	Tables          []string
+	Rows            map[string][]string
+	EstimatedCommit time.Duration
+	Conflicts       []TransactionConflict
+}
+
+// TransactionConflict is a row that another pending transaction also writes.
+type TransactionConflict struct {
+	TxID      int
+	TableName string
+	RowID     string
+}
+
+type TransactionOptions struct {
+	DeferConstraints bool
+	Actor            string
 }
 
+type PendingOperation struct {
+	Op        ChangeOp
+	TableName string
+	RowID     string
+	Data      map[string]interface{}
+	Actor     string
+
+	txID int64
+}
+
+type UnlockFunc func()
+
+// TableHandle reads and writes one table on behalf of WithTableLock, which
+// holds the database lock meanwhile. It must not be used once the func it
+// was passed to has returned.
+type TableHandle struct {
+	db    *NewDatabase
+	table string
+}
+
+// HistoricalTable is a read-only copy of a table as it stood at At, made
+// by AsOf. Later writes to the table do not change it.
+type HistoricalTable struct {
+	At    time.Time
+	db    *NewDatabase
+	table string
+}
+
+// RowPolicy lets Principal read only the rows of a table for which Filter,
+// a WHERE expression, is true.
+type RowPolicy struct {
+	Name      string
+	Principal string
+	Filter    string
+}
+
+// ConstraintTrigger rejects a write to its table if Check, a
+// SELECT COUNT(*) query, counts any rows once the write is made.
+type ConstraintTrigger struct {
+	Name   string
+	Check  string
+	Timing TriggerTiming
+}
+
+// TriggerTiming says when a constraint trigger checks a write made in a
+// transaction. TriggerImmediate checks it as it is made, as other
+// constraints are unless the transaction defers them; TriggerDeferred
+// checks it at commit, against the state the whole transaction leaves.
+// Writes outside transactions are checked as they are made either way.
+type TriggerTiming int
+
+const (
+	TriggerImmediate TriggerTiming = iota
+	TriggerDeferred
+)
+
+// MatViewRefresh says when a materialized view is recomputed besides on
+// RefreshView. RefreshOnChange recomputes it in the background after each
+// committed change to a table it reads, so a read just after a write may
+// still see the old contents; RefreshOnRead recomputes it when it is read
+// after such a change.
+type MatViewRefresh int
+
+const (
+	RefreshManual MatViewRefresh = iota
+	RefreshOnChange
+	RefreshOnRead
+)
+
 type TransactionStatus int
 
 const (
@@ -96,11 +849,441 @@ const (
 	RolledBack
 )
 
+// QueryResult holds the rows a query produced. ColumnTypes gives the type
+// of each of Columns, taken from the schema for plain columns and inferred
+// for computed and aggregate ones.
 type QueryResult struct {
-	Columns []string
-	Rows    []Row
+	Columns     []string
+	ColumnTypes []DataType
+	Rows        []Row
+	Unlock      UnlockFunc `json:"-"`
+	// Sampled is set on results of SampleQuery.
+	Sampled bool
+
+	scanned int
+}
+
+type Migration interface {
+	Version() int
+	Description() string
+	Up(db *NewDatabase) error
+}
+
+type AppliedMigration struct {
+	Version     int
+	Description string
+	AppliedAt   time.Time
+}
+
+type ChangeOp int
+
+const (
+	ChangeInsert ChangeOp = iota
+	ChangeUpdate
+	ChangeDelete
+	ChangeOverflow
+)
+
+// ChangeEvent describes a committed write. TxID is the ID of the
+// transaction that made it, or zero for a write outside one.
+type ChangeEvent struct {
+	Seq       uint64
+	Op        ChangeOp
+	TableName string
+	RowID     string
+	OldRow    Row
+	NewRow    Row
+	TxID      int64
+	Timestamp time.Time
+}
+
+type WatchOptions struct {
+	BufferSize int
+}
+
+// TableWatcher is a subscription made by WatchTable. Events arrive on C,
+// which is closed once the context the subscription was made with is done.
+type TableWatcher struct {
+	C <-chan ChangeEvent
+	w *watcher
+}
+
+type HookTime int
+
+const (
+	HookBefore HookTime = iota
+	HookAfter
+)
+
+type HookOp int
+
+const (
+	HookInsert HookOp = iota
+	HookUpdate
+	HookDelete
+)
+
+// HookContext describes the write a hook is called for. Before insert and
+// update hooks may modify NewRow.Columns in place to change the row that is
+// written; OldRow is empty for inserts and NewRow is empty for deletes.
+// The rows are decrypted copies, and changing them otherwise has no
+// effect on what is stored.
+type HookContext struct {
+	TableName string
+	Op        HookOp
+	RowID     string
+	OldRow    Row
+	NewRow    Row
+}
+
+// Sequence is a named counter. Current is the value most recently returned
+// by NextVal.
+type Sequence struct {
+	Name      string
+	Current   int64
+	Increment int64
+	Min       int64
+	Max       int64
+	Cycle     bool
+
+	start   int64
+	started bool
+}
+
+// SequenceSession reads sequences on behalf of one client, like a SQL
+// session: CurrVal gives the value the session's own NextVal last
+// returned, not one since handed to another client. It is not safe for
+// concurrent use; give each goroutine its own.
+type SequenceSession struct {
+	db   *NewDatabase
+	last map[string]int64
+}
+
+// SequenceOptions configures CreateSequence. A zero Increment means 1. When
+// Min and Max are both zero the sequence is bounded only by the int64 range
+// and Start defaults to 1, or -1 for descending sequences; otherwise Start
+// defaults to Min, or Max for descending sequences.
+type SequenceOptions struct {
+	Name      string
+	Start     *int64
+	Increment int64
+	Min       int64
+	Max       int64
+	Cycle     bool
+}
+
+type CRDTType int
+
+const (
+	GCounter CRDTType = iota
+	PNCounter
+	LWWRegister
+	ORSet
+)
+
+func (t CRDTType) String() string {
+	switch t {
+	case GCounter:
+		return "GCounter"
+	case PNCounter:
+		return "PNCounter"
+	case LWWRegister:
+		return "LWWRegister"
+	case ORSet:
+		return "ORSet"
+	default:
+		return fmt.Sprintf("CRDTType(%d)", int(t))
+	}
+}
+
+// CRDT is a handle on a conflict-free replicated data type stored in a
+// database. It holds no state itself: every operation reads and writes the
+// stored state, so any number of handles on the same CRDT stay consistent.
+type CRDT struct {
+	Name string
+	Type CRDTType
+
+	db    *NewDatabase
+	actor string
+}
+
+// Snapshot is a point-in-time copy of some tables of a database; see
+// CreatePartialSnapshot. Each table is copied under its own read lock, so
+// the tables are individually consistent but need not reflect the same
+// moment.
+type Snapshot struct {
+	Tables  map[string]Table
+	TakenAt time.Time
+}
+
+// RollupSpec configures CreateRollupTable. Rows are grouped into buckets by
+// TimeColumn truncated to a multiple of BucketInterval, and each column in
+// AggregateColumns is aggregated per bucket. The rollup table is recomputed
+// every RefreshInterval, or every BucketInterval if RefreshInterval is
+// zero.
+type RollupSpec struct {
+	TimeColumn       string
+	BucketInterval   time.Duration
+	AggregateColumns map[string]AggFunc
+	RefreshInterval  time.Duration
+}
+
+type AggFunc int
+
+const (
+	AggSum AggFunc = iota
+	AggAvg
+	AggMin
+	AggMax
+	AggCount
+)
+
+// EvictionPolicy chooses rows to drop from a table when a write to it would
+// exceed the memory limit. It is given the table's rows in scan order and
+// the number of bytes that must be freed, and returns the ids to evict.
+type EvictionPolicy func(rows []Row, need int64) []string
+
+type DatabaseStats struct {
+	Tables         map[string]TableStats
+	TotalBytes     int64
+	MemoryLimit    int64
+	ReclaimedBytes int64
+	QueryCache     QueryCacheStats
+}
+
+// MetricsSnapshot is returned by Metrics. Queries counts every query,
+// including those answered from the cache and those run by ForUpdate and
+// DeleteWhere; RowsScanned counts the rows they read from tables. Inserts,
+// Updates and Deletes count the single-row write methods; writes made in a
+// transaction are counted by the transaction counters instead.
+type MetricsSnapshot struct {
+	Queries OperationMetrics
+	Inserts OperationMetrics
+	Updates OperationMetrics
+	Deletes OperationMetrics
+
+	TransactionsBegun      uint64
+	TransactionsCommitted  uint64
+	TransactionsRolledBack uint64
+
+	RowsScanned uint64
+	CacheHits   uint64
+	CacheMisses uint64
+
+	Tables map[string]TableStats
+}
+
+// OperationMetrics counts one kind of operation, and those of them that
+// returned an error.
+type OperationMetrics struct {
+	Count   uint64
+	Errors  uint64
+	Latency LatencyHistogram
+}
+
+// LatencyHistogram counts operations by how long they took. Counts[i] is
+// the number that took at most Bounds[i] (and more than Bounds[i-1]); the
+// last entry of Counts, one past the end of Bounds, counts the slower ones.
+// Sum is the total time taken.
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Sum    time.Duration
+}
+
+// MetricsObserver receives an event for every operation Metrics counts; see
+// SetMetricsObserver.
+type MetricsObserver interface {
+	Observe(event MetricEvent)
+}
+
+// MetricEvent describes one operation. Latency, Err and RowsScanned are
+// zero for transaction events.
+type MetricEvent struct {
+	Op          MetricOp
+	Latency     time.Duration
+	Err         error
+	RowsScanned int
+}
+
+type MetricOp int
+
+const (
+	MetricQuery MetricOp = iota
+	MetricInsert
+	MetricUpdate
+	MetricDelete
+	MetricBegin
+	MetricCommit
+	MetricRollback
+)
+
+func (op MetricOp) String() string {
+	switch op {
+	case MetricQuery:
+		return "query"
+	case MetricInsert:
+		return "insert"
+	case MetricUpdate:
+		return "update"
+	case MetricDelete:
+		return "delete"
+	case MetricBegin:
+		return "begin"
+	case MetricCommit:
+		return "commit"
+	case MetricRollback:
+		return "rollback"
+	default:
+		return fmt.Sprintf("MetricOp(%d)", int(op))
+	}
+}
+
+// QueryCacheOptions bounds the query result cache. Zero values mean 1000
+// entries and 64 MiB. A positive TTL also drops each entry once it is that
+// old; zero keeps entries until they are evicted or invalidated.
+type QueryCacheOptions struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL        time.Duration
+}
+
+// QueryCacheStats reports the query result cache's size, estimated as for
+// table memory, and how many lookups it has answered since it was enabled.
+type QueryCacheStats struct {
+	Entries int
+	Bytes   int64
+	Hits    uint64
+	Misses  uint64
+}
+
+// TableStats describes one table. Bytes is an estimate of the memory its
+// rows use, and ReclaimedBytes of the memory compaction has returned since
+// the table was loaded.
+type TableStats struct {
+	Rows           int
+	Bytes          int64
+	Indexes        int
+	ReclaimedBytes int64
 }
 
+// QueryError describes why a query could not be planned or run, or why a
+// write lost a conflict. It wraps one of the package's sentinel errors, so
+// errors.Is against ErrInvalidQuery, ErrTableNotFound and the rest works
+// as before.
 type QueryError struct {
+	Code    ErrorCode
 	Message string
+	// Token is the offending token, column, table or operator, if any.
+	Token string
+	// Clause is the part of the query the error was found in: "Select",
+	// "From", "Join", "Where" or "OrderBy", or empty if it is not known.
+	Clause string
+	// Position is the byte offset of Token in the clause's text, or -1.
+	Position int
+	Err      error
+}
+
+type ErrorCode int
+
+const (
+	CodeInternal ErrorCode = iota
+	CodeSyntaxError
+	CodeUnknownTable
+	CodeUnknownColumn
+	CodeUnknownFunction
+	CodeTypeMismatch
+	CodeDivisionByZero
+	CodeInvalidArgument
+	CodeQueryTimeout
+	CodeWriteConflict
+	CodeResourceExhausted
+)
+
+func (c ErrorCode) String() string {
+	switch c {
+	case CodeInternal:
+		return "internal"
+	case CodeSyntaxError:
+		return "syntax_error"
+	case CodeUnknownTable:
+		return "unknown_table"
+	case CodeUnknownColumn:
+		return "unknown_column"
+	case CodeUnknownFunction:
+		return "unknown_function"
+	case CodeTypeMismatch:
+		return "type_mismatch"
+	case CodeDivisionByZero:
+		return "division_by_zero"
+	case CodeInvalidArgument:
+		return "invalid_argument"
+	case CodeQueryTimeout:
+		return "query_timeout"
+	case CodeWriteConflict:
+		return "write_conflict"
+	case CodeResourceExhausted:
+		return "resource_exhausted"
+	default:
+		return fmt.Sprintf("ErrorCode(%d)", int(c))
+	}
+}
+
+// MatchType says which source rows a MergeClause applies to: those with a
+// matching target row, or those without one.
+type MatchType int
+
+const (
+	WhenMatched MatchType = iota
+	WhenNotMatched
+)
+
+func (m MatchType) String() string {
+	switch m {
+	case WhenMatched:
+		return "WHEN MATCHED"
+	case WhenNotMatched:
+		return "WHEN NOT MATCHED"
+	default:
+		return fmt.Sprintf("MatchType(%d)", int(m))
+	}
+}
+
+// MergeOp is what a MergeAction does to the target table. MergeSkip, the
+// zero value, means the clause does not apply, and the next clause is
+// tried.
+type MergeOp int
+
+const (
+	MergeSkip MergeOp = iota
+	MergeUpdate
+	MergeDelete
+	MergeInsert
+)
+
+// MergeAction is the result of a MergeClause's Action. Data holds the
+// columns to set for MergeUpdate and the new row for MergeInsert.
+type MergeAction struct {
+	Op   MergeOp
+	Data map[string]interface{}
+}
+
+// MergeClause is one WHEN clause of Merge. Action is called with the
+// matched target row, empty for WhenNotMatched, and the source row; it
+// plays the part of both the AND condition and the THEN action.
+type MergeClause struct {
+	Match  MatchType
+	Action func(target, source Row) (MergeAction, error)
+}
+
+type MergeResult struct {
+	Inserted int
+	Updated  int
+	Deleted  int
+}
+
+// TestingT is the part of *testing.T that AssertTableEquals uses.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	Helper()
 }
@@ -0,0 +1,293 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTableExists(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+
+	if !db.TableExists("items") {
+		t.Error("TableExists(items) = false")
+	}
+	if db.TableExists("missing") {
+		t.Error("TableExists(missing) = true")
+	}
+	if err := db.DropTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	if db.TableExists("items") {
+		t.Error("TableExists(items) = true after DropTable")
+	}
+}
+
+func TestRowExists(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	mustInsert(t, db, "items", "a", map[string]interface{}{"n": 1})
+	mustInsert(t, db, "items", "b", map[string]interface{}{"n": 2})
+
+	for id, want := range map[string]bool{"a": true, "b": true, "c": false} {
+		exists, err := db.RowExists("items", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != want {
+			t.Errorf("RowExists(items, %s) = %v, want %v", id, exists, want)
+		}
+	}
+
+	if err := db.DeleteRow("items", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := db.RowExists("items", "a"); err != nil || exists {
+		t.Errorf("RowExists after DeleteRow = %v, %v, want false", exists, err)
+	}
+
+	if err := db.EnableSoftDelete("items", SoftDeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRow("items", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := db.RowExists("items", "b"); err != nil || exists {
+		t.Errorf("RowExists of a soft-deleted row = %v, %v, want false", exists, err)
+	}
+
+	if _, err := db.RowExists("missing", "a"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("RowExists(missing) = %v, want ErrTableNotFound", err)
+	}
+}
+
+func TestUpdateRowIfVersionRejectsStaleClient(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "accounts", []Column{{Name: "balance", DataType: Int}}, nil)
+	mustInsert(t, db, "accounts", "a", map[string]interface{}{"balance": 100})
+
+	// Both clients read the row before either writes it.
+	alice, err := db.GetRowByID("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.GetRowByID("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newBalance := toInt64(alice.Columns["balance"]) + 10
+	if err := db.UpdateRowIfVersion("accounts", "a", alice.Version, map[string]interface{}{"balance": newBalance}); err != nil {
+		t.Fatalf("first client's update: %v", err)
+	}
+
+	newBalance = toInt64(bob.Columns["balance"]) - 50
+	err = db.UpdateRowIfVersion("accounts", "a", bob.Version, map[string]interface{}{"balance": newBalance})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale client's update = %v, want ErrVersionConflict", err)
+	}
+
+	row, err := db.GetRowByID("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toInt64(row.Columns["balance"]) != 110 {
+		t.Fatalf("balance = %v, want the first client's 110", row.Columns["balance"])
+	}
+	if row.Version != alice.Version+1 {
+		t.Fatalf("version = %d, want %d", row.Version, alice.Version+1)
+	}
+
+	// Re-reading lets the second client retry.
+	if err := db.UpdateRowIfVersion("accounts", "a", row.Version, map[string]interface{}{"balance": toInt64(row.Columns["balance"]) - 50}); err != nil {
+		t.Fatalf("retry with the current version: %v", err)
+	}
+}
+
+// fkTestDB returns a database whose orders.customer references customers.
+func fkTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "customers", []Column{{Name: "name", DataType: String}}, nil)
+	mustCreateTable(t, db, "orders", []Column{
+		{Name: "customer", DataType: String, ForeignKey: &ForeignKey{Table: "customers"}},
+	}, nil)
+	mustInsert(t, db, "customers", "c1", map[string]interface{}{"name": "Ann"})
+	mustInsert(t, db, "orders", "o1", map[string]interface{}{"customer": "c1"})
+	return db
+}
+
+func TestDropTableRefusesReferencedTable(t *testing.T) {
+	db := fkTestDB(t)
+
+	err := db.DropTable("customers")
+	if !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("DropTable(customers) = %v, want ErrForeignKey", err)
+	}
+	if !strings.Contains(err.Error(), "orders") {
+		t.Errorf("error %q does not name the dependent table", err)
+	}
+	if !db.TableExists("customers") {
+		t.Fatal("DropTable dropped the referenced table")
+	}
+}
+
+func TestDropTableCascade(t *testing.T) {
+	db := fkTestDB(t)
+	if err := db.CreateView("ann", Query{Select: []string{"id"}, From: "customers", Where: "name = 'Ann'"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DropTableCascade("customers"); err != nil {
+		t.Fatal(err)
+	}
+	if db.TableExists("customers") {
+		t.Fatal("DropTableCascade left the table")
+	}
+	if _, err := db.ExecuteQuery(Query{Select: []string{"id"}, From: "ann"}); err == nil {
+		t.Error("the view reading the dropped table is still queryable")
+	}
+
+	schema, err := db.DescribeTable("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fk := schema.Columns[0].ForeignKey; fk != nil {
+		t.Errorf("orders.customer still references %s", fk.Table)
+	}
+	row, err := db.GetRowByID("orders", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Columns["customer"] != "c1" {
+		t.Errorf("orders.customer = %v, want the value kept", row.Columns["customer"])
+	}
+	mustInsert(t, db, "orders", "o2", map[string]interface{}{"customer": "anyone"})
+
+	if err := db.DropTableCascade("customers"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("DropTableCascade of a missing table = %v, want ErrTableNotFound", err)
+	}
+}
+
+func TestExplicitNullAndMissingColumn(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "people", []Column{
+		{Name: "name", DataType: String},
+		{Name: "email", DataType: String, Nullable: true},
+	}, nil)
+	mustInsert(t, db, "people", "null", map[string]interface{}{"name": "Ann", "email": nil})
+	mustInsert(t, db, "people", "missing", map[string]interface{}{"name": "Bob"})
+	mustInsert(t, db, "people", "set", map[string]interface{}{"name": "Cy", "email": "cy@example.com"})
+
+	for id, wantKey := range map[string]bool{"null": true, "missing": false} {
+		row, err := db.GetRowByID("people", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, ok := row.Columns["email"]
+		if ok != wantKey || val != nil {
+			t.Errorf("row %s: email = %v, %v, want nil, %v", id, val, ok, wantKey)
+		}
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: "email IS NULL", OrderBy: "id"})
+	if got := strings.Join(resultIDs(result), ","); got != "missing,null" {
+		t.Errorf("IS NULL matched %s, want missing,null", got)
+	}
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: "email IS NOT NULL"})
+	if got := strings.Join(resultIDs(result), ","); got != "set" {
+		t.Errorf("IS NOT NULL matched %s, want set", got)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id", "email"}, From: "people", Where: "email IS NULL", OrderBy: "id"})
+	if _, ok := result.Rows[0].Columns["email"]; ok {
+		t.Error("projection of a missing column holds it")
+	}
+	if _, ok := result.Rows[1].Columns["email"]; !ok {
+		t.Error("projection of an explicit NULL leaves it out")
+	}
+
+	// Updating to nil stores NULL; updating other columns leaves it missing.
+	if err := db.UpdateRow("people", "set", map[string]interface{}{"email": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRow("people", "missing", map[string]interface{}{"name": "Bo"}); err != nil {
+		t.Fatal(err)
+	}
+	for id, wantKey := range map[string]bool{"set": true, "missing": false} {
+		row, err := db.GetRowByID("people", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val, ok := row.Columns["email"]; ok != wantKey || val != nil {
+			t.Errorf("row %s after UpdateRow: email = %v, %v, want nil, %v", id, val, ok, wantKey)
+		}
+	}
+
+	if err := db.InsertRow("people", "bad", map[string]interface{}{"name": nil}); err == nil {
+		t.Error("InsertRow with an explicit NULL in a non-nullable column succeeded")
+	}
+	if err := db.InsertRow("people", "noname", map[string]interface{}{"email": "x@example.com"}); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("InsertRow leaving out a non-nullable column = %v, want ErrSchemaViolation", err)
+	}
+
+	// A default fills the column before it is checked.
+	mustCreateTable(t, db, "tickets", []Column{{Name: "status", DataType: String, Default: "new"}}, nil)
+	mustInsert(t, db, "tickets", "t1", nil)
+	if row, _ := db.GetRowByID("tickets", "t1"); row.Columns["status"] != "new" {
+		t.Errorf("status = %v, want the default", row.Columns["status"])
+	}
+}
+
+func TestMutationsReturningRows(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{
+		{Name: "name", DataType: String},
+		{Name: "qty", DataType: Int},
+		{Name: "status", DataType: String, Default: "new"},
+	}, nil)
+
+	row, err := db.InsertRowReturning("items", "a", map[string]interface{}{"name": "bolt", "qty": 3.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Version != 1 || row.Columns["status"] != "new" || row.Columns["qty"] != int64(3) || rowID(row) != "a" {
+		t.Errorf("InsertRowReturning = %+v, want the stored row with default and coercion applied", row)
+	}
+
+	row, err = db.UpdateRowReturning("items", "a", map[string]interface{}{"qty": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Version != 2 || row.Columns["name"] != "bolt" || toInt64(row.Columns["qty"]) != 5 || row.Columns["status"] != "new" {
+		t.Errorf("UpdateRowReturning = %+v, want the old columns merged with qty 5 at version 2", row)
+	}
+
+	// The returned row is a copy.
+	row.Columns["name"] = "changed"
+	stored, err := db.GetRowByID("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Columns["name"] != "bolt" {
+		t.Error("changing the returned row changed the table")
+	}
+
+	row, err = db.DeleteRowReturning("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Version != 2 || row.Columns["name"] != "bolt" || toInt64(row.Columns["qty"]) != 5 {
+		t.Errorf("DeleteRowReturning = %+v, want the row as it was before the delete", row)
+	}
+	if exists, _ := db.RowExists("items", "a"); exists {
+		t.Error("DeleteRowReturning did not delete the row")
+	}
+
+	if _, err := db.UpdateRowReturning("items", "a", map[string]interface{}{"qty": 1}); !errors.Is(err, ErrIDNotFound) {
+		t.Errorf("UpdateRowReturning of a deleted row = %v, want ErrIDNotFound", err)
+	}
+	if _, err := db.DeleteRowReturning("items", "a"); !errors.Is(err, ErrIDNotFound) {
+		t.Errorf("DeleteRowReturning of a deleted row = %v, want ErrIDNotFound", err)
+	}
+}
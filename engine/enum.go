@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// enumExpr reads the value of x as its position among values, so that
+// comparing two enumExprs follows the declared order. A value that is not
+// one of values is left as it is, and so equals no enum value.
+type enumExpr struct {
+	x      expr
+	values []string
+}
+
+func (e enumExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+	return enumOrdinal(val, e.values), nil
+}
+
+func (e enumExpr) String() string {
+	return e.x.String()
+}
+
+// enumOrdinal returns the position of val among values as an int64, or val
+// itself if it is not one of them.
+func enumOrdinal(val interface{}, values []string) interface{} {
+	if s, ok := val.(string); ok {
+		for i, v := range values {
+			if v == s {
+				return int64(i)
+			}
+		}
+	}
+	return val
+}
+
+func (c Column) enumOrdinal(val string) int {
+	for i, v := range c.EnumValues {
+		if v == val {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkEnumValues rejects an Enum column without values or with a value
+// listed twice, and EnumValues on a column of any other type.
+func checkEnumValues(col Column) error {
+	switch {
+	case col.DataType == Array && col.ElementType == Enum:
+		return fmt.Errorf("%w: column %s is an array of enums", ErrInvalidSchema, col.Name)
+	case col.DataType != Enum && len(col.EnumValues) > 0:
+		return fmt.Errorf("%w: column %s of type %s has enum values", ErrInvalidSchema, col.Name, col.DataType)
+	case col.DataType == Enum && len(col.EnumValues) == 0:
+		return fmt.Errorf("%w: enum column %s has no values", ErrInvalidSchema, col.Name)
+	}
+
+	seen := make(map[string]bool, len(col.EnumValues))
+	for _, v := range col.EnumValues {
+		if seen[v] {
+			return fmt.Errorf("%w: enum column %s lists %q twice", ErrInvalidSchema, col.Name, v)
+		}
+		seen[v] = true
+	}
+	return nil
+}
+
+func enumList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
+
+// AddEnumValues appends values to the end of an Enum column's EnumValues,
+// so they sort after the existing ones. Stored rows are not rewritten.
+func (db *NewDatabase) AddEnumValues(tableName, columnName string, values ...string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	columns := append([]Column(nil), table.Columns...)
+	pos := -1
+	for i, col := range columns {
+		if col.Name == columnName {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return fmt.Errorf("%w: table %s has no column %s", ErrInvalidSchema, tableName, columnName)
+	}
+	if columns[pos].DataType != Enum {
+		return fmt.Errorf("%w: column %s of table %s is not an enum", ErrInvalidSchema, columnName, tableName)
+	}
+
+	columns[pos].EnumValues = append(append([]string(nil), columns[pos].EnumValues...), values...)
+	if err := checkEnumValues(columns[pos]); err != nil {
+		return fmt.Errorf("table %s: %w", tableName, err)
+	}
+
+	table.Columns = columns
+	table.touchSchema()
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+	return nil
+}
+
+// columnEnums maps the names columnTypes gives Enum columns to their
+// values. The caller must hold db.mu.
+func (db *NewDatabase) columnEnums(plan ExecutionPlan, names joinNames) map[string][]string {
+	enums := make(map[string][]string)
+	joined := plan.hasJoins()
+
+	for _, op := range plan.Operations {
+		if (op.Type != Scan && op.Type != JoinOp) || op.series != nil {
+			continue
+		}
+
+		table, _ := db.queryTable(op.Table)
+		for _, col := range table.Columns {
+			if col.DataType != Enum {
+				continue
+			}
+			if !joined {
+				enums[col.Name] = col.EnumValues
+				continue
+			}
+			enums[table.Name+"."+col.Name] = col.EnumValues
+			if !names.ambiguous[col.Name] {
+				enums[col.Name] = col.EnumValues
+			}
+		}
+	}
+	return enums
+}
+
+// bindEnums returns plan with its filters and sort keys comparing the Enum
+// columns in enums by their declared order.
+func (plan ExecutionPlan) bindEnums(enums map[string][]string) ExecutionPlan {
+	if len(enums) == 0 {
+		return plan
+	}
+
+	ops := append([]Operation(nil), plan.Operations...)
+	for i, op := range ops {
+		switch op.Type {
+		case Filter:
+			ops[i].filterExpr = bindEnumExpr(op.filterExpr, enums)
+		case Sort:
+			keys := append([]orderKey(nil), op.orderKeys...)
+			for j, key := range keys {
+				keys[j].enum = enums[key.col.name]
+			}
+			ops[i].orderKeys = keys
+		}
+	}
+	plan.Operations = ops
+	return plan
+}
+
+// bindEnumExpr wraps both sides of each comparison, and all three operands
+// of each BETWEEN, that involve an Enum column in enumExprs.
+func bindEnumExpr(e expr, enums map[string][]string) expr {
+	values := func(x expr) []string {
+		if col, ok := x.(columnExpr); ok {
+			return enums[col.name]
+		}
+		return nil
+	}
+
+	bound, _ := rewriteExpr(e, func(e expr) (expr, error) {
+		switch e := e.(type) {
+		case binaryExpr:
+			switch e.op {
+			case "=", "!=", "<", "<=", ">", ">=":
+			default:
+				return e, nil
+			}
+			v := values(e.left)
+			if v == nil {
+				v = values(e.right)
+			}
+			if v != nil {
+				e.left, e.right = enumExpr{x: e.left, values: v}, enumExpr{x: e.right, values: v}
+			}
+			return e, nil
+		case betweenExpr:
+			if v := values(e.x); v != nil {
+				e.x, e.lo, e.hi = enumExpr{x: e.x, values: v}, enumExpr{x: e.lo, values: v}, enumExpr{x: e.hi, values: v}
+			}
+			return e, nil
+		}
+		return e, nil
+	})
+	return bound
+}
+
+// encodeEnums returns rows with the values of t's Enum columns replaced by
+// their positions in EnumValues, the form in which tables are saved.
+func (t *Table) encodeEnums(rows []Row) []Row {
+	var enums []Column
+	for _, col := range t.Columns {
+		if col.DataType == Enum {
+			enums = append(enums, col)
+		}
+	}
+	if enums == nil {
+		return rows
+	}
+
+	encoded := make([]Row, len(rows))
+	for i, row := range rows {
+		row = copyRow(row)
+		for _, col := range enums {
+			s, ok := row.Columns[col.Name].(string)
+			if n := col.enumOrdinal(s); ok && n >= 0 {
+				row.Columns[col.Name] = int64(n)
+			}
+		}
+		encoded[i] = row
+	}
+	return encoded
+}
+
+// decodeEnums reverses encodeEnums on t's rows, in place.
+func (t *Table) decodeEnums() error {
+	for _, col := range t.Columns {
+		if col.DataType != Enum {
+			continue
+		}
+		for _, row := range t.Rows {
+			n, ok := row.Columns[col.Name].(int64)
+			if !ok {
+				continue
+			}
+			if n < 0 || n >= int64(len(col.EnumValues)) {
+				return fmt.Errorf("%w: row %s holds enum value %d of column %s, which has %d values", ErrSchemaViolation, rowID(row), n, col.Name, len(col.EnumValues))
+			}
+			row.Columns[col.Name] = col.EnumValues[n]
+		}
+	}
+	return nil
+}
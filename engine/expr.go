@@ -0,0 +1,1129 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// expr is a compiled filter or projection expression. Evaluation follows SQL
+// three-valued logic: comparisons involving NULL yield nil, and a filter
+// only matches when its expression yields true.
+type expr interface {
+	eval(row Row) (interface{}, error)
+	String() string
+}
+
+type scalarFunc func(args []interface{}) (interface{}, error)
+
+var scalarFuncs = map[string]scalarFunc{
+	"YEAR":      dateField("YEAR", time.Time.Year),
+	"MONTH":     dateField("MONTH", func(t time.Time) int { return int(t.Month()) }),
+	"DAY":       dateField("DAY", time.Time.Day),
+	"HOUR":      dateField("HOUR", time.Time.Hour),
+	"DATE_ADD":  dateAdd,
+	"DATE_DIFF": dateDiff,
+	"UPPER":     stringFunc("UPPER", func(s string) interface{} { return strings.ToUpper(s) }),
+	"LOWER":     stringFunc("LOWER", func(s string) interface{} { return strings.ToLower(s) }),
+	"TRIM":      stringFunc("TRIM", func(s string) interface{} { return strings.TrimSpace(s) }),
+	"LTRIM":     stringFunc("LTRIM", func(s string) interface{} { return strings.TrimLeftFunc(s, unicode.IsSpace) }),
+	"RTRIM":     stringFunc("RTRIM", func(s string) interface{} { return strings.TrimRightFunc(s, unicode.IsSpace) }),
+	"LENGTH":    stringFunc("LENGTH", length),
+	"CONCAT":    concat,
+	"SUBSTRING": substring,
+	"REPLACE":   replace,
+	"ABS":       numberFunc("ABS", absInt, math.Abs),
+	"CEIL":      numberFunc("CEIL", sameInt, math.Ceil),
+	"FLOOR":     numberFunc("FLOOR", sameInt, math.Floor),
+	"ROUND":     round,
+	"MOD":       mod,
+	"SQRT":      sqrt,
+	"POW":       pow,
+
+	"ARRAY_LENGTH":   arrayLength,
+	"ARRAY_CONTAINS": arrayContains,
+	"ARRAY_APPEND":   arrayAppend,
+	"ARRAY_REMOVE":   arrayRemove,
+	"JSON_EXTRACT":   jsonExtract,
+	"JSON_CONTAINS":  jsonContains,
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+type columnExpr struct {
+	name string
+	// paths are the ways name can be read as a JSON path into a column,
+	// tried when the row has no column called name.
+	paths []columnPath
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+type betweenExpr struct {
+	x, lo, hi expr
+	not       bool
+}
+
+type likeExpr struct {
+	x       expr
+	pattern string
+	re      *regexp.Regexp
+	not     bool
+}
+
+type funcExpr struct {
+	name string
+	args []expr
+	fn   scalarFunc
+}
+
+func evaluateFilter(row Row, filter expr) (bool, error) {
+	val, err := filter.eval(row)
+
+	if err != nil {
+		return false, err
+	}
+
+	matched, _ := val.(bool)
+	return matched, nil
+}
+
+func (e literalExpr) eval(Row) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e literalExpr) String() string {
+	switch v := e.value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (e columnExpr) eval(row Row) (interface{}, error) {
+	val, _ := e.lookup(row)
+	return val, nil
+}
+
+// lookup returns the value of the column e names or, if the row has no
+// such column, of the JSON path it names; ok is false if neither is there.
+func (e columnExpr) lookup(row Row) (interface{}, bool) {
+	if val, ok := row.Columns[e.name]; ok || e.paths == nil {
+		return val, ok
+	}
+	for _, path := range e.paths {
+		if doc, ok := row.Columns[path.column]; ok {
+			return walkJSON(doc, path.steps)
+		}
+	}
+	return nil, false
+}
+
+func (e columnExpr) String() string {
+	return e.name
+}
+
+func (e unaryExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil || val == nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "NOT":
+		b, ok := val.(bool)
+		if !ok {
+			return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, "NOT", "NOT applied to %T", val)
+		}
+		return !b, nil
+	default:
+		switch n := val.(type) {
+		case float32, float64:
+			return -toFloat(n), nil
+		case DecimalValue:
+			return DecimalValue{Units: -n.Units, Scale: n.Scale}, nil
+		default:
+			if valueKind(n) != kindNumber {
+				return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, "-", "cannot negate %T", val)
+			}
+			return -toInt64(n), nil
+		}
+	}
+}
+
+func (e unaryExpr) String() string {
+	if e.op == "NOT" {
+		return "NOT " + e.x.String()
+	}
+	return e.op + e.x.String()
+}
+
+func (e binaryExpr) eval(row Row) (interface{}, error) {
+	left, err := e.left.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "AND", "OR":
+		return e.evalLogical(row, left)
+	}
+
+	right, err := e.right.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	switch e.op {
+	case "+", "-", "*", "/", "%":
+		// A literal such as 0.1 meant as money stays exact next to a
+		// decimal, rather than pulling the result into float64.
+		if isDecimal(right) {
+			left = exactLiteral(e.left, left)
+		}
+		if isDecimal(left) {
+			right = exactLiteral(e.right, right)
+		}
+		return arithmetic(e.op, left, right)
+	}
+
+	return compareOp(e.op, left, right)
+}
+
+// compareOp applies a comparison operator to two non-nil values. Values of
+// different kinds are never equal, except that a string compared with a
+// DateTime is read as a date-time.
+func compareOp(op string, left, right interface{}) (interface{}, error) {
+	left, right = timeOperands(left, right)
+	if valueKind(left) != valueKind(right) {
+		return op == "!=", nil
+	}
+
+	c := compareOrdered(left, right)
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown operator %s", ErrInvalidQuery, op)
+}
+
+func (e binaryExpr) evalLogical(row Row, left interface{}) (interface{}, error) {
+	l, lok := left.(bool)
+	if left != nil && !lok {
+		return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, e.op, "%s applied to %T", e.op, left)
+	}
+
+	if lok && l == (e.op == "OR") {
+		return l, nil
+	}
+
+	right, err := e.right.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r, rok := right.(bool)
+	if right != nil && !rok {
+		return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, e.op, "%s applied to %T", e.op, right)
+	}
+
+	if rok && r == (e.op == "OR") {
+		return r, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func (e binaryExpr) String() string {
+	return "(" + e.left.String() + " " + e.op + " " + e.right.String() + ")"
+}
+
+func (e isNullExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+	return (val == nil) != e.not, nil
+}
+
+func (e isNullExpr) String() string {
+	if e.not {
+		return e.x.String() + " IS NOT NULL"
+	}
+	return e.x.String() + " IS NULL"
+}
+
+func (e inExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil || val == nil {
+		return nil, err
+	}
+
+	sawNull := false
+	for _, item := range e.list {
+		candidate, err := item.eval(row)
+
+		if err != nil {
+			return nil, err
+		}
+		if candidate == nil {
+			sawNull = true
+			continue
+		}
+		_, candidate = timeOperands(val, candidate)
+		if valueKind(val) == valueKind(candidate) && compareOrdered(val, candidate) == 0 {
+			return !e.not, nil
+		}
+	}
+
+	if sawNull {
+		return nil, nil
+	}
+	return e.not, nil
+}
+
+func (e inExpr) String() string {
+	items := make([]string, len(e.list))
+	for i, item := range e.list {
+		items[i] = item.String()
+	}
+	op := " IN ("
+	if e.not {
+		op = " NOT IN ("
+	}
+	return e.x.String() + op + strings.Join(items, ", ") + ")"
+}
+
+func (e betweenExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil || val == nil {
+		return nil, err
+	}
+
+	lo, err := e.lo.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hi, err := e.hi.eval(row)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lo == nil || hi == nil {
+		return nil, nil
+	}
+	_, lo = timeOperands(val, lo)
+	_, hi = timeOperands(val, hi)
+	if valueKind(val) != valueKind(lo) || valueKind(val) != valueKind(hi) {
+		return e.not, nil
+	}
+
+	above, err := compareValues(val, lo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	below, err := compareValues(val, hi)
+
+	if err != nil {
+		return nil, err
+	}
+
+	in := above >= 0 && below <= 0
+	return in != e.not, nil
+}
+
+func (e betweenExpr) String() string {
+	op := " BETWEEN "
+	if e.not {
+		op = " NOT BETWEEN "
+	}
+	return e.x.String() + op + e.lo.String() + " AND " + e.hi.String()
+}
+
+func (e likeExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil || val == nil {
+		return nil, err
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return e.not, nil
+	}
+	return e.re.MatchString(s) != e.not, nil
+}
+
+func (e likeExpr) String() string {
+	op := " LIKE "
+	if e.not {
+		op = " NOT LIKE "
+	}
+	return e.x.String() + op + literalExpr{e.pattern}.String()
+}
+
+func (e funcExpr) eval(row Row) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		val, err := arg.eval(row)
+
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+
+	return e.fn(args)
+}
+
+func (e funcExpr) String() string {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.String()
+	}
+	return e.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	if valueKind(left) != kindNumber || valueKind(right) != kindNumber {
+		return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, op, "cannot apply %s to %T and %T", op, left, right)
+	}
+
+	if isDecimal(left) || isDecimal(right) {
+		if result, ok, err := exactArithmetic(op, left, right); ok {
+			return result, err
+		}
+	}
+
+	if isFloat(left) || isFloat(right) || isDecimal(left) || isDecimal(right) {
+		l, r := toFloat(left), toFloat(right)
+		switch op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/":
+			if r == 0 {
+				return nil, queryError(CodeDivisionByZero, ErrInvalidQuery, op, "division by zero")
+			}
+			return l / r, nil
+		default:
+			return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, op, "%% requires integers")
+		}
+	}
+
+	l, r := toInt64(left), toInt64(right)
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	default:
+		if r == 0 {
+			return nil, queryError(CodeDivisionByZero, ErrInvalidQuery, op, "division by zero")
+		}
+		if op == "/" {
+			return l / r, nil
+		}
+		return l % r, nil
+	}
+}
+
+func isFloat(v interface{}) bool {
+	switch v.(type) {
+	case float32, float64:
+		return true
+	}
+	return false
+}
+
+func isDecimal(v interface{}) bool {
+	_, ok := v.(DecimalValue)
+	return ok
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case uint:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case float32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case DecimalValue:
+		return n.Units / pow10(n.Scale).Int64()
+	default:
+		return 0
+	}
+}
+
+func likePattern(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokParam
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(src) {
+		c, size := utf8.DecodeRuneInString(src[i:])
+
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case c == '\'' || c == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					return nil, syntaxError(CodeSyntaxError, string(c), start, "unterminated string at position %d", start)
+				}
+				if rune(src[i]) == c {
+					if i+1 < len(src) && rune(src[i+1]) == c {
+						b.WriteByte(src[i])
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(src[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokString, text: b.String(), pos: start})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start})
+		case c == '$':
+			start := i
+			i++
+			for i < len(src) && unicode.IsDigit(rune(src[i])) {
+				i++
+			}
+			if i == start+1 {
+				return nil, syntaxError(CodeSyntaxError, "$", start, "expected a parameter number after $ at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokParam, text: src[start:i], pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) {
+				r, n := utf8.DecodeRuneInString(src[i:])
+				if !isIdentChar(r) {
+					break
+				}
+				i += n
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			start := i
+			op := string(c)
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "<=", ">=", "!=", "<>", "==":
+					op = two
+				}
+			}
+			if !strings.Contains("=<>!+-*/%(),", string(c)) {
+				return nil, syntaxError(CodeSyntaxError, string(c), start, "unexpected %q at position %d", c, start)
+			}
+			i += len(op)
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: start})
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isIdentChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '.' || c == '[' || c == ']'
+}
+
+type exprParser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+// parseExpr compiles a filter or projection expression. The grammar covers
+// AND/OR/NOT, comparisons (= != <> < <= > >=), IS [NOT] NULL, [NOT] IN,
+// [NOT] BETWEEN, [NOT] LIKE, [NOT] CONTAINS [ANY|ALL], arithmetic,
+// literals (numbers, quoted strings, TRUE, FALSE, NULL), parameters ($1,
+// $2, ...), column references and paths into JSON and Array columns
+// (profile.address.city, items[0].sku), CAST(x AS type) and scalar
+// function calls.
+func parseExpr(src string) (expr, error) {
+	tokens, err := tokenize(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{src: src, tokens: tokens}
+	e, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+
+	return e, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) errorf(tok token, format string, args ...interface{}) error {
+	return p.codeErrorf(CodeSyntaxError, tok, format, args...)
+}
+
+func (p *exprParser) codeErrorf(code ErrorCode, tok token, format string, args ...interface{}) error {
+	return syntaxError(code, tok.text, tok.pos, "%s at position %d in %q", fmt.Sprintf(format, args...), tok.pos, p.src)
+}
+
+func (p *exprParser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokIdent && strings.EqualFold(tok.text, word)
+}
+
+func (p *exprParser) acceptKeyword(word string) bool {
+	if p.isKeyword(word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) acceptOp(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		tok := p.peek()
+		return p.errorf(tok, "expected %q, found %q", op, tok.text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "OR", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: "AND", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "NOT", x: x}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") {
+			tok := p.peek()
+			return nil, p.errorf(tok, "expected NULL, found %q", tok.text)
+		}
+		return isNullExpr{x: left, not: not}, nil
+	}
+
+	not := p.acceptKeyword("NOT")
+
+	switch {
+	case p.acceptKeyword("IN"):
+		return p.parseIn(left, not)
+	case p.acceptKeyword("BETWEEN"):
+		return p.parseBetween(left, not)
+	case p.acceptKeyword("LIKE"):
+		return p.parseLike(left, not)
+	case p.acceptKeyword("CONTAINS"):
+		return p.parseContains(left, not)
+	case p.acceptKeyword("MATCH"):
+		return p.parseMatch(left, not)
+	case not:
+		tok := p.peek()
+		return nil, p.errorf(tok, "expected IN, BETWEEN, LIKE, CONTAINS or MATCH after NOT, found %q", tok.text)
+	}
+
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return left, nil
+	}
+
+	op := tok.text
+	switch op {
+	case "==":
+		op = "="
+	case "<>":
+		op = "!="
+	case "=", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.pos++
+
+	right, err := p.parseAdditive()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if array, ok := left.(anyOperand); ok {
+		return p.anyComparison(tok, op, array, right, true)
+	}
+	if array, ok := right.(anyOperand); ok {
+		return p.anyComparison(tok, op, array, left, false)
+	}
+	return binaryExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseIn(left expr, not bool) (expr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	list, err := p.parseList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return inExpr{x: left, list: list, not: not}, nil
+}
+
+func (p *exprParser) parseBetween(left expr, not bool) (expr, error) {
+	lo, err := p.parseAdditive()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.acceptKeyword("AND") {
+		tok := p.peek()
+		return nil, p.errorf(tok, "expected AND in BETWEEN, found %q", tok.text)
+	}
+
+	hi, err := p.parseAdditive()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return betweenExpr{x: left, lo: lo, hi: hi, not: not}, nil
+}
+
+func (p *exprParser) parseLike(left expr, not bool) (expr, error) {
+	tok := p.next()
+	if tok.kind != tokString {
+		return nil, p.errorf(tok, "LIKE requires a string pattern, found %q", tok.text)
+	}
+
+	re, err := likePattern(tok.text)
+
+	if err != nil {
+		return nil, p.errorf(tok, "invalid LIKE pattern: %v", err)
+	}
+
+	return likeExpr{x: left, pattern: tok.text, re: re, not: not}, nil
+}
+
+// parseList parses comma-separated expressions up to and including the
+// closing parenthesis.
+func (p *exprParser) parseList() ([]expr, error) {
+	var list []expr
+
+	if p.acceptOp(")") {
+		return list, nil
+	}
+
+	for {
+		item, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+
+		if p.acceptOp(")") {
+			return list, nil
+		}
+		if err := p.expectOp(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokOp || (tok.text != "+" && tok.text != "-") {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseMultiplicative()
+
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokOp || (tok.text != "*" && tok.text != "/" && tok.text != "%") {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.acceptOp("-") {
+		x, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "-", x: x}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		if strings.Contains(tok.text, ".") {
+			f, err := strconv.ParseFloat(tok.text, 64)
+
+			if err != nil {
+				return nil, p.errorf(tok, "invalid number %q", tok.text)
+			}
+			return literalExpr{f}, nil
+		}
+
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+
+		if err != nil {
+			return nil, p.errorf(tok, "invalid number %q", tok.text)
+		}
+		return literalExpr{n}, nil
+	case tokString:
+		return literalExpr{tok.text}, nil
+	case tokParam:
+		n, err := strconv.Atoi(tok.text[1:])
+
+		if err != nil || n < 1 {
+			return nil, p.errorf(tok, "invalid parameter %q", tok.text)
+		}
+		return paramExpr{index: n}, nil
+	case tokIdent:
+		switch strings.ToUpper(tok.text) {
+		case "NULL":
+			return literalExpr{nil}, nil
+		case "TRUE":
+			return literalExpr{true}, nil
+		case "FALSE":
+			return literalExpr{false}, nil
+		}
+
+		if p.acceptOp("(") {
+			return p.parseCall(tok)
+		}
+		return newColumnExpr(tok.text), nil
+	case tokOp:
+		if tok.text == "(" {
+			e, err := p.parseOr()
+
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	}
+
+	if tok.kind == tokEOF {
+		return nil, p.errorf(tok, "unexpected end of expression")
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+func (p *exprParser) parseCall(name token) (expr, error) {
+	upper := strings.ToUpper(name.text)
+
+	if isAggregateName(upper) {
+		return p.parseAggregate(upper)
+	}
+
+	if upper == "CAST" {
+		return p.parseCast()
+	}
+
+	if upper == "ANY" {
+		return p.parseAny(name)
+	}
+
+	fn, ok := scalarFuncs[upper]
+	if !ok {
+		return nil, p.codeErrorf(CodeUnknownFunction, name, "unknown function %s", name.text)
+	}
+
+	args, err := p.parseList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return funcExpr{name: upper, args: args, fn: fn}, nil
+}
+
+func (p *exprParser) parseCast() (expr, error) {
+	x, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.acceptKeyword("AS") {
+		tok := p.peek()
+		return nil, p.errorf(tok, "expected AS in CAST, found %q", tok.text)
+	}
+
+	tok := p.next()
+	to, ok := castTypes[strings.ToUpper(tok.text)]
+	if tok.kind != tokIdent || !ok {
+		return nil, p.errorf(tok, "unknown type %q in CAST", tok.text)
+	}
+
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	return castExpr{x: x, to: to}, nil
+}
+
+func (p *exprParser) parseAggregate(name string) (expr, error) {
+	if p.acceptOp("*") {
+		if name != "COUNT" {
+			return nil, p.errorf(p.peek(), "%s(*) is not supported", name)
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return aggExpr{name: name}, nil
+	}
+
+	args, err := p.parseList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) != 1 {
+		return nil, p.errorf(p.peek(), "%s takes exactly one argument", name)
+	}
+
+	return aggExpr{name: name, arg: args[0]}, nil
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CreateTestFixture creates a table for each entry of tables and inserts
+// its rows, for setting up tests. Each table's columns are inferred from
+// its rows: one per key other than "id", of the type of its non-NULL
+// values, where ints and floats together make a Float and arrays whose
+// elements are not all of one type, or include NULL, make a JSON column.
+// A column with a NULL value is nullable, and one that is only ever NULL
+// is a String. A row's "id" is its id, as text if it is not a string; a
+// row without one gets its position, counting from 1.
+//
+// Everything happens under one acquisition of the write lock, and if any
+// table exists already or any row is rejected, nothing is created.
+// Hooks do not run. DropFixture(name) drops the tables again.
+func (db *NewDatabase) CreateTestFixture(name string, tables map[string][]map[string]interface{}) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	names := make([]string, 0, len(tables))
+	for tableName := range tables {
+		names = append(names, tableName)
+	}
+	sort.Strings(names)
+
+	created := make([]Table, 0, len(names))
+	var ops []PendingOperation
+	for _, tableName := range names {
+		rows := tables[tableName]
+
+		columns, err := inferColumns(tableName, rows)
+
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", name, err)
+		}
+		if err := validateSchema(columns, nil); err != nil {
+			return fmt.Errorf("fixture %s: table %s: %w", name, tableName, err)
+		}
+		created = append(created, Table{Name: tableName, Columns: columns, Rows: []Row{}})
+
+		floats := make(map[string]bool)
+		for _, col := range columns {
+			floats[col.Name] = col.DataType == Float
+		}
+
+		for i, row := range rows {
+			id := strconv.Itoa(i + 1)
+			data := make(map[string]interface{}, len(row))
+			for key, val := range row {
+				switch {
+				case floats[key] && val != nil && !isFloat(val):
+					data[key] = toFloat(val)
+				case key != "id":
+					data[key] = val
+				case val != nil:
+					id = fmt.Sprint(val)
+				}
+			}
+			ops = append(ops, PendingOperation{Op: ChangeInsert, TableName: tableName, RowID: id, Data: data})
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.fixtures[name]; ok {
+		return fmt.Errorf("%w: %s", ErrFixtureExists, name)
+	}
+	for _, table := range created {
+		if _, exists := db.Tables[table.Name]; exists || db.metaTables[table.Name] != nil {
+			return fmt.Errorf("fixture %s: %w: %s", name, ErrTableExists, table.Name)
+		}
+	}
+
+	for _, table := range created {
+		table.ensureIndexes()
+		db.Tables[table.Name] = table
+	}
+
+	staged, _, err := db.stagePending(ops, true, false)
+
+	if err != nil {
+		for _, tableName := range names {
+			db.dropTableLocked(tableName)
+		}
+		return fmt.Errorf("fixture %s: %w", name, err)
+	}
+
+	for tableName, table := range staged {
+		db.Tables[tableName] = *table
+	}
+	for _, tableName := range names {
+		db.replicateTable(tableName)
+	}
+	if db.fixtures == nil {
+		db.fixtures = make(map[string][]string)
+	}
+	db.fixtures[name] = names
+	return nil
+}
+
+// DropFixture drops the tables CreateTestFixture created for the fixture
+// name, all at once. Tables already dropped are skipped. It refuses, with
+// ErrForeignKey, if a table outside the fixture references one of them.
+func (db *NewDatabase) DropFixture(name string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	names, ok := db.fixtures[name]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrFixtureNotFound, name)
+	}
+
+	inFixture := make(map[string]bool, len(names))
+	for _, tableName := range names {
+		inFixture[tableName] = true
+	}
+	for _, tableName := range names {
+		for _, ref := range db.referencesTo(tableName) {
+			if !inFixture[strings.SplitN(ref, ".", 2)[0]] {
+				return fmt.Errorf("%w: table %s of fixture %s is referenced by %s", ErrForeignKey, tableName, name, ref)
+			}
+		}
+	}
+
+	for _, tableName := range names {
+		db.dropTableLocked(tableName)
+	}
+	delete(db.fixtures, name)
+	return nil
+}
+
+// LoadFixtureFromYAML creates a fixture, as CreateTestFixture does, from a
+// YAML file of the form
+//
+//	tables:
+//	  users:
+//	    - id: u1
+//	      name: Ada
+//	      born: 1815-12-10
+//	    - {id: u2, name: Grace}
+//
+// The fixture is named after the file, without its extension. Only the
+// block and flow collections and plain and quoted scalars of YAML are
+// understood, not anchors, tags or multi-line strings; plain scalars that
+// look like numbers, booleans, null or RFC 3339 dates are read as such.
+func (db *NewDatabase) LoadFixtureFromYAML(path string) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	tables, err := parseFixtureYAML(data)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return db.CreateTestFixture(name, tables)
+}
+
+// inferColumns works out the columns of a fixture table from its rows.
+func inferColumns(tableName string, rows []map[string]interface{}) ([]Column, error) {
+	byName := make(map[string]*Column)
+	typed := make(map[string]bool)
+
+	for _, row := range rows {
+		keys := make([]string, 0, len(row))
+		for key := range row {
+			if key != "id" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			col, ok := byName[key]
+			if !ok {
+				col = &Column{Name: key, DataType: String}
+				byName[key] = col
+			}
+
+			val := row[key]
+			dataType, ok := valueType(val)
+			if !ok {
+				if val != nil {
+					return nil, fmt.Errorf("%w: column %s of table %s holds a %T", ErrInvalidSchema, key, tableName, val)
+				}
+				col.Nullable = true
+				continue
+			}
+
+			var elemType DataType
+			if dataType == Array {
+				if elemType, ok = elementType(val.([]interface{})); !ok {
+					dataType = JSON
+				}
+			}
+
+			switch {
+			case !typed[key]:
+				col.DataType, col.ElementType = dataType, elemType
+			case col.DataType == dataType && col.ElementType == elemType:
+			case col.DataType == Int && dataType == Float, col.DataType == Float && dataType == Int:
+				col.DataType = Float
+			case (col.DataType == Array || col.DataType == JSON) && (dataType == Array || dataType == JSON):
+				col.DataType, col.ElementType = JSON, 0
+			default:
+				return nil, fmt.Errorf("%w: column %s of table %s holds both %s and %s values", ErrInvalidSchema, key, tableName, col.DataType, dataType)
+			}
+			typed[key] = true
+		}
+	}
+
+	result := make([]Column, 0, len(byName))
+	for _, col := range byName {
+		result = append(result, *col)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// elementType returns the type shared by every element of an array, which
+// may hold neither NULLs nor arrays. An empty array is taken to be of
+// strings.
+func elementType(items []interface{}) (DataType, bool) {
+	result, seen := String, false
+	for _, item := range items {
+		dataType, ok := valueType(item)
+		switch {
+		case !ok, dataType == Array:
+			return 0, false
+		case seen && dataType != result:
+			return 0, false
+		}
+		result, seen = dataType, true
+	}
+	return result, true
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreateTestFixture(t *testing.T) {
+	db := newTestDB(t)
+	err := db.CreateTestFixture("shop", map[string][]map[string]interface{}{
+		"users": {
+			{"id": "u1", "name": "Ada", "age": 36},
+			{"id": "u2", "name": "Grace", "age": nil},
+		},
+		"orders": {
+			{"user": "u1", "total": 10, "tags": []interface{}{"a", "b"}},
+			{"user": "u2", "total": 2.5, "tags": []interface{}{1, "x"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]Column{
+		"users": {
+			{Name: "age", DataType: Int, Nullable: true},
+			{Name: "name", DataType: String},
+		},
+		"orders": {
+			{Name: "tags", DataType: JSON},
+			{Name: "total", DataType: Float},
+			{Name: "user", DataType: String},
+		},
+	}
+	for name, columns := range want {
+		if got := db.Tables[name].Columns; !reflect.DeepEqual(got, columns) {
+			t.Errorf("columns of %s = %+v, want %+v", name, got, columns)
+		}
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id", "total"}, From: "orders", OrderBy: "id"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("order ids = %v, want positions [1 2]", got)
+	}
+	if total := result.Rows[0].Columns["total"]; total != 10.0 {
+		t.Errorf("total of order 1 = %#v, want 10.0", total)
+	}
+
+	if err := db.CreateTestFixture("shop", nil); !errors.Is(err, ErrFixtureExists) {
+		t.Errorf("second CreateTestFixture(shop) = %v, want ErrFixtureExists", err)
+	}
+
+	if err := db.DropFixture("shop"); err != nil {
+		t.Fatal(err)
+	}
+	if db.TableExists("users") || db.TableExists("orders") {
+		t.Error("DropFixture left tables behind")
+	}
+	if err := db.DropFixture("shop"); !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("second DropFixture = %v, want ErrFixtureNotFound", err)
+	}
+}
+
+func TestCreateTestFixtureIsAtomic(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "taken", []Column{{Name: "n", DataType: Int}}, nil)
+
+	tests := []struct {
+		name   string
+		tables map[string][]map[string]interface{}
+		want   error
+	}{
+		{"existing table", map[string][]map[string]interface{}{
+			"fresh": {{"n": 1}},
+			"taken": {{"n": 1}},
+		}, ErrTableExists},
+		{"duplicate id", map[string][]map[string]interface{}{
+			"fresh": {{"id": "a", "n": 1}, {"id": "a", "n": 2}},
+		}, ErrIDExists},
+		{"mixed types", map[string][]map[string]interface{}{
+			"fresh": {{"n": 1}, {"n": "one"}},
+		}, ErrInvalidSchema},
+	}
+	for _, tt := range tests {
+		if err := db.CreateTestFixture(tt.name, tt.tables); !errors.Is(err, tt.want) {
+			t.Errorf("%s: CreateTestFixture = %v, want %v", tt.name, err, tt.want)
+		}
+		if db.TableExists("fresh") {
+			t.Errorf("%s: failed CreateTestFixture created a table", tt.name)
+		}
+	}
+}
+
+func TestLoadFixtureFromYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.yaml")
+	yaml := `tables:
+  people:
+    - id: p1
+      name: Ada
+      born: 1815-12-10
+      score: 9.5
+    - {id: p2, name: "Grace Hopper", born: 1906-12-09, score: 10}
+    - id: p3
+      name: 'nobody'
+      born: null
+      score: 1
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := newTestDB(t)
+	if err := db.LoadFixtureFromYAML(path); err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := db.GetRowByID("people", "p2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	born := time.Date(1906, 12, 9, 0, 0, 0, 0, time.UTC)
+	if got, ok := row.Columns["born"].(time.Time); !ok || !got.Equal(born) {
+		t.Errorf("born = %#v, want %v", row.Columns["born"], born)
+	}
+	if row.Columns["name"] != "Grace Hopper" || row.Columns["score"] != 10.0 {
+		t.Errorf("row p2 = %v", row.Columns)
+	}
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: "born IS NULL"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"p3"}) {
+		t.Errorf("born IS NULL = %v, want [p3]", got)
+	}
+
+	// The fixture is named after the file.
+	if err := db.DropFixture("people"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// matchScoreColumn is the column a query's filter adds to each row that a
+// MATCH in it selects, holding the row's score.
+const matchScoreColumn = "match_score"
+
+// matchExpr is x MATCH query: true if the text of x holds every word of
+// the text of query, as splitWords splits them. Neither phrases nor prefixes
+// are recognised; a query with no words matches nothing.
+type matchExpr struct {
+	x, query expr
+	not      bool
+}
+
+func (p *exprParser) parseMatch(left expr, not bool) (expr, error) {
+	query, err := p.parseAdditive()
+
+	if err != nil {
+		return nil, err
+	}
+	return matchExpr{x: left, query: query, not: not}, nil
+}
+
+func (e matchExpr) eval(row Row) (interface{}, error) {
+	val, err := e.x.eval(row)
+
+	if err != nil || val == nil {
+		return nil, err
+	}
+
+	terms, err := e.terms(row)
+
+	if err != nil || terms == nil {
+		return nil, err
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return e.not, nil
+	}
+	return (len(terms) > 0 && matchScore(s, terms) > 0) != e.not, nil
+}
+
+// terms returns the words of e's query, or nil if it is NULL.
+func (e matchExpr) terms(row Row) ([]string, error) {
+	query, err := e.query.eval(row)
+
+	if err != nil || query == nil {
+		return nil, err
+	}
+
+	s, ok := query.(string)
+	if !ok {
+		return nil, queryError(CodeTypeMismatch, ErrInvalidQuery, "MATCH", "MATCH requires a string query, got %T", query)
+	}
+	return append([]string{}, splitWords(s, nil)...), nil
+}
+
+func (e matchExpr) String() string {
+	op := " MATCH "
+	if e.not {
+		op = " NOT MATCH "
+	}
+	return e.x.String() + op + e.query.String()
+}
+
+// splitWords splits s into lower-case words, runs of letters and digits,
+// leaving out those in stopwords.
+func splitWords(s string, stopwords map[string]bool) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(stopwords) == 0 {
+		return words
+	}
+
+	kept := words[:0]
+	for _, w := range words {
+		if !stopwords[w] {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
+
+// matchScore returns 0 if text lacks any of terms, and otherwise the
+// share of its words that are one of them.
+func matchScore(text string, terms []string) float64 {
+	words := splitWords(text, nil)
+	counts := make(map[string]int, len(words))
+	for _, w := range words {
+		counts[w]++
+	}
+
+	hits := 0
+	for _, term := range terms {
+		if counts[term] == 0 {
+			return 0
+		}
+		hits += counts[term]
+		counts[term] = 0
+	}
+	return float64(hits) / float64(len(words))
+}
+
+// scoreRows returns rows with matchScoreColumn set to the summed scores of
+// filter's MATCH conjuncts, or rows as they are if it has none.
+func scoreRows(rows []Row, filter expr) []Row {
+	var matches []matchExpr
+	for _, c := range conjuncts(filter) {
+		if m, ok := c.(matchExpr); ok && !m.not {
+			matches = append(matches, m)
+		}
+	}
+	if matches == nil {
+		return rows
+	}
+
+	scored := make([]Row, len(rows))
+	for i, row := range rows {
+		score := 0.0
+		for _, m := range matches {
+			val, _ := m.x.eval(row)
+			terms, _ := m.terms(row)
+			if s, ok := val.(string); ok && len(terms) > 0 {
+				score += matchScore(s, terms)
+			}
+		}
+		scored[i] = copyRow(row)
+		scored[i].Columns[matchScoreColumn] = score
+	}
+	return scored
+}
+
+// fullTextKeys returns the keys the full-text index idx holds row under,
+// one per distinct word of its column other than a stopword.
+func fullTextKeys(row Row, idx Index) []string {
+	s, ok := row.Columns[idx.Columns[0]].(string)
+	if !ok {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for _, w := range splitWords(s, idx.stopwords()) {
+		if key := indexValueKey(w); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (idx Index) stopwords() map[string]bool {
+	if len(idx.Stopwords) == 0 {
+		return nil
+	}
+	stop := make(map[string]bool, len(idx.Stopwords))
+	for _, w := range idx.Stopwords {
+		stop[strings.ToLower(w)] = true
+	}
+	return stop
+}
+
+// indexedLookup returns the ids of the rows that may satisfy filter's
+// conjuncts that inverted and full-text indexes answer; ok is false if it
+// has none.
+func (t *Table) indexedLookup(filter expr) (map[string]bool, bool) {
+	contains, containsOK := t.containsLookup(filter)
+	matches, matchOK := t.matchLookup(filter)
+	switch {
+	case !matchOK:
+		return contains, containsOK
+	case !containsOK:
+		return matches, true
+	}
+	return intersectIDs(contains, matches), true
+}
+
+// matchLookup returns the ids of the rows that may satisfy filter's MATCH
+// conjuncts on columns with a full-text index and constant queries; ok is
+// false if it has none. Stopwords in a query do not narrow the lookup.
+func (t *Table) matchLookup(filter expr) (map[string]bool, bool) {
+	if filter == nil || t.indexData == nil {
+		return nil, false
+	}
+
+	var result map[string]bool
+	for _, c := range conjuncts(filter) {
+		e, isMatch := c.(matchExpr)
+		col, isColumn := e.x.(columnExpr)
+		if !isMatch || !isColumn || e.not || !isConstant(e.query) {
+			continue
+		}
+		idx, ok := t.fullTextIndex(col.name)
+		if !ok {
+			continue
+		}
+
+		terms, err := e.terms(Row{})
+
+		if err != nil {
+			continue
+		}
+
+		var ids map[string]bool
+		stop := idx.stopwords()
+		for _, term := range terms {
+			if stop[term] {
+				continue
+			}
+			matches := make(map[string]bool)
+			for _, id := range t.indexData[idx.Name][indexValueKey(term)] {
+				matches[id] = true
+			}
+			if ids == nil {
+				ids = matches
+			} else {
+				ids = intersectIDs(ids, matches)
+			}
+		}
+		switch {
+		case len(terms) == 0:
+			// NULL or no words: nothing matches.
+			ids = map[string]bool{}
+		case ids == nil:
+			continue
+		}
+
+		if result == nil {
+			result = ids
+		} else {
+			result = intersectIDs(result, ids)
+		}
+	}
+	return result, result != nil
+}
+
+// fullTextIndex returns the full-text index on column.
+func (t *Table) fullTextIndex(column string) (Index, bool) {
+	for _, idx := range t.Indexes {
+		if idx.FullText && idx.Columns[0] == column {
+			return idx, true
+		}
+	}
+	return Index{}, false
+}
+
+// RebuildIndex rebuilds the index indexName of tableName from the stored
+// rows.
+func (db *NewDatabase) RebuildIndex(tableName, indexName string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	var idx *Index
+	for i := range table.Indexes {
+		if table.Indexes[i].Name == indexName {
+			idx = &table.Indexes[i]
+		}
+	}
+	if idx == nil {
+		return fmt.Errorf("%w: table %s has no index %s", ErrInvalidSchema, tableName, indexName)
+	}
+
+	candidate := table.cloneStorage()
+	candidate.ensureIndexes()
+	entries := make(map[string][]string)
+	for _, row := range candidate.allRows() {
+		for _, key := range candidate.indexKeys(row, *idx) {
+			entries[key] = append(entries[key], rowID(row))
+		}
+	}
+
+	indexData := make(map[string]map[string][]string, len(candidate.indexData))
+	for name, data := range candidate.indexData {
+		indexData[name] = data
+	}
+	indexData[indexName] = entries
+	candidate.indexData = indexData
+
+	db.Tables[tableName] = candidate
+	db.replicateTable(tableName)
+	return nil
+}
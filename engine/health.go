@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// longTransaction is how long a transaction may stay open before Healthz
+// reports the database as degraded.
+const longTransaction = 60 * time.Second
+
+// lagWindowSeconds is how many seconds back Healthz compares the rates at
+// which writes are queued in and flushed from eventual consistency
+// buffers.
+const lagWindowSeconds = 10
+
+// Healthz reports the database's health for a /healthz endpoint, as a map
+// that encodes to JSON:
+//
+//	status             "ok", "degraded" or "unavailable"
+//	uptime_s           seconds since Open, or since the first operation
+//	                   for a database not made by Open
+//	table_count        user tables
+//	transaction_count  transactions begun and not yet ended
+//	wal_lag_bytes      estimated size of the writes queued in eventual
+//	                   consistency buffers and not yet applied
+//	last_error         the most recent error returned by a query, insert,
+//	                   update or delete, or nil
+//
+// The status is "degraded" if writes are queued and, over the last 10
+// seconds, were queued more than twice as fast as they were flushed, or
+// if a transaction has been open for more than 60 seconds. It is
+// "unavailable" once GracefulShutdown has begun. Healthz only reads the
+// database's state, so calling it does not change what it reports.
+func (db *NewDatabase) Healthz() map[string]interface{} {
+	now := time.Now()
+
+	db.mu.RLock()
+	tables := len(db.Tables)
+	db.mu.RUnlock()
+
+	db.txMu.Lock()
+	transactions := len(db.transactions)
+	stuck := false
+	for tx := range db.transactions {
+		if now.Sub(tx.StartedAt) > longTransaction {
+			stuck = true
+		}
+	}
+	db.txMu.Unlock()
+
+	lag := db.bufferedBytes()
+	queued, flushed := db.lagRates.totals(now)
+	growing := lag > 0 && queued > 2*flushed
+
+	db.opsMu.Lock()
+	var uptime time.Duration
+	if !db.opened.IsZero() {
+		uptime = now.Sub(db.opened)
+	}
+	closing := db.closing
+	db.opsMu.Unlock()
+
+	status := "ok"
+	switch {
+	case closing:
+		status = "unavailable"
+	case growing || stuck:
+		status = "degraded"
+	}
+
+	var lastError interface{}
+	if ref := db.metrics.lastError.Load(); ref != nil {
+		lastError = ref.err.Error()
+	}
+
+	return map[string]interface{}{
+		"status":            status,
+		"uptime_s":          int64(uptime.Seconds()),
+		"table_count":       tables,
+		"transaction_count": transactions,
+		"wal_lag_bytes":     lag,
+		"last_error":        lastError,
+	}
+}
+
+// bufferedBytes estimates the size of every write queued in an eventual
+// consistency buffer.
+func (db *NewDatabase) bufferedBytes() int64 {
+	db.bufferMu.Lock()
+	defer db.bufferMu.Unlock()
+
+	var size int64
+	for _, buf := range db.buffers {
+		buf.mu.Lock()
+		for _, op := range buf.ops {
+			size += rowSize(Row{Columns: op.Data})
+		}
+		buf.mu.Unlock()
+	}
+	return size
+}
+
+// lagRates counts the bytes of the writes queued in and flushed from
+// eventual consistency buffers, per second over the last lagWindowSeconds.
+type lagRates struct {
+	mu      sync.Mutex
+	buckets [lagWindowSeconds]lagBucket
+}
+
+type lagBucket struct {
+	second          int64
+	queued, flushed int64
+}
+
+func (r *lagRates) add(now time.Time, queued, flushed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	second := now.Unix()
+	b := &r.buckets[second%lagWindowSeconds]
+	if b.second != second {
+		*b = lagBucket{second: second}
+	}
+	b.queued += queued
+	b.flushed += flushed
+}
+
+// totals returns the bytes queued and flushed over the window ending now.
+func (r *lagRates) totals(now time.Time) (queued, flushed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	second := now.Unix()
+	for _, b := range r.buckets {
+		if second-b.second < lagWindowSeconds {
+			queued += b.queued
+			flushed += b.flushed
+		}
+	}
+	return queued, flushed
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthzReportsBufferBacklog(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "events", []Column{{Name: "kind", DataType: String}}, nil)
+	if err := db.CreateEventualConsistencyBuffer("events", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer db.RemoveEventualConsistencyBuffer("events")
+
+	if status := db.Healthz()["status"]; status != "ok" {
+		t.Fatalf("status with nothing queued = %v, want ok", status)
+	}
+
+	mustInsert(t, db, "events", "e1", map[string]interface{}{"kind": "click"})
+	for i := 0; i < 3; i++ {
+		health := db.Healthz()
+		if health["status"] != "degraded" {
+			t.Fatalf("call %d: status with unflushed writes = %v, want degraded", i, health["status"])
+		}
+		if lag, _ := health["wal_lag_bytes"].(int64); lag <= 0 {
+			t.Fatalf("call %d: wal_lag_bytes = %v, want positive", i, health["wal_lag_bytes"])
+		}
+	}
+
+	if err := db.FlushBuffer("events"); err != nil {
+		t.Fatal(err)
+	}
+	if status := db.Healthz()["status"]; status != "ok" {
+		t.Fatalf("status after flushing = %v, want ok", status)
+	}
+}
+
+func TestLagRatesForgetOldSeconds(t *testing.T) {
+	var rates lagRates
+	start := time.Unix(1000, 0)
+
+	rates.add(start, 100, 0)
+	rates.add(start.Add(time.Second), 0, 40)
+	if queued, flushed := rates.totals(start.Add(time.Second)); queued != 100 || flushed != 40 {
+		t.Fatalf("totals = %d, %d, want 100, 40", queued, flushed)
+	}
+
+	later := start.Add(lagWindowSeconds * time.Second)
+	if queued, flushed := rates.totals(later); queued != 0 || flushed != 40 {
+		t.Fatalf("totals a window later = %d, %d, want 0, 40", queued, flushed)
+	}
+	rates.add(later, 7, 0)
+	if queued, _ := rates.totals(later); queued != 7 {
+		t.Fatalf("queued after reusing a bucket = %d, want 7", queued)
+	}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"sort"
+	"testing"
+)
+
+func newTestDB(t testing.TB) *NewDatabase {
+	t.Helper()
+	return &NewDatabase{Name: "test", Tables: make(map[string]Table)}
+}
+
+func mustCreateTable(t testing.TB, db *NewDatabase, name string, columns []Column, indexes []Index) {
+	t.Helper()
+	if err := db.CreateTable(name, columns, indexes); err != nil {
+		t.Fatalf("CreateTable(%s): %v", name, err)
+	}
+}
+
+func mustInsert(t testing.TB, db *NewDatabase, table, id string, data map[string]interface{}) {
+	t.Helper()
+	if err := db.InsertRow(table, id, data); err != nil {
+		t.Fatalf("InsertRow(%s, %s): %v", table, id, err)
+	}
+}
+
+// mustInsertRows inserts rows, keyed by id, into table in order of id.
+func mustInsertRows(t testing.TB, db *NewDatabase, table string, rows map[string]map[string]interface{}) {
+	t.Helper()
+	ids := make([]string, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		mustInsert(t, db, table, id, rows[id])
+	}
+}
+
+// usersOrdersTestDB returns a database with the users and orders tables
+// that many tests share: users has a name and a nullable age, and orders a
+// user_id and a nullable total. If indexed, orders.user_id is indexed by
+// orders_user. The tables are empty.
+func usersOrdersTestDB(t testing.TB, indexed bool) *NewDatabase {
+	t.Helper()
+	var indexes []Index
+	if indexed {
+		indexes = []Index{{Name: "orders_user", Columns: []string{"user_id"}}}
+	}
+
+	db := newTestDB(t)
+	mustCreateTable(t, db, "users", []Column{
+		{Name: "name", DataType: String},
+		{Name: "age", DataType: Int, Nullable: true},
+	}, nil)
+	mustCreateTable(t, db, "orders", []Column{
+		{Name: "user_id", DataType: String},
+		{Name: "total", DataType: Int, Nullable: true},
+	}, indexes)
+	return db
+}
+
+func mustQuery(t testing.TB, db *NewDatabase, query Query) QueryResult {
+	t.Helper()
+	result, err := db.ExecuteQuery(query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery(%+v): %v", query, err)
+	}
+	return result
+}
+
+// resultIDs returns the id column of each row of result, in order.
+func resultIDs(result QueryResult) []string {
+	ids := make([]string, len(result.Rows))
+	for i, row := range result.Rows {
+		ids[i], _ = row.Columns["id"].(string)
+	}
+	return ids
+}
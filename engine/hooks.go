@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+)
+
+type hook struct {
+	when HookTime
+	op   HookOp
+	fn   func(ctx HookContext) error
+}
+
+// RegisterHook calls fn for every op write to tableName, before or after it
+// is applied. Hooks for the same table run in registration order.
+//
+// A Before hook that returns an error aborts the write and the error is
+// returned to the caller; Before insert and update hooks may also modify
+// ctx.NewRow.Columns, and the modified row is validated and written. After
+// hooks observe the applied change; an error from one is returned to the
+// caller but does not undo the write. For transactions, Before hooks run at
+// commit and a veto rolls the whole transaction back.
+//
+// Hooks run while the database write lock is held, so the write stays atomic
+// with respect to other writers. For the same reason a hook must not call
+// back into db: doing so deadlocks. BulkLoad does not run hooks. The returned
+// func unregisters the hook.
+func (db *NewDatabase) RegisterHook(tableName string, when HookTime, op HookOp, fn func(ctx HookContext) error) (func(), error) {
+	db.mu.RLock()
+	_, ok := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	h := &hook{when: when, op: op, fn: fn}
+
+	db.hookMu.Lock()
+	if db.hooks == nil {
+		db.hooks = make(map[string][]*hook)
+	}
+	db.hooks[tableName] = append(db.hooks[tableName], h)
+	db.hookMu.Unlock()
+
+	var once sync.Once
+	unregister := func() {
+		once.Do(func() {
+			db.hookMu.Lock()
+			defer db.hookMu.Unlock()
+
+			list := db.hooks[tableName]
+			for i, other := range list {
+				if other == h {
+					db.hooks[tableName] = append(list[:i:i], list[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+
+	return unregister, nil
+}
+
+// runHooks calls the hooks registered for ctx.TableName, when and ctx.Op in
+// order, stopping at the first error. The hooks are passed decrypted copies
+// of the stored rows in ctx, so that they cannot change what is stored,
+// except that Before hooks get ctx.NewRow itself, the row about to be
+// written. The caller must hold db.mu.
+func (db *NewDatabase) runHooks(when HookTime, ctx HookContext) error {
+	db.hookMu.RLock()
+	var list []*hook
+	for _, h := range db.hooks[ctx.TableName] {
+		if h.when == when && h.op == ctx.Op {
+			list = append(list, h)
+		}
+	}
+	db.hookMu.RUnlock()
+
+	if len(list) == 0 {
+		return nil
+	}
+
+	var err error
+	if ctx.OldRow, err = db.hookRow(ctx.TableName, ctx.OldRow); err != nil {
+		return err
+	}
+	if when == HookAfter {
+		if ctx.NewRow, err = db.hookRow(ctx.TableName, ctx.NewRow); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range list {
+		if err := h.fn(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hookRow returns a decrypted copy of row, a row of tableName, for a hook.
+// The caller must hold db.mu.
+func (db *NewDatabase) hookRow(tableName string, row Row) (Row, error) {
+	if row.Columns == nil {
+		return row, nil
+	}
+
+	table := db.Tables[tableName]
+	plain, err := db.openRow(&table, row)
+
+	if err != nil {
+		return Row{}, err
+	}
+	return copyRow(plain), nil
+}
+
+// runBeforeHooks runs the Before hooks for an insert or update of newRow and
+// rejects any change they make to its id.
+func (db *NewDatabase) runBeforeHooks(tableName string, op HookOp, id string, oldRow, newRow Row) error {
+	ctx := HookContext{TableName: tableName, Op: op, RowID: id, OldRow: oldRow, NewRow: newRow}
+
+	if err := db.runHooks(HookBefore, ctx); err != nil {
+		return err
+	}
+
+	if newRow.Columns["id"] != id {
+		return fmt.Errorf("%w: hook cannot change id of row %s", ErrInvalidQuery, id)
+	}
+	return nil
+}
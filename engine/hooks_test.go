@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHooksRunInRegistrationOrder(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "name", DataType: String}}, nil)
+
+	var calls []string
+	for _, name := range []string{"first", "second", "third"} {
+		if _, err := db.RegisterHook("items", HookBefore, HookInsert, func(HookContext) error {
+			calls = append(calls, name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustInsert(t, db, "items", "a", map[string]interface{}{"name": "x"})
+	if want := []string{"first", "second", "third"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("hooks ran as %v, want %v", calls, want)
+	}
+}
+
+func TestBeforeHookMutatesAndVetoes(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "name", DataType: String}}, nil)
+
+	veto := errors.New("veto")
+	if _, err := db.RegisterHook("items", HookBefore, HookInsert, func(ctx HookContext) error {
+		if ctx.NewRow.Columns["name"] == "bad" {
+			return veto
+		}
+		ctx.NewRow.Columns["name"] = ctx.NewRow.Columns["name"].(string) + "!"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "items", "a", map[string]interface{}{"name": "x"})
+	row, err := db.GetRowByID("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Columns["name"] != "x!" {
+		t.Errorf("name = %v, want the hook's x!", row.Columns["name"])
+	}
+
+	if err := db.InsertRow("items", "b", map[string]interface{}{"name": "bad"}); !errors.Is(err, veto) {
+		t.Fatalf("vetoed InsertRow = %v, want the hook's error", err)
+	}
+	if _, err := db.GetRowByID("items", "b"); !errors.Is(err, ErrIDNotFound) {
+		t.Fatalf("vetoed row was written: %v", err)
+	}
+}
+
+func TestUnregisterHook(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "name", DataType: String}}, nil)
+
+	calls := 0
+	unregister, err := db.RegisterHook("items", HookAfter, HookInsert, func(HookContext) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "items", "a", map[string]interface{}{"name": "x"})
+	unregister()
+	unregister()
+	mustInsert(t, db, "items", "b", map[string]interface{}{"name": "y"})
+	if calls != 1 {
+		t.Fatalf("hook ran %d times, want once before it was unregistered", calls)
+	}
+
+	if _, err := db.RegisterHook("missing", HookAfter, HookInsert, func(HookContext) error { return nil }); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("RegisterHook(missing) = %v, want ErrTableNotFound", err)
+	}
+}
+
+// TestHooksGetCopies checks that changing the rows a hook is passed, other
+// than a Before hook's NewRow, does not change what is stored.
+func TestHooksGetCopies(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "name", DataType: String}}, nil)
+	mustInsert(t, db, "items", "a", map[string]interface{}{"name": "x"})
+
+	scribble := func(ctx HookContext) error {
+		for _, row := range []Row{ctx.OldRow, ctx.NewRow} {
+			if row.Columns != nil {
+				row.Columns["name"] = "scribbled"
+			}
+		}
+		return nil
+	}
+	if _, err := db.RegisterHook("items", HookBefore, HookUpdate, func(ctx HookContext) error {
+		ctx.OldRow.Columns["name"] = "scribbled"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RegisterHook("items", HookAfter, HookUpdate, scribble); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateRow("items", "a", map[string]interface{}{"name": "y"}); err != nil {
+		t.Fatal(err)
+	}
+	row, err := db.GetRowByID("items", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Columns["name"] != "y" {
+		t.Fatalf("name = %v, want y", row.Columns["name"])
+	}
+}
+
+type testKeys map[string][]byte
+
+func (k testKeys) Key(id string) ([]byte, error) {
+	if key, ok := k[id]; ok {
+		return key, nil
+	}
+	return nil, errors.New("no such key")
+}
+
+func TestHooksSeeDecryptedRows(t *testing.T) {
+	db := newTestDB(t)
+	db.SetKeyProvider(testKeys{"k": make([]byte, 32)})
+	mustCreateTable(t, db, "secrets", []Column{{Name: "ssn", DataType: String, Encrypted: true, EncryptionKeyID: "k"}}, nil)
+
+	var seen []interface{}
+	if _, err := db.RegisterHook("secrets", HookAfter, HookUpdate, func(ctx HookContext) error {
+		seen = append(seen, ctx.OldRow.Columns["ssn"], ctx.NewRow.Columns["ssn"])
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "secrets", "a", map[string]interface{}{"ssn": "123"})
+	if err := db.UpdateRow("secrets", "a", map[string]interface{}{"ssn": "456"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"123", "456"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("after update hook saw %v, want %v", seen, want)
+	}
+}
@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+func (t *Table) ensureIndexes() {
+	if t.Storage == KeyValueStorage && t.kv == nil {
+		t.kv = newKVStore(t.Rows)
+		t.Rows = nil
+		t.indexData = nil
+	}
+	if t.indexData == nil || (t.kv == nil && t.ids == nil) || (t.PartitionColumn != "" && t.partitions == nil) {
+		t.rebuildIndexes()
+	}
+}
+
+// rebuildIndexes replaces the id map and every secondary index with fresh
+// structures built from the stored rows. On a duplicate id or unique key it
+// returns the id of the first offending row; the indexes are still fully
+// built.
+func (t *Table) rebuildIndexes() (string, error) {
+	t.indexData = make(map[string]map[string][]string, len(t.Indexes))
+	for _, idx := range t.Indexes {
+		t.indexData[idx.Name] = make(map[string][]string)
+	}
+	t.resetPartitions()
+	t.sizeBytes = 0
+	t.touchSchema()
+
+	bad, firstErr := "", error(nil)
+	if t.kv != nil {
+		for _, row := range t.kv.ordered() {
+			t.sizeBytes += rowSize(row)
+			if err := t.checkUnique(row, rowID(row)); err != nil && firstErr == nil {
+				bad, firstErr = rowID(row), err
+			}
+			t.indexRow(row)
+		}
+		return bad, firstErr
+	}
+
+	t.ids = make(map[string]int, len(t.Rows))
+	for i, row := range t.Rows {
+		id := rowID(row)
+		if _, exists := t.ids[id]; exists && firstErr == nil {
+			bad, firstErr = id, fmt.Errorf("%w: %s in table %s", ErrIDExists, id, t.Name)
+		}
+		if firstErr == nil {
+			if err := t.checkUnique(row, id); err != nil {
+				bad, firstErr = id, err
+			}
+		}
+		t.ids[id] = i
+		t.indexRow(row)
+		t.sizeBytes += rowSize(row)
+	}
+
+	return bad, firstErr
+}
+
+func (t *Table) indexRow(row Row) {
+	id := rowID(row)
+	if t.partitions != nil {
+		t.partitions[t.Partitioning.partitionOf(row.Columns[t.PartitionColumn])][id] = struct{}{}
+	}
+	for _, idx := range t.Indexes {
+		for _, key := range t.indexKeys(row, idx) {
+			t.indexData[idx.Name][key] = append(t.indexData[idx.Name][key], id)
+		}
+	}
+}
+
+func (t *Table) unindexRow(row Row) {
+	id := rowID(row)
+	if t.partitions != nil {
+		delete(t.partitions[t.Partitioning.partitionOf(row.Columns[t.PartitionColumn])], id)
+	}
+	for _, idx := range t.Indexes {
+		entries := t.indexData[idx.Name]
+		for _, key := range t.indexKeys(row, idx) {
+			ids := entries[key]
+			for i, v := range ids {
+				if v == id {
+					ids = append(ids[:i], ids[i+1:]...)
+					break
+				}
+			}
+			if len(ids) == 0 {
+				delete(entries, key)
+			} else {
+				entries[key] = ids
+			}
+		}
+	}
+}
+
+// checkUnique reports whether row would collide with another row on any
+// unique index. ignoreID names the row being replaced, if any.
+func (t *Table) checkUnique(row Row, ignoreID string) error {
+	return t.checkUniqueWith(row, ignoreID, nil)
+}
+
+// checkUniqueWith is checkUnique with the rows in pending, by id, read in
+// place of those stored, an empty row standing for a deleted one.
+func (t *Table) checkUniqueWith(row Row, ignoreID string, pending map[string]Row) error {
+	for _, idx := range t.Indexes {
+		if !idx.Unique || idx.Inverted {
+			continue
+		}
+		key, ok := t.indexKey(row, idx.Columns)
+		if !ok {
+			continue
+		}
+		collides := false
+		for _, id := range t.indexData[idx.Name][key] {
+			if _, replaced := pending[id]; id != ignoreID && !replaced {
+				collides = true
+			}
+		}
+		for id, other := range pending {
+			if id == ignoreID || other.Columns == nil {
+				continue
+			}
+			if otherKey, ok := t.indexKey(other, idx.Columns); ok && otherKey == key {
+				collides = true
+			}
+		}
+		if collides {
+			return fmt.Errorf("%w: %s on %s in table %s", ErrUniqueViolation, idx.Name, strings.Join(idx.Columns, ", "), t.Name)
+		}
+	}
+	return nil
+}
+
+// indexKeys returns the keys idx holds row under: the one indexKey builds,
+// for an inverted index one per distinct non-NULL element of the array, or
+// for a full-text index one per distinct word.
+func (t *Table) indexKeys(row Row, idx Index) []string {
+	if idx.FullText {
+		return fullTextKeys(row, idx)
+	}
+	if !idx.Inverted {
+		if key, ok := t.indexKey(row, idx.Columns); ok {
+			return []string{key}
+		}
+		return nil
+	}
+
+	items, _ := row.Columns[idx.Columns[0]].([]interface{})
+	keys := make([]string, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		if key := indexValueKey(item); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// lookupKeys returns the keys under which a value equal to val may be
+// indexed: numbers under both their integer and float encodings, so that,
+// as in comparisons, 2 finds 2.0.
+func lookupKeys(val interface{}) []string {
+	keys := []string{indexValueKey(val)}
+	if valueKind(val) == kindNumber {
+		f := toFloat(val)
+		if !isFloat(val) {
+			keys = append(keys, indexValueKey(f))
+		} else if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			keys = append(keys, indexValueKey(int64(f)))
+		}
+	}
+	return keys
+}
+
+// indexKey builds the lookup key for the given columns, each value keyed
+// under its column's collation. Rows with a NULL in any indexed column are
+// not indexed.
+func (t *Table) indexKey(row Row, columns []string) (string, bool) {
+	var b strings.Builder
+	for i, col := range columns {
+		val, ok := row.Columns[col]
+		if !ok || val == nil {
+			return "", false
+		}
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		b.WriteString(indexValueKey(t.collation(col).key(val)))
+	}
+	return b.String(), true
+}
+
+// indexValueKey encodes one indexed value. Integers of every width share an
+// encoding, as do floats, so that equal values of different Go types land
+// on the same key. A whole decimal is keyed as an integer and any other as
+// a float.
+func indexValueKey(val interface{}) string {
+	if d, ok := val.(DecimalValue); ok {
+		if whole, err := d.rescale(0, false); err == nil {
+			return fmt.Sprintf("int64:%d", whole.Units)
+		}
+		return fmt.Sprintf("float64:%v", d.Float64())
+	}
+	if valueKind(val) == kindNumber {
+		if isFloat(val) {
+			return fmt.Sprintf("float64:%v", toFloat(val))
+		}
+		return fmt.Sprintf("int64:%d", toInt64(val))
+	}
+	return fmt.Sprintf("%T:%v", val, val)
+}
@@ -0,0 +1,457 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// planJoin compiles join and picks its strategy: an index join when the ON
+// condition equates a column of the joined table that has a single-column
+// index (or is its id) with an expression over the preceding tables, and a
+// nested loop otherwise. Except in RuleBased mode, the index is used only
+// if that is estimated to be cheaper than the nested loop.
+func (db *NewDatabase) planJoin(join Join, mode PlannerMode) (Operation, error) {
+	on, err := parseExpr(join.On)
+
+	if err != nil {
+		return Operation{}, err
+	}
+
+	op := Operation{
+		Type:       JoinOp,
+		Table:      join.Table,
+		Filter:     join.On,
+		Strategy:   NestedLoopJoin,
+		filterExpr: on,
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, ok := db.queryTable(join.Table)
+
+	if !ok {
+		return Operation{}, queryError(CodeUnknownTable, ErrTableNotFound, join.Table, "%s", join.Table)
+	}
+
+	for _, conjunct := range conjuncts(on) {
+		eq, ok := conjunct.(binaryExpr)
+		if !ok || eq.op != "=" {
+			continue
+		}
+
+		for _, sides := range [][2]expr{{eq.left, eq.right}, {eq.right, eq.left}} {
+			col, ok := sides[0].(columnExpr)
+			if !ok || !strings.HasPrefix(col.name, table.Name+".") || referencesTable(sides[1], &table) {
+				continue
+			}
+
+			column := strings.TrimPrefix(col.name, table.Name+".")
+			index, ok := table.singleColumnIndex(column)
+			if !ok || (mode != RuleBased && !table.indexJoinCheaper(index)) {
+				continue
+			}
+
+			op.Strategy = IndexJoin
+			op.joinProbe = sides[1]
+			op.joinColumn = column
+			op.joinIndex = index
+			return op, nil
+		}
+	}
+
+	return op, nil
+}
+
+// Costs, in row comparisons, of looking up one key in an index and of
+// sorting one probed row into scan order.
+const (
+	indexLookupCost = 4
+	probeSortCost   = 1
+)
+
+// indexJoinCheaper reports whether probing index of t once per row joined
+// to t is estimated to cost less than comparing each such row with every
+// row of t, as a nested loop does. A probe finds the rows/distinct rows
+// with its key and sorts them into scan order. The caller must hold db.mu.
+func (t *Table) indexJoinCheaper(index string) bool {
+	rows := t.rowCount()
+	distinct := rows
+	if index != "id" {
+		distinct = len(t.indexData[index])
+	}
+	if distinct == 0 {
+		return false
+	}
+
+	matches := float64(rows) / float64(distinct)
+	probe := indexLookupCost + matches + probeSortCost*matches*math.Log2(matches+1)
+	return probe < float64(rows)
+}
+
+// singleColumnIndex returns the name of an index on exactly column. The id
+// column is always indexed, under the name "id".
+func (t *Table) singleColumnIndex(column string) (string, bool) {
+	if column == "id" {
+		return "id", true
+	}
+	for _, idx := range t.Indexes {
+		if len(idx.Columns) == 1 && idx.Columns[0] == column && !idx.Inverted && !idx.FullText {
+			return idx.Name, true
+		}
+	}
+	return "", false
+}
+
+// splitWhere separates the conjuncts of where that read none of the joined
+// tables, which are applied to the FROM rows before any join, from the
+// rest, which are applied to the joined rows. Either result may be nil.
+func (db *NewDatabase) splitWhere(where expr, joins []Join) (expr, expr) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var early, late []expr
+	for _, conjunct := range conjuncts(where) {
+		joined := false
+		for _, join := range joins {
+			table, ok := db.queryTable(join.Table)
+			if !ok || referencesTable(conjunct, &table) {
+				joined = true
+				break
+			}
+		}
+
+		if joined {
+			late = append(late, conjunct)
+		} else {
+			early = append(early, conjunct)
+		}
+	}
+	return conjunction(early), conjunction(late)
+}
+
+// conjunction joins exprs with AND; it is nil for none.
+func conjunction(exprs []expr) expr {
+	if len(exprs) == 0 {
+		return nil
+	}
+	e := exprs[0]
+	for _, next := range exprs[1:] {
+		e = binaryExpr{op: "AND", left: e, right: next}
+	}
+	return e
+}
+
+func conjuncts(e expr) []expr {
+	if and, ok := e.(binaryExpr); ok && and.op == "AND" {
+		return append(conjuncts(and.left), conjuncts(and.right)...)
+	}
+	return []expr{e}
+}
+
+// referencesTable reports whether e may read a column of t, either
+// qualified or by a bare name that t has. Unknown expression types are
+// assumed to.
+func referencesTable(e expr, t *Table) bool {
+	switch e := e.(type) {
+	case literalExpr, paramExpr:
+		return false
+	case columnExpr:
+		if strings.HasPrefix(e.name, t.Name+".") {
+			return true
+		}
+		if e.name == "id" {
+			return true
+		}
+		for _, col := range t.Columns {
+			if col.Name == e.name {
+				return true
+			}
+		}
+		return false
+	case unaryExpr:
+		return referencesTable(e.x, t)
+	case binaryExpr:
+		return referencesTable(e.left, t) || referencesTable(e.right, t)
+	case isNullExpr:
+		return referencesTable(e.x, t)
+	case inExpr:
+		for _, item := range e.list {
+			if referencesTable(item, t) {
+				return true
+			}
+		}
+		return referencesTable(e.x, t)
+	case betweenExpr:
+		return referencesTable(e.x, t) || referencesTable(e.lo, t) || referencesTable(e.hi, t)
+	case likeExpr:
+		return referencesTable(e.x, t)
+	case matchExpr:
+		return referencesTable(e.x, t) || referencesTable(e.query, t)
+	case castExpr:
+		return referencesTable(e.x, t)
+	case anyExpr:
+		return referencesTable(e.array, t) || referencesTable(e.x, t)
+	case containsExpr:
+		for _, item := range e.list {
+			if referencesTable(item, t) {
+				return true
+			}
+		}
+		return referencesTable(e.x, t)
+	case funcExpr:
+		for _, arg := range e.args {
+			if referencesTable(arg, t) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func (p ExecutionPlan) hasJoins() bool {
+	for _, op := range p.Operations {
+		if op.Type == JoinOp {
+			return true
+		}
+	}
+	return false
+}
+
+// joinNames records which bare column names are unambiguous across the
+// tables of a join.
+type joinNames struct {
+	ambiguous map[string]bool
+}
+
+// joinNames collects the column names of every table in plan. The caller
+// must hold db.mu.
+func (db *NewDatabase) joinNames(plan ExecutionPlan) (joinNames, error) {
+	owners := make(map[string]int)
+	for _, op := range plan.Operations {
+		if op.Type != Scan && op.Type != JoinOp {
+			continue
+		}
+
+		if op.series != nil {
+			owners[seriesColumn]++
+			continue
+		}
+
+		table, ok := db.queryTable(op.Table)
+
+		if !ok {
+			return joinNames{}, queryError(CodeUnknownTable, ErrTableNotFound, op.Table, "%s", op.Table)
+		}
+
+		owners["id"]++
+		for _, col := range table.Columns {
+			owners[col.Name]++
+		}
+		if op.unnest != nil {
+			owners[op.unnest.alias]++
+		}
+	}
+
+	names := joinNames{ambiguous: make(map[string]bool)}
+	for name, n := range owners {
+		if n > 1 {
+			names.ambiguous[name] = true
+		}
+	}
+	return names, nil
+}
+
+// qualify adds the columns of row, from tableName, to combined.
+func (n joinNames) qualify(combined map[string]interface{}, tableName string, row Row) {
+	for key, val := range row.Columns {
+		combined[tableName+"."+key] = val
+		if !n.ambiguous[key] {
+			combined[key] = val
+		}
+	}
+}
+
+func (n joinNames) qualifyAll(tableName string, rows []Row) []Row {
+	qualified := make([]Row, len(rows))
+	for i, row := range rows {
+		qualified[i] = Row{Columns: make(map[string]interface{}, 2*len(row.Columns))}
+		n.qualify(qualified[i].Columns, tableName, row)
+	}
+	return qualified
+}
+
+// joinRows pairs each of left with the rows of right satisfying the join
+// condition. Both strategies produce the same rows in the same order: left
+// rows in turn, each followed by its matches in right's scan order. Right
+// rows are passed through transform once found.
+func joinRows(ctx context.Context, left []Row, right *Table, op Operation, names joinNames, includeDeleted bool, transform func([]Row) []Row) ([]Row, int, error) {
+	var joined []Row
+	now := time.Now()
+
+	var candidates func(Row) ([]Row, error)
+	if op.Strategy != IndexJoin {
+		all := transformRows(transform, right.scanRows(includeDeleted))
+		candidates = func(Row) ([]Row, error) {
+			return all, nil
+		}
+	} else {
+		candidates = func(row Row) ([]Row, error) {
+			val, err := op.joinProbe.eval(row)
+
+			if err != nil || val == nil {
+				return nil, err
+			}
+
+			var matches []Row
+			for _, r := range right.probe(op.joinIndex, op.joinColumn, val) {
+				if right.visible(r, now, includeDeleted) {
+					matches = append(matches, r)
+				}
+			}
+			return transformRows(transform, matches), nil
+		}
+	}
+
+	checked := 0
+	for _, l := range left {
+		matches, err := candidates(l)
+
+		if err != nil {
+			return nil, checked, err
+		}
+
+		for _, r := range matches {
+			if err := queryCheckpoint(ctx, checked); err != nil {
+				return nil, checked, err
+			}
+			checked++
+
+			combined := make(map[string]interface{}, len(l.Columns)+2*len(r.Columns))
+			for key, val := range l.Columns {
+				combined[key] = val
+			}
+			names.qualify(combined, right.Name, r)
+			row := Row{Columns: combined}
+
+			matched, err := evaluateFilter(row, op.filterExpr)
+
+			if err != nil {
+				return nil, checked, err
+			}
+			if matched {
+				joined = append(joined, row)
+			}
+		}
+	}
+
+	return joined, checked, nil
+}
+
+// probe returns the rows whose column, indexed by index, may equal val, in
+// scan order.
+func (t *Table) probe(index, column string, val interface{}) []Row {
+	if index == "id" {
+		id, ok := val.(string)
+		if !ok {
+			return nil
+		}
+		if row, ok := t.getRow(id); ok {
+			return []Row{row}
+		}
+		return nil
+	}
+
+	var ids []string
+	for _, key := range lookupKeys(t.collation(column).key(val)) {
+		ids = append(ids, t.indexData[index][key]...)
+	}
+
+	rows := make([]Row, 0, len(ids))
+	for _, id := range ids {
+		if row, ok := t.getRow(id); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	t.inScanOrder(rows)
+	return rows
+}
+
+// inScanOrder sorts rows, which must be stored in t, into scan order.
+func (t *Table) inScanOrder(rows []Row) {
+	if t.kv != nil {
+		sort.Slice(rows, func(i, j int) bool { return rowID(rows[i]) < rowID(rows[j]) })
+	} else {
+		sort.Slice(rows, func(i, j int) bool { return t.ids[rowID(rows[i])] < t.ids[rowID(rows[j])] })
+	}
+}
+
+// Explain describes how query would be executed, one operation per line.
+func (db *NewDatabase) Explain(query Query) (string, error) {
+	query, err := db.expandViews(query)
+
+	if err != nil {
+		return "", err
+	}
+
+	plan, err := db.createExecutionPlan(query)
+
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, op := range plan.Operations {
+		b.WriteString(op.Type.String())
+		switch op.Type {
+		case Scan:
+			if op.series != nil {
+				b.WriteString(" " + op.series.String())
+				break
+			}
+			if op.unnest != nil {
+				b.WriteString(" " + op.unnest.String())
+				break
+			}
+			b.WriteString(" " + op.Table)
+			db.mu.RLock()
+			if table, ok := db.Tables[op.Table]; ok && table.partitions != nil {
+				var pruneBy expr
+				if db.transformers[op.Table] == nil {
+					pruneBy = plan.scanFilter()
+				}
+				b.WriteString(" (" + table.describePartitions(pruneBy) + ")")
+			}
+			db.mu.RUnlock()
+		case JoinOp:
+			fmt.Fprintf(&b, " %s ON %s (%s", op.Table, op.Filter, op.Strategy)
+			if op.Strategy == IndexJoin {
+				fmt.Fprintf(&b, " using %s", op.joinIndex)
+			}
+			b.WriteString(")")
+		case Filter:
+			b.WriteString(" " + op.Filter)
+		case Sort:
+			b.WriteString(" " + op.Order)
+		case Project, Aggregate, CountOp:
+			if len(op.Columns) > 0 {
+				b.WriteString(" " + strings.Join(op.Columns, ", "))
+			}
+		case LimitOp:
+			fmt.Fprintf(&b, " %d", op.Limit)
+			if op.Offset > 0 {
+				fmt.Fprintf(&b, " OFFSET %d", op.Offset)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// joinTestDB returns users and orders tables with every order referencing
+// a user, and orders.user_id indexed if indexed is set.
+func joinTestDB(t testing.TB, users, orders int, indexed bool) *NewDatabase {
+	db := usersOrdersTestDB(t, indexed)
+	for i := 0; i < users; i++ {
+		mustInsert(t, db, "users", fmt.Sprintf("u%d", i), map[string]interface{}{"name": fmt.Sprintf("user %d", i)})
+	}
+	for i := 0; i < orders; i++ {
+		mustInsert(t, db, "orders", fmt.Sprintf("o%d", i), map[string]interface{}{
+			"user_id": fmt.Sprintf("u%d", i%users),
+			"total":   i,
+		})
+	}
+	return db
+}
+
+var usersOrdersQuery = Query{
+	Select:  []string{"users.id", "users.name", "orders.id", "orders.total"},
+	From:    "users",
+	Joins:   []Join{{Table: "orders", On: "orders.user_id = users.id"}},
+	Where:   "orders.total >= 10",
+	OrderBy: "orders.total",
+}
+
+func TestIndexJoinMatchesNestedLoop(t *testing.T) {
+	indexed := joinTestDB(t, 20, 200, true)
+	plain := joinTestDB(t, 20, 200, false)
+
+	for db, strategy := range map[*NewDatabase]string{indexed: IndexJoin, plain: NestedLoopJoin} {
+		explain, err := db.Explain(usersOrdersQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(explain, "("+strategy) {
+			t.Errorf("EXPLAIN\n%s\nwant strategy %s", explain, strategy)
+		}
+	}
+
+	want := mustQuery(t, plain, usersOrdersQuery)
+	got := mustQuery(t, indexed, usersOrdersQuery)
+	if len(want.Rows) != 190 {
+		t.Fatalf("nested loop join returned %d rows, want 190", len(want.Rows))
+	}
+	if !reflect.DeepEqual(got.Rows, want.Rows) {
+		t.Fatalf("index join and nested loop join differ:\n%v\n%v", got.Rows, want.Rows)
+	}
+}
+
+func TestIndexJoinSkipsUnmatchedRows(t *testing.T) {
+	db := joinTestDB(t, 3, 3, true)
+	mustInsert(t, db, "users", "lonely", map[string]interface{}{"name": "no orders"})
+	mustInsert(t, db, "orders", "orphan", map[string]interface{}{"user_id": "nobody", "total": 99})
+
+	result := mustQuery(t, db, Query{
+		Select:  []string{"users.id", "orders.id"},
+		From:    "users",
+		Joins:   []Join{{Table: "orders", On: "orders.user_id = users.id"}},
+		OrderBy: "users.id",
+	})
+	if len(result.Rows) != 3 {
+		t.Fatalf("join returned %v, want the three matched pairs", result.Rows)
+	}
+}
+
+// TestJoinOnAndWhere checks that the ON condition is applied while joining
+// and the WHERE clause before or after it, as the columns it reads allow.
+func TestJoinOnAndWhere(t *testing.T) {
+	db := joinTestDB(t, 3, 9, true)
+	query := Query{
+		Select:  []string{"users.id", "orders.id"},
+		From:    "users",
+		Joins:   []Join{{Table: "orders", On: "orders.user_id = users.id AND orders.total > 4"}},
+		Where:   "users.name != 'user 0' AND orders.total < 8",
+		OrderBy: "orders.id",
+	}
+
+	explain, err := db.Explain(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"SCAN users",
+		"FILTER (users.name != 'user 0')",
+		"JOIN orders ON orders.user_id = users.id AND orders.total > 4",
+		"FILTER (orders.total < 8)",
+		"SORT orders.id",
+		"PROJECT",
+	}
+	lines := strings.Split(strings.TrimSpace(explain), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("EXPLAIN\n%s\nwant %d steps", explain, len(want))
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("step %d = %q, want %q", i, lines[i], prefix)
+		}
+	}
+
+	// Orders 5 to 7 pass both conditions; order 6 belongs to user 0.
+	result := mustQuery(t, db, query)
+	var got [][2]interface{}
+	for _, row := range result.Rows {
+		got = append(got, [2]interface{}{row.Columns["users.id"], row.Columns["orders.id"]})
+	}
+	if want := [][2]interface{}{{"u2", "o5"}, {"u1", "o7"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+func benchmarkJoin(b *testing.B, indexed bool) {
+	db := joinTestDB(b, 200, 2000, indexed)
+	query := usersOrdersQuery
+	query.NoCache = true
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.ExecuteQuery(query); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJoinIndex(b *testing.B)      { benchmarkJoin(b, true) }
+func BenchmarkJoinNestedLoop(b *testing.B) { benchmarkJoin(b, false) }
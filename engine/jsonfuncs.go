@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonStep is one step of a JSON path: an object key, or an array index
+// when key is empty.
+type jsonStep struct {
+	key   string
+	index int
+}
+
+// parseJSONPath parses the JSONPath subset accepted by JSON_EXTRACT and
+// JSON_CONTAINS: $ followed by any number of .key and [index] steps, as in
+// $.items[0].sku.
+func parseJSONPath(path string) ([]jsonStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w: JSON path %q must start with $", ErrInvalidQuery, path)
+	}
+
+	var steps []jsonStep
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("%w: empty key in JSON path %q", ErrInvalidQuery, path)
+			}
+			steps = append(steps, jsonStep{key: rest[1:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated index in JSON path %q", ErrInvalidQuery, path)
+			}
+
+			index, err := strconv.Atoi(rest[1:end])
+
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("%w: bad index %q in JSON path %q", ErrInvalidQuery, rest[1:end], path)
+			}
+			steps = append(steps, jsonStep{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q in JSON path %q", ErrInvalidQuery, rest[0], path)
+		}
+	}
+	return steps, nil
+}
+
+// walkJSON follows steps from v; ok is false if a key or index is missing
+// or a step does not fit the value it is applied to.
+func walkJSON(v interface{}, steps []jsonStep) (interface{}, bool) {
+	for _, step := range steps {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			if step.key == "" {
+				return nil, false
+			}
+			child, ok := node[step.key]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			if step.key != "" || step.index >= len(node) {
+				return nil, false
+			}
+			v = node[step.index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// columnPath reads a column reference as a JSON path: the value of column,
+// then steps into it.
+type columnPath struct {
+	column string
+	steps  []jsonStep
+}
+
+func newColumnExpr(name string) columnExpr {
+	return columnExpr{name: name, paths: columnPaths(name)}
+}
+
+// columnPaths lists the ways name, such as profile.address.city or
+// orders.items[0].sku, splits into a column and a JSON path into it,
+// longest column name first, so that a qualified column in a join is
+// preferred to a key of the table-named column.
+func columnPaths(name string) []columnPath {
+	var paths []columnPath
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] != '.' && name[i] != '[' {
+			continue
+		}
+
+		steps, err := parseJSONPath("$" + name[i:])
+
+		if err != nil {
+			continue
+		}
+		paths = append(paths, columnPath{column: name[:i], steps: steps})
+	}
+	return paths
+}
+
+// isJSONValue reports whether v can be stored in a JSON column: nil, a
+// bool, number or string, or a []interface{} or map[string]interface{} of
+// such values.
+func isJSONValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil, bool, string:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if !isJSONValue(item) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		for _, item := range v {
+			if !isJSONValue(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return valueKind(v) == kindNumber
+}
+
+// jsonPathArg returns the value at the path in argument 1 of the document
+// in argument 0; found is false if either is NULL or the path is missing.
+func jsonPathArg(name string, args []interface{}) (interface{}, bool, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, false, nil
+	}
+
+	switch args[0].(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return nil, false, fmt.Errorf("%w: %s requires a JSON value, got %T", ErrInvalidQuery, name, args[0])
+	}
+
+	path, ok := args[1].(string)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %s requires a string path, got %T", ErrInvalidQuery, name, args[1])
+	}
+
+	steps, err := parseJSONPath(path)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	val, found := walkJSON(args[0], steps)
+	return val, found, nil
+}
+
+// jsonExtract implements JSON_EXTRACT(doc, path). The value is returned as
+// stored, so numbers decoded by encoding/json are Float; a missing path
+// yields NULL.
+func jsonExtract(args []interface{}) (interface{}, error) {
+	if err := checkArgs("JSON_EXTRACT", args, 2); err != nil {
+		return nil, err
+	}
+
+	val, _, err := jsonPathArg("JSON_EXTRACT", args)
+	return val, err
+}
+
+// jsonContains implements JSON_CONTAINS(doc, path, val): true if the value
+// at path equals val or is an array with an element equal to val, and false
+// if it does not or the path is missing.
+func jsonContains(args []interface{}) (interface{}, error) {
+	if err := checkArgs("JSON_CONTAINS", args, 3); err != nil {
+		return nil, err
+	}
+
+	val, found, err := jsonPathArg("JSON_CONTAINS", args)
+
+	if err != nil || args[0] == nil || args[1] == nil || args[2] == nil {
+		return nil, err
+	}
+	if !found || val == nil {
+		return false, nil
+	}
+
+	if items, ok := val.([]interface{}); ok {
+		for _, item := range items {
+			if item != nil && sameValue(item, args[2]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return sameValue(val, args[2]), nil
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// decodeJSON returns text decoded as json.Unmarshal would for a JSON column.
+func decodeJSON(t *testing.T, text string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestJSONExtract(t *testing.T) {
+	doc := decodeJSON(t, `{"user": {"name": "ann", "age": 31, "admin": false, "tags": ["a", "b"]}, "items": [{"sku": "x1", "qty": 2}, {"sku": "y2"}], "note": null}`)
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"$.user.name", "ann"},
+		{"$.user.age", 31.0},
+		{"$.user.admin", false},
+		{"$.user.tags[1]", "b"},
+		{"$.items[0].sku", "x1"},
+		{"$.items[0].qty", 2.0},
+		{"$.user.tags", []interface{}{"a", "b"}},
+		{"$.note", nil},
+		{"$.user.email", nil},
+		{"$.missing.deeper", nil},
+		{"$.items[5].sku", nil},
+		{"$.items[1].qty", nil},
+		{"$.user.name.first", nil},
+		{"$.user[0]", nil},
+	}
+	for _, tt := range tests {
+		got, err := callScalar(t, "JSON_EXTRACT", doc, tt.path)
+		if err != nil {
+			t.Errorf("JSON_EXTRACT(%s): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("JSON_EXTRACT(%s) = %#v (%T), want %#v (%T)", tt.path, got, got, tt.want, tt.want)
+		}
+	}
+
+	for _, path := range []string{"user.name", "$.", "$.items[x]", "$.items[0", "$user"} {
+		if _, err := callScalar(t, "JSON_EXTRACT", doc, path); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("JSON_EXTRACT(%q) = %v, want ErrInvalidQuery", path, err)
+		}
+	}
+	if got, err := callScalar(t, "JSON_EXTRACT", nil, "$.a"); err != nil || got != nil {
+		t.Errorf("JSON_EXTRACT(NULL) = %v, %v, want NULL", got, err)
+	}
+}
+
+func TestJSONContains(t *testing.T) {
+	doc := decodeJSON(t, `{"tags": ["go", "db"], "level": 3, "name": "kiv"}`)
+
+	tests := []struct {
+		path string
+		val  interface{}
+		want interface{}
+	}{
+		{"$.tags", "go", true},
+		{"$.tags", "rust", false},
+		{"$.level", int64(3), true},
+		{"$.level", 3.0, true},
+		{"$.name", "kiv", true},
+		{"$.name", "KIV", false},
+		{"$.missing", "x", false},
+		{"$.tags", nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := callScalar(t, "JSON_CONTAINS", doc, tt.path, tt.val)
+		if err != nil {
+			t.Errorf("JSON_CONTAINS(%s, %v): %v", tt.path, tt.val, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("JSON_CONTAINS(%s, %v) = %v, want %v", tt.path, tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestJSONColumn(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "events", []Column{{Name: "payload", DataType: JSON, Nullable: true}}, nil)
+	mustInsert(t, db, "events", "a", map[string]interface{}{"payload": decodeJSON(t, `{"kind": "click", "pos": {"x": 1, "y": 2}}`)})
+	mustInsert(t, db, "events", "b", map[string]interface{}{"payload": decodeJSON(t, `{"kind": "view", "tags": ["home"]}`)})
+	mustInsert(t, db, "events", "c", map[string]interface{}{"payload": decodeJSON(t, `[1, 2, 3]`)})
+
+	if err := db.InsertRow("events", "bad", map[string]interface{}{"payload": map[string]interface{}{"ch": make(chan int)}}); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("InsertRow of a non-JSON value = %v, want ErrSchemaViolation", err)
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "events", Where: "JSON_EXTRACT(payload, '$.kind') = 'click'"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("kind = click matched %v, want [a]", ids)
+	}
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "events", Where: "JSON_CONTAINS(payload, '$.tags', 'home')"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Errorf("tags contains home matched %v, want [b]", ids)
+	}
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "events", Where: "JSON_EXTRACT(payload, '$[2]') = 3"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"c"}) {
+		t.Errorf("$[2] = 3 matched %v, want [c]", ids)
+	}
+}
+
+func TestDottedPathFilter(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "people", []Column{{Name: "address", DataType: JSON, Nullable: true}}, nil)
+	mustInsert(t, db, "people", "a", map[string]interface{}{"address": decodeJSON(t, `{"city": "NYC", "geo": {"zip": "10001"}}`)})
+	mustInsert(t, db, "people", "b", map[string]interface{}{"address": decodeJSON(t, `{"city": "Oslo"}`)})
+	mustInsert(t, db, "people", "c", map[string]interface{}{"address": decodeJSON(t, `{"town": "Rye", "geo": "none"}`)})
+	mustInsert(t, db, "people", "d", map[string]interface{}{"address": nil})
+
+	tests := []struct {
+		where string
+		want  []string
+	}{
+		{"address.city = 'NYC'", []string{"a"}},
+		{"address.geo.zip = '10001'", []string{"a"}},
+		// A miss at the leaf.
+		{"address.city IS NULL", []string{"c", "d"}},
+		{"address.geo.plus4 IS NULL", []string{"a", "b", "c", "d"}},
+		// A miss at an intermediate level, including one that is not an
+		// object and a NULL column.
+		{"address.geo.zip IS NULL", []string{"b", "c", "d"}},
+		{"address.geo.zip = '10001' OR address.city = 'Oslo'", []string{"a", "b"}},
+		{"address.city <> 'NYC'", []string{"b"}},
+	}
+	for _, tt := range tests {
+		result := mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: tt.where, OrderBy: "id"})
+		if got := resultIDs(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WHERE %s = %v, want %v", tt.where, got, tt.want)
+		}
+	}
+}
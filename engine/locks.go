@@ -0,0 +1,374 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultLockTimeout = 5 * time.Second
+
+// LockRow waits until it holds the exclusive lock on the row. The lock has
+// no owner to write through it: UpdateRow, DeleteRow and commits that
+// write the row, the caller's own included, wait until it is released. To
+// lock a row and then write it, use LockRowTx.
+func (db *NewDatabase) LockRow(tableName, id string) (UnlockFunc, error) {
+	return db.lockRow(nil, tableName, id, true)
+}
+
+// ShareLockRow waits until it holds a shared lock on the row. Any number of
+// shared holders may coexist; LockRow, UpdateRow and DeleteRow wait until
+// every shared lock has been released. While one of them waits, new shared
+// locks wait too, except for owners already sharing the row.
+func (db *NewDatabase) ShareLockRow(tableName, id string) (UnlockFunc, error) {
+	return db.lockRow(nil, tableName, id, false)
+}
+
+// LockRowTx waits until tx holds the exclusive lock on the row, which it
+// keeps until it commits or rolls back. Committing tx writes the row
+// through the lock, while other writers wait for it as for LockRow's.
+func (db *NewDatabase) LockRowTx(tx *Transaction, tableName, id string) error {
+	return db.lockRowTx(tx, tableName, id, true)
+}
+
+// ShareLockRowTx waits until tx holds a shared lock on the row, which it
+// keeps until it commits or rolls back. If no one else holds a shared lock
+// on the row, committing tx may write it.
+func (db *NewDatabase) ShareLockRowTx(tx *Transaction, tableName, id string) error {
+	return db.lockRowTx(tx, tableName, id, false)
+}
+
+func (db *NewDatabase) lockRowTx(tx *Transaction, tableName, id string, exclusive bool) error {
+	if tx.Status != Pending {
+		return ErrTransactionFailed
+	}
+
+	unlock, err := db.lockRow(tx, tableName, id, exclusive)
+
+	if err != nil {
+		return err
+	}
+
+	db.txMu.Lock()
+	tx.Locks = append(tx.Locks, unlock)
+	db.txMu.Unlock()
+	return nil
+}
+
+// lockRow takes the lock on a row that exists for owner, or for a new
+// owner of its own if owner is nil.
+func (db *NewDatabase) lockRow(owner *Transaction, tableName, id string, exclusive bool) (UnlockFunc, error) {
+	if _, err := db.GetRowByID(tableName, id); err != nil {
+		return nil, err
+	}
+
+	return db.acquireRowLock(owner, tableName, id, exclusive)
+}
+
+// ForUpdate runs query and takes the exclusive lock on every returned row,
+// like SELECT ... FOR UPDATE. The rows are locked before the query is run
+// again, so that the result is read with every row in it locked: no other
+// writer can change them until result.Unlock is called. Rows that no
+// longer match once locked are unlocked, and rows that match for the
+// first time are locked and the query run once more. If any lock cannot
+// be taken within the lock timeout, every lock already taken is released
+// and ErrLockTimeout is returned.
+//
+// The locks have no owner, so that every write to the rows waits for
+// them. To lock rows and then write them, use ForUpdateTx.
+func (db *NewDatabase) ForUpdate(query Query) (QueryResult, error) {
+	return db.forUpdate(&Transaction{}, query)
+}
+
+// ForUpdateTx runs query and locks the returned rows for tx, as ForUpdate
+// does. The locks are held until tx commits or rolls back, or until
+// result.Unlock is called, and committing tx writes the rows through them.
+func (db *NewDatabase) ForUpdateTx(tx *Transaction, query Query) (QueryResult, error) {
+	if tx.Status != Pending {
+		return QueryResult{}, ErrTransactionFailed
+	}
+
+	result, err := db.forUpdate(tx, query)
+
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	db.txMu.Lock()
+	tx.Locks = append(tx.Locks, result.Unlock)
+	db.txMu.Unlock()
+	return result, nil
+}
+
+func (db *NewDatabase) forUpdate(owner *Transaction, query Query) (QueryResult, error) {
+	withID := query
+	if !containsString(query.Select, "id") {
+		withID.Select = append(append([]string(nil), query.Select...), "id")
+	}
+
+	locks := make(map[string]UnlockFunc)
+	release := func() {
+		for _, unlock := range locks {
+			unlock()
+		}
+	}
+
+	for {
+		result, err := db.ExecuteQuery(withID)
+
+		if err != nil {
+			release()
+			return QueryResult{}, err
+		}
+
+		matched := make(map[string]bool, len(result.Rows))
+		var unlocked []string
+		for _, row := range result.Rows {
+			id := rowID(row)
+			if !matched[id] && locks[id] == nil {
+				unlocked = append(unlocked, id)
+			}
+			matched[id] = true
+		}
+
+		if len(unlocked) > 0 {
+			sort.Strings(unlocked)
+			for _, id := range unlocked {
+				unlock, err := db.acquireRowLock(owner, query.From, id, true)
+
+				if err != nil {
+					release()
+					return QueryResult{}, err
+				}
+				locks[id] = unlock
+			}
+			continue
+		}
+
+		for id, unlock := range locks {
+			if !matched[id] {
+				unlock()
+				delete(locks, id)
+			}
+		}
+
+		if len(withID.Select) != len(query.Select) {
+			result.Columns = query.Select
+			result.ColumnTypes = result.ColumnTypes[:len(query.Select)]
+			for _, row := range result.Rows {
+				delete(row.Columns, "id")
+			}
+		}
+
+		var once sync.Once
+		result.Unlock = func() {
+			once.Do(release)
+		}
+		return result, nil
+	}
+}
+
+func (db *NewDatabase) SetLockTimeout(d time.Duration) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.lockTimeout = d
+}
+
+// rowLock is the lock on one row, held exclusively by one owner or shared
+// by any number. An owner may take it more than once, and may take it
+// exclusively while it is the only one sharing it. refs counts the
+// holders and waiters; the lock is forgotten only once there are none, so
+// that everyone locking the row uses the same one.
+type rowLock struct {
+	exclusive      *Transaction
+	exclusiveHolds int
+	holds          map[*Transaction]int
+	refs           int
+
+	// exclusiveWaiters counts the owners waiting to hold the lock
+	// exclusively. While there are any, owners not yet holding it cannot
+	// share it, so that a stream of shared holders cannot keep them
+	// waiting until they time out.
+	exclusiveWaiters int
+	// released is closed, and replaced, whenever the lock may have become
+	// free for a waiter.
+	released chan struct{}
+}
+
+// tryLock takes the lock for owner if no other owner's holds, or waits
+// for an exclusive hold, prevent it.
+func (l *rowLock) tryLock(owner *Transaction, exclusive bool) bool {
+	if l.exclusive != nil && l.exclusive != owner {
+		return false
+	}
+	if exclusive {
+		for holder := range l.holds {
+			if holder != owner {
+				return false
+			}
+		}
+		l.exclusive = owner
+		l.exclusiveHolds++
+	} else if l.exclusiveWaiters > 0 && l.holds[owner] == 0 {
+		return false
+	}
+	l.holds[owner]++
+	return true
+}
+
+func (l *rowLock) unlock(owner *Transaction, exclusive bool) {
+	if exclusive {
+		if l.exclusiveHolds--; l.exclusiveHolds == 0 {
+			l.exclusive = nil
+		}
+	}
+	if l.holds[owner]--; l.holds[owner] == 0 {
+		delete(l.holds, owner)
+	}
+	l.wake()
+}
+
+// wake wakes every owner waiting for the lock to try again.
+func (l *rowLock) wake() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// acquireRowLock waits until owner holds the lock on the row, or until the
+// lock timeout passes. A nil owner stands for a new owner of its own, so
+// that the lock is shared with no one else's writes. Waiters sleep until
+// a hold on the row is released.
+func (db *NewDatabase) acquireRowLock(owner *Transaction, tableName, id string, exclusive bool) (UnlockFunc, error) {
+	db.mu.RLock()
+	timeout := db.lockTimeout
+	db.mu.RUnlock()
+
+	if timeout <= 0 {
+		timeout = defaultLockTimeout
+	}
+
+	if owner == nil {
+		owner = &Transaction{}
+	}
+	key := rowLockKey(tableName, id)
+	l := db.refRowLock(key)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	waiting := false
+	for {
+		db.rowLockMu.Lock()
+		if l.tryLock(owner, exclusive) {
+			if waiting && exclusive {
+				l.exclusiveWaiters--
+			}
+			db.rowLockMu.Unlock()
+			break
+		}
+		if !waiting && exclusive {
+			l.exclusiveWaiters++
+		}
+		waiting = true
+		released := l.released
+		db.rowLockMu.Unlock()
+
+		select {
+		case <-released:
+		case <-timer.C:
+			if exclusive {
+				db.rowLockMu.Lock()
+				l.exclusiveWaiters--
+				l.wake()
+				db.rowLockMu.Unlock()
+			}
+			db.releaseRowLock(key, l, nil, false)
+			return nil, queryError(CodeWriteConflict, ErrLockTimeout, id, "row %s in table %s", id, tableName)
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			db.releaseRowLock(key, l, owner, exclusive)
+		})
+	}, nil
+}
+
+// tryAcquireRowLock takes the exclusive lock on the row for a new owner
+// of its own, without waiting, and reports whether it could.
+func (db *NewDatabase) tryAcquireRowLock(tableName, id string) (UnlockFunc, bool) {
+	key := rowLockKey(tableName, id)
+	l := db.refRowLock(key)
+	owner := &Transaction{}
+
+	if !db.tryRowLock(l, owner, true) {
+		db.releaseRowLock(key, l, nil, false)
+		return nil, false
+	}
+	return func() {
+		db.releaseRowLock(key, l, owner, true)
+	}, true
+}
+
+// tryRowLock takes the row lock l for owner, without waiting, if it is
+// free for it. The caller must hold a reference to l.
+func (db *NewDatabase) tryRowLock(l *rowLock, owner *Transaction, exclusive bool) bool {
+	db.rowLockMu.Lock()
+	defer db.rowLockMu.Unlock()
+
+	return l.tryLock(owner, exclusive)
+}
+
+// refRowLock returns the lock stored under key, adding it if there is
+// none, and counts a reference to it.
+func (db *NewDatabase) refRowLock(key string) *rowLock {
+	db.rowLockMu.Lock()
+	defer db.rowLockMu.Unlock()
+
+	if db.rowLocks == nil {
+		db.rowLocks = make(map[string]*rowLock)
+	}
+	l := db.rowLocks[key]
+	if l == nil {
+		l = &rowLock{holds: make(map[*Transaction]int), released: make(chan struct{})}
+		db.rowLocks[key] = l
+	}
+	l.refs++
+	return l
+}
+
+// releaseRowLock releases owner's hold on l, if owner is not nil, and the
+// reference to it, forgetting l once nothing refers to it.
+func (db *NewDatabase) releaseRowLock(key string, l *rowLock, owner *Transaction, exclusive bool) {
+	db.rowLockMu.Lock()
+	defer db.rowLockMu.Unlock()
+
+	if owner != nil {
+		l.unlock(owner, exclusive)
+	}
+	if l.refs--; l.refs == 0 {
+		delete(db.rowLocks, key)
+	}
+}
+
+func rowLockKey(tableName, id string) string {
+	return tableName + "\x00" + id
+}
+
+func (t *Transaction) releaseLocks() {
+	for _, unlock := range t.Locks {
+		unlock()
+	}
+	t.Locks = nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,418 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func lockTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	db.SetLockTimeout(50 * time.Millisecond)
+	mustCreateTable(t, db, "accounts", []Column{{Name: "balance", DataType: Int}}, nil)
+	mustInsert(t, db, "accounts", "a", map[string]interface{}{"balance": 10})
+	return db
+}
+
+func TestLockRowBlocksWriters(t *testing.T) {
+	db := lockTestDB(t)
+
+	unlock, err := db.LockRow("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 20}); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("UpdateRow while locked = %v, want ErrLockTimeout", err)
+	}
+	if err := db.DeleteRow("accounts", "a"); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("DeleteRow while locked = %v, want ErrLockTimeout", err)
+	}
+
+	unlock()
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 20}); err != nil {
+		t.Fatalf("UpdateRow after unlock: %v", err)
+	}
+}
+
+func TestLockWaiterWakesOnRelease(t *testing.T) {
+	db := lockTestDB(t)
+	db.SetLockTimeout(5 * time.Second)
+
+	unlock, err := db.LockRow("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 20})
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("UpdateRow returned %v while the row was locked", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	released := time.Now()
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("UpdateRow after unlock: %v", err)
+	}
+	if waited := time.Since(released); waited > time.Second {
+		t.Fatalf("UpdateRow took %v after the lock was released", waited)
+	}
+}
+
+func TestLockRowTxOwnerWrites(t *testing.T) {
+	db := lockTestDB(t)
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LockRowTx(tx, "accounts", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 99}); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("other writer's UpdateRow = %v, want ErrLockTimeout", err)
+	}
+
+	other, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRowTx(other, "accounts", "a", map[string]interface{}{"balance": 98}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(other); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("other transaction's commit = %v, want ErrLockTimeout", err)
+	}
+	if other.Status != RolledBack {
+		t.Fatalf("other transaction status = %v, want RolledBack", other.Status)
+	}
+
+	if err := db.UpdateRowTx(tx, "accounts", "a", map[string]interface{}{"balance": 11}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatalf("owner's commit: %v", err)
+	}
+
+	row, err := db.GetRowByID("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toInt64(row.Columns["balance"]) != 11 {
+		t.Fatalf("balance = %v, want 11", row.Columns["balance"])
+	}
+
+	// Committing released the lock.
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 12}); err != nil {
+		t.Fatalf("UpdateRow after commit: %v", err)
+	}
+}
+
+func TestLockRowTxReleasedOnRollback(t *testing.T) {
+	db := lockTestDB(t)
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LockRowTx(tx, "accounts", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RollbackTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 1}); err != nil {
+		t.Fatalf("UpdateRow after rollback: %v", err)
+	}
+}
+
+func TestLockRowMissingRow(t *testing.T) {
+	db := lockTestDB(t)
+
+	if _, err := db.LockRow("accounts", "missing"); !errors.Is(err, ErrIDNotFound) {
+		t.Fatalf("LockRow(missing) = %v, want ErrIDNotFound", err)
+	}
+}
+
+// TestLockRowExclusiveAcrossDeletes checks that deleting a row never hands
+// a second caller a fresh lock while the first still holds the old one.
+func TestLockRowExclusiveAcrossDeletes(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+
+	var holders [3]int32
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				slot := i % len(holders)
+				id := fmt.Sprint(slot)
+				db.InsertRow("items", id, map[string]interface{}{"n": i})
+
+				unlock, err := db.LockRow("items", id)
+				if err != nil {
+					continue
+				}
+				if n := atomic.AddInt32(&holders[slot], 1); n != 1 {
+					t.Errorf("row %s has %d holders", id, n)
+				}
+				if g%2 == 0 {
+					go db.DeleteRow("items", id)
+				}
+				atomic.AddInt32(&holders[slot], -1)
+				unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestRowLocksForgottenWhenReleased(t *testing.T) {
+	db := lockTestDB(t)
+
+	unlock, err := db.LockRow("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	unlock()
+	if err := db.DeleteRow("accounts", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.rowLockMu.Lock()
+	defer db.rowLockMu.Unlock()
+	if len(db.rowLocks) != 0 {
+		t.Fatalf("%d row locks left, want 0", len(db.rowLocks))
+	}
+}
+
+func forUpdateTestDB(t *testing.T) *NewDatabase {
+	db := lockTestDB(t)
+	mustInsert(t, db, "accounts", "b", map[string]interface{}{"balance": 20})
+	mustInsert(t, db, "accounts", "c", map[string]interface{}{"balance": 1})
+	return db
+}
+
+func TestForUpdateLocksResultRows(t *testing.T) {
+	db := forUpdateTestDB(t)
+
+	result, err := db.ForUpdate(Query{Select: []string{"balance"}, From: "accounts", Where: "balance > 5", OrderBy: "balance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Columns) != 1 || result.Columns[0] != "balance" || len(result.Rows) != 2 {
+		t.Fatalf("result = %v %v, want the balance of two rows", result.Columns, result.Rows)
+	}
+	for _, row := range result.Rows {
+		if _, ok := row.Columns["id"]; ok {
+			t.Fatalf("row %v has the id ForUpdate added to lock it", row.Columns)
+		}
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if err := db.UpdateRow("accounts", id, map[string]interface{}{"balance": 0}); !errors.Is(err, ErrLockTimeout) {
+			t.Fatalf("UpdateRow(%s) while locked = %v, want ErrLockTimeout", id, err)
+		}
+	}
+	if err := db.UpdateRow("accounts", "c", map[string]interface{}{"balance": 2}); err != nil {
+		t.Fatalf("UpdateRow of a row outside the result: %v", err)
+	}
+
+	result.Unlock()
+	result.Unlock()
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 0}); err != nil {
+		t.Fatalf("UpdateRow after Unlock: %v", err)
+	}
+}
+
+func TestForUpdateTimeoutReleasesLocks(t *testing.T) {
+	db := forUpdateTestDB(t)
+
+	// ForUpdate locks in id order, so it takes a and b before waiting for c.
+	unlock, err := db.LockRow("accounts", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	if _, err := db.ForUpdate(Query{Select: []string{"id"}, From: "accounts"}); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("ForUpdate = %v, want ErrLockTimeout", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := db.UpdateRow("accounts", id, map[string]interface{}{"balance": 0}); err != nil {
+			t.Fatalf("UpdateRow(%s) after ForUpdate failed: %v", id, err)
+		}
+	}
+}
+
+// TestForUpdateRereadsLockedRows checks that ForUpdate's result is read
+// once the rows are locked, not before, so that a write it waited for is
+// reflected in it.
+func TestForUpdateRereadsLockedRows(t *testing.T) {
+	db := forUpdateTestDB(t)
+	db.SetLockTimeout(5 * time.Second)
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LockRowTx(tx, "accounts", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	type forUpdateResult struct {
+		result QueryResult
+		err    error
+	}
+	done := make(chan forUpdateResult, 1)
+	go func() {
+		result, err := db.ForUpdate(Query{Select: []string{"id", "balance"}, From: "accounts", Where: "balance > 5", OrderBy: "id"})
+		done <- forUpdateResult{result, err}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := db.UpdateRowTx(tx, "accounts", "a", map[string]interface{}{"balance": 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-done
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	defer got.result.Unlock()
+	if ids := resultIDs(got.result); len(ids) != 1 || ids[0] != "b" {
+		t.Fatalf("ForUpdate ids = %v, want [b]", ids)
+	}
+
+	// a no longer matched once it was locked, so it was unlocked again.
+	db.SetLockTimeout(50 * time.Millisecond)
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 3}); err != nil {
+		t.Fatalf("UpdateRow of a row dropped from the result: %v", err)
+	}
+}
+
+func TestForUpdateTxOwnerWrites(t *testing.T) {
+	db := forUpdateTestDB(t)
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.ForUpdateTx(tx, Query{Select: []string{"id", "balance"}, From: "accounts", Where: "id = 'a'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 {
+		t.Fatalf("ForUpdateTx rows = %v, want one", result.Rows)
+	}
+
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 0}); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("other writer's UpdateRow = %v, want ErrLockTimeout", err)
+	}
+
+	balance := toInt64(result.Rows[0].Columns["balance"])
+	if err := db.UpdateRowTx(tx, "accounts", "a", map[string]interface{}{"balance": balance + 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatalf("owner's commit: %v", err)
+	}
+
+	row, err := db.GetRowByID("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toInt64(row.Columns["balance"]) != 15 {
+		t.Fatalf("balance = %v, want 15", row.Columns["balance"])
+	}
+	if err := db.UpdateRow("accounts", "a", map[string]interface{}{"balance": 0}); err != nil {
+		t.Fatalf("UpdateRow after commit: %v", err)
+	}
+
+	if _, err := db.ForUpdateTx(tx, Query{Select: []string{"id"}, From: "accounts"}); !errors.Is(err, ErrTransactionFailed) {
+		t.Fatalf("ForUpdateTx on a committed transaction = %v, want ErrTransactionFailed", err)
+	}
+}
+
+func TestExclusiveWaiterNotStarvedBySharers(t *testing.T) {
+	db := lockTestDB(t)
+	db.SetLockTimeout(5 * time.Second)
+
+	unlockFirst, err := db.ShareLockRow("accounts", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	var mu sync.Mutex
+	record := func(name string) {
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+
+	writerDone := make(chan error, 1)
+	go func() {
+		unlock, err := db.LockRow("accounts", "a")
+		if err == nil {
+			record("writer")
+			unlock()
+		}
+		writerDone <- err
+	}()
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		db.rowLockMu.Lock()
+		l := db.rowLocks[rowLockKey("accounts", "a")]
+		waiting := l != nil && l.exclusiveWaiters == 1
+		db.rowLockMu.Unlock()
+		if waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("writer never started waiting")
+		}
+	}
+
+	readerDone := make(chan error, 1)
+	go func() {
+		unlock, err := db.ShareLockRow("accounts", "a")
+		if err == nil {
+			record("reader")
+			unlock()
+		}
+		readerDone <- err
+	}()
+
+	select {
+	case err := <-readerDone:
+		t.Fatalf("new shared lock taken while a writer waits: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlockFirst()
+	if err := <-writerDone; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-readerDone; err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(order); got != "[writer reader]" {
+		t.Fatalf("locks taken in order %s, want [writer reader]", got)
+	}
+}
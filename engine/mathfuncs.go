@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// numberArg returns argument i as an int64 or a float64. Decimals are
+// taken as floats.
+func numberArg(name string, args []interface{}, i int) (interface{}, bool, error) {
+	v := args[i]
+	switch {
+	case v == nil:
+		return nil, false, nil
+	case valueKind(v) != kindNumber:
+		return nil, false, fmt.Errorf("%w: %s requires a number, got %T", ErrInvalidQuery, name, v)
+	case isFloat(v), isDecimal(v):
+		return toFloat(v), true, nil
+	default:
+		return toInt64(v), true, nil
+	}
+}
+
+// numberArgs returns every argument as with numberArg; ok is false if any
+// of them is NULL.
+func numberArgs(name string, args []interface{}) ([]interface{}, bool, error) {
+	nums := make([]interface{}, len(args))
+	for i := range args {
+		n, ok, err := numberArg(name, args, i)
+
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		nums[i] = n
+	}
+	return nums, true, nil
+}
+
+// numberFunc builds a one-argument function that keeps integers integral
+// and applies fn to floats.
+func numberFunc(name string, intFn func(int64) (int64, error), fn func(float64) float64) scalarFunc {
+	return func(args []interface{}) (interface{}, error) {
+		if err := checkArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		n, ok, err := numberArg(name, args, 0)
+
+		if err != nil || !ok {
+			return nil, err
+		}
+		if i, isInt := n.(int64); isInt {
+			return intFn(i)
+		}
+		return fn(n.(float64)), nil
+	}
+}
+
+func absInt(n int64) (int64, error) {
+	if n == math.MinInt64 {
+		return 0, fmt.Errorf("%w: ABS(%d) overflows Int", ErrInvalidQuery, n)
+	}
+	if n < 0 {
+		return -n, nil
+	}
+	return n, nil
+}
+
+func sameInt(n int64) (int64, error) {
+	return n, nil
+}
+
+// round implements ROUND(x) and ROUND(x, decimals). Halves round away from
+// zero, and negative decimals round to tens, hundreds and so on. Integers
+// stay integral.
+func round(args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("%w: ROUND takes 1 or 2 arguments, got %d", ErrInvalidQuery, len(args))
+	}
+
+	nums, ok, err := numberArgs("ROUND", args)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var decimals int64
+	if len(nums) == 2 {
+		d, isInt := nums[1].(int64)
+		if !isInt {
+			return nil, fmt.Errorf("%w: ROUND requires integer decimals", ErrInvalidQuery)
+		}
+		decimals = d
+	}
+
+	switch n := nums[0].(type) {
+	case int64:
+		if decimals >= 0 {
+			return n, nil
+		}
+		if decimals < -18 {
+			return int64(0), nil
+		}
+		scale := int64(math.Pow10(int(-decimals)))
+		rounded := n / scale * scale
+		if rem := n % scale; rem*2 >= scale {
+			rounded += scale
+		} else if rem*2 <= -scale {
+			rounded -= scale
+		}
+		if (n > 0 && rounded < 0) || (n < 0 && rounded > 0) {
+			return nil, fmt.Errorf("%w: ROUND(%d, %d) overflows Int", ErrInvalidQuery, n, decimals)
+		}
+		return rounded, nil
+	default:
+		f := n.(float64)
+		if decimals == 0 {
+			return math.Round(f), nil
+		}
+		scale := math.Pow10(int(decimals))
+		if math.IsInf(scale, 0) || scale == 0 {
+			return f, nil
+		}
+		return math.Round(f*scale) / scale, nil
+	}
+}
+
+// mod implements MOD(x, divisor). The result takes the sign of x, and is an
+// Int when both arguments are.
+func mod(args []interface{}) (interface{}, error) {
+	if err := checkArgs("MOD", args, 2); err != nil {
+		return nil, err
+	}
+
+	nums, ok, err := numberArgs("MOD", args)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	x, xInt := nums[0].(int64)
+	d, dInt := nums[1].(int64)
+	if xInt && dInt {
+		if d == 0 {
+			return nil, fmt.Errorf("%w: MOD(%d, 0)", ErrDivisionByZero, x)
+		}
+		if d == -1 {
+			return int64(0), nil
+		}
+		return x % d, nil
+	}
+
+	divisor := toFloat(nums[1])
+	if divisor == 0 {
+		return nil, fmt.Errorf("%w: MOD(%v, 0)", ErrDivisionByZero, nums[0])
+	}
+	return math.Mod(toFloat(nums[0]), divisor), nil
+}
+
+func sqrt(args []interface{}) (interface{}, error) {
+	if err := checkArgs("SQRT", args, 1); err != nil {
+		return nil, err
+	}
+
+	n, ok, err := numberArg("SQRT", args, 0)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	f := toFloat(n)
+	if f < 0 {
+		return nil, fmt.Errorf("%w: SQRT of negative number %v", ErrInvalidQuery, n)
+	}
+	return math.Sqrt(f), nil
+}
+
+// pow implements POW(x, exp). The result is always a Float, but when both
+// arguments are Ints it must also fit in an Int.
+func pow(args []interface{}) (interface{}, error) {
+	if err := checkArgs("POW", args, 2); err != nil {
+		return nil, err
+	}
+
+	nums, ok, err := numberArgs("POW", args)
+
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	result := math.Pow(toFloat(nums[0]), toFloat(nums[1]))
+
+	_, xInt := nums[0].(int64)
+	_, eInt := nums[1].(int64)
+	if xInt && eInt && (result >= math.MaxInt64 || result < math.MinInt64) {
+		return nil, fmt.Errorf("%w: POW(%d, %d) overflows Int", ErrInvalidQuery, nums[0], nums[1])
+	}
+	if math.IsNaN(result) {
+		return nil, fmt.Errorf("%w: POW(%v, %v) is not a real number", ErrInvalidQuery, nums[0], nums[1])
+	}
+	return result, nil
+}
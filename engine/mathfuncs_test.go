@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestNumericFunctions(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want interface{}
+	}{
+		{"ABS", []interface{}{int64(-5)}, int64(5)},
+		{"ABS", []interface{}{int64(0)}, int64(0)},
+		{"ABS", []interface{}{-2.5}, 2.5},
+		{"CEIL", []interface{}{1.2}, 2.0},
+		{"CEIL", []interface{}{-1.2}, -1.0},
+		{"CEIL", []interface{}{int64(3)}, int64(3)},
+		{"FLOOR", []interface{}{1.8}, 1.0},
+		{"FLOOR", []interface{}{-1.2}, -2.0},
+		{"ROUND", []interface{}{2.5}, 3.0},
+		{"ROUND", []interface{}{-2.5}, -3.0},
+		{"ROUND", []interface{}{3.14159, int64(2)}, 3.14},
+		{"ROUND", []interface{}{int64(7)}, int64(7)},
+		{"ROUND", []interface{}{int64(1250), int64(-2)}, int64(1300)},
+		{"ROUND", []interface{}{int64(-1250), int64(-2)}, int64(-1300)},
+		{"ROUND", []interface{}{1234.5, int64(-2)}, 1200.0},
+		{"MOD", []interface{}{int64(7), int64(3)}, int64(1)},
+		{"MOD", []interface{}{int64(-7), int64(3)}, int64(-1)},
+		{"MOD", []interface{}{int64(0), int64(3)}, int64(0)},
+		{"MOD", []interface{}{int64(math.MinInt64), int64(-1)}, int64(0)},
+		{"MOD", []interface{}{7.5, int64(2)}, 1.5},
+		{"MOD", []interface{}{-7.5, 2.0}, -1.5},
+		{"SQRT", []interface{}{int64(16)}, 4.0},
+		{"SQRT", []interface{}{int64(0)}, 0.0},
+		{"SQRT", []interface{}{2.25}, 1.5},
+		{"POW", []interface{}{int64(2), int64(10)}, 1024.0},
+		{"POW", []interface{}{int64(-2), int64(3)}, -8.0},
+		{"POW", []interface{}{int64(2), int64(-1)}, 0.5},
+		{"POW", []interface{}{int64(0), int64(0)}, 1.0},
+		{"POW", []interface{}{4.0, 0.5}, 2.0},
+	}
+	for _, tt := range tests {
+		got, err := callScalar(t, tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("%s%v: %v", tt.name, tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s%v = %#v, want %#v", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestNumericFunctionsPropagateNull(t *testing.T) {
+	calls := []struct {
+		name string
+		args []interface{}
+	}{
+		{"ABS", []interface{}{nil}},
+		{"CEIL", []interface{}{nil}},
+		{"FLOOR", []interface{}{nil}},
+		{"ROUND", []interface{}{nil}},
+		{"ROUND", []interface{}{1.5, nil}},
+		{"MOD", []interface{}{nil, int64(2)}},
+		{"MOD", []interface{}{int64(2), nil}},
+		{"SQRT", []interface{}{nil}},
+		{"POW", []interface{}{int64(2), nil}},
+	}
+	for _, c := range calls {
+		got, err := callScalar(t, c.name, c.args...)
+		if err != nil || got != nil {
+			t.Errorf("%s%v = %#v, %v, want NULL", c.name, c.args, got, err)
+		}
+	}
+}
+
+func TestNumericFunctionErrors(t *testing.T) {
+	for _, args := range [][]interface{}{{int64(5), int64(0)}, {5.5, 0.0}, {int64(5), 0.0}} {
+		if _, err := callScalar(t, "MOD", args...); !errors.Is(err, ErrDivisionByZero) {
+			t.Errorf("MOD%v = %v, want ErrDivisionByZero", args, err)
+		}
+	}
+
+	calls := []struct {
+		name string
+		args []interface{}
+	}{
+		{"ABS", []interface{}{int64(math.MinInt64)}},
+		{"POW", []interface{}{int64(10), int64(19)}},
+		{"POW", []interface{}{int64(-2), int64(64)}},
+		{"POW", []interface{}{-8.0, 0.5}},
+		{"SQRT", []interface{}{int64(-1)}},
+		{"ROUND", []interface{}{1.5, 0.5}},
+		{"ABS", []interface{}{"1"}},
+	}
+	for _, c := range calls {
+		if _, err := callScalar(t, c.name, c.args...); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s%v = %v, want ErrInvalidQuery", c.name, c.args, err)
+		}
+	}
+}
+
+func TestNumericFunctionsInQuery(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "points", []Column{
+		{Name: "x", DataType: Int},
+		{Name: "y", DataType: Float},
+	}, nil)
+	mustInsert(t, db, "points", "a", map[string]interface{}{"x": 3, "y": -4.4})
+
+	result := mustQuery(t, db, Query{Select: []string{"SQRT(POW(x, 2) + POW(ROUND(y), 2))", "MOD(x, 2)"}, From: "points"})
+	row := result.Rows[0]
+	if got := row.Columns[result.Columns[0]]; got != 5.0 {
+		t.Errorf("%s = %#v, want 5.0", result.Columns[0], got)
+	}
+	if got := row.Columns[result.Columns[1]]; toInt64(got) != 1 {
+		t.Errorf("%s = %#v, want 1", result.Columns[1], got)
+	}
+}
@@ -0,0 +1,320 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// matView is a materialized view: the query whose result is stored as the
+// table of the view's name, and the writes stamp of each table the query
+// read when that result was computed.
+type matView struct {
+	query       Query
+	opts        MatViewOptions
+	stamps      map[string]uint64
+	refreshedAt time.Time
+
+	// kick asks the goroutine refreshing a RefreshOnChange view to run;
+	// stop ends its subscriptions.
+	kick chan struct{}
+	stop context.CancelFunc
+}
+
+// CreateMaterializedView runs query and stores its result as the table
+// name, which queries read as any other. Its columns are the query's,
+// named as opts.Columns says, and its rows have the ids the query selects
+// as id or else "1", "2" and so on in result order. It is recomputed by
+// RefreshView and as opts.Refresh says, each time replacing the whole
+// table at once so that readers see either the old contents or the new.
+//
+// Writes to a materialized view fail with ErrViewReadOnly; DropTable drops
+// it. RefreshOnChange views are not refreshed by the refresh of a
+// materialized view they read. Like views, materialized views are not
+// saved to disk.
+func (db *NewDatabase) CreateMaterializedView(name string, query Query, opts MatViewOptions) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if name == "" {
+		return fmt.Errorf("%w: materialized view needs a name", ErrInvalidQuery)
+	}
+	if opts.Refresh < RefreshManual || opts.Refresh > RefreshOnRead {
+		return fmt.Errorf("%w: materialized view %s has unknown refresh %s", ErrInvalidQuery, name, opts.Refresh)
+	}
+
+	query.Select = append([]string(nil), query.Select...)
+	opts.Columns = append([]string(nil), opts.Columns...)
+	view := &matView{query: query, opts: opts}
+	table, stamps, err := db.computeMatView(name, view)
+
+	if err != nil {
+		return err
+	}
+
+	if opts.Refresh == RefreshOnChange {
+		if err := db.watchMatView(name, view, stamps); err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.Tables[name]; exists || db.metaTables[name] != nil || db.views[name] != nil {
+		if view.stop != nil {
+			view.stop()
+		}
+		return fmt.Errorf("%w: %s", ErrTableExists, name)
+	}
+
+	view.stamps, view.refreshedAt = stamps, time.Now()
+	if db.matViews == nil {
+		db.matViews = make(map[string]*matView)
+	}
+	db.matViews[name] = view
+	table.touchSchema()
+	db.Tables[name] = table
+	db.replicateTable(name)
+
+	if opts.Refresh == RefreshOnChange && db.matViewStale(view) {
+		// A table changed while the view was being computed, before
+		// refreshes could find it.
+		view.requestRefresh()
+	}
+	return nil
+}
+
+// RefreshView recomputes the materialized view name and replaces its
+// contents with the result.
+func (db *NewDatabase) RefreshView(name string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.RLock()
+	view := db.matViews[name]
+	db.mu.RUnlock()
+
+	if view == nil {
+		return fmt.Errorf("%w: materialized view %s", ErrTableNotFound, name)
+	}
+
+	table, stamps, err := db.computeMatView(name, view)
+
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.matViews[name] != view {
+		return fmt.Errorf("%w: materialized view %s", ErrTableNotFound, name)
+	}
+
+	table.touchSchema()
+	db.Tables[name] = table
+	view.stamps, view.refreshedAt = stamps, time.Now()
+	db.replicateTable(name)
+	return nil
+}
+
+// computeMatView runs view's query and returns the table holding its
+// result, with the writes stamps of the tables the query read, taken
+// before it ran.
+func (db *NewDatabase) computeMatView(name string, view *matView) (Table, map[string]uint64, error) {
+	query := view.query
+	query.NoCache = true
+
+	expanded, err := db.expandViews(query)
+
+	if err != nil {
+		return Table{}, nil, fmt.Errorf("materialized view %s: %w", name, err)
+	}
+
+	db.mu.RLock()
+	stamps := make(map[string]uint64)
+	for _, table := range queryTables(expanded) {
+		stamps[table] = db.Tables[table].writes
+	}
+	db.mu.RUnlock()
+
+	result, err := db.ExecuteQuery(query)
+
+	if err != nil {
+		return Table{}, nil, fmt.Errorf("materialized view %s: %w", name, err)
+	}
+
+	table, err := matViewTable(name, result, view.opts.Columns)
+
+	if err != nil {
+		return Table{}, nil, err
+	}
+	return table, stamps, nil
+}
+
+// matViewTable returns the table called name holding result, its columns
+// renamed to columns if there are any.
+func matViewTable(name string, result QueryResult, columns []string) (Table, error) {
+	if len(columns) == 0 {
+		columns = result.Columns
+	}
+	if len(columns) != len(result.Columns) {
+		return Table{}, fmt.Errorf("%w: materialized view %s names %d columns for %d SELECT items", ErrInvalidSchema, name, len(columns), len(result.Columns))
+	}
+
+	table := Table{Name: name, Rows: make([]Row, 0, len(result.Rows))}
+	for i, column := range columns {
+		if column == "id" {
+			continue
+		}
+
+		dataType := result.ColumnTypes[i]
+		switch dataType {
+		case Enum:
+			dataType = String
+		case Array:
+			dataType = JSON
+		}
+		table.Columns = append(table.Columns, Column{Name: column, DataType: dataType, Nullable: true})
+	}
+	if err := validateSchema(table.Columns, nil); err != nil {
+		return Table{}, fmt.Errorf("materialized view %s: %w", name, err)
+	}
+
+	for n, row := range result.Rows {
+		data := make(map[string]interface{}, len(columns)+1)
+		for i, column := range columns {
+			data[column] = row.Columns[result.Columns[i]]
+		}
+
+		if id := data["id"]; id != nil {
+			data["id"] = fmt.Sprint(id)
+		} else {
+			data["id"] = strconv.Itoa(n + 1)
+		}
+		table.Rows = append(table.Rows, Row{Columns: data})
+	}
+
+	if bad, err := table.rebuildIndexes(); err != nil {
+		return Table{}, fmt.Errorf("materialized view %s: row %s: %w", name, bad, err)
+	}
+	return table, nil
+}
+
+// watchMatView subscribes to the tables in stamps, which view's query
+// reads, and refreshes view, one refresh at a time, after changes to them
+// until view.stop is called or the database shuts down.
+func (db *NewDatabase) watchMatView(name string, view *matView, stamps map[string]uint64) error {
+	ctx, stop := context.WithCancel(context.Background())
+	view.kick, view.stop = make(chan struct{}, 1), stop
+
+	var wg sync.WaitGroup
+	for table := range stamps {
+		tw, err := db.WatchTable(ctx, table)
+
+		if err != nil {
+			stop()
+			return fmt.Errorf("materialized view %s: %w", name, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range tw.C {
+				view.requestRefresh()
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(view.kick)
+	}()
+	go func() {
+		for range view.kick {
+			db.RefreshView(name)
+		}
+	}()
+	return nil
+}
+
+// requestRefresh asks the goroutine watchMatView started to refresh view,
+// unless a refresh is already waiting to run.
+func (view *matView) requestRefresh() {
+	select {
+	case view.kick <- struct{}{}:
+	default:
+	}
+}
+
+// matViewStale reports whether a table view read has changed since view
+// was last computed. The caller must hold db.mu.
+func (db *NewDatabase) matViewStale(view *matView) bool {
+	for table, stamp := range view.stamps {
+		if db.Tables[table].writes != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshStale refreshes the RefreshOnRead materialized views query reads
+// that are stale.
+func (db *NewDatabase) refreshStale(query Query) error {
+	db.mu.RLock()
+	var stale []string
+	if len(db.matViews) > 0 {
+		for _, table := range queryTables(query) {
+			if view := db.matViews[table]; view != nil && view.opts.Refresh == RefreshOnRead && db.matViewStale(view) {
+				stale = append(stale, table)
+			}
+		}
+	}
+	db.mu.RUnlock()
+
+	for _, name := range stale {
+		if err := db.RefreshView(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeMatView returns the MaterializedView describing name, or nil if
+// it is not a materialized view. The caller must hold db.mu.
+func (db *NewDatabase) describeMatView(name string) *MaterializedView {
+	view := db.matViews[name]
+	if view == nil {
+		return nil
+	}
+	return &MaterializedView{
+		Query:       view.query,
+		Refresh:     view.opts.Refresh,
+		RefreshedAt: view.refreshedAt,
+		Stale:       db.matViewStale(view),
+	}
+}
+
+// forgetMatView stops name being a materialized view, once its table is
+// dropped. The caller must hold db.mu for writing.
+func (db *NewDatabase) forgetMatView(name string) {
+	view := db.matViews[name]
+	if view == nil {
+		return
+	}
+	if view.stop != nil {
+		view.stop()
+	}
+	delete(db.matViews, name)
+}
@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func matViewTestDB(t *testing.T, refresh MatViewRefresh) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "sales", []Column{{Name: "amount", DataType: Int}}, nil)
+	mustInsert(t, db, "sales", "a", map[string]interface{}{"amount": 10})
+	mustInsert(t, db, "sales", "b", map[string]interface{}{"amount": 5})
+
+	query := Query{Select: []string{"COUNT(*)", "SUM(amount)"}, From: "sales"}
+	if err := db.CreateMaterializedView("totals", query, MatViewOptions{Refresh: refresh, Columns: []string{"n", "total"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DropTable("totals") })
+	return db
+}
+
+// viewTotal returns the n and total the view totals holds.
+func viewTotal(t *testing.T, db *NewDatabase) (int64, int64) {
+	t.Helper()
+	result := mustQuery(t, db, Query{Select: []string{"n", "total"}, From: "totals", NoCache: true})
+	if len(result.Rows) != 1 {
+		t.Fatalf("totals has %d rows, want 1", len(result.Rows))
+	}
+	row := result.Rows[0].Columns
+	return toInt64(row["n"]), toInt64(row["total"])
+}
+
+func TestMaterializedViewManualRefresh(t *testing.T) {
+	db := matViewTestDB(t, RefreshManual)
+
+	if n, total := viewTotal(t, db); n != 2 || total != 15 {
+		t.Fatalf("totals = %d, %d, want 2, 15", n, total)
+	}
+	schema, err := db.DescribeTable("totals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Materialized == nil || schema.Materialized.Stale || schema.Materialized.RefreshedAt.IsZero() {
+		t.Fatalf("DescribeTable(totals).Materialized = %+v", schema.Materialized)
+	}
+	refreshed := schema.Materialized.RefreshedAt
+
+	mustInsert(t, db, "sales", "c", map[string]interface{}{"amount": 7})
+	if n, total := viewTotal(t, db); n != 2 || total != 15 {
+		t.Errorf("totals before RefreshView = %d, %d, want the old 2, 15", n, total)
+	}
+	if schema, _ := db.DescribeTable("totals"); !schema.Materialized.Stale {
+		t.Error("view is not stale after a write to its table")
+	}
+
+	if err := db.RefreshView("totals"); err != nil {
+		t.Fatal(err)
+	}
+	if n, total := viewTotal(t, db); n != 3 || total != 22 {
+		t.Errorf("totals after RefreshView = %d, %d, want 3, 22", n, total)
+	}
+	schema, _ = db.DescribeTable("totals")
+	if schema.Materialized.Stale || !schema.Materialized.RefreshedAt.After(refreshed) {
+		t.Errorf("after RefreshView Materialized = %+v", schema.Materialized)
+	}
+
+	if err := db.InsertRow("totals", "x", map[string]interface{}{"n": 1}); !errors.Is(err, ErrViewReadOnly) {
+		t.Errorf("InsertRow into the view = %v, want ErrViewReadOnly", err)
+	}
+	if err := db.RefreshView("sales"); err == nil {
+		t.Error("RefreshView of a table succeeded")
+	}
+}
+
+func TestMaterializedViewAutoRefresh(t *testing.T) {
+	db := matViewTestDB(t, RefreshOnRead)
+	mustInsert(t, db, "sales", "c", map[string]interface{}{"amount": 7})
+	if n, total := viewTotal(t, db); n != 3 || total != 22 {
+		t.Errorf("RefreshOnRead totals = %d, %d, want 3, 22", n, total)
+	}
+
+	db = matViewTestDB(t, RefreshOnChange)
+	mustInsert(t, db, "sales", "c", map[string]interface{}{"amount": 7})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n, total := viewTotal(t, db)
+		if n == 3 && total == 22 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("RefreshOnChange totals = %d, %d after 5s, want 3, 22", n, total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestMaterializedViewRefreshIsAtomic reads a view while it is refreshed
+// and checks every read sees a whole result: rows numbering 0 to n-1 for
+// some n.
+func TestMaterializedViewRefreshIsAtomic(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	if err := db.CreateMaterializedView("copy", Query{Select: []string{"id", "n"}, From: "items"}, MatViewOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			result, err := db.ExecuteQuery(Query{Select: []string{"MAX(n)", "COUNT(*)"}, From: "copy", NoCache: true})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			row := result.Rows[0].Columns
+			if count := toInt64(row["COUNT(*)"]); count > 0 && toInt64(row["MAX(n)"]) != count-1 {
+				t.Errorf("read a partly refreshed view: %v", row)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		mustInsert(t, db, "items", fmt.Sprint(i), map[string]interface{}{"n": i})
+		if err := db.RefreshView("copy"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestMaterializedViewNotSaved(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCreateTable(t, db, "sales", []Column{{Name: "amount", DataType: Int}}, nil)
+	mustInsert(t, db, "sales", "a", map[string]interface{}{"amount": 10})
+	if err := db.CreateMaterializedView("totals", Query{Select: []string{"SUM(amount)"}, From: "sales"}, MatViewOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "totals"+tableFileExt)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("view was saved: %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.TableExists("sales") || reopened.TableExists("totals") {
+		t.Error("reopened database should have sales and no totals")
+	}
+}
@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetMemoryLimit caps the estimated size of all tables at bytes; zero
+// removes the cap. Writes that would take the total over the limit fail
+// with ErrMemoryLimitExceeded, unless the table being written has an
+// eviction policy that frees enough room. Reads are never limited, and
+// lowering the limit does not shrink tables already over it.
+func (db *NewDatabase) SetMemoryLimit(bytes int64) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.memoryLimit = bytes
+}
+
+// SetEvictionPolicy lets InsertRow and UpdateRow on tableName evict rows
+// chosen by policy instead of failing when the memory limit is reached.
+// Evicted rows are deleted as by DeleteRow, without hooks. Rows that a
+// foreign key in another row references, which DeleteRow would refuse to
+// delete, are never offered to policy. A nil policy removes it. Transactional and buffered writes never evict.
+func (db *NewDatabase) SetEvictionPolicy(tableName string, policy EvictionPolicy) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.Tables[tableName]; !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	if policy == nil {
+		delete(db.evictions, tableName)
+		return nil
+	}
+	if db.evictions == nil {
+		db.evictions = make(map[string]EvictionPolicy)
+	}
+	db.evictions[tableName] = policy
+	return nil
+}
+
+// EvictOldest is an EvictionPolicy that drops expired rows first and then
+// the earliest rows in scan order, which for slice storage is insertion
+// order.
+func EvictOldest(rows []Row, need int64) []string {
+	var ids []string
+	now := time.Now()
+
+	for pass := 0; pass < 2 && need > 0; pass++ {
+		for _, row := range rows {
+			if need <= 0 {
+				break
+			}
+			if isExpired(row, now) != (pass == 0) {
+				continue
+			}
+			ids = append(ids, rowID(row))
+			need -= rowSize(row)
+		}
+	}
+	return ids
+}
+
+func (db *NewDatabase) Stats() DatabaseStats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stats := DatabaseStats{
+		Tables:      make(map[string]TableStats, len(db.Tables)),
+		MemoryLimit: db.memoryLimit,
+	}
+	for name, table := range db.Tables {
+		stats.Tables[name] = TableStats{
+			Rows:           table.rowCount(),
+			Bytes:          table.sizeBytes,
+			Indexes:        len(table.Indexes),
+			ReclaimedBytes: table.reclaimedBytes,
+		}
+		stats.TotalBytes += table.sizeBytes
+		stats.ReclaimedBytes += table.reclaimedBytes
+	}
+
+	if cache := db.queryCache(); cache != nil {
+		stats.QueryCache = cache.Stats()
+	}
+
+	return stats
+}
+
+// TableMemory estimates the bytes tableName holds: its rows, counted as
+// for Stats, plus what deleted rows still hold until the table is
+// compacted and the unused capacity of its row storage. It therefore
+// grows as rows are written and shrinks once deletes are followed by
+// Compact.
+func (db *NewDatabase) TableMemory(tableName string) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, ok := db.Tables[tableName]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	slack := int64(cap(table.Rows)-len(table.Rows)) * rowHeaderBytes
+	return table.sizeBytes + table.garbageBytes + slack, nil
+}
+
+// memoryUsage is the estimated size of all tables, taking those in staged
+// in place of their committed versions. The caller must hold db.mu.
+func (db *NewDatabase) memoryUsage(staged map[string]*Table) int64 {
+	var total int64
+	for name, table := range db.Tables {
+		if s, ok := staged[name]; ok {
+			total += s.sizeBytes
+			continue
+		}
+		total += table.sizeBytes
+	}
+	for name, s := range staged {
+		if _, ok := db.Tables[name]; !ok {
+			total += s.sizeBytes
+		}
+	}
+	return total
+}
+
+// reserveMemory checks that growing table by delta bytes stays within the
+// memory limit, evicting rows other than keepID under the table's eviction
+// policy if needed, auditing the evictions as made by origin, the write's.
+// It returns the evicted rows, which the caller must publish once the
+// write succeeds. The caller must hold db.mu.
+func (db *NewDatabase) reserveMemory(table *Table, delta int64, keepID string, origin writeOrigin) ([]Row, error) {
+	if db.memoryLimit <= 0 || delta <= 0 {
+		return nil, nil
+	}
+
+	staged := map[string]*Table{table.Name: table}
+	over := db.memoryUsage(staged) + delta - db.memoryLimit
+	if over <= 0 {
+		return nil, nil
+	}
+
+	policy, ok := db.evictions[table.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d bytes over the limit of %d writing table %s", ErrMemoryLimitExceeded, over, db.memoryLimit, table.Name)
+	}
+
+	refs := db.referencedValues(table)
+	var candidates []Row
+	for _, row := range table.allRows() {
+		if rowID(row) != keepID && !table.isReferenced(refs, row) {
+			candidates = append(candidates, row)
+		}
+	}
+
+	var freed int64
+	var evicted []Row
+	for _, id := range policy(candidates, over) {
+		row, ok := table.getRow(id)
+		if !ok || id == keepID {
+			continue
+		}
+		evicted = append(evicted, row)
+		freed += rowSize(row)
+	}
+
+	if freed < over {
+		return nil, fmt.Errorf("%w: eviction freed %d of %d bytes needed writing table %s", ErrMemoryLimitExceeded, freed, over, table.Name)
+	}
+
+	for _, row := range evicted {
+		table.deleteRow(rowID(row))
+		table.audit(AuditDelete, row, Row{}, origin)
+	}
+	return evicted, nil
+}
+
+// referencedValues returns, for each column of table that foreign keys
+// refer to, the index keys of the values referenced by some row, of table
+// or of another table. The caller must hold db.mu.
+func (db *NewDatabase) referencedValues(table *Table) map[string]map[string]bool {
+	refs := make(map[string]map[string]bool)
+	for name, stored := range db.Tables {
+		for _, col := range stored.Columns {
+			fk := col.ForeignKey
+			if fk == nil || fk.Table != table.Name {
+				continue
+			}
+			referencing, err := db.stagedTable(name, table, nil)
+			if err != nil {
+				continue
+			}
+
+			target := fk.column()
+			if refs[target] == nil {
+				refs[target] = make(map[string]bool)
+			}
+			for _, row := range referencing.allRows() {
+				if val := row.Columns[col.Name]; val != nil {
+					refs[target][indexValueKey(table.collation(target).key(val))] = true
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// isReferenced reports whether refs, as returned by referencedValues,
+// holds a value of row.
+func (t *Table) isReferenced(refs map[string]map[string]bool, row Row) bool {
+	for column, keys := range refs {
+		if val := row.Columns[column]; val != nil && keys[indexValueKey(t.collation(column).key(val))] {
+			return true
+		}
+	}
+	return false
+}
+
+// publishEvictions reports rows removed by reserveMemory. The caller must
+// hold db.mu.
+func (db *NewDatabase) publishEvictions(tableName string, evicted []Row) {
+	for _, row := range evicted {
+		db.publishChange(ChangeDelete, tableName, rowID(row), row, Row{})
+	}
+}
+
+// rowSize estimates the memory used by row: map and header overhead plus
+// the keys and values it holds.
+func rowSize(row Row) int64 {
+	if row.Columns == nil {
+		return 0
+	}
+
+	size := int64(48)
+	for key, val := range row.Columns {
+		size += 16 + int64(len(key)) + valueSize(val)
+	}
+	return size
+}
+
+func valueSize(val interface{}) int64 {
+	switch v := val.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return 16 + int64(len(v))
+	case time.Time:
+		return 24
+	case []interface{}:
+		size := int64(24)
+		for _, item := range v {
+			size += 16 + valueSize(item)
+		}
+		return size
+	case map[string]interface{}:
+		size := int64(48)
+		for key, item := range v {
+			size += 16 + int64(len(key)) + valueSize(item)
+		}
+		return size
+	default:
+		if valueKind(v) == kindNumber {
+			return 8
+		}
+		return 16
+	}
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvictionSkipsReferencedRows(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "users", []Column{{Name: "name", DataType: String}}, nil)
+	mustCreateTable(t, db, "orders", []Column{
+		{Name: "uid", DataType: String, ForeignKey: &ForeignKey{Table: "users"}},
+	}, nil)
+	mustInsertRows(t, db, "users", map[string]map[string]interface{}{
+		"u0": {"name": "ann"},
+		"u1": {"name": "bob"},
+	})
+	mustInsert(t, db, "orders", "o1", map[string]interface{}{"uid": "u0"})
+
+	db.SetMemoryLimit(db.Stats().TotalBytes + 10)
+	if err := db.SetEvictionPolicy("users", EvictOldest); err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "users", "u2", map[string]interface{}{"name": "cy"})
+	if _, err := db.GetRowByID("users", "u0"); err != nil {
+		t.Fatalf("referenced user u0 was evicted: %v", err)
+	}
+	if _, err := db.GetRowByID("users", "u1"); !errors.Is(err, ErrIDNotFound) {
+		t.Fatalf("GetRowByID(u1) = %v, want it evicted in place of u0", err)
+	}
+
+	// Once only referenced rows and the row being written are left, the
+	// write fails rather than leaving an order dangling.
+	db.SetMemoryLimit(0)
+	if err := db.InsertRow("orders", "o2", map[string]interface{}{"uid": "u2"}); err != nil {
+		t.Fatal(err)
+	}
+	db.SetMemoryLimit(db.Stats().TotalBytes + 10)
+	err := db.InsertRow("users", "u3", map[string]interface{}{"name": "dee"})
+	if !errors.Is(err, ErrMemoryLimitExceeded) {
+		t.Fatalf("InsertRow with only referenced rows to evict = %v, want ErrMemoryLimitExceeded", err)
+	}
+	for _, id := range []string{"u0", "u2"} {
+		if _, err := db.GetRowByID("users", id); err != nil {
+			t.Fatalf("referenced user %s was evicted: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// Merge applies source to target as SQL MERGE does. Each source row is
+// matched against the target rows whose matchColumn equals its own, as =
+// compares them; a NULL matches nothing. For each matched target row, or
+// once for an unmatched source row, the clauses of that MatchType are tried
+// in order and the first whose Action does not return MergeSkip decides
+// what happens. WhenMatched clauses may update or delete the target row,
+// WhenNotMatched clauses may insert a row; one whose Data has no "id" takes
+// the source row's.
+//
+// Matching sees the target as it was before the merge, and a target row
+// matched by two source rows is an error. The whole merge runs under the
+// database write lock and is atomic: constraints are checked against the
+// final state, and if any action or check fails nothing is applied.
+func (db *NewDatabase) Merge(target string, source []Row, matchColumn string, clauses []MergeClause) (MergeResult, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return MergeResult{}, err
+	}
+	defer done()
+
+	for i, clause := range clauses {
+		if clause.Action == nil {
+			return MergeResult{}, fmt.Errorf("%w: merge clause %d has no action", ErrInvalidQuery, i)
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[target]
+
+	if !ok || db.matViews[target] != nil {
+		return MergeResult{}, db.notWritable(target)
+	}
+	table.ensureIndexes()
+
+	matches := make(map[string][]Row)
+	for _, row := range table.scanRows(false) {
+		row, err := db.openRow(&table, row)
+
+		if err != nil {
+			return MergeResult{}, err
+		}
+		if key, ok := mergeKey(row.Columns[matchColumn]); ok {
+			matches[key] = append(matches[key], row)
+		}
+	}
+
+	var result MergeResult
+	var ops []PendingOperation
+	matchedBy := make(map[string]int)
+	for i, src := range source {
+		key, ok := mergeKey(src.Columns[matchColumn])
+		targets := matches[key]
+		if !ok || len(targets) == 0 {
+			op, ok, err := mergeAction(clauses, WhenNotMatched, target, Row{}, src)
+
+			if err != nil {
+				return MergeResult{}, fmt.Errorf("merge source row %d: %w", i, err)
+			}
+			if ok {
+				ops = append(ops, op)
+				result.Inserted++
+			}
+			continue
+		}
+
+		for _, row := range targets {
+			id := rowID(row)
+			if prev, dup := matchedBy[id]; dup {
+				return MergeResult{}, fmt.Errorf("%w: target row %s is matched by source rows %d and %d", ErrInvalidQuery, id, prev, i)
+			}
+			matchedBy[id] = i
+
+			op, ok, err := mergeAction(clauses, WhenMatched, target, row, src)
+
+			if err != nil {
+				return MergeResult{}, fmt.Errorf("merge source row %d: %w", i, err)
+			}
+			if !ok {
+				continue
+			}
+			if op.Op == ChangeDelete {
+				result.Deleted++
+			} else {
+				result.Updated++
+			}
+			ops = append(ops, op)
+		}
+	}
+
+	staged, applied, err := db.stagePending(ops, true, true)
+
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("merge into %s: %w", target, err)
+	}
+
+	for name, table := range staged {
+		db.Tables[name] = *table
+		db.compactIfNeeded(name)
+	}
+	for _, change := range applied {
+		db.publishApplied(change)
+	}
+
+	for _, change := range applied {
+		if err := db.runHooks(HookAfter, change.hookContext()); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// mergeAction runs the clauses for match in order and returns the write the
+// first that applies asks for. ok is false if none applies.
+func mergeAction(clauses []MergeClause, match MatchType, tableName string, target, source Row) (PendingOperation, bool, error) {
+	for _, clause := range clauses {
+		if clause.Match != match {
+			continue
+		}
+
+		action, err := clause.Action(target, source)
+
+		if err != nil {
+			return PendingOperation{}, false, err
+		}
+
+		switch {
+		case action.Op == MergeSkip:
+			continue
+		case match == WhenMatched && action.Op == MergeUpdate:
+			return PendingOperation{Op: ChangeUpdate, TableName: tableName, RowID: rowID(target), Data: action.Data}, true, nil
+		case match == WhenMatched && action.Op == MergeDelete:
+			return PendingOperation{Op: ChangeDelete, TableName: tableName, RowID: rowID(target)}, true, nil
+		case match == WhenNotMatched && action.Op == MergeInsert:
+			id, _ := action.Data["id"].(string)
+			if id == "" {
+				id = rowID(source)
+			}
+			if id == "" {
+				return PendingOperation{}, false, fmt.Errorf("%w: merge insert has no id", ErrInvalidQuery)
+			}
+			data := make(map[string]interface{}, len(action.Data))
+			for key, value := range action.Data {
+				if key != "id" {
+					data[key] = value
+				}
+			}
+			return PendingOperation{Op: ChangeInsert, TableName: tableName, RowID: id, Data: data}, true, nil
+		default:
+			return PendingOperation{}, false, fmt.Errorf("%w: %s clause cannot perform merge operation %d", ErrInvalidQuery, match, action.Op)
+		}
+	}
+	return PendingOperation{}, false, nil
+}
+
+// mergeKey encodes a match column value so that values = finds equal
+// share a key, as an integral float does with the integer.
+func mergeKey(val interface{}) (string, bool) {
+	if val == nil {
+		return "", false
+	}
+	if f, ok := val.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		val = int64(f)
+	}
+	return indexValueKey(val), true
+}
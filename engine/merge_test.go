@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mergeTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "stock", []Column{
+		{Name: "sku", DataType: String},
+		{Name: "qty", DataType: Int},
+	}, nil)
+	for id, sku := range map[string]string{"s1": "apple", "s2": "pear", "s3": "plum"} {
+		mustInsert(t, db, "stock", id, map[string]interface{}{"sku": sku, "qty": 5})
+	}
+	return db
+}
+
+// stockClauses deletes items whose new quantity is 0, updates the others
+// and inserts new ones with a quantity.
+var stockClauses = []MergeClause{
+	{Match: WhenMatched, Action: func(target, source Row) (MergeAction, error) {
+		if toInt64(source.Columns["qty"]) == 0 {
+			return MergeAction{Op: MergeDelete}, nil
+		}
+		return MergeAction{}, nil
+	}},
+	{Match: WhenMatched, Action: func(target, source Row) (MergeAction, error) {
+		return MergeAction{Op: MergeUpdate, Data: map[string]interface{}{"qty": source.Columns["qty"]}}, nil
+	}},
+	{Match: WhenNotMatched, Action: func(target, source Row) (MergeAction, error) {
+		if toInt64(source.Columns["qty"]) == 0 {
+			return MergeAction{}, nil
+		}
+		return MergeAction{Op: MergeInsert, Data: source.Columns}, nil
+	}},
+}
+
+func TestMerge(t *testing.T) {
+	db := mergeTestDB(t)
+	source := []Row{
+		{Columns: map[string]interface{}{"id": "s4", "sku": "fig", "qty": 2}},
+		{Columns: map[string]interface{}{"id": "x", "sku": "apple", "qty": 9}},
+		{Columns: map[string]interface{}{"id": "x", "sku": "pear", "qty": 0}},
+		{Columns: map[string]interface{}{"id": "s5", "sku": "kiwi", "qty": 0}},
+	}
+
+	result, err := db.Merge("stock", source, "sku", stockClauses)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MergeResult{Inserted: 1, Updated: 1, Deleted: 1}); result != want {
+		t.Errorf("Merge = %+v, want %+v", result, want)
+	}
+
+	got := mustQuery(t, db, Query{Select: []string{"id", "sku", "qty"}, From: "stock", OrderBy: "id"})
+	want := [][2]interface{}{{"apple", 9}, {"plum", 5}, {"fig", 2}}
+	if ids := resultIDs(got); !reflect.DeepEqual(ids, []string{"s1", "s3", "s4"}) {
+		t.Fatalf("rows after Merge = %v, want [s1 s3 s4]", ids)
+	}
+	for i, row := range got.Rows {
+		if row.Columns["sku"] != want[i][0] || toInt64(row.Columns["qty"]) != toInt64(want[i][1]) {
+			t.Errorf("row %s = %v, want sku %v, qty %v", rowID(row), row.Columns, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestMergeIsAtomic(t *testing.T) {
+	db := mergeTestDB(t)
+	before := mustQuery(t, db, Query{Select: []string{"id", "sku", "qty"}, From: "stock", OrderBy: "id"})
+
+	// The insert of s2 clashes with an existing id, so the update of
+	// apple must not be applied either.
+	source := []Row{
+		{Columns: map[string]interface{}{"id": "x", "sku": "apple", "qty": 1}},
+		{Columns: map[string]interface{}{"id": "s2", "sku": "fig", "qty": 1}},
+	}
+	if _, err := db.Merge("stock", source, "sku", stockClauses); !errors.Is(err, ErrIDExists) {
+		t.Fatalf("Merge = %v, want ErrIDExists", err)
+	}
+
+	// Two source rows matching one target row is an error too.
+	source = []Row{
+		{Columns: map[string]interface{}{"sku": "apple", "qty": 1}},
+		{Columns: map[string]interface{}{"sku": "apple", "qty": 2}},
+	}
+	if _, err := db.Merge("stock", source, "sku", stockClauses); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("Merge with a doubly matched row = %v, want ErrInvalidQuery", err)
+	}
+
+	after := mustQuery(t, db, Query{Select: []string{"id", "sku", "qty"}, From: "stock", OrderBy: "id"})
+	if !reflect.DeepEqual(after.Rows, before.Rows) {
+		t.Errorf("failed Merge changed the table: %v", after.Rows)
+	}
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	tablesMetaTable  = "_tables"
+	columnsMetaTable = "_columns"
+	indexesMetaTable = "_indexes"
+)
+
+// CreateMetaTable makes _tables queryable: a read-only table with one row
+// per table, whose id is the table's name, and columns table_name,
+// row_count, column_count, index_count and size_bytes. Its rows are
+// computed each time a query reads it, so they are always current, and it
+// can be joined with ordinary tables. Writes to it fail with
+// ErrTableNotFound, as it is not stored.
+func (db *NewDatabase) CreateMetaTable() error {
+	return db.createMetaTable(tablesMetaTable, (*NewDatabase).tablesMeta)
+}
+
+// CreateColumnsMetaTable makes _columns queryable, like _tables: a
+// read-only table with one row per column of every table, in schema order,
+// whose id is "table.column". Its columns are table_name, column_name,
+// data_type (the DataType's name, such as "String"), nullable, has_default
+// and default_value, the Default as text, such as "NOW()".
+func (db *NewDatabase) CreateColumnsMetaTable() error {
+	return db.createMetaTable(columnsMetaTable, (*NewDatabase).columnsMeta)
+}
+
+// CreateIndexesMetaTable makes _indexes queryable, like _tables: a
+// read-only table with one row per secondary index, whose id is
+// "table.index". Its columns are table_name, index_name, columns (the
+// indexed columns joined with commas), unique, type ("hash", or
+// "inverted" for an inverted index) and entry_count, the number of rows
+// the index holds, or for an inverted index of elements.
+// Like every meta table it is built when read, so it reflects tables and
+// indexes as soon as they are created or dropped.
+func (db *NewDatabase) CreateIndexesMetaTable() error {
+	return db.createMetaTable(indexesMetaTable, (*NewDatabase).indexesMeta)
+}
+
+func (db *NewDatabase) createMetaTable(name string, build func(*NewDatabase) Table) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.Tables[name]; exists || db.metaTables[name] != nil || db.views[name] != nil {
+		return fmt.Errorf("%w: %s", ErrTableExists, name)
+	}
+
+	if db.metaTables == nil {
+		db.metaTables = make(map[string]func(*NewDatabase) Table)
+	}
+	db.metaTables[name] = build
+	return nil
+}
+
+// queryTable returns the table a query reads under name: a stored table or
+// the current contents of a meta table. The caller must hold db.mu.
+func (db *NewDatabase) queryTable(name string) (Table, bool) {
+	if table, ok := db.Tables[name]; ok {
+		return table, true
+	}
+	if build := db.metaTables[name]; build != nil {
+		return build(db), true
+	}
+	return Table{}, false
+}
+
+// userTableNames returns the names ListTables reports. The caller must hold
+// db.mu.
+func (db *NewDatabase) userTableNames() []string {
+	names := make([]string, 0, len(db.Tables))
+	for name := range db.Tables {
+		if !isInternalTable(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (db *NewDatabase) tablesMeta() Table {
+	names := db.userTableNames()
+	rows := make([]Row, 0, len(names))
+	for _, name := range names {
+		table := db.Tables[name]
+		rows = append(rows, Row{Columns: map[string]interface{}{
+			"id":           name,
+			"table_name":   name,
+			"row_count":    int64(table.liveCount()),
+			"column_count": int64(len(table.Columns)),
+			"index_count":  int64(len(table.Indexes)),
+			"size_bytes":   table.sizeBytes,
+		}, Version: 1})
+	}
+
+	return metaTable(tablesMetaTable, []Column{
+		{Name: "table_name", DataType: String},
+		{Name: "row_count", DataType: Int},
+		{Name: "column_count", DataType: Int},
+		{Name: "index_count", DataType: Int},
+		{Name: "size_bytes", DataType: Int},
+	}, rows)
+}
+
+func (db *NewDatabase) columnsMeta() Table {
+	var rows []Row
+	for _, name := range db.userTableNames() {
+		for _, col := range db.Tables[name].Columns {
+			rows = append(rows, Row{Columns: map[string]interface{}{
+				"id":            name + "." + col.Name,
+				"table_name":    name,
+				"column_name":   col.Name,
+				"data_type":     col.DataType.String(),
+				"nullable":      col.Nullable,
+				"has_default":   col.Default != nil,
+				"default_value": defaultText(col.Default),
+			}, Version: 1})
+		}
+	}
+
+	return metaTable(columnsMetaTable, []Column{
+		{Name: "table_name", DataType: String},
+		{Name: "column_name", DataType: String},
+		{Name: "data_type", DataType: String},
+		{Name: "nullable", DataType: Bool},
+		{Name: "has_default", DataType: Bool},
+		{Name: "default_value", DataType: String, Nullable: true},
+	}, rows)
+}
+
+func (db *NewDatabase) indexesMeta() Table {
+	var rows []Row
+	for _, name := range db.userTableNames() {
+		table := db.Tables[name]
+		for _, idx := range table.Indexes {
+			indexType := "hash"
+			switch {
+			case idx.Inverted:
+				indexType = "inverted"
+			case idx.FullText:
+				indexType = "fulltext"
+			}
+			rows = append(rows, Row{Columns: map[string]interface{}{
+				"id":          name + "." + idx.Name,
+				"table_name":  name,
+				"index_name":  idx.Name,
+				"columns":     strings.Join(idx.Columns, ","),
+				"unique":      idx.Unique,
+				"type":        indexType,
+				"entry_count": int64(table.indexEntries(idx)),
+			}, Version: 1})
+		}
+	}
+
+	return metaTable(indexesMetaTable, []Column{
+		{Name: "table_name", DataType: String},
+		{Name: "index_name", DataType: String},
+		{Name: "columns", DataType: String},
+		{Name: "unique", DataType: Bool},
+		{Name: "type", DataType: String},
+		{Name: "entry_count", DataType: Int},
+	}, rows)
+}
+
+// indexEntries counts the rows idx holds, from the rows themselves if the
+// table's indexes have not been built since it was loaded.
+func (t *Table) indexEntries(idx Index) int {
+	if t.indexData == nil {
+		n := 0
+		for _, row := range t.allRows() {
+			n += len(t.indexKeys(row, idx))
+		}
+		return n
+	}
+
+	n := 0
+	for _, ids := range t.indexData[idx.Name] {
+		n += len(ids)
+	}
+	return n
+}
+
+// metaTable builds a table holding rows, indexed by id only, for a query
+// to read.
+func metaTable(name string, columns []Column, rows []Row) Table {
+	table := Table{
+		Name:      name,
+		Columns:   columns,
+		Rows:      rows,
+		ids:       make(map[string]int, len(rows)),
+		indexData: make(map[string]map[string][]string),
+	}
+	for i, row := range rows {
+		table.ids[rowID(row)] = i
+	}
+	return table
+}
+
+func defaultText(d interface{}) interface{} {
+	if d == nil {
+		return nil
+	}
+	return fmt.Sprint(d)
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the latency histogram buckets. A
+// final bucket counts anything slower.
+var latencyBounds = [...]time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type histogram struct {
+	counts [len(latencyBounds) + 1]atomic.Uint64
+	sum    atomic.Int64
+}
+
+type opMetrics struct {
+	count   atomic.Uint64
+	errors  atomic.Uint64
+	latency histogram
+}
+
+// metrics holds the counters behind Metrics. Everything is updated with
+// atomics so recording never takes a lock, nor allocates unless the
+// operation failed.
+type metrics struct {
+	queries opMetrics
+	inserts opMetrics
+	updates opMetrics
+	deletes opMetrics
+
+	begun      atomic.Uint64
+	committed  atomic.Uint64
+	rolledBack atomic.Uint64
+
+	rowsScanned atomic.Uint64
+
+	lastError atomic.Pointer[errorRef]
+
+	observer atomic.Pointer[observerRef]
+}
+
+type errorRef struct {
+	err error
+}
+
+type observerRef struct {
+	MetricsObserver
+}
+
+// SetMetricsObserver has observer called for every recorded operation, in
+// addition to the counters reported by Metrics, so the metrics can be fed
+// to a monitoring system. Observe runs synchronously on the operation's
+// goroutine, possibly with the database locked: it must be quick and must
+// not call back into the database. A nil observer removes the current one.
+func (db *NewDatabase) SetMetricsObserver(observer MetricsObserver) {
+	if observer == nil {
+		db.metrics.observer.Store(nil)
+		return
+	}
+	db.metrics.observer.Store(&observerRef{observer})
+}
+
+// Metrics returns the operation counters and latency histograms recorded
+// since the database was opened, with the query cache's hit counts and
+// the current size of every table. Each counter is read atomically, but
+// operations finishing while the snapshot is taken may be only partly
+// reflected in it.
+func (db *NewDatabase) Metrics() MetricsSnapshot {
+	stats := db.Stats()
+	m := &db.metrics
+
+	return MetricsSnapshot{
+		Queries:                m.queries.snapshot(),
+		Inserts:                m.inserts.snapshot(),
+		Updates:                m.updates.snapshot(),
+		Deletes:                m.deletes.snapshot(),
+		TransactionsBegun:      m.begun.Load(),
+		TransactionsCommitted:  m.committed.Load(),
+		TransactionsRolledBack: m.rolledBack.Load(),
+		RowsScanned:            m.rowsScanned.Load(),
+		CacheHits:              stats.QueryCache.Hits,
+		CacheMisses:            stats.QueryCache.Misses,
+		Tables:                 stats.Tables,
+	}
+}
+
+// observe records an operation that started at start. rowsScanned only
+// applies to queries.
+func (m *metrics) observe(op MetricOp, start time.Time, err error, rowsScanned int) {
+	latency := time.Since(start)
+
+	switch op {
+	case MetricQuery:
+		m.queries.record(latency, err)
+		m.rowsScanned.Add(uint64(rowsScanned))
+	case MetricInsert:
+		m.inserts.record(latency, err)
+	case MetricUpdate:
+		m.updates.record(latency, err)
+	case MetricDelete:
+		m.deletes.record(latency, err)
+	}
+	if err != nil {
+		m.lastError.Store(&errorRef{err})
+	}
+
+	m.notify(MetricEvent{Op: op, Latency: latency, Err: err, RowsScanned: rowsScanned})
+}
+
+// transaction records that a transaction began, committed or rolled back.
+func (m *metrics) transaction(op MetricOp) {
+	switch op {
+	case MetricBegin:
+		m.begun.Add(1)
+	case MetricCommit:
+		m.committed.Add(1)
+	case MetricRollback:
+		m.rolledBack.Add(1)
+	}
+
+	m.notify(MetricEvent{Op: op})
+}
+
+func (m *metrics) notify(event MetricEvent) {
+	if ref := m.observer.Load(); ref != nil {
+		ref.Observe(event)
+	}
+}
+
+func (o *opMetrics) record(latency time.Duration, err error) {
+	o.count.Add(1)
+	if err != nil {
+		o.errors.Add(1)
+	}
+
+	bucket := len(latencyBounds)
+	for i, bound := range latencyBounds {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+	o.latency.counts[bucket].Add(1)
+	o.latency.sum.Add(int64(latency))
+}
+
+func (o *opMetrics) snapshot() OperationMetrics {
+	counts := make([]uint64, len(o.latency.counts))
+	for i := range o.latency.counts {
+		counts[i] = o.latency.counts[i].Load()
+	}
+
+	return OperationMetrics{
+		Count:  o.count.Load(),
+		Errors: o.errors.Load(),
+		Latency: LatencyHistogram{
+			Bounds: append([]time.Duration(nil), latencyBounds[:]...),
+			Counts: counts,
+			Sum:    time.Duration(o.latency.sum.Load()),
+		},
+	}
+}
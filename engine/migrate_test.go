@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// testMigration is a Migration whose Up is up, counting its runs.
+type testMigration struct {
+	version int
+	up      func(db *NewDatabase) error
+	runs    int
+}
+
+func (m *testMigration) Version() int        { return m.version }
+func (m *testMigration) Description() string { return "test migration" }
+
+func (m *testMigration) Up(db *NewDatabase) error {
+	m.runs++
+	if m.up == nil {
+		return nil
+	}
+	return m.up(db)
+}
+
+func TestApplyMigrationIsIdempotent(t *testing.T) {
+	db := newTestDB(t)
+	m := &testMigration{version: 1, up: func(db *NewDatabase) error {
+		return db.CreateTable("users", []Column{{Name: "name", DataType: String}}, nil)
+	}}
+
+	if err := db.ApplyMigration(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ApplyMigration(m); !errors.Is(err, ErrMigrationAlreadyApplied) {
+		t.Fatalf("second ApplyMigration = %v, want ErrMigrationAlreadyApplied", err)
+	}
+	if m.runs != 1 {
+		t.Errorf("Up ran %d times, want 1", m.runs)
+	}
+	if history := db.MigrationHistory(); len(history) != 1 {
+		t.Errorf("MigrationHistory = %+v, want one migration", history)
+	}
+}
+
+func TestMigrationHistoryOrder(t *testing.T) {
+	db := newTestDB(t)
+	if history := db.MigrationHistory(); len(history) != 0 {
+		t.Fatalf("MigrationHistory before any migration = %+v", history)
+	}
+
+	for _, version := range []int{3, 1, 2} {
+		if err := db.ApplyMigration(&testMigration{version: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := db.MigrationHistory()
+	if len(history) != 3 {
+		t.Fatalf("MigrationHistory = %+v, want three migrations", history)
+	}
+	for i, applied := range history {
+		if applied.Version != i+1 {
+			t.Errorf("history[%d].Version = %d, want %d", i, applied.Version, i+1)
+		}
+		if applied.Description != "test migration" || applied.AppliedAt.IsZero() {
+			t.Errorf("history[%d] = %+v", i, applied)
+		}
+	}
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	db := newTestDB(t)
+	boom := errors.New("boom")
+	m := &testMigration{version: 1, up: func(*NewDatabase) error { return boom }}
+
+	if err := db.ApplyMigration(m); !errors.Is(err, boom) {
+		t.Fatalf("ApplyMigration = %v, want the error Up returned", err)
+	}
+	if history := db.MigrationHistory(); len(history) != 0 {
+		t.Fatalf("MigrationHistory = %+v, want none", history)
+	}
+
+	m.up = nil
+	if err := db.ApplyMigration(m); err != nil {
+		t.Fatalf("retrying the migration: %v", err)
+	}
+}
+
+func TestMigrationsTableHidden(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "users", []Column{{Name: "name", DataType: String}}, nil)
+	if err := db.ApplyMigration(&testMigration{version: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range db.ListTables() {
+		if table == migrationsTable {
+			t.Fatalf("ListTables() = %v, includes %s", db.ListTables(), migrationsTable)
+		}
+	}
+	if tables := db.ListTables(); len(tables) != 1 || tables[0] != "users" {
+		t.Errorf("ListTables() = %v, want [users]", tables)
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const migrationsTable = "_migrations"
+
+func isInternalTable(name string) bool {
+	switch name {
+	case migrationsTable, crdtsTable:
+		return true
+	}
+	return false
+}
+
+// ApplyMigration runs m.Up unless its version is already recorded in the
+// _migrations table. Migrations are serialized against each other, but Up
+// runs without holding the database lock so it can use the public API.
+func (db *NewDatabase) ApplyMigration(m Migration) error {
+	db.migrateMu.Lock()
+	defer db.migrateMu.Unlock()
+
+	err := db.CreateTable(migrationsTable, []Column{
+		{Name: "version", DataType: Int},
+		{Name: "description", DataType: String},
+		{Name: "applied_at", DataType: DateTime},
+	}, nil)
+
+	if err != nil && !errors.Is(err, ErrTableExists) {
+		return err
+	}
+
+	id := strconv.Itoa(m.Version())
+	if _, err := db.GetRowByID(migrationsTable, id); err == nil {
+		return fmt.Errorf("%w: version %d", ErrMigrationAlreadyApplied, m.Version())
+	}
+
+	if err := m.Up(db); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.Version(), m.Description(), err)
+	}
+
+	return db.InsertRow(migrationsTable, id, map[string]interface{}{
+		"version":     m.Version(),
+		"description": m.Description(),
+		"applied_at":  time.Now(),
+	})
+}
+
+func (db *NewDatabase) MigrationHistory() []AppliedMigration {
+	rows, err := db.GetAllRows(migrationsTable)
+
+	if err != nil {
+		return nil
+	}
+
+	history := make([]AppliedMigration, 0, len(rows))
+	for _, row := range rows {
+		version, _ := row.Columns["version"].(int)
+		description, _ := row.Columns["description"].(string)
+		appliedAt, _ := row.Columns["applied_at"].(time.Time)
+		history = append(history, AppliedMigration{
+			Version:     version,
+			Description: description,
+			AppliedAt:   appliedAt,
+		})
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Version < history[j].Version
+	})
+
+	return history
+}
@@ -0,0 +1,68 @@
+package engine
+
+import "fmt"
+
+// PaginateQuery returns page page, counting from 1, of query's result
+// split into pages of pageSize rows. It runs query twice: once as
+// COUNT(*) to find the total, and once with Limit and Offset set to read
+// the page, so the two can disagree if the table changes in between.
+// query's own Limit and Offset are ignored. A page past the last has no
+// rows.
+func (db *NewDatabase) PaginateQuery(query Query, page, pageSize int) (Page, error) {
+	if page < 1 || pageSize < 1 {
+		return Page{}, fmt.Errorf("%w: page %d of size %d; both must be at least 1", ErrInvalidQuery, page, pageSize)
+	}
+
+	total, err := db.countResult(query)
+
+	if err != nil {
+		return Page{}, err
+	}
+
+	query.Limit = pageSize
+	query.Offset = (page - 1) * pageSize
+	result, err := db.ExecuteQuery(query)
+
+	if err != nil {
+		return Page{}, err
+	}
+
+	pages := (total + pageSize - 1) / pageSize
+	return Page{
+		Rows:       result.Rows,
+		Columns:    result.Columns,
+		TotalRows:  total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: pages,
+		HasNext:    page < pages,
+		HasPrev:    page > 1,
+	}, nil
+}
+
+// countResult returns how many rows query's result has, ignoring its
+// Limit and Offset. An aggregate query has one.
+func (db *NewDatabase) countResult(query Query) (int, error) {
+	if _, aggregate, err := parseProjections(query.Select); err == nil && aggregate {
+		return 1, nil
+	}
+
+	query.Select = []string{"COUNT(*)"}
+	query.OrderBy = ""
+	query.Limit = 0
+	query.Offset = 0
+	result, err := db.ExecuteQuery(query)
+
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Rows) != 1 {
+		return 0, fmt.Errorf("%w: COUNT(*) returned %d rows", ErrInvalidQuery, len(result.Rows))
+	}
+
+	n, ok := result.Rows[0].Columns["COUNT(*)"].(int64)
+	if !ok {
+		return 0, fmt.Errorf("%w: COUNT(*) returned %T", ErrInvalidQuery, result.Rows[0].Columns["COUNT(*)"])
+	}
+	return int(n), nil
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func paginateTestDB(t *testing.T, rows int) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	for i := 1; i <= rows; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%02d", i), map[string]interface{}{"n": i})
+	}
+	return db
+}
+
+func TestPaginateQuery(t *testing.T) {
+	db := paginateTestDB(t, 23)
+	query := Query{Select: []string{"id"}, From: "items", OrderBy: "n", Limit: 3, Offset: 7}
+
+	tests := []struct {
+		page             int
+		first, last      string
+		rows             int
+		hasNext, hasPrev bool
+	}{
+		{1, "i01", "i10", 10, true, false},
+		{2, "i11", "i20", 10, true, true},
+		{3, "i21", "i23", 3, false, true},
+		{4, "", "", 0, false, true},
+	}
+	for _, tt := range tests {
+		page, err := db.PaginateQuery(query, tt.page, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := resultIDs(QueryResult{Rows: page.Rows})
+		if len(ids) != tt.rows || (tt.rows > 0 && (ids[0] != tt.first || ids[len(ids)-1] != tt.last)) {
+			t.Errorf("page %d = %v, want %d rows from %s to %s", tt.page, ids, tt.rows, tt.first, tt.last)
+		}
+		want := Page{Rows: page.Rows, Columns: []string{"id"}, TotalRows: 23, Page: tt.page, PageSize: 10, TotalPages: 3, HasNext: tt.hasNext, HasPrev: tt.hasPrev}
+		if !reflect.DeepEqual(page, want) {
+			t.Errorf("page %d = %+v, want %+v", tt.page, page, want)
+		}
+	}
+}
+
+func TestPaginateQueryEdges(t *testing.T) {
+	db := paginateTestDB(t, 20)
+
+	// An exact number of pages has no partial last page.
+	page, err := db.PaginateQuery(Query{Select: []string{"id"}, From: "items", OrderBy: "n"}, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TotalPages != 2 || page.HasNext || len(page.Rows) != 10 {
+		t.Errorf("last of two full pages = %+v", page)
+	}
+
+	// The total counts only the rows the filter keeps.
+	page, err = db.PaginateQuery(Query{Select: []string{"id"}, From: "items", Where: "n % 2 = 0"}, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TotalRows != 10 || page.TotalPages != 3 || len(page.Rows) != 4 {
+		t.Errorf("filtered page = %+v", page)
+	}
+
+	// No rows at all make one empty page 1 of 0.
+	page, err = db.PaginateQuery(Query{Select: []string{"id"}, From: "items", Where: "n > 100"}, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TotalRows != 0 || page.TotalPages != 0 || page.HasNext || page.HasPrev || len(page.Rows) != 0 {
+		t.Errorf("empty result page = %+v", page)
+	}
+
+	// An aggregate has a single row.
+	page, err = db.PaginateQuery(Query{Select: []string{"SUM(n)"}, From: "items"}, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TotalRows != 1 || len(page.Rows) != 1 || toInt64(page.Rows[0].Columns["SUM(n)"]) != 210 {
+		t.Errorf("aggregate page = %+v", page)
+	}
+
+	for _, bad := range [][2]int{{0, 10}, {-1, 10}, {1, 0}, {1, -5}} {
+		if _, err := db.PaginateQuery(Query{Select: []string{"id"}, From: "items"}, bad[0], bad[1]); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("PaginateQuery(page %d, size %d) = %v, want ErrInvalidQuery", bad[0], bad[1], err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+)
+
+// minParallelRows is the fewest rows a filter fans out over goroutines
+// for; below it the goroutines cost more than they save.
+const minParallelRows = 1024
+
+// ExecuteQueryWithOptions runs query like ExecuteQuery, with opts.
+func (db *NewDatabase) ExecuteQueryWithOptions(query Query, opts QueryOptions) (QueryResult, error) {
+	return db.executeQuery(context.Background(), query, opts)
+}
+
+func (db *NewDatabase) executeQuery(ctx context.Context, query Query, opts QueryOptions) (QueryResult, error) {
+	return db.runQuery(ctx, query, func() (ExecutionPlan, error) {
+		plan, err := db.planQuery(query)
+
+		if err != nil {
+			return ExecutionPlan{}, err
+		}
+		plan.ParallelScans = opts.Parallelism
+		return plan.bind(query.Args)
+	})
+}
+
+// parallelFilterRows is filterRows with rows split into n chunks, each
+// filtered on its own goroutine. The chunks are merged in order, so the
+// result is the same as filterRows', and so is the error: the one from the
+// earliest chunk that failed.
+func parallelFilterRows(ctx context.Context, rows []Row, filter expr, n int) ([]Row, error) {
+	if n <= 1 || len(rows) < minParallelRows {
+		return filterRows(ctx, rows, filter)
+	}
+
+	type chunkResult struct {
+		chunk int
+		rows  []Row
+		err   error
+	}
+
+	size := (len(rows) + n - 1) / n
+	chunks := (len(rows) + size - 1) / size
+	results := make(chan chunkResult, chunks)
+	for i := 0; i < chunks; i++ {
+		chunk := rows[i*size : min((i+1)*size, len(rows))]
+		go func(i int) {
+			filtered, err := filterRows(ctx, chunk, filter)
+			results <- chunkResult{chunk: i, rows: filtered, err: err}
+		}(i)
+	}
+
+	ordered := make([]chunkResult, chunks)
+	for i := 0; i < chunks; i++ {
+		result := <-results
+		ordered[result.chunk] = result
+	}
+
+	var filtered []Row
+	for _, result := range ordered {
+		if result.err != nil {
+			return nil, result.err
+		}
+		filtered = append(filtered, result.rows...)
+	}
+	return filtered, nil
+}
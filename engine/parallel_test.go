@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func parallelTestDB(t testing.TB, rows int) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "readings", []Column{
+		{Name: "sensor", DataType: String},
+		{Name: "value", DataType: Float},
+		{Name: "raw", DataType: String},
+	}, nil)
+
+	data := make([]Row, rows)
+	for i := range data {
+		data[i] = Row{Columns: map[string]interface{}{
+			"id":     fmt.Sprintf("r%06d", i),
+			"sensor": fmt.Sprintf("s%d", i%13),
+			"value":  float64(i%1000) / 10,
+			"raw":    fmt.Sprint(i % 97),
+		}}
+	}
+	if err := db.BulkLoad("readings", data); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestParallelQueryMatchesSequential(t *testing.T) {
+	db := parallelTestDB(t, 5000)
+
+	queries := []Query{
+		{Select: []string{"id", "value"}, From: "readings", Where: "value > 50 AND sensor != 's3'"},
+		{Select: []string{"id"}, From: "readings", Where: "sensor IN ('s1', 's2') OR value < 1", OrderBy: "value DESC, id", Limit: 100},
+		{Select: []string{"COUNT(*)", "SUM(value)"}, From: "readings", Where: "CAST(raw AS INT) % 2 = 0"},
+	}
+	for _, query := range queries {
+		query.NoCache = true
+		want, err := db.ExecuteQueryWithOptions(query, QueryOptions{Parallelism: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{2, 4, 7} {
+			got, err := db.ExecuteQueryWithOptions(query, QueryOptions{Parallelism: n})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Rows, want.Rows) {
+				t.Errorf("Parallelism %d differs from a sequential scan for WHERE %s", n, query.Where)
+			}
+		}
+	}
+}
+
+func TestParallelQueryError(t *testing.T) {
+	db := parallelTestDB(t, 5000)
+	mustInsert(t, db, "readings", "bad", map[string]interface{}{"sensor": "s0", "value": 1.0, "raw": "oops"})
+
+	query := Query{Select: []string{"id"}, From: "readings", Where: "CAST(raw AS INT) > 5", NoCache: true}
+	for _, n := range []int{1, 4} {
+		if _, err := db.ExecuteQueryWithOptions(query, QueryOptions{Parallelism: n}); !errors.Is(err, ErrInvalidCast) {
+			t.Errorf("Parallelism %d: %v, want ErrInvalidCast", n, err)
+		}
+	}
+}
+
+func BenchmarkParallelScan(b *testing.B) {
+	db := parallelTestDB(b, 500000)
+	query := Query{Select: []string{"id"}, From: "readings", Where: "value > 42.5 AND sensor != 's3' AND CAST(raw AS INT) % 3 = 1", NoCache: true}
+
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("Parallelism%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.ExecuteQueryWithOptions(query, QueryOptions{Parallelism: n}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CreatePartitionedTable creates a table divided into partitions by the
+// value of partitionCol, an Int or DateTime column, as strategy describes.
+// Rows are placed in their partition as they are written, and a query whose
+// WHERE clause restricts partitionCol with =, <, <=, >, >=, BETWEEN or IN
+// against constants reads only the partitions that can match.
+func (db *NewDatabase) CreatePartitionedTable(name string, cols []Column, partitionCol string, strategy PartitionStrategy) error {
+	if err := validatePartitioning(cols, partitionCol, strategy); err != nil {
+		return fmt.Errorf("table %s: %w", name, err)
+	}
+
+	return db.createTable(Table{
+		Name:            name,
+		Columns:         cols,
+		PartitionColumn: partitionCol,
+		Partitioning: PartitionStrategy{
+			Type:   strategy.Type,
+			Bounds: append([]interface{}(nil), strategy.Bounds...),
+		},
+	})
+}
+
+// ListPartitions describes the partitions of tableName in order. It returns
+// nil if the table does not exist or is not partitioned.
+func (db *NewDatabase) ListPartitions(tableName string) []PartitionInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, ok := db.Tables[tableName]
+	if !ok || table.partitions == nil {
+		return nil
+	}
+
+	bounds := table.Partitioning.Bounds
+	now := time.Now()
+	infos := make([]PartitionInfo, len(table.partitions))
+	for i, ids := range table.partitions {
+		info := PartitionInfo{Number: i}
+		if i > 0 {
+			info.Lower = bounds[i-1]
+		}
+		if i < len(bounds) {
+			info.Upper = bounds[i]
+		}
+		for id := range ids {
+			if row, ok := table.getRow(id); ok && table.visible(row, now, false) {
+				info.Rows++
+			}
+		}
+		infos[i] = info
+	}
+	return infos
+}
+
+func validatePartitioning(cols []Column, partitionCol string, strategy PartitionStrategy) error {
+	if strategy.Type != RangePartition {
+		return fmt.Errorf("%w: unknown partition type %d", ErrInvalidSchema, strategy.Type)
+	}
+
+	var col *Column
+	for i := range cols {
+		if cols[i].Name == partitionCol {
+			col = &cols[i]
+		}
+	}
+	switch {
+	case col == nil:
+		return fmt.Errorf("%w: unknown partition column %s", ErrInvalidSchema, partitionCol)
+	case col.Encrypted:
+		return fmt.Errorf("%w: partition column %s is encrypted", ErrInvalidSchema, partitionCol)
+	case col.DataType != Int && col.DataType != DateTime:
+		return fmt.Errorf("%w: partition column %s is %s, not Int or DateTime", ErrInvalidSchema, partitionCol, col.DataType)
+	case len(strategy.Bounds) == 0:
+		return fmt.Errorf("%w: range partitioning needs at least one bound", ErrInvalidSchema)
+	}
+
+	for i, bound := range strategy.Bounds {
+		if !valueMatchesType(bound, col.DataType) {
+			return fmt.Errorf("%w: partition bound %v is not %s", ErrInvalidSchema, bound, col.DataType)
+		}
+		if i > 0 && compareOrdered(strategy.Bounds[i-1], bound) >= 0 {
+			return fmt.Errorf("%w: partition bounds must be ascending", ErrInvalidSchema)
+		}
+	}
+	return nil
+}
+
+// partitionOf returns the partition holding val.
+func (s PartitionStrategy) partitionOf(val interface{}) int {
+	if val == nil {
+		return 0
+	}
+	return sort.Search(len(s.Bounds), func(i int) bool {
+		return compareOrdered(s.Bounds[i], val) > 0
+	})
+}
+
+func (t *Table) resetPartitions() {
+	if t.PartitionColumn == "" {
+		t.partitions = nil
+		return
+	}
+	t.partitions = make([]map[string]struct{}, len(t.Partitioning.Bounds)+1)
+	for i := range t.partitions {
+		t.partitions[i] = make(map[string]struct{})
+	}
+}
+
+// scanFilter returns the filter applied directly to the scanned rows, if
+// any.
+func (p ExecutionPlan) scanFilter() expr {
+	if len(p.Operations) > 1 && p.Operations[1].Type == Filter {
+		return p.Operations[1].filterExpr
+	}
+	return nil
+}
+
+// prunedScan is scanRows restricted to the partitions whose rows may
+// satisfy filter, and to the rows inverted and full-text indexes list for
+// its CONTAINS and MATCH conjuncts. The filter is applied to the scanned
+// rows afterwards.
+func (t *Table) prunedScan(includeDeleted bool, filter expr) []Row {
+	keep := t.prunePartitions(filter)
+	if ids, ok := t.indexedLookup(filter); ok {
+		var rows []Row
+		now := time.Now()
+		for id := range ids {
+			row, ok := t.getRow(id)
+			if !ok || !t.visible(row, now, includeDeleted) {
+				continue
+			}
+			if keep != nil && !keep[t.Partitioning.partitionOf(row.Columns[t.PartitionColumn])] {
+				continue
+			}
+			rows = append(rows, row)
+		}
+		t.inScanOrder(rows)
+		return rows
+	}
+	if keep == nil {
+		return t.scanRows(includeDeleted)
+	}
+
+	var rows []Row
+	now := time.Now()
+	for i, ids := range t.partitions {
+		if !keep[i] {
+			continue
+		}
+		for id := range ids {
+			if row, ok := t.getRow(id); ok && t.visible(row, now, includeDeleted) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	t.inScanOrder(rows)
+	return rows
+}
+
+// prunePartitions reports which partitions may hold rows matching filter,
+// or nil if all may.
+func (t *Table) prunePartitions(filter expr) []bool {
+	if t.partitions == nil || filter == nil {
+		return nil
+	}
+
+	keep := make([]bool, len(t.partitions))
+	for i := range keep {
+		keep[i] = true
+	}
+
+	pruned := false
+	for _, conjunct := range conjuncts(filter) {
+		allowed := t.partitionsMatching(conjunct)
+		if allowed == nil {
+			continue
+		}
+		for i := range keep {
+			if keep[i] && !allowed[i] {
+				keep[i] = false
+				pruned = true
+			}
+		}
+	}
+
+	if !pruned {
+		return nil
+	}
+	return keep
+}
+
+// partitionsMatching reports which partitions may hold rows satisfying e, or
+// nil if e does not restrict the partition column.
+func (t *Table) partitionsMatching(e expr) []bool {
+	s := t.Partitioning
+	allowed := make([]bool, len(t.partitions))
+	mark := func(from, to int) {
+		for i := from; i <= to; i++ {
+			allowed[i] = true
+		}
+	}
+	last := len(allowed) - 1
+
+	switch e := e.(type) {
+	case binaryExpr:
+		op := e.op
+		x, val := e.left, e.right
+		if !t.isPartitionColumn(x) {
+			x, val = e.right, e.left
+			op = flipComparison(op)
+		}
+
+		v, ok := t.partitionBound(x, val)
+		if !ok {
+			return nil
+		}
+
+		switch op {
+		case "=":
+			p := s.partitionOf(v)
+			mark(p, p)
+		case "<":
+			// Nothing below a partition's lower bound is in it.
+			p := s.partitionOf(v)
+			if p > 0 && compareOrdered(v, s.Bounds[p-1]) == 0 {
+				p--
+			}
+			mark(0, p)
+		case "<=":
+			mark(0, s.partitionOf(v))
+		case ">", ">=":
+			mark(s.partitionOf(v), last)
+		default:
+			return nil
+		}
+	case betweenExpr:
+		if e.not {
+			return nil
+		}
+
+		lo, loOK := t.partitionBound(e.x, e.lo)
+		hi, hiOK := t.partitionBound(e.x, e.hi)
+		if !loOK || !hiOK {
+			return nil
+		}
+		mark(s.partitionOf(lo), s.partitionOf(hi))
+	case inExpr:
+		if e.not {
+			return nil
+		}
+
+		for _, item := range e.list {
+			v, ok := t.partitionBound(e.x, item)
+			if !ok {
+				return nil
+			}
+			p := s.partitionOf(v)
+			mark(p, p)
+		}
+	default:
+		return nil
+	}
+	return allowed
+}
+
+// partitionBound returns the constant value of e if x is the partition
+// column and e is comparable with its bounds.
+func (t *Table) partitionBound(x, e expr) (interface{}, bool) {
+	if !t.isPartitionColumn(x) || !isConstant(e) {
+		return nil, false
+	}
+
+	v, err := e.eval(Row{})
+	if err == nil {
+		_, v = timeOperands(t.Partitioning.Bounds[0], v)
+	}
+	if err != nil || v == nil || valueKind(v) != valueKind(t.Partitioning.Bounds[0]) {
+		return nil, false
+	}
+	return v, true
+}
+
+func (t *Table) isPartitionColumn(e expr) bool {
+	col, ok := e.(columnExpr)
+	if !ok {
+		return false
+	}
+	return col.name == t.PartitionColumn || col.name == t.Name+"."+t.PartitionColumn
+}
+
+// isConstant reports whether e reads no column, so it has the same value
+// for every row.
+func isConstant(e expr) bool {
+	switch e := e.(type) {
+	case literalExpr:
+		return true
+	case unaryExpr:
+		return isConstant(e.x)
+	case binaryExpr:
+		return isConstant(e.left) && isConstant(e.right)
+	case castExpr:
+		return isConstant(e.x)
+	case funcExpr:
+		for _, arg := range e.args {
+			if !isConstant(arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// flipComparison returns the operator that gives the same result with its
+// operands swapped.
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// describePartitions says which partitions a scan of t with filter reads,
+// for Explain.
+func (t *Table) describePartitions(filter expr) string {
+	keep := t.prunePartitions(filter)
+	if keep == nil {
+		return fmt.Sprintf("all %d partitions", len(t.partitions))
+	}
+
+	var read []string
+	for i, ok := range keep {
+		if ok {
+			read = append(read, fmt.Sprint(i))
+		}
+	}
+	return fmt.Sprintf("partitions %s of %d", strings.Join(read, ", "), len(t.partitions))
+}
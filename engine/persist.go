@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/veltahq/kiv/storage"
+)
+
+const tableFileExt = ".tbl"
+
+// Open loads the database stored in dir, creating the directory if it does
+// not exist. SaveToDisk writes back to the same directory.
+func Open(dir string) (*NewDatabase, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	db := &NewDatabase{
+		Name:   filepath.Base(dir),
+		Tables: make(map[string]Table),
+		path:   dir,
+		opened: time.Now(),
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), tableFileExt) {
+			continue
+		}
+
+		var table Table
+		if err := storage.ReadFile(filepath.Join(dir, entry.Name()), &table); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", entry.Name(), err)
+		}
+		if err := table.decodeEnums(); err != nil {
+			return nil, fmt.Errorf("loading %s: %w", entry.Name(), err)
+		}
+
+		table.ensureIndexes()
+		db.Tables[table.Name] = table
+	}
+
+	return db, nil
+}
+
+func (db *NewDatabase) SaveToDisk() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.saveLocked()
+}
+
+func (db *NewDatabase) Tablespace() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.path
+}
+
+// SetTablespace redirects persistence to dir. Everything in memory is first
+// flushed to the current tablespace, if there is one; writers are blocked
+// from the flush until the switch, so nothing lands in between.
+func (db *NewDatabase) SetTablespace(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.path != "" {
+		if err := db.saveLocked(); err != nil {
+			return fmt.Errorf("flushing tablespace %s: %w", db.path, err)
+		}
+	}
+
+	db.path = dir
+	return nil
+}
+
+// saveLocked writes every table to the tablespace and removes the files of
+// tables that no longer exist. Materialized views are not saved, and any
+// file of a table with a materialized view's name is removed. The caller
+// must hold db.mu.
+func (db *NewDatabase) saveLocked() error {
+	if db.path == "" {
+		return ErrNoStoragePath
+	}
+
+	keep := make(map[string]bool, len(db.Tables))
+	for name, table := range db.Tables {
+		if db.matViews[name] != nil {
+			continue
+		}
+
+		snapshot := table
+		snapshot.Rows = table.encodeEnums(table.allRows())
+
+		file := tableFileName(name)
+		if err := storage.WriteFile(filepath.Join(db.path, file), snapshot); err != nil {
+			return fmt.Errorf("saving table %s: %w", name, err)
+		}
+		keep[file] = true
+	}
+
+	entries, err := os.ReadDir(db.path)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), tableFileExt) && !keep[entry.Name()] {
+			if err := os.Remove(filepath.Join(db.path, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func tableFileName(tableName string) string {
+	return url.PathEscape(tableName) + tableFileExt
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestReopenKeepsOnlyCommittedTransactions saves while one transaction is
+// committed and another still open, and checks that reopening the saved
+// database brings back the first's writes and none of the second's.
+func TestReopenKeepsOnlyCommittedTransactions(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCreateTable(t, db, "accounts", []Column{{Name: "balance", DataType: Int}}, nil)
+	mustInsert(t, db, "accounts", "a", map[string]interface{}{"balance": 100})
+
+	committed, err := db.BeginTransaction()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(committed, "accounts", "b", map[string]interface{}{"balance": 50}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRowTx(committed, "accounts", "a", map[string]interface{}{"balance": 50}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(committed); err != nil {
+		t.Fatal(err)
+	}
+
+	open, err := db.BeginTransaction()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(open, "accounts", "c", map[string]interface{}{"balance": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRowTx(open, "accounts", "a", map[string]interface{}{"balance": 40}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SaveToDisk(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := mustQuery(t, reopened, Query{Select: []string{"id", "balance"}, From: "accounts", OrderBy: "id"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("reopened rows = %v, want [a b]", got)
+	}
+	for _, row := range result.Rows {
+		if balance := toInt64(row.Columns["balance"]); balance != 50 {
+			t.Errorf("reopened balance of %s = %d, want 50", rowID(row), balance)
+		}
+	}
+
+	if err := db.RollbackTransaction(open); err != nil {
+		t.Fatal(err)
+	}
+}
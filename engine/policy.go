@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+)
+
+type principalKey struct{}
+
+// SetCurrentPrincipal returns a copy of ctx under which reads run as
+// principal: queries, GetRowByIDContext, GetAllRowsContext and
+// CountRowsContext given it see only the rows principal's policies allow.
+// An empty principal, like a context without one, reads everything.
+func SetCurrentPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// CurrentPrincipal returns the principal SetCurrentPrincipal set on ctx,
+// or "" if there is none.
+func CurrentPrincipal(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// CreatePolicy adds policy to tableName. Once a table has a policy, a
+// principal reads only the rows for which the Filter of one of its own
+// policies is true, and none at all if it has no policy on the table.
+// Reads without a principal are not restricted. Policies are checked
+// against the stored rows, decrypted but before any row transformer, and
+// a row whose filter fails to evaluate is not visible. Writes are not
+// restricted.
+func (db *NewDatabase) CreatePolicy(tableName string, policy RowPolicy) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if policy.Name == "" || policy.Principal == "" {
+		return fmt.Errorf("%w: policy needs a name and a principal", ErrInvalidQuery)
+	}
+	if _, err := parseExpr(policy.Filter); err != nil {
+		return fmt.Errorf("policy %s: %w", policy.Name, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	for _, p := range table.Policies {
+		if p.Name == policy.Name {
+			return fmt.Errorf("%w: %s on %s", ErrPolicyExists, policy.Name, tableName)
+		}
+	}
+
+	table.Policies = append(append([]RowPolicy(nil), table.Policies...), policy)
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+	return nil
+}
+
+// DropPolicy removes the policy policyName from tableName. Dropping a
+// table's last policy makes all its rows visible to every principal again.
+func (db *NewDatabase) DropPolicy(tableName, policyName string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	policies := make([]RowPolicy, 0, len(table.Policies))
+	for _, p := range table.Policies {
+		if p.Name != policyName {
+			policies = append(policies, p)
+		}
+	}
+	if len(policies) == len(table.Policies) {
+		return fmt.Errorf("%w: %s on %s", ErrPolicyNotFound, policyName, tableName)
+	}
+
+	if len(policies) == 0 {
+		policies = nil
+	}
+	table.Policies = policies
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+	return nil
+}
+
+// policyFilter returns a function dropping the rows of t that the
+// principal of ctx may not read, or nil if its reads of t are not
+// restricted.
+func policyFilter(ctx context.Context, t *Table) func([]Row) []Row {
+	principal := CurrentPrincipal(ctx)
+	if principal == "" || len(t.Policies) == 0 {
+		return nil
+	}
+
+	var filters []expr
+	for _, p := range t.Policies {
+		if p.Principal != principal {
+			continue
+		}
+		// CreatePolicy has checked that the filter parses.
+		if e, err := parseExpr(p.Filter); err == nil {
+			filters = append(filters, e)
+		}
+	}
+
+	return func(rows []Row) []Row {
+		visible := make([]Row, 0, len(rows))
+		for _, row := range rows {
+			for _, filter := range filters {
+				if ok, err := evaluateFilter(row, filter); err == nil && ok {
+					visible = append(visible, row)
+					break
+				}
+			}
+		}
+		return visible
+	}
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func policyTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "docs", []Column{{Name: "owner", DataType: String}}, nil)
+	mustCreateTable(t, db, "owners", []Column{{Name: "name", DataType: String}}, nil)
+	for i, owner := range []string{"ann", "bob", "ann", "cy"} {
+		mustInsert(t, db, "docs", fmt.Sprintf("d%d", i+1), map[string]interface{}{"owner": owner})
+	}
+	for _, name := range []string{"ann", "bob"} {
+		mustInsert(t, db, "owners", name, map[string]interface{}{"name": name})
+	}
+	if err := db.CreatePolicy("docs", RowPolicy{Name: "own", Principal: "ann", Filter: "owner = 'ann'"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPolicyHidesRows(t *testing.T) {
+	db := policyTestDB(t)
+	ann := SetCurrentPrincipal(context.Background(), "ann")
+
+	rows, err := db.GetAllRowsContext(ann, "docs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(QueryResult{Rows: rows}); !reflect.DeepEqual(got, []string{"d1", "d3"}) {
+		t.Errorf("GetAllRowsContext as ann = %v, want [d1 d3]", got)
+	}
+	if n, err := db.CountRowsContext(ann, "docs"); err != nil || n != 2 {
+		t.Errorf("CountRowsContext as ann = %d, %v, want 2", n, err)
+	}
+	if _, err := db.GetRowByIDContext(ann, "docs", "d2"); !errors.Is(err, ErrIDNotFound) {
+		t.Errorf("GetRowByIDContext(d2) as ann = %v, want ErrIDNotFound", err)
+	}
+
+	// The policy is ANDed with the query's own filter, and applies to
+	// joined tables too.
+	result, err := db.ExecuteQueryContext(ann, Query{Select: []string{"id"}, From: "docs", Where: "owner != 'ann' OR id = 'd3'"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"d3"}) {
+		t.Errorf("query as ann = %v, want [d3]", got)
+	}
+	result, err = db.ExecuteQueryContext(ann, Query{
+		Select:  []string{"docs.id"},
+		From:    "owners",
+		Joins:   []Join{{Table: "docs", On: "owners.name = docs.owner"}},
+		OrderBy: "docs.id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 2 {
+		t.Errorf("join as ann has %d rows, want 2", len(result.Rows))
+	}
+
+	// A principal with no policy on the table sees nothing; without a
+	// principal everything is visible.
+	bob := SetCurrentPrincipal(context.Background(), "bob")
+	if n, err := db.CountRowsContext(bob, "docs"); err != nil || n != 0 {
+		t.Errorf("CountRowsContext as bob = %d, %v, want 0", n, err)
+	}
+	if n, err := db.CountRowsContext(bob, "owners"); err != nil || n != 2 {
+		t.Errorf("CountRowsContext of a table without policies as bob = %d, %v, want 2", n, err)
+	}
+	if rows, err := db.GetAllRows("docs"); err != nil || len(rows) != 4 {
+		t.Errorf("GetAllRows without a principal = %d rows, %v, want 4", len(rows), err)
+	}
+}
+
+func TestDropPolicy(t *testing.T) {
+	db := policyTestDB(t)
+	ann := SetCurrentPrincipal(context.Background(), "ann")
+
+	err := db.CreatePolicy("docs", RowPolicy{Name: "own", Principal: "ann", Filter: "TRUE"})
+	if !errors.Is(err, ErrPolicyExists) {
+		t.Errorf("CreatePolicy of a duplicate name = %v, want ErrPolicyExists", err)
+	}
+	if err := db.CreatePolicy("docs", RowPolicy{Name: "cy", Principal: "ann", Filter: "owner = 'cy'"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.CountRowsContext(ann, "docs"); n != 3 {
+		t.Errorf("with two policies ann sees %d rows, want 3", n)
+	}
+
+	if err := db.DropPolicy("docs", "own"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.CountRowsContext(ann, "docs"); n != 1 {
+		t.Errorf("after dropping own ann sees %d rows, want 1", n)
+	}
+	if err := db.DropPolicy("docs", "cy"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.CountRowsContext(ann, "docs"); n != 4 {
+		t.Errorf("after dropping every policy ann sees %d rows, want 4", n)
+	}
+	if err := db.DropPolicy("docs", "cy"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("DropPolicy of a dropped policy = %v, want ErrPolicyNotFound", err)
+	}
+}
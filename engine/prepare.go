@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// paramExpr is a $n query parameter. Plans are built with parameters in
+// place and bound to values by ExecutionPlan.bind.
+type paramExpr struct {
+	index int
+}
+
+func (e paramExpr) eval(Row) (interface{}, error) {
+	return nil, fmt.Errorf("%w: parameter $%d is not bound", ErrInvalidQuery, e.index)
+}
+
+func (e paramExpr) String() string {
+	return fmt.Sprintf("$%d", e.index)
+}
+
+// PreparedQuery is a query planned once by Prepare and run any number of
+// times, concurrently if need be, with different parameter values. It is
+// planned again when a table it reads is re-created or its schema changes.
+type PreparedQuery struct {
+	db    *NewDatabase
+	query Query
+
+	mu     sync.Mutex
+	plan   ExecutionPlan
+	stamps map[string]uint64
+}
+
+// Prepare parses and plans query, whose expressions may refer to
+// parameters $1, $2 and so on. query.Args is ignored; the values are given
+// to Execute.
+func (db *NewDatabase) Prepare(query Query) (*PreparedQuery, error) {
+	query.Args = nil
+
+	stamps := db.schemaStamps(query)
+	plan, err := db.planQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreparedQuery{db: db, query: query, plan: plan, stamps: stamps}, nil
+}
+
+func (p *PreparedQuery) Execute(args ...interface{}) (QueryResult, error) {
+	return p.ExecuteContext(context.Background(), args...)
+}
+
+// ExecuteContext runs the query with args bound to its parameters, as
+// ExecuteQueryContext would.
+func (p *PreparedQuery) ExecuteContext(ctx context.Context, args ...interface{}) (QueryResult, error) {
+	query := p.query
+	query.Args = args
+
+	return p.db.runQuery(ctx, query, func() (ExecutionPlan, error) {
+		plan, err := p.currentPlan()
+
+		if err != nil {
+			return ExecutionPlan{}, err
+		}
+		return plan.bind(args)
+	})
+}
+
+// currentPlan returns the prepared plan, planning again first if the
+// schema of a table it reads or the planner mode has changed.
+func (p *PreparedQuery) currentPlan() (ExecutionPlan, error) {
+	stamps := p.db.schemaStamps(p.query)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if sameStamps(stamps, p.stamps) && p.plan.Mode == p.db.GetQueryPlannerMode() {
+		return p.plan, nil
+	}
+
+	plan, err := p.db.planQuery(p.query)
+
+	if err != nil {
+		return ExecutionPlan{}, err
+	}
+	p.plan, p.stamps = plan, stamps
+	return plan, nil
+}
+
+// schemaStamps returns the schema stamp of each table query reads,
+// through any views; a missing table has stamp zero.
+func (db *NewDatabase) schemaStamps(query Query) map[string]uint64 {
+	if expanded, err := db.expandViews(query); err == nil {
+		query = expanded
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stamps := make(map[string]uint64)
+	for _, name := range queryTables(query) {
+		stamps[name] = db.Tables[name].schema
+	}
+	return stamps
+}
+
+func sameStamps(a, b map[string]uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, stamp := range a {
+		if b[name] != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+// planQuery builds the plan for query without binding its parameters.
+func (db *NewDatabase) planQuery(query Query) (ExecutionPlan, error) {
+	query, err := db.expandViews(query)
+
+	if err != nil {
+		return ExecutionPlan{}, err
+	}
+
+	plan, err := db.createExecutionPlan(query)
+
+	if err != nil {
+		return ExecutionPlan{}, err
+	}
+	if err := db.checkColumns(query, plan); err != nil {
+		return ExecutionPlan{}, err
+	}
+
+	for _, op := range plan.Operations {
+		for _, e := range op.exprs() {
+			if _, err := rewriteExpr(e, func(e expr) (expr, error) {
+				if param, ok := e.(paramExpr); ok && param.index > plan.params {
+					plan.params = param.index
+				}
+				return e, nil
+			}); err != nil {
+				return ExecutionPlan{}, err
+			}
+		}
+	}
+	return plan, nil
+}
+
+// bind returns a copy of p with args in place of its parameters. There
+// must be exactly one argument per parameter.
+func (p ExecutionPlan) bind(args []interface{}) (ExecutionPlan, error) {
+	if len(args) != p.params {
+		return ExecutionPlan{}, fmt.Errorf("%w: query has %d parameters, got %d arguments", ErrInvalidQuery, p.params, len(args))
+	}
+	if p.params == 0 {
+		return p, nil
+	}
+
+	substitute := func(e expr) (expr, error) {
+		if param, ok := e.(paramExpr); ok {
+			return literalExpr{args[param.index-1]}, nil
+		}
+		return e, nil
+	}
+
+	bound := p
+	bound.Operations = make([]Operation, len(p.Operations))
+	for i, op := range p.Operations {
+		if i > 0 {
+			op.Parent = &bound.Operations[i-1]
+		}
+
+		var err error
+		if op.filterExpr != nil {
+			if op.filterExpr, err = rewriteExpr(op.filterExpr, substitute); err != nil {
+				return ExecutionPlan{}, err
+			}
+		}
+		if op.joinProbe != nil {
+			if op.joinProbe, err = rewriteExpr(op.joinProbe, substitute); err != nil {
+				return ExecutionPlan{}, err
+			}
+		}
+		if op.projections != nil {
+			projections := make([]projection, len(op.projections))
+			for j, proj := range op.projections {
+				if proj.expr, err = rewriteExpr(proj.expr, substitute); err != nil {
+					return ExecutionPlan{}, err
+				}
+				projections[j] = proj
+			}
+			op.projections = projections
+		}
+		bound.Operations[i] = op
+	}
+	return bound, nil
+}
+
+// exprs returns the compiled expressions op evaluates.
+func (op Operation) exprs() []expr {
+	var exprs []expr
+	if op.filterExpr != nil {
+		exprs = append(exprs, op.filterExpr)
+	}
+	if op.joinProbe != nil {
+		exprs = append(exprs, op.joinProbe)
+	}
+	for _, proj := range op.projections {
+		exprs = append(exprs, proj.expr)
+	}
+	return exprs
+}
+
+// rewriteExpr rebuilds e bottom-up, replacing each node by fn's result.
+func rewriteExpr(e expr, fn func(expr) (expr, error)) (expr, error) {
+	var err error
+	rewrite := func(x expr) expr {
+		if x == nil || err != nil {
+			return x
+		}
+		var out expr
+		out, err = rewriteExpr(x, fn)
+		return out
+	}
+	rewriteAll := func(xs []expr) []expr {
+		out := make([]expr, len(xs))
+		for i, x := range xs {
+			out[i] = rewrite(x)
+		}
+		return out
+	}
+
+	switch e := e.(type) {
+	case unaryExpr:
+		e.x = rewrite(e.x)
+		return finishRewrite(e, err, fn)
+	case binaryExpr:
+		e.left, e.right = rewrite(e.left), rewrite(e.right)
+		return finishRewrite(e, err, fn)
+	case isNullExpr:
+		e.x = rewrite(e.x)
+		return finishRewrite(e, err, fn)
+	case inExpr:
+		e.x, e.list = rewrite(e.x), rewriteAll(e.list)
+		return finishRewrite(e, err, fn)
+	case betweenExpr:
+		e.x, e.lo, e.hi = rewrite(e.x), rewrite(e.lo), rewrite(e.hi)
+		return finishRewrite(e, err, fn)
+	case likeExpr:
+		e.x = rewrite(e.x)
+		return finishRewrite(e, err, fn)
+	case matchExpr:
+		e.x, e.query = rewrite(e.x), rewrite(e.query)
+		return finishRewrite(e, err, fn)
+	case funcExpr:
+		e.args = rewriteAll(e.args)
+		return finishRewrite(e, err, fn)
+	case castExpr:
+		e.x = rewrite(e.x)
+		return finishRewrite(e, err, fn)
+	case anyExpr:
+		e.array, e.x = rewrite(e.array), rewrite(e.x)
+		return finishRewrite(e, err, fn)
+	case containsExpr:
+		e.x, e.list = rewrite(e.x), rewriteAll(e.list)
+		return finishRewrite(e, err, fn)
+	case aggExpr:
+		e.arg = rewrite(e.arg)
+		return finishRewrite(e, err, fn)
+	default:
+		return fn(e)
+	}
+}
+
+func finishRewrite(e expr, err error, fn func(expr) (expr, error)) (expr, error) {
+	if err != nil {
+		return nil, err
+	}
+	return fn(e)
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func prepareTestDB(t testing.TB, rows int) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{
+		{Name: "n", DataType: Int},
+		{Name: "kind", DataType: String},
+	}, nil)
+	for i := 0; i < rows; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%04d", i), map[string]interface{}{"n": i, "kind": fmt.Sprintf("k%d", i%3)})
+	}
+	return db
+}
+
+var preparedItemsQuery = Query{Select: []string{"id"}, From: "items", Where: "n >= $1 AND kind = $2", OrderBy: "id"}
+
+func TestPreparedQueryMatchesExecuteQuery(t *testing.T) {
+	db := prepareTestDB(t, 100)
+	prepared, err := db.Prepare(preparedItemsQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]interface{}{{90, "k0"}, {0, "k2"}, {1000, "k1"}} {
+		query := preparedItemsQuery
+		query.Args = args
+		want := mustQuery(t, db, query)
+
+		got, err := prepared.Execute(args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(resultIDs(got), resultIDs(want)) {
+			t.Errorf("Execute%v = %v, ExecuteQuery = %v", args, resultIDs(got), resultIDs(want))
+		}
+	}
+
+	if _, err := prepared.Execute(1); err == nil {
+		t.Error("Execute with too few arguments succeeded")
+	}
+}
+
+func TestPreparedQueryConcurrentExecute(t *testing.T) {
+	db := prepareTestDB(t, 300)
+	prepared, err := db.Prepare(preparedItemsQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				min := (w*20 + i) % 300
+				result, err := prepared.Execute(min, "k1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for _, id := range resultIDs(result) {
+					var n int
+					fmt.Sscanf(id, "i%d", &n)
+					if n < min || n%3 != 1 {
+						t.Errorf("Execute(%d, k1) returned %s", min, id)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestPreparedQueryReplansOnSchemaChange(t *testing.T) {
+	db := prepareTestDB(t, 10)
+	prepared, err := db.Prepare(Query{Select: []string{"id", "n"}, From: "items", Where: "n = $1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := prepared.Execute(4); err != nil || len(result.Rows) != 1 {
+		t.Fatalf("Execute(4) = %v, %v, want one row", result.Rows, err)
+	}
+
+	// Re-create the table with an index on n; the prepared query must see
+	// the new table and probe its index.
+	if err := db.DropTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, []Index{{Name: "by_n", Columns: []string{"n"}}})
+	mustInsert(t, db, "items", "x", map[string]interface{}{"n": 4})
+	mustInsert(t, db, "items", "y", map[string]interface{}{"n": 4})
+
+	result, err := prepared.Execute(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"x", "y"}) {
+		t.Fatalf("Execute(4) after re-creating the table = %v, want [x y]", ids)
+	}
+	if !sameStamps(prepared.stamps, db.schemaStamps(prepared.query)) {
+		t.Fatal("the prepared plan was not replaced")
+	}
+}
+
+// BenchmarkPreparedQuery runs over a small table, so that the time
+// spent parsing and planning shows.
+func BenchmarkPreparedQuery(b *testing.B) {
+	db := prepareTestDB(b, 20)
+	b.Run("ExecuteQuery", func(b *testing.B) {
+		query := preparedItemsQuery
+		query.NoCache = true
+		for i := 0; i < b.N; i++ {
+			query.Args = []interface{}{i % 20, "k1"}
+			if _, err := db.ExecuteQuery(query); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Prepared", func(b *testing.B) {
+		query := preparedItemsQuery
+		query.NoCache = true
+		prepared, err := db.Prepare(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := prepared.Execute(i%20, "k1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type projection struct {
+	name string
+	expr expr
+}
+
+type aggExpr struct {
+	name string
+	arg  expr
+}
+
+var aggregateFuncs = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"AVG":   true,
+	"MIN":   true,
+	"MAX":   true,
+}
+
+func (e aggExpr) eval(Row) (interface{}, error) {
+	return nil, fmt.Errorf("%w: aggregate %s is only allowed as a SELECT item", ErrInvalidQuery, e.name)
+}
+
+func (e aggExpr) String() string {
+	if e.arg == nil {
+		return e.name + "(*)"
+	}
+	return e.name + "(" + e.arg.String() + ")"
+}
+
+// parseProjections compiles the SELECT list. The result column is named
+// after the item as written. A query either projects plain expressions or
+// only aggregates; mixing the two is rejected.
+func parseProjections(items []string) ([]projection, bool, error) {
+	projections := make([]projection, 0, len(items))
+	aggregates := 0
+
+	for _, item := range items {
+		e, err := parseExpr(item)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		if _, ok := e.(aggExpr); ok {
+			aggregates++
+		}
+		projections = append(projections, projection{name: item, expr: e})
+	}
+
+	if aggregates > 0 && aggregates != len(projections) {
+		return nil, false, queryError(CodeInvalidArgument, ErrInvalidQuery, "", "cannot mix aggregate and non-aggregate SELECT items")
+	}
+
+	return projections, aggregates > 0, nil
+}
+
+func isCountOnly(projections []projection) bool {
+	if len(projections) != 1 {
+		return false
+	}
+	agg, ok := projections[0].expr.(aggExpr)
+	return ok && agg.name == "COUNT" && agg.arg == nil
+}
+
+func (p ExecutionPlan) isCountOnly() bool {
+	for _, op := range p.Operations {
+		if op.Type == CountOp {
+			return true
+		}
+	}
+	return false
+}
+
+// countRows answers COUNT(*) without materializing rows: with no filter
+// and no transform it is the table size, otherwise matching rows, passed
+// through transform if it is not nil, are counted in a single pass.
+func countRows(ctx context.Context, table *Table, plan ExecutionPlan, transform func([]Row) []Row) (QueryResult, error) {
+	var filter expr
+	var columns []string
+	var includeDeleted bool
+	for _, op := range plan.Operations {
+		switch op.Type {
+		case Scan:
+			includeDeleted = op.includeDeleted
+		case Filter:
+			filter = op.filterExpr
+		case CountOp:
+			columns = op.Columns
+		}
+	}
+
+	var count int64
+	var scanned int
+	switch {
+	case filter == nil && transform == nil && (includeDeleted || !table.SoftDelete) && !table.HasExpiry:
+		count = int64(table.rowCount())
+	case filter == nil && transform == nil:
+		scanned = table.rowCount()
+		count = int64(len(table.scanRows(includeDeleted)))
+	default:
+		var rows []Row
+		if transform != nil {
+			rows = table.scanRows(includeDeleted)
+			scanned = len(rows)
+			rows = transform(rows)
+		} else {
+			rows = table.prunedScan(includeDeleted, filter)
+			scanned = len(rows)
+		}
+		for i, row := range rows {
+			if err := queryCheckpoint(ctx, i); err != nil {
+				return QueryResult{}, err
+			}
+			if filter == nil {
+				count++
+				continue
+			}
+
+			matched, err := evaluateFilter(row, filter)
+
+			if err != nil {
+				return QueryResult{}, err
+			}
+			if matched {
+				count++
+			}
+		}
+	}
+
+	return QueryResult{
+		Columns:     columns,
+		ColumnTypes: []DataType{Int},
+		Rows:        []Row{{Columns: map[string]interface{}{columns[0]: count}}},
+		scanned:     scanned,
+	}, nil
+}
+
+func projectRows(ctx context.Context, rows []Row, projections []projection) ([]Row, error) {
+	projected := make([]Row, 0, len(rows))
+	for i, row := range rows {
+		if err := queryCheckpoint(ctx, i); err != nil {
+			return nil, err
+		}
+
+		newRow := Row{Columns: make(map[string]interface{}, len(projections))}
+		for _, p := range projections {
+			if col, ok := p.expr.(columnExpr); ok {
+				if val, ok := col.lookup(row); ok {
+					newRow.Columns[p.name] = cloneArray(val)
+				}
+				continue
+			}
+
+			val, err := p.expr.eval(row)
+
+			if err != nil {
+				return nil, err
+			}
+			newRow.Columns[p.name] = cloneArray(val)
+		}
+		projected = append(projected, newRow)
+	}
+	return projected, nil
+}
+
+type accumulator struct {
+	count    int64
+	sum      float64
+	isum     int64
+	dsum     DecimalValue
+	floats   bool
+	decimals bool
+	best     interface{}
+}
+
+// aggregateRows folds rows into a single result row. NULL inputs are
+// skipped; SUM stays integral unless a float is seen, and AVG, MIN, MAX and
+// SUM of no values are NULL. SUM and AVG of decimals, and of decimals and
+// integers, are exact decimals.
+func aggregateRows(ctx context.Context, rows []Row, projections []projection) ([]Row, error) {
+	accs := make([]accumulator, len(projections))
+
+	for n, row := range rows {
+		if err := queryCheckpoint(ctx, n); err != nil {
+			return nil, err
+		}
+
+		for i, p := range projections {
+			agg := p.expr.(aggExpr)
+			acc := &accs[i]
+
+			if agg.arg == nil {
+				acc.count++
+				continue
+			}
+
+			val, err := agg.arg.eval(row)
+
+			if err != nil {
+				return nil, err
+			}
+			if val == nil {
+				continue
+			}
+
+			if err := acc.add(agg.name, val); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := Row{Columns: make(map[string]interface{}, len(projections))}
+	for i, p := range projections {
+		result.Columns[p.name] = accs[i].result(p.expr.(aggExpr).name)
+	}
+
+	return []Row{result}, nil
+}
+
+func (a *accumulator) add(name string, val interface{}) error {
+	a.count++
+
+	switch name {
+	case "SUM", "AVG":
+		if valueKind(val) != kindNumber {
+			return fmt.Errorf("%w: %s of non-numeric value %T", ErrInvalidQuery, name, val)
+		}
+		if isFloat(val) {
+			a.floats = true
+		}
+		if isDecimal(val) && !a.decimals {
+			a.decimals = true
+			a.dsum = DecimalValue{Units: a.isum}
+		}
+		if a.decimals && !a.floats {
+			d, err := toDecimal(val)
+
+			if err != nil {
+				return err
+			}
+			if a.dsum, err = decimalArithmetic("+", a.dsum, d); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		a.sum += toFloat(val)
+		a.isum += toInt64(val)
+	case "MIN", "MAX":
+		if a.best == nil {
+			a.best = val
+			return nil
+		}
+		c, err := compareValues(val, a.best)
+
+		if err != nil {
+			return err
+		}
+		if (name == "MIN" && c < 0) || (name == "MAX" && c > 0) {
+			a.best = val
+		}
+	}
+
+	return nil
+}
+
+func (a *accumulator) result(name string) interface{} {
+	switch name {
+	case "COUNT":
+		return a.count
+	case "SUM":
+		if a.count == 0 {
+			return nil
+		}
+		if a.floats {
+			return a.sum
+		}
+		if a.decimals {
+			return a.dsum
+		}
+		return a.isum
+	case "AVG":
+		if a.count == 0 {
+			return nil
+		}
+		if a.decimals && !a.floats {
+			return a.dsum.average(a.count)
+		}
+		return a.sum / float64(a.count)
+	default:
+		return a.best
+	}
+}
+
+func isAggregateName(name string) bool {
+	return aggregateFuncs[strings.ToUpper(name)]
+}
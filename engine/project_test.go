@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func countTestDB(t testing.TB, rows int) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "events", []Column{
+		{Name: "kind", DataType: String},
+		{Name: "n", DataType: Int},
+	}, []Index{{Name: "by_kind", Columns: []string{"kind"}}})
+	for i := 0; i < rows; i++ {
+		mustInsert(t, db, "events", fmt.Sprintf("e%05d", i), map[string]interface{}{
+			"kind": fmt.Sprintf("k%d", i%4),
+			"n":    i,
+		})
+	}
+	return db
+}
+
+// TestCountMatchesQuery checks that COUNT(*), which is answered without
+// materializing rows, counts the rows the same query selects.
+func TestCountMatchesQuery(t *testing.T) {
+	db := countTestDB(t, 500)
+	if err := db.EnableSoftDelete("events", SoftDeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"e00001", "e00002", "e00100"} {
+		if err := db.DeleteRow("events", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, where := range []string{"", "kind = 'k1'", "n >= 250", "kind = 'k2' AND n < 100", "n < 0"} {
+		for _, includeDeleted := range []bool{false, true} {
+			count := mustQuery(t, db, Query{Select: []string{"COUNT(*)"}, From: "events", Where: where, IncludeDeleted: includeDeleted})
+			rows := mustQuery(t, db, Query{Select: []string{"id"}, From: "events", Where: where, IncludeDeleted: includeDeleted})
+
+			if len(count.Rows) != 1 {
+				t.Fatalf("WHERE %q: COUNT(*) returned %d rows", where, len(count.Rows))
+			}
+			if got := toInt64(count.Rows[0].Columns["COUNT(*)"]); got != int64(len(rows.Rows)) {
+				t.Errorf("WHERE %q IncludeDeleted=%v: COUNT(*) = %d, query returned %d rows", where, includeDeleted, got, len(rows.Rows))
+			}
+		}
+	}
+}
+
+func BenchmarkCountOnly(b *testing.B) {
+	db := countTestDB(b, 10000)
+	for _, bench := range []struct {
+		name  string
+		query Query
+	}{
+		{"NoWhere", Query{Select: []string{"COUNT(*)"}, From: "events", NoCache: true}},
+		{"Where", Query{Select: []string{"COUNT(*)"}, From: "events", Where: "n >= 5000", NoCache: true}},
+		{"Materialized", Query{Select: []string{"id"}, From: "events", Where: "n >= 5000", NoCache: true}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.ExecuteQuery(bench.query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
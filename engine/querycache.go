@@ -0,0 +1,294 @@
+package engine
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheEntries = 1000
+	defaultCacheBytes   = 64 << 20
+)
+
+// QueryCache is an LRU cache of query results, attached to a database with
+// SetQueryCache. Each entry records the writes stamp of every table its
+// query read; it is only returned while all of them are unchanged and,
+// with a TTL, until it expires.
+type QueryCache struct {
+	mu sync.Mutex
+
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	bytes      int64
+
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits, misses uint64
+}
+
+type cacheEntry struct {
+	key     string
+	stamps  map[string]uint64
+	result  QueryResult
+	size    int64
+	expires time.Time
+}
+
+// NewQueryCache returns an empty cache bounded by opts.
+func NewQueryCache(opts QueryCacheOptions) *QueryCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultCacheEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultCacheBytes
+	}
+
+	return &QueryCache{
+		maxEntries: opts.MaxEntries,
+		maxBytes:   opts.MaxBytes,
+		ttl:        opts.TTL,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// SetQueryCache caches the results of ExecuteQuery in cache, replacing the
+// current cache; nil turns caching off. A cached result is returned only
+// while none of the tables its query read has been written to since, by
+// an insert, update, delete or anything else that changes its rows, and
+// while it is younger than the cache's TTL. Queries on tables with row
+// TTLs, a row transformer or row policies are never cached. Set
+// Query.NoCache to bypass the cache for one query.
+func (db *NewDatabase) SetQueryCache(cache *QueryCache) {
+	db.cacheMu.Lock()
+	defer db.cacheMu.Unlock()
+
+	db.cache = cache
+}
+
+// EnableQueryCache attaches a new QueryCache bounded by opts, emptying any
+// previous cache and resetting its counters.
+func (db *NewDatabase) EnableQueryCache(opts QueryCacheOptions) {
+	db.SetQueryCache(NewQueryCache(opts))
+}
+
+func (db *NewDatabase) DisableQueryCache() {
+	db.SetQueryCache(nil)
+}
+
+// queryCache returns the attached cache, if any.
+func (db *NewDatabase) queryCache() *QueryCache {
+	db.cacheMu.Lock()
+	defer db.cacheMu.Unlock()
+
+	return db.cache
+}
+
+// Stats reports the cache's size and how many lookups it has answered.
+func (c *QueryCache) Stats() QueryCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return QueryCacheStats{
+		Entries: c.order.Len(),
+		Bytes:   c.bytes,
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+}
+
+// cachedResult looks query up in the cache. On a miss it returns the key
+// and table stamps to store the result under, or an empty key if the
+// result must not be cached. The stamps are taken before the query runs,
+// so a write racing with it can only make the stored entry stale on
+// arrival, never let it outlive the write.
+func (db *NewDatabase) cachedResult(query Query) (string, map[string]uint64, QueryResult, bool) {
+	cache := db.queryCache()
+	if cache == nil || query.NoCache {
+		return "", nil, QueryResult{}, false
+	}
+
+	db.mu.RLock()
+	stamps, ok := db.tableStamps(query)
+	db.mu.RUnlock()
+
+	if !ok {
+		return "", nil, QueryResult{}, false
+	}
+
+	key := queryCacheKey(query)
+	if result, ok := cache.get(key, stamps); ok {
+		return "", nil, result, true
+	}
+	return key, stamps, QueryResult{}, false
+}
+
+func (db *NewDatabase) cacheResult(key string, stamps map[string]uint64, result QueryResult) {
+	if key == "" {
+		return
+	}
+	if cache := db.queryCache(); cache != nil {
+		cache.put(key, stamps, result)
+	}
+}
+
+// tableStamps returns the writes stamp of each table query reads. It
+// reports false if the result depends on anything but the tables'
+// contents. The caller must hold db.mu.
+func (db *NewDatabase) tableStamps(query Query) (map[string]uint64, bool) {
+	if query.GenerateSeries == nil {
+		if _, _, err := parseSource(query.From); err != nil {
+			return nil, false
+		}
+	}
+
+	names := queryTables(query)
+	stamps := make(map[string]uint64, len(names))
+	for _, name := range names {
+		table, ok := db.Tables[name]
+		if !ok || table.HasExpiry || db.transformers[name] != nil || len(table.Policies) > 0 {
+			return nil, false
+		}
+		stamps[name] = table.writes
+	}
+	return stamps, true
+}
+
+// queryTables returns the names of the tables query reads.
+func queryTables(query Query) []string {
+	names := make([]string, 0, len(query.Joins)+1)
+	if query.GenerateSeries == nil {
+		series, unnest, _ := parseSource(query.From)
+
+		switch {
+		case unnest != nil:
+			names = append(names, unnest.table)
+		case series == nil:
+			names = append(names, query.From)
+		}
+	}
+	for _, join := range query.Joins {
+		names = append(names, join.Table)
+	}
+	return names
+}
+
+// queryCacheKey returns a canonical form of query: expressions are
+// normalised by parsing them, so spacing and keyword case do not matter.
+func queryCacheKey(query Query) string {
+	var b strings.Builder
+	field := func(s string) {
+		fmt.Fprintf(&b, "%q;", s)
+	}
+
+	for _, item := range query.Select {
+		field(canonicalExpr(item))
+	}
+	b.WriteString("|")
+	field(query.From)
+	if query.GenerateSeries != nil {
+		field(query.GenerateSeries.String())
+	}
+	for _, join := range query.Joins {
+		field(join.Table)
+		field(canonicalExpr(join.On))
+	}
+	field(canonicalExpr(query.Where))
+	field(query.OrderBy)
+	fmt.Fprintf(&b, "%d;%d;%t", query.Limit, query.Offset, query.IncludeDeleted)
+	for _, arg := range query.Args {
+		fmt.Fprintf(&b, ";%T:%v", arg, arg)
+	}
+	return b.String()
+}
+
+// canonicalExpr returns the parsed form of src, or src itself if it does
+// not parse.
+func canonicalExpr(src string) string {
+	if strings.TrimSpace(src) == "" {
+		return ""
+	}
+	if e, err := parseExpr(src); err == nil {
+		return e.String()
+	}
+	return src
+}
+
+func (c *QueryCache) get(key string, stamps map[string]uint64) (QueryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return QueryResult{}, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	stale := !entry.expires.IsZero() && !time.Now().Before(entry.expires)
+	for name, stamp := range stamps {
+		if entry.stamps[name] != stamp {
+			stale = true
+		}
+	}
+	if stale {
+		c.remove(elem)
+		c.misses++
+		return QueryResult{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	return copyResult(entry.result), true
+}
+
+func (c *QueryCache) put(key string, stamps map[string]uint64, result QueryResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	entry := &cacheEntry{key: key, stamps: stamps, result: copyResult(result), size: int64(len(key))}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	for _, row := range result.Rows {
+		entry.size += rowSize(row)
+	}
+	if entry.size > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += entry.size
+
+	for c.order.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *QueryCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// copyResult returns a copy of result that shares no rows with it.
+func copyResult(result QueryResult) QueryResult {
+	copied := QueryResult{
+		Columns:     append([]string(nil), result.Columns...),
+		ColumnTypes: append([]DataType(nil), result.ColumnTypes...),
+		Rows:        make([]Row, len(result.Rows)),
+	}
+	for i, row := range result.Rows {
+		copied.Rows[i] = copyRow(row)
+	}
+	return copied
+}
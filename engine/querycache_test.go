@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func cacheTestDB(t *testing.T, opts QueryCacheOptions) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	mustCreateTable(t, db, "other", []Column{{Name: "n", DataType: Int}}, nil)
+	for i := 0; i < 5; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%d", i), map[string]interface{}{"n": i})
+	}
+	db.EnableQueryCache(opts)
+	return db
+}
+
+func checkCacheStats(t *testing.T, db *NewDatabase, hits, misses uint64) {
+	t.Helper()
+	stats := db.queryCache().Stats()
+	if stats.Hits != hits || stats.Misses != misses {
+		t.Errorf("hits, misses = %d, %d, want %d, %d", stats.Hits, stats.Misses, hits, misses)
+	}
+}
+
+func TestQueryCacheHits(t *testing.T) {
+	db := cacheTestDB(t, QueryCacheOptions{})
+	query := Query{Select: []string{"id"}, From: "items", Where: "n > 1"}
+
+	mustQuery(t, db, query)
+	checkCacheStats(t, db, 0, 1)
+	mustQuery(t, db, query)
+	checkCacheStats(t, db, 1, 1)
+
+	// Spacing and keyword case are not part of the key.
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "items", Where: "n>1"})
+	checkCacheStats(t, db, 2, 1)
+	if len(result.Rows) != 3 {
+		t.Errorf("cached result has %d rows, want 3", len(result.Rows))
+	}
+
+	// A caller changing a result does not change the cached one.
+	result.Rows[0].Columns["id"] = "changed"
+	if got := resultIDs(mustQuery(t, db, query))[0]; got == "changed" {
+		t.Error("cached result shares rows with a returned one")
+	}
+
+	mustQuery(t, db, Query{Select: []string{"id"}, From: "items", Where: "n > 1", NoCache: true})
+	checkCacheStats(t, db, 3, 1)
+}
+
+func TestQueryCacheInvalidatedByWrites(t *testing.T) {
+	db := cacheTestDB(t, QueryCacheOptions{})
+	query := Query{Select: []string{"COUNT(*)"}, From: "items"}
+	count := func() int64 {
+		return toInt64(mustQuery(t, db, query).Rows[0].Columns["COUNT(*)"])
+	}
+
+	writes := []struct {
+		name  string
+		write func() error
+		want  int64
+	}{
+		{"insert", func() error { return db.InsertRow("items", "i9", map[string]interface{}{"n": 9}) }, 6},
+		{"update", func() error { return db.UpdateRow("items", "i9", map[string]interface{}{"n": 10}) }, 6},
+		{"delete", func() error { return db.DeleteRow("items", "i9") }, 5},
+		{"other table", func() error { return db.InsertRow("other", "o", map[string]interface{}{"n": 1}) }, 5},
+	}
+	count()
+	for _, w := range writes {
+		before := db.queryCache().Stats()
+		if err := w.write(); err != nil {
+			t.Fatal(err)
+		}
+		if got := count(); got != w.want {
+			t.Errorf("after %s: COUNT(*) = %d, want %d", w.name, got, w.want)
+		}
+		after := db.queryCache().Stats()
+		hit := after.Hits > before.Hits
+		if wantHit := w.name == "other table"; hit != wantHit {
+			t.Errorf("after %s: cache hit = %v, want %v", w.name, hit, wantHit)
+		}
+	}
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	db := cacheTestDB(t, QueryCacheOptions{MaxEntries: 2})
+	queries := make([]Query, 3)
+	for i := range queries {
+		queries[i] = Query{Select: []string{"id"}, From: "items", Where: fmt.Sprintf("n = %d", i)}
+	}
+
+	mustQuery(t, db, queries[0])
+	mustQuery(t, db, queries[1])
+	mustQuery(t, db, queries[0]) // 0 is now the most recently used
+	mustQuery(t, db, queries[2]) // evicts 1
+	checkCacheStats(t, db, 1, 3)
+	if n := db.queryCache().Stats().Entries; n != 2 {
+		t.Errorf("%d entries, want 2", n)
+	}
+
+	mustQuery(t, db, queries[0])
+	mustQuery(t, db, queries[2])
+	checkCacheStats(t, db, 3, 3)
+	mustQuery(t, db, queries[1])
+	checkCacheStats(t, db, 3, 4)
+}
+
+func TestQueryCacheTTL(t *testing.T) {
+	db := cacheTestDB(t, QueryCacheOptions{TTL: 20 * time.Millisecond})
+	query := Query{Select: []string{"id"}, From: "items"}
+
+	mustQuery(t, db, query)
+	mustQuery(t, db, query)
+	checkCacheStats(t, db, 1, 1)
+
+	time.Sleep(30 * time.Millisecond)
+	mustQuery(t, db, query)
+	checkCacheStats(t, db, 1, 2)
+	mustQuery(t, db, query)
+	checkCacheStats(t, db, 2, 2)
+}
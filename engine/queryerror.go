@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func (e *QueryError) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.withClause(e.Message)
+	case e.Message == "":
+		return e.withClause(e.Err.Error())
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.withClause(e.Message))
+}
+
+func (e *QueryError) withClause(msg string) string {
+	if e.Clause == "" {
+		return msg
+	}
+	return e.Clause + ": " + msg
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether running the same operation again may succeed:
+// true for query timeouts and for write conflicts (a row version that
+// changed underneath UpdateRowIfVersion, or a row lock that could not be
+// taken in time). Every other error will recur until the query or the data
+// changes.
+func (e *QueryError) Retryable() bool {
+	switch e.Code {
+	case CodeQueryTimeout, CodeWriteConflict:
+		return true
+	}
+	return false
+}
+
+// queryError returns a QueryError wrapping sentinel with no position.
+func queryError(code ErrorCode, sentinel error, token string, format string, args ...interface{}) *QueryError {
+	return &QueryError{
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Token:    token,
+		Position: -1,
+		Err:      sentinel,
+	}
+}
+
+// syntaxError returns a QueryError for token at pos in the text being
+// parsed.
+func syntaxError(code ErrorCode, token string, pos int, format string, args ...interface{}) *QueryError {
+	err := queryError(code, ErrInvalidQuery, token, format, args...)
+	err.Position = pos
+	return err
+}
+
+// inClause records that err, if it is a QueryError, was found in clause.
+func inClause(clause string, err error) error {
+	var qe *QueryError
+	if errors.As(err, &qe) && qe.Clause == "" {
+		qe.Clause = clause
+	}
+	return err
+}
+
+// asQueryError returns err as a QueryError, classifying errors raised
+// without one by the sentinel they wrap.
+func asQueryError(err error) error {
+	var qe *QueryError
+	if err == nil || errors.As(err, &qe) {
+		return err
+	}
+
+	code := CodeInternal
+	switch {
+	case errors.Is(err, ErrTableNotFound):
+		code = CodeUnknownTable
+	case errors.Is(err, ErrInvalidCast):
+		code = CodeTypeMismatch
+	case errors.Is(err, ErrDivisionByZero):
+		code = CodeDivisionByZero
+	case errors.Is(err, ErrQueryTimeout):
+		code = CodeQueryTimeout
+	case errors.Is(err, ErrVersionConflict), errors.Is(err, ErrLockTimeout):
+		code = CodeWriteConflict
+	case errors.Is(err, ErrMemoryLimitExceeded):
+		code = CodeResourceExhausted
+	case errors.Is(err, ErrInvalidQuery):
+		code = CodeInvalidArgument
+	}
+	return &QueryError{Code: code, Position: -1, Err: err}
+}
+
+// checkColumns rejects a qualified column reference or JSON path, such as
+// orders.total, that starts with neither a table the query reads nor a
+// column of one. It would otherwise read as NULL and quietly match
+// nothing.
+func (db *NewDatabase) checkColumns(query Query, plan ExecutionPlan) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	tables := make(map[string]bool)
+	known := make(map[string]bool)
+	for _, op := range plan.Operations {
+		if op.Type != Scan && op.Type != JoinOp {
+			continue
+		}
+		tables[op.Table] = true
+		if table, ok := db.Tables[op.Table]; ok {
+			for _, col := range table.Columns {
+				known[col.Name] = true
+			}
+		}
+	}
+
+	for _, op := range plan.Operations {
+		clause, text := op.clause(query)
+		for _, e := range op.exprs() {
+			_, err := rewriteExpr(e, func(e expr) (expr, error) {
+				col, ok := e.(columnExpr)
+				if !ok || known[col.name] {
+					return e, nil
+				}
+				end := strings.IndexAny(col.name, ".[")
+				if end < 0 || tables[col.name[:end]] || known[col.name[:end]] {
+					return e, nil
+				}
+				prefix := col.name[:end]
+
+				err := queryError(CodeUnknownColumn, ErrInvalidQuery, col.name, "unknown column %s: %s is neither a table the query reads nor a column of one", col.name, prefix)
+				err.Clause = clause
+				if text != "" {
+					err.Position = strings.Index(text, col.name)
+				}
+				return nil, err
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clause names the part of query op comes from and, where op's expressions
+// were parsed from a single string, returns that string.
+func (op Operation) clause(query Query) (string, string) {
+	switch op.Type {
+	case Filter:
+		return "Where", query.Where
+	case JoinOp:
+		return "Join", op.Filter
+	default:
+		return "Select", ""
+	}
+}
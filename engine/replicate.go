@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// replicaLink is a database ReplicateTo keeps in step with this one. Entries
+// are queued in commit order and applied by the replica's goroutine.
+type replicaLink struct {
+	db *NewDatabase
+
+	mu       sync.Mutex
+	queue    []replicationEntry
+	applying int
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// replicationEntry is a change to apply to a replica: a committed row
+// change, or the whole of a table whose definition changed, with table
+// nil if it was dropped.
+type replicationEntry struct {
+	change    *ChangeEvent
+	tableName string
+	table     *Table
+}
+
+// ReplicateTo makes replica a read-only copy of db. Each table of db is
+// copied to replica, replacing any table of the same name; the replica's
+// other tables are left alone. From then on every committed row change
+// is applied to replica in commit order, asynchronously, so a read from it
+// may not yet see the latest writes (see ReplicaLag). Creating, altering
+// or dropping a table, and other changes to its definition, copy the table
+// again. Sequences are not replicated. Writes made directly to replica
+// are not sent back to db and may be overwritten; replica must not itself
+// replicate to db. Replication stops when db is closed or replica is
+// removed with RemoveReplica.
+func (db *NewDatabase) ReplicateTo(replica *NewDatabase) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if replica == nil || replica == db {
+		return fmt.Errorf("%w: a database cannot replicate to itself", ErrInvalidQuery)
+	}
+
+	// Holding db.mu keeps the copies and the changes that follow them
+	// in order.
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.replicaMu.Lock()
+	defer db.replicaMu.Unlock()
+
+	for _, r := range db.replicas {
+		if r.db == replica {
+			return fmt.Errorf("%w: %s", ErrReplicaExists, replica.Name)
+		}
+	}
+
+	names := make([]string, 0, len(db.Tables))
+	for name := range db.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := newReplica(replica)
+	for _, name := range names {
+		table := copyTable(db.Tables[name])
+		r.queue = append(r.queue, replicationEntry{tableName: name, table: &table})
+	}
+	db.replicas = append(db.replicas, r)
+	db.startReplica(r)
+	return nil
+}
+
+// RemoveReplica stops replicating db to replica. Changes not yet applied
+// to it are discarded. It does nothing if replica is not a replica of db.
+func (db *NewDatabase) RemoveReplica(replica *NewDatabase) {
+	db.replicaMu.Lock()
+	var removed *replicaLink
+	for i, r := range db.replicas {
+		if r.db == replica {
+			removed = r
+			db.replicas = append(db.replicas[:i:i], db.replicas[i+1:]...)
+			break
+		}
+	}
+	db.replicaMu.Unlock()
+
+	if removed != nil {
+		close(removed.stop)
+		<-removed.done
+	}
+}
+
+// ReplicaLag returns the number of changes of db not yet applied to
+// replica, or 0 if replica is not a replica of db.
+func (db *NewDatabase) ReplicaLag(replica *NewDatabase) int64 {
+	db.replicaMu.Lock()
+	defer db.replicaMu.Unlock()
+
+	for _, r := range db.replicas {
+		if r.db == replica {
+			return r.lag()
+		}
+	}
+	return 0
+}
+
+// ExecuteQueryOnReplica runs query on the replica of db that is furthest
+// along, or on db itself if it has none. The result may not reflect the
+// latest writes to db.
+func (db *NewDatabase) ExecuteQueryOnReplica(query Query) (QueryResult, error) {
+	db.replicaMu.Lock()
+	target, best := db, int64(-1)
+	for _, r := range db.replicas {
+		if lag := r.lag(); best < 0 || lag < best {
+			target, best = r.db, lag
+		}
+	}
+	db.replicaMu.Unlock()
+
+	return target.ExecuteQuery(query)
+}
+
+func newReplica(db *NewDatabase) *replicaLink {
+	return &replicaLink{
+		db:   db,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (r *replicaLink) lag() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.queue) + r.applying)
+}
+
+func (r *replicaLink) enqueue(entry replicationEntry) {
+	r.mu.Lock()
+	r.queue = append(r.queue, entry)
+	r.mu.Unlock()
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// startReplica starts r's goroutine, which applies its queued entries to
+// it until stopped. The caller must hold db.replicaMu.
+func (db *NewDatabase) startReplica(r *replicaLink) {
+	go func() {
+		defer close(r.done)
+
+		for {
+			r.mu.Lock()
+			batch := r.queue
+			r.queue, r.applying = nil, len(batch)
+			r.mu.Unlock()
+
+			for _, entry := range batch {
+				select {
+				case <-r.stop:
+					return
+				default:
+				}
+
+				if err := r.db.applyReplicated(entry); err != nil {
+					db.mu.RLock()
+					db.logf("replication to %s: %v", r.db.Name, err)
+					db.mu.RUnlock()
+				}
+
+				r.mu.Lock()
+				r.applying--
+				r.mu.Unlock()
+			}
+			if len(batch) > 0 {
+				continue
+			}
+
+			select {
+			case <-r.wake:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopReplicas stops replicating db to each of its replicas.
+func (db *NewDatabase) stopReplicas() {
+	db.replicaMu.Lock()
+	replicas := db.replicas
+	db.replicas = nil
+	db.replicaMu.Unlock()
+
+	for _, r := range replicas {
+		close(r.stop)
+		<-r.done
+	}
+}
+
+// replicateChange queues a committed row change for db's replicas. The
+// caller must hold db.mu for writing, as publishChange does.
+func (db *NewDatabase) replicateChange(event ChangeEvent) {
+	db.replicaMu.Lock()
+	defer db.replicaMu.Unlock()
+
+	for _, r := range db.replicas {
+		r.enqueue(replicationEntry{change: &event, tableName: event.TableName})
+	}
+}
+
+// replicateTable queues a copy of the table tableName, or its removal if
+// it no longer exists, for db's replicas. It is called after a change to
+// the table that is not a row change published to watchers, such as to
+// its definition. The caller must hold db.mu for writing.
+func (db *NewDatabase) replicateTable(tableName string) {
+	db.replicaMu.Lock()
+	defer db.replicaMu.Unlock()
+
+	if len(db.replicas) == 0 {
+		return
+	}
+
+	entry := replicationEntry{tableName: tableName}
+	if table, ok := db.Tables[tableName]; ok {
+		copied := copyTable(table)
+		entry.table = &copied
+	}
+	for _, r := range db.replicas {
+		r.enqueue(entry)
+	}
+}
+
+// applyReplicated applies entry, from the database db replicates, to db.
+func (db *NewDatabase) applyReplicated(entry replicationEntry) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if entry.change == nil {
+		if entry.table == nil {
+			if _, ok := db.Tables[entry.tableName]; ok {
+				db.dropTableLocked(entry.tableName)
+			}
+			return nil
+		}
+
+		table := copyTable(*entry.table)
+		table.ensureIndexes()
+		db.Tables[entry.tableName] = table
+		db.replicateTable(entry.tableName)
+		return nil
+	}
+
+	change := entry.change
+	table, ok := db.Tables[change.TableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, change.TableName)
+	}
+	table.ensureIndexes()
+
+	current, exists := table.getRow(change.RowID)
+	switch change.Op {
+	case ChangeInsert, ChangeUpdate:
+		stored := table.putRow(copyRow(change.NewRow))
+		db.Tables[change.TableName] = table
+		db.publishChange(change.Op, change.TableName, change.RowID, current, stored)
+	case ChangeDelete:
+		if !exists {
+			return nil
+		}
+		table.removeRow(current)
+		db.Tables[change.TableName] = table
+		db.publishChange(change.Op, change.TableName, change.RowID, current, Row{})
+	}
+	return nil
+}
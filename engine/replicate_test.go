@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitForReplica sleeps until replica has caught up with db.
+func waitForReplica(t *testing.T, db, replica *NewDatabase) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for db.ReplicaLag(replica) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("replica still %d changes behind", db.ReplicaLag(replica))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func replicaTestDBs(t *testing.T) (primary, replica *NewDatabase) {
+	primary, replica = newTestDB(t), newTestDB(t)
+	mustCreateTable(t, primary, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	mustInsert(t, primary, "items", "a", map[string]interface{}{"n": 1})
+
+	if err := primary.ReplicateTo(replica); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { primary.RemoveReplica(replica) })
+	return primary, replica
+}
+
+func TestReplicateRows(t *testing.T) {
+	primary, replica := replicaTestDBs(t)
+
+	mustInsert(t, primary, "items", "b", map[string]interface{}{"n": 2})
+	if err := primary.UpdateRow("items", "a", map[string]interface{}{"n": 10}); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := primary.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.InsertRowTx(tx, "items", "c", map[string]interface{}{"n": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.CommitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.DeleteRow("items", "b"); err != nil {
+		t.Fatal(err)
+	}
+	waitForReplica(t, primary, replica)
+
+	query := Query{Select: []string{"id", "n"}, From: "items", OrderBy: "id", NoCache: true}
+	want := mustQuery(t, primary, query)
+	if got := mustQuery(t, replica, query); !reflect.DeepEqual(got.Rows, want.Rows) {
+		t.Errorf("replica rows = %v, want %v", got.Rows, want.Rows)
+	}
+	if got, err := primary.ExecuteQueryOnReplica(query); err != nil || !reflect.DeepEqual(got.Rows, want.Rows) {
+		t.Errorf("ExecuteQueryOnReplica = %v, %v, want %v", got.Rows, err, want.Rows)
+	}
+
+	// An open transaction is not replicated until it commits.
+	tx, err = primary.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.InsertRowTx(tx, "items", "d", map[string]interface{}{"n": 4}); err != nil {
+		t.Fatal(err)
+	}
+	waitForReplica(t, primary, replica)
+	if exists, _ := replica.RowExists("items", "d"); exists {
+		t.Error("an uncommitted insert reached the replica")
+	}
+	if err := primary.RollbackTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicateSchema(t *testing.T) {
+	primary, replica := replicaTestDBs(t)
+
+	mustCreateTable(t, primary, "tags", []Column{{Name: "label", DataType: String}}, nil)
+	mustInsert(t, primary, "tags", "t1", map[string]interface{}{"label": "new"})
+	if err := primary.AlterColumn("items", "n", Float, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForReplica(t, primary, replica)
+
+	row, err := replica.GetRowByID("tags", "t1")
+	if err != nil {
+		t.Fatalf("replica has no tags row: %v", err)
+	}
+	if row.Columns["label"] != "new" {
+		t.Errorf("replica label = %v, want new", row.Columns["label"])
+	}
+	if col := replica.Tables["items"].Columns[0]; col.DataType != Float {
+		t.Errorf("replica items.n is %s, want Float", col.DataType)
+	}
+
+	if err := primary.DropTable("tags"); err != nil {
+		t.Fatal(err)
+	}
+	waitForReplica(t, primary, replica)
+	if replica.TableExists("tags") {
+		t.Error("dropped table is still on the replica")
+	}
+}
+
+func TestRemoveReplica(t *testing.T) {
+	primary, replica := replicaTestDBs(t)
+
+	if err := primary.ReplicateTo(replica); !errors.Is(err, ErrReplicaExists) {
+		t.Errorf("second ReplicateTo = %v, want ErrReplicaExists", err)
+	}
+	if err := primary.ReplicateTo(primary); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("ReplicateTo itself = %v, want ErrInvalidQuery", err)
+	}
+
+	waitForReplica(t, primary, replica)
+	primary.RemoveReplica(replica)
+	mustInsert(t, primary, "items", "late", map[string]interface{}{"n": 9})
+	time.Sleep(10 * time.Millisecond)
+
+	if exists, _ := replica.RowExists("items", "late"); exists {
+		t.Error("a write after RemoveReplica reached the replica")
+	}
+	if lag := primary.ReplicaLag(replica); lag != 0 {
+		t.Errorf("ReplicaLag of a removed replica = %d, want 0", lag)
+	}
+}
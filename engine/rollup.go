@@ -0,0 +1,388 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rollupBucketColumn holds the start of each bucket in a rollup table.
+const rollupBucketColumn = "bucket"
+
+type rollup struct {
+	src, dst string
+	spec     RollupSpec
+	columns  []string
+
+	// dropped is set, under db.mu and db.rollupMu, once src or dst is
+	// dropped, after which the rollup never writes again, even if a table
+	// of the same name is created.
+	dropped bool
+
+	stop, done chan struct{}
+}
+
+// CreateRollupTable creates dstTable holding aggregates of srcTable over
+// time buckets, and keeps it up to date from a background goroutine that
+// recomputes it every spec.RefreshInterval; see ForceRollup. dstTable has
+// one row per bucket that holds source rows, with id the bucket start in
+// RFC 3339 form, a bucket column holding the same time, and for each
+// aggregated column a column named after it and its function, such as
+// amount_sum. As in queries, NULLs are skipped and COUNT counts non-NULL
+// values. Close stops the goroutine, as does dropping either table.
+func (db *NewDatabase) CreateRollupTable(srcTable, dstTable string, spec RollupSpec) error {
+	if spec.BucketInterval <= 0 {
+		return fmt.Errorf("%w: rollup bucket interval must be positive", ErrInvalidQuery)
+	}
+	if spec.RefreshInterval < 0 {
+		return fmt.Errorf("%w: rollup refresh interval must not be negative", ErrInvalidQuery)
+	}
+	if len(spec.AggregateColumns) == 0 {
+		return fmt.Errorf("%w: rollup needs at least one aggregate column", ErrInvalidQuery)
+	}
+
+	db.mu.RLock()
+	src, ok := db.Tables[srcTable]
+	db.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, srcTable)
+	}
+
+	columns, err := rollupColumns(src, spec)
+
+	if err != nil {
+		return err
+	}
+
+	if err := db.CreateTable(dstTable, columns, nil); err != nil {
+		return err
+	}
+
+	r := &rollup{src: srcTable, dst: dstTable, spec: spec}
+	for col := range spec.AggregateColumns {
+		r.columns = append(r.columns, col)
+	}
+	sort.Strings(r.columns)
+
+	// Register r before its first run, so that dropping either table from
+	// now on marks it dropped.
+	db.mu.Lock()
+	_, srcOK := db.Tables[srcTable]
+	_, dstOK := db.Tables[dstTable]
+	if srcOK && dstOK {
+		db.rollupMu.Lock()
+		if db.rollups == nil {
+			db.rollups = make(map[string][]*rollup)
+		}
+		db.rollups[srcTable] = append(db.rollups[srcTable], r)
+		db.rollupMu.Unlock()
+	}
+	db.mu.Unlock()
+
+	if !srcOK || !dstOK {
+		return fmt.Errorf("%w: rollup of %s into %s: table dropped while creating it", ErrTableNotFound, srcTable, dstTable)
+	}
+
+	if err := db.runRollup(r, writeOrigin{actor: RollupActor}); err != nil {
+		db.mu.Lock()
+		db.forgetRollups(dstTable)
+		db.mu.Unlock()
+		return err
+	}
+
+	db.rollupMu.Lock()
+	defer db.rollupMu.Unlock()
+
+	if !r.dropped {
+		db.startRollup(r)
+	}
+	return nil
+}
+
+// RollupActor is the actor the audit log records for the writes that fill
+// a rollup table when it is created and refresh it in the background.
+const RollupActor = "rollup"
+
+// ForceRollup recomputes every rollup table of srcTable now.
+func (db *NewDatabase) ForceRollup(srcTable string) error {
+	return db.ForceRollupWithOptions(srcTable, WriteOptions{})
+}
+
+func (db *NewDatabase) ForceRollupWithOptions(srcTable string, opts WriteOptions) error {
+	db.rollupMu.Lock()
+	rollups := append([]*rollup(nil), db.rollups[srcTable]...)
+	db.rollupMu.Unlock()
+
+	if len(rollups) == 0 {
+		return fmt.Errorf("%w: table %s has no rollups", ErrInvalidQuery, srcTable)
+	}
+
+	for _, r := range rollups {
+		if err := db.runRollup(r, writeOrigin{actor: opts.Actor}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fn AggFunc) String() string {
+	switch fn {
+	case AggSum:
+		return "SUM"
+	case AggAvg:
+		return "AVG"
+	case AggMin:
+		return "MIN"
+	case AggMax:
+		return "MAX"
+	case AggCount:
+		return "COUNT"
+	default:
+		return fmt.Sprintf("AggFunc(%d)", int(fn))
+	}
+}
+
+func rollupColumnName(col string, fn AggFunc) string {
+	return col + "_" + strings.ToLower(fn.String())
+}
+
+// rollupColumns returns the schema of a rollup table of src.
+func rollupColumns(src Table, spec RollupSpec) ([]Column, error) {
+	types := make(map[string]DataType, len(src.Columns))
+	for _, col := range src.Columns {
+		types[col.Name] = col.DataType
+	}
+
+	if t, ok := types[spec.TimeColumn]; !ok || t != DateTime {
+		return nil, fmt.Errorf("%w: rollup time column %s.%s must be a DateTime column", ErrInvalidSchema, src.Name, spec.TimeColumn)
+	}
+
+	columns := []Column{{Name: rollupBucketColumn, DataType: DateTime}}
+	for col, fn := range spec.AggregateColumns {
+		dataType, ok := types[col]
+		if !ok {
+			return nil, fmt.Errorf("%w: rollup column %s.%s does not exist", ErrInvalidSchema, src.Name, col)
+		}
+
+		switch fn {
+		case AggCount:
+			dataType = Int
+		case AggAvg:
+			dataType = Float
+		case AggMin, AggMax:
+		case AggSum:
+		default:
+			return nil, fmt.Errorf("%w: unknown rollup function %s for %s", ErrInvalidQuery, fn, col)
+		}
+		if (fn == AggSum || fn == AggAvg) && types[col] != Int && types[col] != Float {
+			return nil, fmt.Errorf("%w: %s of non-numeric column %s.%s", ErrInvalidSchema, fn, src.Name, col)
+		}
+
+		columns = append(columns, Column{Name: rollupColumnName(col, fn), DataType: dataType, Nullable: true})
+	}
+
+	sort.Slice(columns[1:], func(i, j int) bool {
+		return columns[i+1].Name < columns[j+1].Name
+	})
+	return columns, nil
+}
+
+// runRollup recomputes r's table from its source, writing only the buckets
+// that changed and deleting those left empty. Each change is audited, as
+// made by origin, and published as for any other write.
+func (db *NewDatabase) runRollup(r *rollup, origin writeOrigin) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if r.dropped {
+		return fmt.Errorf("%w: rollup of %s into %s was dropped with its table", ErrTableNotFound, r.src, r.dst)
+	}
+	src, ok := db.Tables[r.src]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, r.src)
+	}
+	dst, ok := db.Tables[r.dst]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, r.dst)
+	}
+
+	buckets := make(map[time.Time][]accumulator)
+	for _, row := range src.scanRows(false) {
+		row, err := db.openRow(&src, row)
+
+		if err != nil {
+			return err
+		}
+		t, ok := row.Columns[r.spec.TimeColumn].(time.Time)
+		if !ok {
+			continue
+		}
+
+		bucket := t.Truncate(r.spec.BucketInterval).UTC()
+		accs, ok := buckets[bucket]
+		if !ok {
+			accs = make([]accumulator, len(r.columns))
+			buckets[bucket] = accs
+		}
+
+		for i, col := range r.columns {
+			val := row.Columns[col]
+			if val == nil {
+				continue
+			}
+			if err := accs[i].add(r.spec.AggregateColumns[col].String(), val); err != nil {
+				return err
+			}
+		}
+	}
+
+	dst.ensureIndexes()
+
+	type change struct {
+		op       ChangeOp
+		old, new Row
+	}
+	var changes []change
+
+	want := make(map[string]bool, len(buckets))
+	for bucket, accs := range buckets {
+		id := bucket.Format(time.RFC3339Nano)
+		want[id] = true
+
+		row := Row{Columns: map[string]interface{}{"id": id, rollupBucketColumn: bucket}}
+		for i, col := range r.columns {
+			fn := r.spec.AggregateColumns[col]
+			row.Columns[rollupColumnName(col, fn)] = accs[i].result(fn.String())
+		}
+
+		old, exists := dst.getRow(id)
+		switch {
+		case !exists:
+			changes = append(changes, change{ChangeInsert, Row{}, dst.putRow(row)})
+		case !reflect.DeepEqual(old.Columns, row.Columns):
+			changes = append(changes, change{ChangeUpdate, old, dst.putRow(row)})
+		}
+	}
+
+	for _, row := range dst.allRows() {
+		if !want[rowID(row)] {
+			changes = append(changes, change{op: ChangeDelete, old: row})
+		}
+	}
+	for _, c := range changes {
+		if c.op == ChangeDelete {
+			dst.deleteRow(rowID(c.old))
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	for _, c := range changes {
+		switch c.op {
+		case ChangeInsert:
+			dst.audit(AuditInsert, Row{}, c.new, origin)
+		case ChangeUpdate:
+			dst.audit(AuditUpdate, c.old, c.new, origin)
+		case ChangeDelete:
+			dst.audit(AuditDelete, c.old, Row{}, origin)
+		}
+	}
+	db.Tables[r.dst] = dst
+
+	for _, c := range changes {
+		id := rowID(c.old)
+		if c.op != ChangeDelete {
+			id = rowID(c.new)
+		}
+		db.publishChange(c.op, r.dst, id, c.old, c.new)
+	}
+	return nil
+}
+
+// startRollup starts r's refresh goroutine. The caller must hold
+// db.rollupMu.
+func (db *NewDatabase) startRollup(r *rollup) {
+	interval := r.spec.RefreshInterval
+	if interval == 0 {
+		interval = r.spec.BucketInterval
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	r.stop, r.done = stop, done
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := db.runRollup(r, writeOrigin{actor: RollupActor}); err != nil {
+					db.mu.RLock()
+					db.logf("rollup of %s into %s: %v", r.src, r.dst, err)
+					db.mu.RUnlock()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopRollups stops every rollup goroutine and waits for them to exit.
+// The rollups can still be run with ForceRollup.
+func (db *NewDatabase) stopRollups() {
+	db.rollupMu.Lock()
+	var done []chan struct{}
+	for _, rollups := range db.rollups {
+		for _, r := range rollups {
+			if r.stop == nil {
+				continue
+			}
+			close(r.stop)
+			done = append(done, r.done)
+			r.stop, r.done = nil, nil
+		}
+	}
+	db.rollupMu.Unlock()
+
+	// The goroutines may be waiting for db.mu, whose holder may be waiting
+	// for rollupMu in forgetRollups, so wait for them without it.
+	for _, ch := range done {
+		<-ch
+	}
+}
+
+// forgetRollups unregisters every rollup that reads or writes tableName,
+// which is being dropped, and stops its goroutine without waiting for it
+// to exit. The caller must hold db.mu for writing.
+func (db *NewDatabase) forgetRollups(tableName string) {
+	db.rollupMu.Lock()
+	defer db.rollupMu.Unlock()
+
+	for src, rollups := range db.rollups {
+		kept := rollups[:0]
+		for _, r := range rollups {
+			if r.src != tableName && r.dst != tableName {
+				kept = append(kept, r)
+				continue
+			}
+			r.dropped = true
+			if r.stop != nil {
+				close(r.stop)
+				r.stop, r.done = nil, nil
+			}
+		}
+		if len(kept) == 0 {
+			delete(db.rollups, src)
+		} else {
+			db.rollups[src] = kept
+		}
+	}
+}
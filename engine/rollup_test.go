@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func rollupTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	mustCreateTable(t, db, "ev", []Column{
+		{Name: "ts", DataType: DateTime},
+		{Name: "v", DataType: Int},
+	}, nil)
+	at := time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC)
+	mustInsert(t, db, "ev", "e1", map[string]interface{}{"ts": at, "v": 2})
+	mustInsert(t, db, "ev", "e2", map[string]interface{}{"ts": at.Add(time.Minute), "v": 3})
+
+	spec := RollupSpec{TimeColumn: "ts", BucketInterval: time.Hour, AggregateColumns: map[string]AggFunc{"v": AggSum}, RefreshInterval: time.Hour}
+	if err := db.CreateRollupTable("ev", "agg", spec); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRollupSumsBuckets(t *testing.T) {
+	db := rollupTestDB(t)
+	rows, err := db.GetAllRows("agg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || toInt64(rows[0].Columns["v_sum"]) != 5 {
+		t.Fatalf("rollup rows = %+v, want one bucket with v_sum 5", rows)
+	}
+
+	mustInsert(t, db, "ev", "e3", map[string]interface{}{"ts": time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC), "v": 1})
+	if err := db.ForceRollup("ev"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.CountRows("agg"); n != 2 {
+		t.Fatalf("%d buckets after ForceRollup, want 2", n)
+	}
+}
+
+func TestRollupStopsWhenDestinationDropped(t *testing.T) {
+	db := rollupTestDB(t)
+	if err := db.DropTable("agg"); err != nil {
+		t.Fatal(err)
+	}
+	mustCreateTable(t, db, "agg", []Column{{Name: "email", DataType: String}}, nil)
+	mustInsert(t, db, "agg", "u1", map[string]interface{}{"email": "ann@example.com"})
+
+	if err := db.ForceRollup("ev"); err == nil {
+		t.Fatal("ForceRollup after dropping the rollup table succeeded")
+	}
+	rows, err := db.GetAllRows("agg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rowID(rows[0]) != "u1" {
+		t.Fatalf("re-created agg holds %+v, want only u1", rows)
+	}
+}
+
+func TestRollupStopsWhenSourceDropped(t *testing.T) {
+	db := rollupTestDB(t)
+	db.rollupMu.Lock()
+	r := db.rollups["ev"][0]
+	db.rollupMu.Unlock()
+
+	if err := db.DropTable("ev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ForceRollup("ev"); err == nil {
+		t.Fatal("ForceRollup after dropping the source succeeded")
+	}
+	if err := db.runRollup(r, writeOrigin{}); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("running a dropped rollup = %v, want ErrTableNotFound", err)
+	}
+	if n, _ := db.CountRows("agg"); n != 1 {
+		t.Fatalf("agg has %d rows after its source was dropped, want 1 untouched", n)
+	}
+}
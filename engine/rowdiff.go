@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RowDiff previews UpdateRow(tableName, id, newData) without making it:
+// it returns how the row's columns would change and which constraints
+// would be checked against them. Values are compared after coercion, as =
+// compares them, so an update the row already satisfies changes nothing.
+// It does not report whether the update would pass those constraints.
+func (db *NewDatabase) RowDiff(tableName, id string, newData map[string]interface{}) (RowDiff, error) {
+	done, err := db.startOp()
+
+	if err != nil {
+		return RowDiff{}, err
+	}
+	defer done()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return RowDiff{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	current, ok := table.getLiveRow(id)
+
+	if !ok {
+		return RowDiff{}, fmt.Errorf("%w: %s in table %s", ErrIDNotFound, id, tableName)
+	}
+	if newID, ok := newData["id"]; ok && newID != id {
+		return RowDiff{}, fmt.Errorf("%w: cannot change id of row %s", ErrInvalidQuery, id)
+	}
+
+	plain, err := db.openRow(&table, current)
+
+	if err != nil {
+		return RowDiff{}, err
+	}
+
+	updated := copyRow(plain)
+	for key, value := range newData {
+		updated.Columns[key] = value
+	}
+	if err := db.coerceRow(&table, updated); err != nil {
+		return RowDiff{}, err
+	}
+
+	diff := RowDiff{Changed: make(map[string]ColumnChange), Added: make(map[string]interface{})}
+	touched := make(map[string]bool)
+	for name, old := range plain.Columns {
+		if _, set := newData[name]; !set || assertValuesEqual(old, updated.Columns[name]) {
+			diff.Unchanged = append(diff.Unchanged, name)
+			continue
+		}
+		diff.Changed[name] = ColumnChange{Old: old, New: updated.Columns[name]}
+		touched[name] = true
+	}
+	for name := range newData {
+		if _, exists := plain.Columns[name]; !exists {
+			diff.Added[name] = updated.Columns[name]
+			touched[name] = true
+		}
+	}
+	sort.Strings(diff.Unchanged)
+
+	checks, err := compileChecks(table.Name, table.Columns)
+
+	if err != nil {
+		return RowDiff{}, err
+	}
+	for _, check := range checks {
+		for _, name := range exprColumns(check.expr) {
+			if touched[name] {
+				diff.Checks = append(diff.Checks, check.name)
+				break
+			}
+		}
+	}
+
+	for _, idx := range table.Indexes {
+		if !idx.Unique {
+			continue
+		}
+		for _, name := range idx.Columns {
+			if touched[name] {
+				diff.UniqueIndexes = append(diff.UniqueIndexes, idx.Name)
+				break
+			}
+		}
+	}
+	return diff, nil
+}
+
+// exprColumns returns the names of the columns e reads, a JSON path
+// counting as the column it starts at.
+func exprColumns(e expr) []string {
+	var names []string
+	rewriteExpr(e, func(e expr) (expr, error) {
+		if col, ok := e.(columnExpr); ok {
+			name := col.name
+			if end := strings.IndexAny(name, ".["); end >= 0 {
+				names = append(names, name[:end])
+			}
+			names = append(names, name)
+		}
+		return e, nil
+	})
+	return names
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// SampleQuery runs query over a Bernoulli sample of its source rows, each
+// kept with probability fraction, trading accuracy for speed. COUNT and SUM
+// results are scaled by 1/fraction to estimate the full answer; AVG, MIN and
+// MAX are reported as computed over the sample. Other queries return the
+// sampled rows as they are. The result has Sampled set and is never cached.
+func (db *NewDatabase) SampleQuery(query Query, fraction float64) (QueryResult, error) {
+	if !(fraction > 0 && fraction <= 1) {
+		return QueryResult{}, fmt.Errorf("%w: sample fraction %v must be in (0, 1]", ErrInvalidQuery, fraction)
+	}
+
+	query.NoCache = true
+	return db.runQuery(context.Background(), query, func() (ExecutionPlan, error) {
+		plan, err := db.planQuery(query)
+
+		if err != nil {
+			return ExecutionPlan{}, err
+		}
+
+		plan, err = plan.bind(query.Args)
+
+		if err != nil {
+			return ExecutionPlan{}, err
+		}
+		plan.sample = fraction
+		return plan, nil
+	})
+}
+
+func sampleRows(rows []Row, fraction float64) []Row {
+	if fraction >= 1 {
+		return rows
+	}
+
+	sampled := make([]Row, 0, int(float64(len(rows))*fraction)+1)
+	for _, row := range rows {
+		if rand.Float64() < fraction {
+			sampled = append(sampled, row)
+		}
+	}
+	return sampled
+}
+
+// scaleAggregates extrapolates the COUNT and SUM columns of an aggregate
+// row computed over a sample. Integer results stay integers, rounded.
+func scaleAggregates(row Row, projections []projection, fraction float64) {
+	for _, p := range projections {
+		switch p.expr.(aggExpr).name {
+		case "COUNT", "SUM":
+		default:
+			continue
+		}
+
+		switch v := row.Columns[p.name].(type) {
+		case int64:
+			row.Columns[p.name] = int64(math.Round(float64(v) / fraction))
+		case float64:
+			row.Columns[p.name] = v / fraction
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func sampleTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	for i := 0; i < 1000; i++ {
+		mustInsert(t, db, "items", fmt.Sprintf("i%04d", i), map[string]interface{}{"n": 1})
+	}
+	return db
+}
+
+func TestSampleQueryScalesAggregates(t *testing.T) {
+	db := sampleTestDB(t)
+
+	for _, sel := range []string{"COUNT(*)", "COUNT(n)", "SUM(n)"} {
+		t.Run(sel, func(t *testing.T) {
+			result, err := db.SampleQuery(Query{Select: []string{sel}, From: "items"}, 0.5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Sampled {
+				t.Error("result not marked Sampled")
+			}
+			if len(result.Rows) != 1 {
+				t.Fatalf("%d rows, want one aggregate row", len(result.Rows))
+			}
+			// The sample holds about 500 rows, with a standard deviation of
+			// about 16; scaled back, the estimate is about 1000.
+			got, ok := result.Rows[0].Columns[sel].(int64)
+			if !ok || got < 800 || got > 1200 {
+				t.Fatalf("%s = %v, want about 1000", sel, result.Rows[0].Columns[sel])
+			}
+		})
+	}
+
+	result, err := db.SampleQuery(Query{Select: []string{"COUNT(*)"}, From: "items", Where: "n = 1"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Rows[0].Columns["COUNT(*)"]; got != int64(1000) {
+		t.Fatalf("COUNT(*) over a full sample = %v, want 1000", got)
+	}
+}
+
+func TestSampleQueryReturnsSampledRows(t *testing.T) {
+	db := sampleTestDB(t)
+
+	result, err := db.SampleQuery(Query{Select: []string{"id", "n"}, From: "items"}, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(result.Rows); n == 0 || n > 300 {
+		t.Fatalf("sample of 10%% has %d rows, want about 100", n)
+	}
+	if _, err := db.SampleQuery(Query{Select: []string{"id"}, From: "items"}, 0); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("SampleQuery with fraction 0 = %v, want ErrInvalidQuery", err)
+	}
+}
@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+type checkConstraint struct {
+	name string
+	expr expr
+}
+
+func compileChecks(tableName string, columns []Column) ([]checkConstraint, error) {
+	var checks []checkConstraint
+
+	for _, col := range columns {
+		if col.Check == "" {
+			continue
+		}
+
+		name := col.CheckName
+		if name == "" {
+			name = tableName + "_" + col.Name + "_check"
+		}
+
+		e, err := parseExpr(col.Check)
+
+		if err != nil {
+			return nil, fmt.Errorf("check constraint %s: %w", name, err)
+		}
+		checks = append(checks, checkConstraint{name: name, expr: e})
+	}
+
+	return checks, nil
+}
+
+// validateSchema rejects column and index definitions that could never be
+// satisfied: no columns, unnamed or duplicate columns, indexes that are
+// unnamed, duplicated, empty or on a column the table does not have or an
+// encrypted one, inverted indexes on anything but one Array column, and
+// foreign keys on encrypted columns. The implicit id column may be
+// indexed.
+func validateSchema(columns []Column, indexes []Index) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: no columns", ErrInvalidSchema)
+	}
+
+	names := make(map[string]bool, len(columns)+1)
+	types := make(map[string]DataType, len(columns))
+	encrypted := make(map[string]bool, len(columns))
+	for i, col := range columns {
+		if col.Name == "" {
+			return fmt.Errorf("%w: column %d has no name", ErrInvalidSchema, i)
+		}
+		if names[col.Name] {
+			return fmt.Errorf("%w: duplicate column %s", ErrInvalidSchema, col.Name)
+		}
+		names[col.Name] = true
+		types[col.Name] = col.DataType
+		if col.DataType == Array && col.ElementType == Array {
+			return fmt.Errorf("%w: column %s is an array of arrays", ErrInvalidSchema, col.Name)
+		}
+		if err := checkEnumValues(col); err != nil {
+			return err
+		}
+		if err := checkDefault(col); err != nil {
+			return err
+		}
+		switch {
+		case col.Collation < BinaryCollation || col.Collation > NaturalCollation:
+			return fmt.Errorf("%w: column %s has unknown collation %d", ErrInvalidSchema, col.Name, col.Collation)
+		case col.Collation != BinaryCollation && col.DataType != String:
+			return fmt.Errorf("%w: column %s of type %s has a collation", ErrInvalidSchema, col.Name, col.DataType)
+		}
+		if col.Encrypted && col.ForeignKey != nil {
+			return fmt.Errorf("%w: encrypted column %s cannot have a foreign key", ErrInvalidSchema, col.Name)
+		}
+		encrypted[col.Name] = col.Encrypted
+		if col.DataType == Decimal && (col.Precision < 0 || col.Precision > maxDecimalScale || col.Scale < 0 || col.Scale > col.decimalPrecision()) {
+			return fmt.Errorf("%w: column %s has precision %d and scale %d; want 0 <= scale <= precision <= %d", ErrInvalidSchema, col.Name, col.Precision, col.Scale, maxDecimalScale)
+		}
+	}
+	names["id"] = true
+
+	indexNames := make(map[string]bool, len(indexes))
+	for i, idx := range indexes {
+		if idx.Name == "" {
+			return fmt.Errorf("%w: index %d has no name", ErrInvalidSchema, i)
+		}
+		if indexNames[idx.Name] {
+			return fmt.Errorf("%w: duplicate index %s", ErrInvalidSchema, idx.Name)
+		}
+		indexNames[idx.Name] = true
+
+		if len(idx.Columns) == 0 {
+			return fmt.Errorf("%w: index %s has no columns", ErrInvalidSchema, idx.Name)
+		}
+		for _, name := range idx.Columns {
+			if !names[name] {
+				return fmt.Errorf("%w: index %s references unknown column %s", ErrInvalidSchema, idx.Name, name)
+			}
+			if encrypted[name] {
+				return fmt.Errorf("%w: index %s is on encrypted column %s", ErrInvalidSchema, idx.Name, name)
+			}
+		}
+		if idx.Inverted && (len(idx.Columns) != 1 || types[idx.Columns[0]] != Array || idx.Unique) {
+			return fmt.Errorf("%w: inverted index %s must be on one Array column and not unique", ErrInvalidSchema, idx.Name)
+		}
+		if idx.FullText && (len(idx.Columns) != 1 || types[idx.Columns[0]] != String || idx.Unique || idx.Inverted) {
+			return fmt.Errorf("%w: full-text index %s must be on one String column and not unique or inverted", ErrInvalidSchema, idx.Name)
+		}
+		if !idx.FullText && len(idx.Stopwords) > 0 {
+			return fmt.Errorf("%w: index %s has stopwords but is not full-text", ErrInvalidSchema, idx.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkDefault rejects a Default that the column could not hold.
+func checkDefault(col Column) error {
+	switch d := col.Default.(type) {
+	case nil:
+		return nil
+	case DefaultFunc:
+		if d == defaultNow && col.DataType == DateTime {
+			return nil
+		}
+	default:
+		if valueMatchesType(d, col.DataType) && (col.DataType != Enum || col.enumOrdinal(d.(string)) >= 0) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: column %s of type %s cannot default to %v", ErrInvalidSchema, col.Name, col.DataType, col.Default)
+}
+
+// applyDefaults fills the columns row, a row being inserted, leaves out
+// that have a Default, and rejects the row if it still leaves out a column
+// that is not nullable.
+func (t *Table) applyDefaults(row Row) error {
+	now := time.Now()
+	for _, col := range t.Columns {
+		if _, ok := row.Columns[col.Name]; ok {
+			continue
+		}
+		if col.Default == nil {
+			if !col.Nullable {
+				return fmt.Errorf("%w: column %s in table %s is not nullable and has no value", ErrSchemaViolation, col.Name, t.Name)
+			}
+			continue
+		}
+
+		val := col.Default
+		if f, ok := val.(DefaultFunc); ok {
+			var err error
+			if val, err = f.value(now); err != nil {
+				return err
+			}
+		}
+		row.Columns[col.Name] = val
+	}
+	return nil
+}
+
+// validateRow checks column types, nullability and CHECK constraints. As in
+// SQL, a CHECK expression that evaluates to NULL does not reject the row.
+// Nullability applies to columns the row holds as NULL, not to missing
+// ones, which applyDefaults rejects on insert. In place, RFC 3339 strings
+// in DateTime columns are parsed and Decimal values are rescaled to their
+// column's scale.
+func (t *Table) validateRow(row Row) error {
+	for _, col := range t.Columns {
+		val, ok := row.Columns[col.Name]
+		if !ok {
+			continue
+		}
+		if val == nil {
+			if !col.Nullable {
+				return fmt.Errorf("%w: column %s in table %s is not nullable", ErrSchemaViolation, col.Name, t.Name)
+			}
+			continue
+		}
+		if s, ok := val.(string); ok && col.DataType == DateTime {
+			if parsed, ok := parseDateTime(s); ok {
+				val = parsed
+				row.Columns[col.Name] = val
+			}
+		}
+		if _, ok := val.(sealedValue); ok && col.Encrypted {
+			// Checked before it was encrypted.
+			continue
+		}
+		if !valueMatchesType(val, col.DataType) {
+			return fmt.Errorf("%w: column %s in table %s expects %s, got %T", ErrSchemaViolation, col.Name, t.Name, col.DataType, val)
+		}
+		if col.DataType == Enum && col.enumOrdinal(val.(string)) < 0 {
+			return fmt.Errorf("%w: column %s in table %s allows %s, got %q", ErrSchemaViolation, col.Name, t.Name, enumList(col.EnumValues), val)
+		}
+		if col.DataType == Decimal {
+			d, err := col.normalizeDecimal(val.(DecimalValue))
+
+			if err != nil {
+				return fmt.Errorf("%w: column %s in table %s: %w", ErrSchemaViolation, col.Name, t.Name, err)
+			}
+			row.Columns[col.Name] = d
+		}
+		if col.DataType == Array {
+			for i, item := range val.([]interface{}) {
+				if !valueMatchesType(item, col.ElementType) {
+					return fmt.Errorf("%w: element %d of column %s in table %s expects %s, got %T", ErrSchemaViolation, i, col.Name, t.Name, col.ElementType, item)
+				}
+			}
+		}
+	}
+
+	if t.checks == nil {
+		checks, err := compileChecks(t.Name, t.Columns)
+
+		if err != nil {
+			return err
+		}
+		t.checks = checks
+	}
+
+	for _, check := range t.checks {
+		val, err := check.expr.eval(row)
+
+		if err != nil {
+			return fmt.Errorf("check constraint %s: %w", check.name, err)
+		}
+		if val == false {
+			return fmt.Errorf("%w: %s in table %s", ErrCheckViolation, check.name, t.Name)
+		}
+	}
+
+	return nil
+}
+
+func valueMatchesType(val interface{}, dataType DataType) bool {
+	switch dataType {
+	case Int:
+		switch val.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return true
+		}
+	case Float:
+		switch val.(type) {
+		case float32, float64:
+			return true
+		}
+	case String, Enum:
+		_, ok := val.(string)
+		return ok
+	case DateTime:
+		_, ok := val.(time.Time)
+		return ok
+	case Bool:
+		_, ok := val.(bool)
+		return ok
+	case Array:
+		_, ok := val.([]interface{})
+		return ok
+	case JSON:
+		switch val.(type) {
+		case map[string]interface{}, []interface{}:
+			return isJSONValue(val)
+		}
+	case Decimal:
+		_, ok := val.(DecimalValue)
+		return ok
+	}
+	return false
+}
+
+func copyRow(row Row) Row {
+	newRow := Row{Columns: make(map[string]interface{}, len(row.Columns)), Version: row.Version}
+	for key, value := range row.Columns {
+		newRow.Columns[key] = value
+	}
+	return newRow
+}
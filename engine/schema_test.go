@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func checkTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "products", []Column{
+		{Name: "price", DataType: Int, Check: "price > 0", CheckName: "positive_price"},
+		{Name: "discount", DataType: Int, Nullable: true, Check: "discount IS NULL OR discount < price"},
+	}, nil)
+	return db
+}
+
+func TestCheckViolationOnInsert(t *testing.T) {
+	db := checkTestDB(t)
+
+	err := db.InsertRow("products", "a", map[string]interface{}{"price": 0})
+	if !errors.Is(err, ErrCheckViolation) {
+		t.Fatalf("InsertRow = %v, want ErrCheckViolation", err)
+	}
+	if !strings.Contains(err.Error(), "positive_price") {
+		t.Errorf("error %q does not name the constraint", err)
+	}
+	if _, err := db.GetRowByID("products", "a"); !errors.Is(err, ErrIDNotFound) {
+		t.Errorf("the rejected row was inserted: %v", err)
+	}
+
+	mustInsert(t, db, "products", "a", map[string]interface{}{"price": 10})
+}
+
+func TestCheckViolationOnUpdate(t *testing.T) {
+	db := checkTestDB(t)
+	mustInsert(t, db, "products", "a", map[string]interface{}{"price": 10})
+
+	if err := db.UpdateRow("products", "a", map[string]interface{}{"price": -1}); !errors.Is(err, ErrCheckViolation) {
+		t.Fatalf("UpdateRow = %v, want ErrCheckViolation", err)
+	}
+	row, err := db.GetRowByID("products", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toInt64(row.Columns["price"]) != 10 {
+		t.Errorf("price after the rejected update = %v, want 10", row.Columns["price"])
+	}
+}
+
+func TestCheckMultiColumn(t *testing.T) {
+	db := checkTestDB(t)
+	mustInsert(t, db, "products", "a", map[string]interface{}{"price": 10, "discount": 3})
+
+	err := db.InsertRow("products", "b", map[string]interface{}{"price": 10, "discount": 10})
+	if !errors.Is(err, ErrCheckViolation) {
+		t.Fatalf("InsertRow with discount = price: %v, want ErrCheckViolation", err)
+	}
+	if !strings.Contains(err.Error(), "products_discount_check") {
+		t.Errorf("error %q does not name the default constraint name", err)
+	}
+
+	// Lowering price under the discount violates the check on discount.
+	if err := db.UpdateRow("products", "a", map[string]interface{}{"price": 2}); !errors.Is(err, ErrCheckViolation) {
+		t.Fatalf("UpdateRow of price = %v, want ErrCheckViolation", err)
+	}
+	if err := db.UpdateRow("products", "a", map[string]interface{}{"price": 5, "discount": 4}); err != nil {
+		t.Fatalf("UpdateRow satisfying both checks: %v", err)
+	}
+}
+
+func TestCheckNotEvaluatedOnDelete(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	mustInsert(t, db, "items", "a", map[string]interface{}{"n": -5})
+
+	// A check added after the row was written must not stop its delete.
+	db.Tables["items"] = func(t Table) Table {
+		t.Columns = append([]Column(nil), t.Columns...)
+		t.Columns[0].Check = "n > 0"
+		t.checks = nil
+		return t
+	}(db.Tables["items"])
+
+	if err := db.DeleteRow("items", "a"); err != nil {
+		t.Fatalf("DeleteRow of a row violating the check: %v", err)
+	}
+}
+
+func TestCheckValidatedAtCreateTable(t *testing.T) {
+	db := newTestDB(t)
+
+	err := db.CreateTable("bad", []Column{{Name: "n", DataType: Int, Check: "n >"}}, nil)
+	if err == nil {
+		t.Fatal("CreateTable with an invalid check succeeded")
+	}
+	if _, ok := db.Tables["bad"]; ok {
+		t.Fatal("CreateTable created the table with an invalid check")
+	}
+}
+
+func TestCreateTableValidatesSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []Column
+		indexes []Index
+	}{
+		{"no columns", nil, nil},
+		{"unnamed column", []Column{{DataType: String}}, nil},
+		{"duplicate column", []Column{{Name: "a", DataType: String}, {Name: "a", DataType: Int}}, nil},
+		{"index on missing column", []Column{{Name: "a", DataType: String}}, []Index{{Name: "by_b", Columns: []string{"b"}}}},
+		{"unnamed index", []Column{{Name: "a", DataType: String}}, []Index{{Columns: []string{"a"}}}},
+		{"index without columns", []Column{{Name: "a", DataType: String}}, []Index{{Name: "by_nothing"}}},
+		{"duplicate index", []Column{{Name: "a", DataType: String}}, []Index{
+			{Name: "by_a", Columns: []string{"a"}},
+			{Name: "by_a", Columns: []string{"a"}},
+		}},
+	}
+	for _, tt := range tests {
+		db := newTestDB(t)
+		err := db.CreateTable("t", tt.columns, tt.indexes)
+		if !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: CreateTable = %v, want ErrInvalidSchema", tt.name, err)
+		}
+		if _, ok := db.Tables["t"]; ok {
+			t.Errorf("%s: CreateTable created the table", tt.name)
+		}
+	}
+}
+
+func TestCreateTableValidSchema(t *testing.T) {
+	db := newTestDB(t)
+	err := db.CreateTable("t", []Column{
+		{Name: "a", DataType: String},
+		{Name: "b", DataType: Int, Nullable: true},
+	}, []Index{
+		{Name: "by_a", Columns: []string{"a"}, Unique: true},
+		{Name: "by_ab", Columns: []string{"a", "b"}},
+		{Name: "by_id", Columns: []string{"id"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable with a valid schema: %v", err)
+	}
+	mustInsert(t, db, "t", "x", map[string]interface{}{"a": "1", "b": 2})
+}
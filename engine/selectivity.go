@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"math"
+	"sort"
+)
+
+// Guessed fractions of rows a predicate keeps, for columns no index
+// describes.
+const (
+	equalSelectivity   = 0.1
+	rangeSelectivity   = 1.0 / 3
+	defaultSelectivity = 0.5
+)
+
+// columnDistinct maps the names columnTypes gives columns to the number of
+// distinct values in an index on the column alone, for the columns that
+// have one. The caller must hold db.mu.
+func (db *NewDatabase) columnDistinct(plan ExecutionPlan, names joinNames) map[string]int {
+	distinct := make(map[string]int)
+	joined := plan.hasJoins()
+
+	for _, op := range plan.Operations {
+		if (op.Type != Scan && op.Type != JoinOp) || op.series != nil {
+			continue
+		}
+
+		table, _ := db.queryTable(op.Table)
+		add := func(name string, n int) {
+			if !joined {
+				distinct[name] = n
+				return
+			}
+			distinct[table.Name+"."+name] = n
+			if !names.ambiguous[name] {
+				distinct[name] = n
+			}
+		}
+
+		add("id", table.rowCount())
+		for _, col := range table.Columns {
+			if index, ok := table.singleColumnIndex(col.Name); ok {
+				add(col.Name, len(table.indexData[index]))
+			}
+		}
+	}
+	return distinct
+}
+
+// reorderFilters returns plan with the ANDed conjuncts of each filter put
+// in the order the plan's mode ranks them: by increasing estimated
+// selectivity, so that rows are rejected by the most selective one first,
+// or for CostBased by increasing evaluation cost per row rejected. Only
+// conjuncts that cannot fail are moved, and never past one that can, so
+// results and errors are the same as for the original order.
+func (plan ExecutionPlan) reorderFilters(types map[string]DataType, distinct map[string]int) ExecutionPlan {
+	rank := func(e expr) float64 {
+		return selectivity(e, distinct)
+	}
+	if plan.Mode == CostBased {
+		rank = func(e expr) float64 {
+			return rejectionCost(e, distinct)
+		}
+	}
+
+	var ops []Operation
+	for i, op := range plan.Operations {
+		if op.Type != Filter {
+			continue
+		}
+		reordered, ok := reorderConjuncts(op.filterExpr, types, rank)
+		if !ok {
+			continue
+		}
+		if ops == nil {
+			ops = append([]Operation(nil), plan.Operations...)
+		}
+		ops[i].filterExpr = reordered
+	}
+
+	if ops != nil {
+		plan.Operations = ops
+	}
+	return plan
+}
+
+// reorderConjuncts sorts each run of infallible conjuncts of e by rank
+// and reports whether that changed their order.
+func reorderConjuncts(e expr, types map[string]DataType, rank func(expr) float64) (expr, bool) {
+	terms := conjuncts(e)
+	if len(terms) < 2 {
+		return e, false
+	}
+
+	type term struct {
+		e    expr
+		pos  int
+		rank float64
+	}
+
+	moved := false
+	for start := 0; start < len(terms); start++ {
+		if !infallible(terms[start], types) {
+			continue
+		}
+		end := start + 1
+		for end < len(terms) && infallible(terms[end], types) {
+			end++
+		}
+
+		run := make([]term, end-start)
+		for i := range run {
+			e := terms[start+i]
+			run[i] = term{e: e, pos: i, rank: rank(e)}
+		}
+		sort.SliceStable(run, func(i, j int) bool {
+			return run[i].rank < run[j].rank
+		})
+		for i, t := range run {
+			terms[start+i] = t.e
+			moved = moved || t.pos != i
+		}
+		start = end
+	}
+	if !moved {
+		return e, false
+	}
+
+	result := terms[0]
+	for _, t := range terms[1:] {
+		result = binaryExpr{op: "AND", left: result, right: t}
+	}
+	return result, true
+}
+
+// infallible reports whether the predicate e evaluates to true, false or
+// NULL for every row, never to an error.
+func infallible(e expr, types map[string]DataType) bool {
+	switch e := e.(type) {
+	case binaryExpr:
+		switch e.op {
+		case "AND", "OR":
+			return infallible(e.left, types) && infallible(e.right, types)
+		case "=", "!=", "<", "<=", ">", ">=":
+			return isOperand(e.left) && isOperand(e.right)
+		}
+	case unaryExpr:
+		return e.op == "NOT" && infallible(e.x, types)
+	case isNullExpr:
+		return isOperand(e.x)
+	case likeExpr:
+		return isOperand(e.x)
+	case inExpr:
+		return isOperand(e.x) && allOperands(e.list)
+	case containsExpr:
+		col, ok := e.x.(columnExpr)
+		return ok && col.paths == nil && types[col.name] == Array && allOperands(e.list)
+	}
+	return false
+}
+
+// isOperand reports whether e is a column or a literal, which evaluate
+// without error.
+func isOperand(e expr) bool {
+	switch e := e.(type) {
+	case literalExpr, columnExpr:
+		return true
+	case enumExpr:
+		return isOperand(e.x)
+	case collateExpr:
+		return isOperand(e.x)
+	}
+	return false
+}
+
+func allOperands(list []expr) bool {
+	for _, e := range list {
+		if !isOperand(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectivity estimates the fraction of rows for which the predicate e is
+// true. An equality test on a column with an index of n distinct values
+// keeps 1/n of the rows.
+func selectivity(e expr, distinct map[string]int) float64 {
+	equal := func(operands ...expr) float64 {
+		for _, x := range operands {
+			switch wrapped := x.(type) {
+			case enumExpr:
+				x = wrapped.x
+			case collateExpr:
+				x = wrapped.x
+			}
+			if col, ok := x.(columnExpr); ok && distinct[col.name] > 0 {
+				return 1 / float64(distinct[col.name])
+			}
+		}
+		return equalSelectivity
+	}
+	negate := func(s float64, not bool) float64 {
+		if not {
+			return 1 - s
+		}
+		return s
+	}
+
+	switch e := e.(type) {
+	case binaryExpr:
+		switch e.op {
+		case "AND":
+			return selectivity(e.left, distinct) * selectivity(e.right, distinct)
+		case "OR":
+			l, r := selectivity(e.left, distinct), selectivity(e.right, distinct)
+			return l + r - l*r
+		case "=", "!=":
+			return negate(equal(e.left, e.right), e.op == "!=")
+		case "<", "<=", ">", ">=":
+			return rangeSelectivity
+		}
+	case unaryExpr:
+		if e.op == "NOT" {
+			return 1 - selectivity(e.x, distinct)
+		}
+	case isNullExpr:
+		return negate(equalSelectivity, e.not)
+	case inExpr:
+		return negate(math.Min(1, float64(len(e.list))*equal(e.x)), e.not)
+	case containsExpr:
+		return negate(equalSelectivity, e.not)
+	case matchExpr:
+		return negate(equalSelectivity, e.not)
+	}
+	return defaultSelectivity
+}
+
+// rejectionCost estimates the work spent evaluating the predicate e per
+// row it rejects: its evaluation cost divided by the fraction of rows it
+// is false for.
+func rejectionCost(e expr, distinct map[string]int) float64 {
+	rejected := 1 - selectivity(e, distinct)
+	if rejected <= 0 {
+		return math.Inf(1)
+	}
+	return evalCost(e) / rejected
+}
+
+// evalCost estimates the cost of evaluating e for one row, counting one
+// for each node of the expression and more for pattern matching and
+// function calls.
+func evalCost(e expr) float64 {
+	cost := 0.0
+	rewriteExpr(e, func(e expr) (expr, error) {
+		switch e.(type) {
+		case likeExpr:
+			cost += 4
+		case matchExpr:
+			cost += 8
+		case funcExpr:
+			cost += 2
+		default:
+			cost++
+		}
+		return e, nil
+	})
+	return cost
+}
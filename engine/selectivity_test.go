@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetQueryPlannerMode(t *testing.T) {
+	db := newTestDB(t)
+
+	if got := db.GetQueryPlannerMode(); got != RuleBased {
+		t.Fatalf("default mode = %d, want RuleBased", got)
+	}
+	if err := db.SetQueryPlannerMode(CostBased); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.GetQueryPlannerMode(); got != CostBased {
+		t.Fatalf("mode = %d, want CostBased", got)
+	}
+	if err := db.SetQueryPlannerMode(PlannerMode(42)); !errors.Is(err, ErrInvalidPlanner) {
+		t.Fatalf("SetQueryPlannerMode(42) = %v, want ErrInvalidPlanner", err)
+	}
+	if got := db.GetQueryPlannerMode(); got != CostBased {
+		t.Fatalf("mode after invalid set = %d, want CostBased", got)
+	}
+}
+
+// plannerModeDB has a join whose key index has only two distinct values,
+// which only the rule-based planner probes.
+func plannerModeDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "users", []Column{{Name: "team", DataType: String}}, nil)
+	mustCreateTable(t, db, "orders", []Column{
+		{Name: "team", DataType: String},
+		{Name: "n", DataType: Int},
+		{Name: "tag", DataType: String},
+	}, []Index{{Name: "orders_team", Columns: []string{"team"}}})
+
+	for i := 0; i < 40; i++ {
+		mustInsert(t, db, "users", fmt.Sprint(i), map[string]interface{}{"team": fmt.Sprint(i % 2)})
+		mustInsert(t, db, "orders", fmt.Sprint(i), map[string]interface{}{"team": fmt.Sprint(i % 2), "n": i, "tag": fmt.Sprint(i % 5)})
+	}
+	return db
+}
+
+func TestPlannerModeJoinStrategy(t *testing.T) {
+	db := plannerModeDB(t)
+	query := Query{
+		Select: []string{"users.id", "orders.id"},
+		From:   "users",
+		Joins:  []Join{{Table: "orders", On: "orders.team = users.team"}},
+		Where:  "orders.n < 10",
+	}
+
+	want := map[PlannerMode]string{
+		RuleBased: IndexJoin,
+		CostBased: NestedLoopJoin,
+		Heuristic: NestedLoopJoin,
+	}
+	var results []QueryResult
+	for _, mode := range []PlannerMode{RuleBased, CostBased, Heuristic} {
+		if err := db.SetQueryPlannerMode(mode); err != nil {
+			t.Fatal(err)
+		}
+
+		explain, err := db.Explain(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(explain, "("+want[mode]) {
+			t.Errorf("mode %d: EXPLAIN\n%s\nwant strategy %s", mode, explain, want[mode])
+		}
+		results = append(results, mustQuery(t, db, query))
+	}
+
+	for i, result := range results[1:] {
+		if !reflect.DeepEqual(result.Rows, results[0].Rows) {
+			t.Errorf("mode %d returned different rows from RuleBased", i+1)
+		}
+	}
+}
+
+func TestPlannerModeFilterOrder(t *testing.T) {
+	db := plannerModeDB(t)
+	// The IN is more selective than the range but costs more to test.
+	query := Query{Select: []string{"id"}, From: "orders", Where: "tag IN ('1', '2') AND n > 3"}
+
+	want := map[PlannerMode]string{
+		RuleBased: "(tag IN ('1', '2') AND (n > 3))",
+		CostBased: "((n > 3) AND tag IN ('1', '2'))",
+		Heuristic: "(tag IN ('1', '2') AND (n > 3))",
+	}
+	var results []QueryResult
+	for _, mode := range []PlannerMode{RuleBased, CostBased, Heuristic} {
+		if err := db.SetQueryPlannerMode(mode); err != nil {
+			t.Fatal(err)
+		}
+
+		plan, err := db.estimatedPlan(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Mode != mode {
+			t.Errorf("plan mode = %d, want %d", plan.Mode, mode)
+		}
+		for _, op := range plan.Operations {
+			if op.Type == Filter && op.Filter != want[mode] {
+				t.Errorf("mode %d: filter %q, want %q", mode, op.Filter, want[mode])
+			}
+		}
+		results = append(results, mustQuery(t, db, query))
+	}
+
+	for i, result := range results[1:] {
+		if !reflect.DeepEqual(resultIDs(result), resultIDs(results[0])) {
+			t.Errorf("mode %d returned different rows from RuleBased", i+1)
+		}
+	}
+}
+
+func TestPreparedQueryReplansOnModeChange(t *testing.T) {
+	db := plannerModeDB(t)
+	prepared, err := db.Prepare(Query{
+		Select: []string{"users.id"},
+		From:   "users",
+		Joins:  []Join{{Table: "orders", On: "orders.team = users.team"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetQueryPlannerMode(CostBased); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := prepared.currentPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Mode != CostBased {
+		t.Fatalf("prepared plan mode = %d after SetQueryPlannerMode(CostBased)", plan.Mode)
+	}
+}
+
+// selectiveDB has an indexed code column with a distinct value per 20
+// rows, so that an equality on it is far more selective than the other
+// predicates.
+func selectiveDB(t testing.TB, rows int) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "events", []Column{
+		{Name: "code", DataType: String},
+		{Name: "note", DataType: String},
+		{Name: "n", DataType: Int},
+	}, []Index{{Name: "by_code", Columns: []string{"code"}}})
+
+	data := make([]Row, rows)
+	for i := range data {
+		data[i] = Row{Columns: map[string]interface{}{
+			"id":   fmt.Sprintf("e%05d", i),
+			"code": fmt.Sprintf("c%d", i%(rows/20)),
+			"note": strings.Repeat("x", i%7) + "event",
+			"n":    i % 100,
+		}}
+	}
+	if err := db.BulkLoad("events", data); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// filterOrder returns the filter the plan of query evaluates.
+func filterOrder(t testing.TB, db *NewDatabase, query Query) expr {
+	plan, err := db.estimatedPlan(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range plan.Operations {
+		if op.Type == Filter {
+			return op.filterExpr
+		}
+	}
+	t.Fatalf("plan of %q has no filter", query.Where)
+	return nil
+}
+
+func TestReorderingKeepsResults(t *testing.T) {
+	db := selectiveDB(t, 2000)
+	rows, err := db.GetAllRows("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		where     string
+		reordered bool
+	}{
+		{"note LIKE '%xx%' AND n >= 5 AND code = 'c7'", true},
+		{"n <> 3 AND NOT (note = 'event') AND code IN ('c1', 'c2') AND n < 50", true},
+		{"note LIKE '%x%' AND code = 'c3' OR n = 5 AND code = 'c4'", false},
+		{"n > 20 AND code = 'missing'", true},
+	} {
+		query := Query{Select: []string{"id"}, From: "events", Where: tt.where, OrderBy: "id"}
+		filter := mustParseExpr(t, tt.where)
+		if reordered := filterOrder(t, db, query).String() != filter.String(); reordered != tt.reordered {
+			t.Errorf("filter %q reordered = %v, want %v", tt.where, reordered, tt.reordered)
+		}
+
+		// The filter as written, evaluated row by row.
+		var want []string
+		for _, row := range rows {
+			ok, err := evaluateFilter(row, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				want = append(want, rowID(row))
+			}
+		}
+
+		got := resultIDs(mustQuery(t, db, query))
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("WHERE %s = %d rows, want %d", tt.where, len(got), len(want))
+		}
+	}
+
+	// A conjunct that can fail keeps its place, so the error is the same.
+	mustInsert(t, db, "events", "bad", map[string]interface{}{"code": "c9", "note": "oops", "n": 1})
+	query := Query{Select: []string{"id"}, From: "events", Where: "n = 1 AND CAST(note AS INT) > 0 AND code = 'none'"}
+	if _, err := db.ExecuteQuery(query); !errors.Is(err, ErrInvalidCast) {
+		t.Errorf("query with a failing CAST = %v, want ErrInvalidCast", err)
+	}
+}
+
+func mustParseExpr(t testing.TB, src string) expr {
+	t.Helper()
+	e, err := parseExpr(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// BenchmarkFilterReordering evaluates a filter whose selective equality
+// is written last, as written and as the planner reorders it.
+func BenchmarkFilterReordering(b *testing.B) {
+	db := selectiveDB(b, 20000)
+	rows, err := db.GetAllRows("events")
+	if err != nil {
+		b.Fatal(err)
+	}
+	query := Query{Select: []string{"id"}, From: "events", Where: "note LIKE '%xxx%' AND n >= 10 AND code = 'c42'"}
+
+	for _, bb := range []struct {
+		name   string
+		filter expr
+	}{
+		{"AsWritten", mustParseExpr(b, query.Where)},
+		{"Reordered", filterOrder(b, db, query)},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, row := range rows {
+					if _, err := evaluateFilter(row, bb.filter); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+func (db *NewDatabase) CreateSequence(opts SequenceOptions) error {
+	if opts.Name == "" {
+		return fmt.Errorf("%w: sequence needs a name", ErrInvalidQuery)
+	}
+
+	seq := &Sequence{
+		Name:      opts.Name,
+		Increment: opts.Increment,
+		Min:       opts.Min,
+		Max:       opts.Max,
+		Cycle:     opts.Cycle,
+	}
+	if seq.Increment == 0 {
+		seq.Increment = 1
+	}
+	if opts.Min == 0 && opts.Max == 0 {
+		seq.Min, seq.Max = math.MinInt64, math.MaxInt64
+		if seq.Increment > 0 {
+			seq.start = 1
+		} else {
+			seq.start = -1
+		}
+	} else if seq.Increment > 0 {
+		seq.start = seq.Min
+	} else {
+		seq.start = seq.Max
+	}
+	if opts.Start != nil {
+		seq.start = *opts.Start
+	}
+
+	if seq.Min > seq.Max {
+		return fmt.Errorf("%w: sequence %s has min %d above max %d", ErrInvalidQuery, seq.Name, seq.Min, seq.Max)
+	}
+	if seq.start < seq.Min || seq.start > seq.Max {
+		return fmt.Errorf("%w: sequence %s starts at %d outside [%d, %d]", ErrInvalidQuery, seq.Name, seq.start, seq.Min, seq.Max)
+	}
+
+	db.seqMu.Lock()
+	defer db.seqMu.Unlock()
+
+	if _, exists := db.Sequences[seq.Name]; exists {
+		return fmt.Errorf("%w: %s", ErrSequenceExists, seq.Name)
+	}
+
+	if db.Sequences == nil {
+		db.Sequences = make(map[string]*Sequence)
+	}
+	db.Sequences[seq.Name] = seq
+
+	return nil
+}
+
+// NextVal advances the sequence and returns the new value. When the sequence
+// passes its bound it wraps to the opposite bound if Cycle is set and
+// returns ErrSequenceExhausted otherwise.
+func (db *NewDatabase) NextVal(name string) (int64, error) {
+	db.seqMu.Lock()
+	defer db.seqMu.Unlock()
+
+	seq, ok := db.Sequences[name]
+
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrSequenceNotFound, name)
+	}
+
+	if !seq.started {
+		seq.Current = seq.start
+		seq.started = true
+		return seq.Current, nil
+	}
+
+	next, overflow := seq.Current+seq.Increment, false
+	if seq.Increment > 0 {
+		overflow = next < seq.Current || next > seq.Max
+	} else {
+		overflow = next > seq.Current || next < seq.Min
+	}
+
+	if overflow {
+		if !seq.Cycle {
+			return 0, fmt.Errorf("%w: %s", ErrSequenceExhausted, name)
+		}
+		if seq.Increment > 0 {
+			next = seq.Min
+		} else {
+			next = seq.Max
+		}
+	}
+
+	seq.Current = next
+	return next, nil
+}
+
+// SequenceSession returns a new session reading the database's sequences.
+func (db *NewDatabase) SequenceSession() *SequenceSession {
+	return &SequenceSession{db: db, last: make(map[string]int64)}
+}
+
+// NextVal advances the sequence, as NextVal on the database does, and
+// remembers the value for CurrVal.
+func (s *SequenceSession) NextVal(name string) (int64, error) {
+	v, err := s.db.NextVal(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	s.last[name] = v
+	return v, nil
+}
+
+// CurrVal returns the value NextVal most recently returned to the session
+// for the sequence, whatever other sessions have taken since. It fails
+// with ErrSequenceNotRead if the session has not called NextVal on it.
+func (s *SequenceSession) CurrVal(name string) (int64, error) {
+	s.db.seqMu.Lock()
+	_, ok := s.db.Sequences[name]
+	s.db.seqMu.Unlock()
+
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrSequenceNotFound, name)
+	}
+
+	v, ok := s.last[name]
+
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrSequenceNotRead, name)
+	}
+
+	return v, nil
+}
+
+func (db *NewDatabase) DropSequence(name string) error {
+	db.seqMu.Lock()
+	defer db.seqMu.Unlock()
+
+	if _, ok := db.Sequences[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrSequenceNotFound, name)
+	}
+
+	delete(db.Sequences, name)
+	return nil
+}
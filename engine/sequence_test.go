@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestNextValConcurrentUnique(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateSequence(SequenceOptions{Name: "ids"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, perWorker = 8, 500
+	values := make(chan int64, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				v, err := db.NextVal("ids")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				values <- v
+			}
+		}()
+	}
+	wg.Wait()
+	close(values)
+
+	seen := make(map[int64]bool, workers*perWorker)
+	for v := range values {
+		if seen[v] {
+			t.Fatalf("NextVal returned %d twice", v)
+		}
+		seen[v] = true
+	}
+	if len(seen) != workers*perWorker {
+		t.Fatalf("got %d values, want %d", len(seen), workers*perWorker)
+	}
+	for v := int64(1); v <= workers*perWorker; v++ {
+		if !seen[v] {
+			t.Fatalf("NextVal skipped %d", v)
+		}
+	}
+}
+
+func TestSequenceCycle(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateSequence(SequenceOptions{Name: "dice", Min: 1, Max: 3, Cycle: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateSequence(SequenceOptions{Name: "once", Min: 1, Max: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int64
+	for i := 0; i < 5; i++ {
+		v, err := db.NextVal("dice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+	for i, want := range []int64{1, 2, 3, 1, 2} {
+		if got[i] != want {
+			t.Fatalf("NextVal sequence = %v, want [1 2 3 1 2]", got)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.NextVal("once"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.NextVal("once"); !errors.Is(err, ErrSequenceExhausted) {
+		t.Fatalf("NextVal past Max without Cycle = %v, want ErrSequenceExhausted", err)
+	}
+}
+
+func TestCurrVal(t *testing.T) {
+	db := newTestDB(t)
+	start := int64(10)
+	if err := db.CreateSequence(SequenceOptions{Name: "s", Start: &start, Increment: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	session, other := db.SequenceSession(), db.SequenceSession()
+	if _, err := session.CurrVal("s"); !errors.Is(err, ErrSequenceNotRead) {
+		t.Fatalf("CurrVal before NextVal = %v, want ErrSequenceNotRead", err)
+	}
+	for _, want := range []int64{10, 15} {
+		if v, err := session.NextVal("s"); err != nil || v != want {
+			t.Fatalf("NextVal = %d, %v, want %d", v, err, want)
+		}
+	}
+	if v, err := other.NextVal("s"); err != nil || v != 20 {
+		t.Fatalf("other session's NextVal = %d, %v, want 20", v, err)
+	}
+	if v, err := session.CurrVal("s"); err != nil || v != 15 {
+		t.Fatalf("CurrVal = %d, %v, want 15, the session's own value", v, err)
+	}
+	if v, err := other.CurrVal("s"); err != nil || v != 20 {
+		t.Fatalf("other session's CurrVal = %d, %v, want 20", v, err)
+	}
+
+	if err := db.CreateSequence(SequenceOptions{Name: "s"}); !errors.Is(err, ErrSequenceExists) {
+		t.Fatalf("creating s again = %v, want ErrSequenceExists", err)
+	}
+	if err := db.DropSequence("s"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.NextVal("s"); !errors.Is(err, ErrSequenceNotFound) {
+		t.Fatalf("NextVal after DropSequence = %v, want ErrSequenceNotFound", err)
+	}
+	if _, err := session.CurrVal("s"); !errors.Is(err, ErrSequenceNotFound) {
+		t.Fatalf("CurrVal after DropSequence = %v, want ErrSequenceNotFound", err)
+	}
+}
@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	seriesTableName = "generate_series"
+	seriesColumn    = "value"
+	maxSeriesRows   = 10000000
+)
+
+// parseSeriesSource recognises a Query.From of the form
+// generate_series(start, stop[, step]). The arguments may be any constant
+// expressions. It returns nil if from is not a series.
+func parseSeriesSource(from string) (*GenerateSeriesSpec, error) {
+	tokens, err := tokenize(from)
+
+	if err != nil || len(tokens) < 2 || tokens[0].kind != tokIdent || !strings.EqualFold(tokens[0].text, seriesTableName) {
+		return nil, nil
+	}
+
+	p := &exprParser{src: from, tokens: tokens, pos: 1}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	args, err := p.parseList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("%w: generate_series takes 2 or 3 arguments, got %d", ErrInvalidQuery, len(args))
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		val, err := arg.eval(Row{})
+
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+
+	spec := &GenerateSeriesSpec{Start: values[0], Stop: values[1]}
+	if len(values) == 3 {
+		spec.Step = values[2]
+	}
+	return spec, nil
+}
+
+func (s GenerateSeriesSpec) String() string {
+	args := []interface{}{s.Start, s.Stop}
+	if s.Step != nil {
+		args = append(args, s.Step)
+	}
+
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if d, ok := arg.(time.Duration); ok {
+			arg = d.String()
+		}
+		parts[i] = literalExpr{arg}.String()
+	}
+	return seriesTableName + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func (s GenerateSeriesSpec) dataType() (DataType, error) {
+	switch {
+	case s.Start == nil || s.Stop == nil:
+		return 0, fmt.Errorf("%w: %s: start and stop must not be NULL", ErrInvalidQuery, s)
+	case valueKind(s.Start) == kindNumber && valueKind(s.Stop) == kindNumber:
+		if s.Step != nil && valueKind(s.Step) != kindNumber {
+			return 0, fmt.Errorf("%w: %s: numeric series needs a numeric step", ErrInvalidQuery, s)
+		}
+		if isFloat(s.Start) || isFloat(s.Stop) || isFloat(s.Step) {
+			return Float, nil
+		}
+		return Int, nil
+	case valueKind(s.Start) == kindTime && valueKind(s.Stop) == kindTime:
+		switch s.Step.(type) {
+		case time.Duration, string:
+			return DateTime, nil
+		}
+		return 0, fmt.Errorf("%w: %s: DateTime series needs a duration or interval step", ErrInvalidQuery, s)
+	default:
+		return 0, fmt.Errorf("%w: %s: start and stop must both be numbers or both be DateTimes", ErrInvalidQuery, s)
+	}
+}
+
+// table materialises the series as a table with a single column, value.
+// The series runs from Start towards Stop in steps of Step, including Stop
+// if it is reached; a step pointing away from Stop yields no rows. Step
+// defaults to 1 for numbers. For DateTimes it is a time.Duration or an
+// interval as accepted by DATE_ADD, such as '1 hour' or '1 month'.
+func (s GenerateSeriesSpec) table() (Table, error) {
+	dataType, err := s.dataType()
+
+	if err != nil {
+		return Table{}, err
+	}
+
+	var next func(interface{}) (interface{}, error)
+	switch dataType {
+	case Int:
+		step := int64(1)
+		if s.Step != nil {
+			step = toInt64(s.Step)
+		}
+		if step == 0 {
+			return Table{}, fmt.Errorf("%w: %s: step must not be zero", ErrInvalidQuery, s)
+		}
+		next = func(v interface{}) (interface{}, error) {
+			n := v.(int64)
+			if (step > 0 && n > n+step) || (step < 0 && n < n+step) {
+				return nil, nil
+			}
+			return n + step, nil
+		}
+	case Float:
+		step := 1.0
+		if s.Step != nil {
+			step = toFloat(s.Step)
+		}
+		if step == 0 {
+			return Table{}, fmt.Errorf("%w: %s: step must not be zero", ErrInvalidQuery, s)
+		}
+		start := toFloat(s.Start)
+		i := 0
+		next = func(interface{}) (interface{}, error) {
+			i++
+			return start + float64(i)*step, nil
+		}
+	case DateTime:
+		start := s.Start.(time.Time)
+		i := 0
+		next = func(interface{}) (interface{}, error) {
+			i++
+			return seriesTime(start, s.Step, i)
+		}
+	}
+
+	start := s.Start
+	switch dataType {
+	case Int:
+		start = toInt64(s.Start)
+	case Float:
+		start = toFloat(s.Start)
+	}
+
+	second, err := next(start)
+
+	if err != nil {
+		return Table{}, err
+	}
+	direction := 0
+	if second != nil {
+		direction = compareOrdered(second, start)
+	}
+	if direction == 0 {
+		return Table{}, fmt.Errorf("%w: %s: step must move the series", ErrInvalidQuery, s)
+	}
+
+	table := Table{
+		Name:    seriesTableName,
+		Columns: []Column{{Name: seriesColumn, DataType: dataType}},
+	}
+	for val := start; val != nil && compareOrdered(val, s.Stop)*direction <= 0; {
+		if len(table.Rows) == maxSeriesRows {
+			return Table{}, fmt.Errorf("%w: %s has more than %d rows", ErrInvalidQuery, s, maxSeriesRows)
+		}
+		table.Rows = append(table.Rows, Row{Columns: map[string]interface{}{seriesColumn: val}})
+
+		if len(table.Rows) == 1 {
+			val = second
+			continue
+		}
+		if val, err = next(val); err != nil {
+			return Table{}, err
+		}
+	}
+	return table, nil
+}
+
+// seriesTime returns the i'th DateTime after start. Calendar intervals are
+// scaled rather than applied i times, so that a monthly series starting on
+// the 31st does not drift to earlier days after a short month.
+func seriesTime(start time.Time, step interface{}, i int) (interface{}, error) {
+	if d, ok := step.(time.Duration); ok {
+		return start.Add(time.Duration(i) * d), nil
+	}
+
+	interval := step.(string)
+	if d, err := time.ParseDuration(interval); err == nil {
+		return start.Add(time.Duration(i) * d), nil
+	}
+	if fields := strings.Fields(interval); len(fields) == 2 {
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			interval = fmt.Sprintf("%d %s", n*i, fields[1])
+		}
+	}
+	return dateAdd([]interface{}{start, interval})
+}
+
+// parseSource recognises the table-valued functions a Query.From may
+// name. Both results are nil if from names a table.
+func parseSource(from string) (*GenerateSeriesSpec, *unnestSource, error) {
+	series, err := parseSeriesSource(from)
+
+	if err != nil || series != nil {
+		return series, nil, err
+	}
+
+	unnest, err := parseUnnestSource(from)
+	return nil, unnest, err
+}
+
+// sourceTable returns the table a Scan or JoinOp reads. The caller must
+// hold db.mu.
+func (db *NewDatabase) sourceTable(op Operation) (Table, error) {
+	if op.series != nil {
+		return op.series.table()
+	}
+
+	table, ok := db.queryTable(op.Table)
+	if !ok {
+		return Table{}, inClause("From", queryError(CodeUnknownTable, ErrTableNotFound, op.Table, "%s", op.Table))
+	}
+	return table, nil
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// seriesValues returns the value column of each row of result.
+func seriesValues(result QueryResult) []interface{} {
+	values := make([]interface{}, len(result.Rows))
+	for i, row := range result.Rows {
+		values[i] = row.Columns["value"]
+	}
+	return values
+}
+
+func TestGenerateSeriesInt(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		from string
+		want []interface{}
+	}{
+		{"generate_series(1,10,2)", []interface{}{int64(1), int64(3), int64(5), int64(7), int64(9)}},
+		{"generate_series(1, 3)", []interface{}{int64(1), int64(2), int64(3)}},
+		{"generate_series(3, 1, -1)", []interface{}{int64(3), int64(2), int64(1)}},
+		{"generate_series(1, 3, -1)", []interface{}{}},
+		{"generate_series(5, 5)", []interface{}{int64(5)}},
+	}
+	for _, tt := range tests {
+		result := mustQuery(t, db, Query{Select: []string{"value"}, From: tt.from})
+		if got := seriesValues(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SELECT value FROM %s = %v, want %v", tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateSeriesFloat(t *testing.T) {
+	db := newTestDB(t)
+
+	result := mustQuery(t, db, Query{Select: []string{"value"}, From: "generate_series(0.5, 2.0, 0.5)"})
+	if got, want := seriesValues(result), []interface{}{0.5, 1.0, 1.5, 2.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("float series = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateSeriesHourly(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)
+
+	result := mustQuery(t, db, Query{
+		Select:         []string{"value"},
+		GenerateSeries: &GenerateSeriesSpec{Start: start, Stop: start.Add(4 * time.Hour), Step: time.Hour},
+	})
+	got := seriesValues(result)
+	if len(got) != 5 {
+		t.Fatalf("hourly series has %d rows, want 5: %v", len(got), got)
+	}
+	for i, v := range got {
+		if want := start.Add(time.Duration(i) * time.Hour); !v.(time.Time).Equal(want) {
+			t.Errorf("row %d = %v, want %v", i, v, want)
+		}
+	}
+}
+
+func TestGenerateSeriesWithFilter(t *testing.T) {
+	db := newTestDB(t)
+
+	result := mustQuery(t, db, Query{Select: []string{"value"}, From: "generate_series(1, 20)", Where: "value % 5 = 0", OrderBy: "value DESC"})
+	if got, want := seriesValues(result), []interface{}{int64(20), int64(15), int64(10), int64(5)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filtered series = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateSeriesInvalid(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, from := range []string{
+		"generate_series(1, 10, 0)",
+		"generate_series(1)",
+		"generate_series(1, 'x')",
+	} {
+		if _, err := db.ExecuteQuery(Query{Select: []string{"value"}, From: from}); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s = %v, want ErrInvalidQuery", from, err)
+		}
+	}
+}
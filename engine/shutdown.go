@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GracefulShutdown stops the database for good. New reads and writes fail
+// with ErrDatabaseClosed at once; those already running get up to timeout
+// to finish. Then, as Close does, it stops the background goroutines and
+// applies every buffered write, saves a final snapshot if the database was
+// opened from a directory, and closes every Watch channel.
+//
+// If operations are still running after timeout it returns
+// ErrShutdownTimeout without flushing or saving; the database stays closed
+// to new operations, and GracefulShutdown may be called again to wait
+// longer. Transactions not yet committed are lost. Prefer it to Close in
+// production, where writes may be in flight.
+func (db *NewDatabase) GracefulShutdown(timeout time.Duration) error {
+	db.opsMu.Lock()
+	db.closing = true
+	drained := db.drained
+	if drained == nil {
+		drained = make(chan struct{})
+		if db.activeOps == 0 {
+			close(drained)
+		} else {
+			db.drained = drained
+		}
+	}
+	db.opsMu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+	case <-timer.C:
+		db.opsMu.Lock()
+		running := db.activeOps
+		db.opsMu.Unlock()
+		return fmt.Errorf("%w: %d still running after %s", ErrShutdownTimeout, running, timeout)
+	}
+
+	errs := []error{db.Close()}
+	if db.path != "" {
+		errs = append(errs, db.SaveToDisk())
+	}
+	db.closeWatchers()
+
+	return errors.Join(errs...)
+}
+
+// startOp registers a read or write for GracefulShutdown to wait for. The
+// returned func must be called when the operation is done.
+func (db *NewDatabase) startOp() (func(), error) {
+	db.opsMu.Lock()
+	defer db.opsMu.Unlock()
+
+	if db.closing {
+		return nil, ErrDatabaseClosed
+	}
+	if db.opened.IsZero() {
+		db.opened = time.Now()
+	}
+	db.activeOps++
+	return db.endOp, nil
+}
+
+func (db *NewDatabase) endOp() {
+	db.opsMu.Lock()
+	defer db.opsMu.Unlock()
+
+	db.activeOps--
+	if db.activeOps == 0 && db.drained != nil {
+		close(db.drained)
+		db.drained = nil
+	}
+}
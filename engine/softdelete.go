@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+const deletedAtColumn = "deleted_at"
+
+// EnableSoftDelete makes deletes on tableName set the row's deleted_at
+// column instead of removing it, adding the column if the table does not
+// have one. Soft-deleted rows are hidden from GetRowByID, GetAllRows,
+// CountRows and queries unless Query.IncludeDeleted is set; they still count
+// towards unique indexes. Restore brings them back and PurgeDeleted removes
+// them for good.
+func (db *NewDatabase) EnableSoftDelete(tableName string, opts SoftDeleteOptions) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	found := false
+	for _, col := range table.Columns {
+		if col.Name != deletedAtColumn {
+			continue
+		}
+		if col.DataType != DateTime || !col.Nullable {
+			return fmt.Errorf("%w: %s.%s must be a nullable DateTime for soft delete", ErrInvalidSchema, tableName, deletedAtColumn)
+		}
+		found = true
+	}
+
+	if !found {
+		columns := make([]Column, len(table.Columns), len(table.Columns)+1)
+		copy(columns, table.Columns)
+		table.Columns = append(columns, Column{Name: deletedAtColumn, DataType: DateTime, Nullable: true})
+	}
+
+	table.SoftDelete = true
+	table.ReviveDeleted = opts.ReviveOnInsert
+	table.touchSchema()
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+
+	return nil
+}
+
+// Restore undoes the soft delete of a row.
+func (db *NewDatabase) Restore(tableName, id string) error {
+	return db.RestoreWithOptions(tableName, id, WriteOptions{})
+}
+
+func (db *NewDatabase) RestoreWithOptions(tableName, id string, opts WriteOptions) error {
+	unlockRow, err := db.acquireRowLock(nil, tableName, id, true)
+
+	if err != nil {
+		return err
+	}
+	defer unlockRow()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	table.ensureIndexes()
+
+	current, ok := table.getRow(id)
+
+	if !ok || !isDeleted(current) {
+		return fmt.Errorf("%w: no deleted row %s in table %s", ErrIDNotFound, id, tableName)
+	}
+
+	restored := copyRow(current)
+	restored.Columns[deletedAtColumn] = nil
+
+	restored = table.putRow(restored)
+	table.audit(AuditUpdate, current, restored, writeOrigin{actor: opts.Actor})
+	db.Tables[tableName] = table
+	db.publishChange(ChangeInsert, tableName, id, Row{}, restored)
+
+	return nil
+}
+
+// PurgeDeleted permanently removes rows of tableName that were soft-deleted
+// more than olderThan ago and returns how many were removed.
+func (db *NewDatabase) PurgeDeleted(tableName string, olderThan time.Duration) (int, error) {
+	return db.PurgeDeletedWithOptions(tableName, olderThan, WriteOptions{})
+}
+
+func (db *NewDatabase) PurgeDeletedWithOptions(tableName string, olderThan time.Duration, opts WriteOptions) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	table.ensureIndexes()
+
+	cutoff := time.Now().Add(-olderThan)
+	var purged []Row
+	for _, row := range table.allRows() {
+		if deletedAt, ok := row.Columns[deletedAtColumn].(time.Time); ok && deletedAt.Before(cutoff) {
+			purged = append(purged, row)
+		}
+	}
+
+	for _, row := range purged {
+		table.deleteRow(rowID(row))
+		table.audit(AuditDelete, row, Row{}, writeOrigin{actor: opts.Actor})
+	}
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+	db.compactIfNeeded(tableName)
+
+	return len(purged), nil
+}
+
+// removeRow deletes current from the table, or marks it deleted if the
+// table uses soft delete. It returns the row left behind, if any.
+func (t *Table) removeRow(current Row) Row {
+	if !t.SoftDelete {
+		t.deleteRow(rowID(current))
+		return Row{}
+	}
+
+	tombstone := copyRow(current)
+	tombstone.Columns[deletedAtColumn] = time.Now()
+	return t.putRow(tombstone)
+}
+
+func isDeleted(row Row) bool {
+	return row.Columns[deletedAtColumn] != nil
+}
@@ -0,0 +1,316 @@
+package engine
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type orderKey struct {
+	Column     string
+	Desc       bool
+	NullsFirst bool
+
+	col columnExpr
+	// enum holds the values of an Enum sort column, which sorts in their
+	// order.
+	enum []string
+	// collation is the collation of a String sort column: the column's,
+	// or if collated is set the one named by COLLATE.
+	collation Collation
+	collated  bool
+}
+
+// parseOrderBy parses a comma-separated list of "column [COLLATE name]
+// [ASC|DESC] [NULLS FIRST|NULLS LAST]" terms, where name is BINARY, NOCASE
+// or NATURAL. NULL sorts as larger than every value unless told otherwise,
+// so it lands last for ASC and first for DESC.
+func parseOrderBy(orderBy string) ([]orderKey, error) {
+	var keys []orderKey
+
+	offset := 0
+	for _, term := range strings.Split(orderBy, ",") {
+		pos := offset
+		offset += len(term) + 1
+
+		fields := strings.Fields(term)
+		if len(fields) == 0 {
+			return nil, syntaxError(CodeSyntaxError, "", pos, "empty ORDER BY term in %q", orderBy)
+		}
+
+		key := orderKey{Column: fields[0], col: newColumnExpr(fields[0])}
+		rest := fields[1:]
+
+		if len(rest) > 0 && strings.EqualFold(rest[0], "COLLATE") {
+			if len(rest) < 2 {
+				return nil, unexpectedInOrderBy(term, pos, rest)
+			}
+			collation, ok := parseCollation(rest[1])
+			if !ok {
+				return nil, syntaxError(CodeSyntaxError, rest[1], pos+strings.Index(term, rest[1]), "unknown collation %q in ORDER BY", rest[1])
+			}
+			key.collation, key.collated = collation, true
+			rest = rest[2:]
+		}
+
+		if len(rest) > 0 {
+			switch strings.ToUpper(rest[0]) {
+			case "ASC":
+				rest = rest[1:]
+			case "DESC":
+				key.Desc = true
+				rest = rest[1:]
+			}
+		}
+		key.NullsFirst = key.Desc
+
+		if len(rest) > 0 {
+			if len(rest) != 2 || !strings.EqualFold(rest[0], "NULLS") {
+				return nil, unexpectedInOrderBy(term, pos, rest)
+			}
+			switch strings.ToUpper(rest[1]) {
+			case "FIRST":
+				key.NullsFirst = true
+			case "LAST":
+				key.NullsFirst = false
+			default:
+				return nil, unexpectedInOrderBy(term, pos, rest)
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// sortRows returns a sorted copy of rows; the input slice may be a table's
+// own storage and is never reordered. It fails if a sort column holds
+// values compareValues cannot order.
+func sortRows(rows []Row, keys []orderKey) ([]Row, error) {
+	sorted := append([]Row(nil), rows...)
+
+	var sortErr error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, key := range keys {
+			a, _ := key.col.eval(sorted[i])
+			b, _ := key.col.eval(sorted[j])
+			if key.enum != nil {
+				a, b = enumOrdinal(a, key.enum), enumOrdinal(b, key.enum)
+			}
+			a, b = key.collation.key(a), key.collation.key(b)
+
+			if a == nil || b == nil {
+				if a == nil && b == nil {
+					continue
+				}
+				return (a == nil) == key.NullsFirst
+			}
+
+			c, err := compareValues(a, b)
+			if err != nil && sortErr == nil {
+				sortErr = err
+			}
+			if c == 0 {
+				continue
+			}
+			if key.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	return sorted, nil
+}
+
+// compareValues is the order of values shared by ORDER BY, BETWEEN, MIN
+// and MAX, and returns -1, 0 or +1. NULL (nil) comes before every other
+// value and equals only NULL; ORDER BY's NULLS FIRST and LAST, and the
+// NULL handling of BETWEEN, MIN and MAX, are applied before values reach
+// it. Other values are ordered first by kind, Bool before numbers,
+// strings, DateTime, arrays and JSON objects, and then within their kind:
+// false before true; numbers by value, exactly when both are integers and
+// as float64 otherwise, with NaN first; strings bytewise; times
+// chronologically; arrays element by element, a prefix first; and JSON
+// objects by their text with keys sorted. Values of any other Go type
+// cannot be ordered and give an error.
+func compareValues(a, b interface{}) (int, error) {
+	switch {
+	case a == nil && b == nil:
+		return 0, nil
+	case a == nil:
+		return -1, nil
+	case b == nil:
+		return 1, nil
+	}
+
+	ka, kb := valueKind(a), valueKind(b)
+	switch {
+	case ka == kindOther:
+		return 0, queryError(CodeTypeMismatch, ErrInvalidQuery, "", "cannot order %T", a)
+	case kb == kindOther:
+		return 0, queryError(CodeTypeMismatch, ErrInvalidQuery, "", "cannot order %T", b)
+	case ka != kb:
+		return cmp.Compare(ka, kb), nil
+	}
+
+	switch ka {
+	case kindBool:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0, nil
+		case !x:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	case kindNumber:
+		if (isDecimal(a) || isDecimal(b)) && !isFloat(a) && !isFloat(b) {
+			x, errX := toDecimal(a)
+			y, errY := toDecimal(b)
+			if errX == nil && errY == nil {
+				return compareDecimals(x, y), nil
+			}
+			return cmp.Compare(toFloat(a), toFloat(b)), nil
+		}
+		if isFloat(a) || isFloat(b) {
+			return cmp.Compare(toFloat(a), toFloat(b)), nil
+		}
+		return compareIntegers(a, b), nil
+	case kindString:
+		return strings.Compare(a.(string), b.(string)), nil
+	case kindTime:
+		return a.(time.Time).Compare(b.(time.Time)), nil
+	case kindArray:
+		x, y := a.([]interface{}), b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c, err := compareValues(x[i], y[i]); err != nil || c != 0 {
+				return c, err
+			}
+		}
+		return cmp.Compare(len(x), len(y)), nil
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), nil
+	}
+}
+
+// compareOrdered is compareValues for callers that only meet values it can
+// order, such as the values of one typed column. Should another value turn
+// up, values are compared by their text instead.
+func compareOrdered(a, b interface{}) int {
+	c, err := compareValues(a, b)
+
+	if err != nil {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+	return c
+}
+
+// compareIntegers compares two integers of any width or signedness
+// exactly.
+func compareIntegers(a, b interface{}) int {
+	x, xHuge := hugeUint(a)
+	y, yHuge := hugeUint(b)
+	switch {
+	case xHuge && yHuge:
+		return cmp.Compare(x, y)
+	case xHuge:
+		return 1
+	case yHuge:
+		return -1
+	}
+	return cmp.Compare(toInt64(a), toInt64(b))
+}
+
+// hugeUint reports whether v is an unsigned integer too large for int64,
+// and returns it if so.
+func hugeUint(v interface{}) (uint64, bool) {
+	var n uint64
+	switch u := v.(type) {
+	case uint:
+		n = uint64(u)
+	case uint64:
+		n = u
+	default:
+		return 0, false
+	}
+	return n, n > math.MaxInt64
+}
+
+const (
+	kindBool = iota
+	kindNumber
+	kindString
+	kindTime
+	kindArray
+	kindObject
+	kindOther
+)
+
+func valueKind(v interface{}) int {
+	switch v.(type) {
+	case bool:
+		return kindBool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, DecimalValue:
+		return kindNumber
+	case string:
+		return kindString
+	case time.Time:
+		return kindTime
+	case []interface{}:
+		return kindArray
+	case map[string]interface{}:
+		return kindObject
+	default:
+		return kindOther
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int16:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint8:
+		return float64(n)
+	case uint16:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case float64:
+		return n
+	case DecimalValue:
+		return n.Float64()
+	default:
+		return 0
+	}
+}
+
+// unexpectedInOrderBy reports the words rest left over at the end of term,
+// which starts at pos in the ORDER BY clause.
+func unexpectedInOrderBy(term string, pos int, rest []string) error {
+	extra := strings.Join(rest, " ")
+	return syntaxError(CodeSyntaxError, rest[0], pos+strings.Index(term, rest[0]), "unexpected %q in ORDER BY", extra)
+}
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderByNulls(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "scores", []Column{{Name: "score", DataType: Int, Nullable: true}}, nil)
+	for id, score := range map[string]interface{}{"a": 2, "b": nil, "c": 1, "d": nil, "e": 3} {
+		mustInsert(t, db, "scores", id, map[string]interface{}{"score": score})
+	}
+
+	tests := []struct {
+		orderBy string
+		want    []string
+	}{
+		{"score, id", []string{"c", "a", "e", "b", "d"}},
+		{"score ASC, id", []string{"c", "a", "e", "b", "d"}},
+		{"score DESC, id", []string{"b", "d", "e", "a", "c"}},
+		{"score ASC NULLS FIRST, id", []string{"b", "d", "c", "a", "e"}},
+		{"score ASC NULLS LAST, id", []string{"c", "a", "e", "b", "d"}},
+		{"score DESC NULLS FIRST, id", []string{"b", "d", "e", "a", "c"}},
+		{"score DESC NULLS LAST, id", []string{"e", "a", "c", "b", "d"}},
+		{"score desc nulls last, id", []string{"e", "a", "c", "b", "d"}},
+	}
+	for _, tt := range tests {
+		result := mustQuery(t, db, Query{Select: []string{"id"}, From: "scores", OrderBy: tt.orderBy})
+		if got := resultIDs(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ORDER BY %s = %v, want %v", tt.orderBy, got, tt.want)
+		}
+	}
+}
+
+func TestParseOrderByErrors(t *testing.T) {
+	for _, orderBy := range []string{
+		"score NULLS",
+		"score NULLS MIDDLE",
+		"score DESC FIRST",
+		"score, ",
+		"score COLLATE",
+		"score COLLATE KLINGON",
+	} {
+		if _, err := parseOrderBy(orderBy); err == nil {
+			t.Errorf("parseOrderBy(%q) succeeded", orderBy)
+		}
+	}
+}
+
+func TestCompareValuesOrder(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Each value sorts strictly before the next.
+	ordered := []interface{}{
+		nil,
+		false,
+		true,
+		math.NaN(),
+		math.Inf(-1),
+		int64(math.MinInt64),
+		-1.5,
+		int8(-1),
+		DecimalValue{Units: -5, Scale: 1},
+		0,
+		DecimalValue{Units: 1, Scale: 2},
+		float32(0.5),
+		uint8(1),
+		DecimalValue{Units: 1999, Scale: 2},
+		int64(math.MaxInt64),
+		uint64(math.MaxUint64),
+		math.Inf(1),
+		"",
+		"A",
+		"B",
+		"a",
+		"ab",
+		t1,
+		t1.Add(time.Nanosecond),
+		[]interface{}{},
+		[]interface{}{nil},
+		[]interface{}{1},
+		[]interface{}{1, "x"},
+		[]interface{}{2},
+		map[string]interface{}{"a": 1},
+		map[string]interface{}{"a": 2},
+		map[string]interface{}{"b": 0},
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			got, err := compareValues(a, b)
+			if err != nil {
+				t.Fatalf("compareValues(%#v, %#v): %v", a, b, err)
+			}
+			if want := cmp.Compare(i, j); got != want {
+				t.Errorf("compareValues(%#v, %#v) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestCompareValuesEqual(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range [][2]interface{}{
+		{2, int64(2)},
+		{uint32(2), int8(2)},
+		{2, 2.0},
+		{float32(2), 2.0},
+		{2, DecimalValue{Units: 200, Scale: 2}},
+		{DecimalValue{Units: 25, Scale: 1}, 2.5},
+		{DecimalValue{Units: 10, Scale: 1}, DecimalValue{Units: 1, Scale: 0}},
+		{t1, t1.In(time.FixedZone("X", 3600))},
+		{[]interface{}{1, "a"}, []interface{}{1.0, "a"}},
+		{map[string]interface{}{"a": 1, "b": 2}, map[string]interface{}{"b": 2, "a": 1}},
+	} {
+		if c, err := compareValues(tt[0], tt[1]); err != nil || c != 0 {
+			t.Errorf("compareValues(%#v, %#v) = %d, %v, want 0", tt[0], tt[1], c, err)
+		}
+	}
+}
+
+func TestCompareValuesUnorderable(t *testing.T) {
+	for _, tt := range [][2]interface{}{
+		{struct{}{}, 1},
+		{"a", []byte("a")},
+		{[]interface{}{1, struct{}{}}, []interface{}{1, struct{}{}}},
+	} {
+		if _, err := compareValues(tt[0], tt[1]); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("compareValues(%#v, %#v) = %v, want ErrInvalidQuery", tt[0], tt[1], err)
+		}
+	}
+	// NULL is ordered against anything, without looking at it.
+	if c, err := compareValues(nil, struct{}{}); err != nil || c != -1 {
+		t.Errorf("compareValues(nil, struct{}{}) = %d, %v, want -1", c, err)
+	}
+}
+
+// TestOrderingAgrees checks that ORDER BY, BETWEEN, MIN and MAX put the
+// same values in the same order.
+func TestOrderingAgrees(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "prices", []Column{{Name: "price", DataType: Float}}, nil)
+	for id, price := range map[string]interface{}{"a": 2.5, "b": -1.0, "c": 10.0, "d": 2.25, "e": 0.0} {
+		mustInsert(t, db, "prices", id, map[string]interface{}{"price": price})
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "prices", OrderBy: "price"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"b", "e", "d", "a", "c"}) {
+		t.Errorf("ORDER BY price = %v", got)
+	}
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "prices", Where: "price BETWEEN 0 AND 2.5", OrderBy: "price"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"e", "d", "a"}) {
+		t.Errorf("BETWEEN 0 AND 2.5 = %v", got)
+	}
+	result = mustQuery(t, db, Query{Select: []string{"MIN(price)", "MAX(price)"}, From: "prices"})
+	if row := result.Rows[0].Columns; toFloat(row["MIN(price)"]) != -1 || toFloat(row["MAX(price)"]) != 10 {
+		t.Errorf("MIN, MAX = %v", row)
+	}
+}
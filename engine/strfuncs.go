@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringFunc builds a one-argument string function.
+func stringFunc(name string, fn func(string) interface{}) scalarFunc {
+	return func(args []interface{}) (interface{}, error) {
+		if err := checkArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		s, ok, err := stringArg(name, args, 0)
+
+		if err != nil || !ok {
+			return nil, err
+		}
+		return fn(s), nil
+	}
+}
+
+// concat joins two or more values; non-string values are formatted as with
+// fmt. Any NULL argument makes the result NULL.
+func concat(args []interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("%w: CONCAT takes at least 2 arguments, got %d", ErrInvalidQuery, len(args))
+	}
+
+	var b strings.Builder
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			b.WriteString(v)
+		default:
+			fmt.Fprint(&b, v)
+		}
+	}
+	return b.String(), nil
+}
+
+// substring implements SUBSTRING(s, start, length) over characters, with
+// start counting from 1. A start past the end yields the empty string.
+func substring(args []interface{}) (interface{}, error) {
+	if err := checkArgs("SUBSTRING", args, 3); err != nil {
+		return nil, err
+	}
+
+	s, ok, err := stringArg("SUBSTRING", args, 0)
+
+	if err != nil || !ok || args[1] == nil || args[2] == nil {
+		return nil, err
+	}
+
+	if valueKind(args[1]) != kindNumber || valueKind(args[2]) != kindNumber || isFloat(args[1]) || isFloat(args[2]) {
+		return nil, fmt.Errorf("%w: SUBSTRING requires integer start and length", ErrInvalidQuery)
+	}
+
+	start, length := toInt64(args[1]), toInt64(args[2])
+	if length < 0 {
+		return nil, fmt.Errorf("%w: SUBSTRING length %d is negative", ErrInvalidQuery, length)
+	}
+
+	runes := []rune(s)
+	begin, end := start-1, start-1+length
+	if begin < 0 {
+		begin = 0
+	}
+	if end > int64(len(runes)) {
+		end = int64(len(runes))
+	}
+	if begin >= end {
+		return "", nil
+	}
+	return string(runes[begin:end]), nil
+}
+
+func replace(args []interface{}) (interface{}, error) {
+	if err := checkArgs("REPLACE", args, 3); err != nil {
+		return nil, err
+	}
+
+	parts := make([]string, 3)
+	for i := range parts {
+		s, ok, err := stringArg("REPLACE", args, i)
+
+		if err != nil || !ok {
+			return nil, err
+		}
+		parts[i] = s
+	}
+
+	return strings.ReplaceAll(parts[0], parts[1], parts[2]), nil
+}
+
+func length(s string) interface{} {
+	return int64(utf8.RuneCountInString(s))
+}
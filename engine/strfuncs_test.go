@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStringFunctions(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want interface{}
+	}{
+		{"UPPER", []interface{}{"Alice"}, "ALICE"},
+		{"UPPER", []interface{}{""}, ""},
+		{"LOWER", []interface{}{"ÀLICE"}, "àlice"},
+		{"TRIM", []interface{}{"  a b \t"}, "a b"},
+		{"LTRIM", []interface{}{"  a b  "}, "a b  "},
+		{"RTRIM", []interface{}{"  a b  "}, "  a b"},
+		{"TRIM", []interface{}{"   "}, ""},
+		{"LENGTH", []interface{}{"héllo"}, int64(5)},
+		{"LENGTH", []interface{}{""}, int64(0)},
+		{"CONCAT", []interface{}{"a", "b"}, "ab"},
+		{"CONCAT", []interface{}{"x", int64(1), "-", 2.5}, "x1-2.5"},
+		{"CONCAT", []interface{}{"", ""}, ""},
+		{"SUBSTRING", []interface{}{"hello", int64(2), int64(3)}, "ell"},
+		{"SUBSTRING", []interface{}{"hello", int64(1), int64(100)}, "hello"},
+		{"SUBSTRING", []interface{}{"hello", int64(6), int64(1)}, ""},
+		{"SUBSTRING", []interface{}{"hello", int64(99), int64(1)}, ""},
+		{"SUBSTRING", []interface{}{"hello", int64(1), int64(0)}, ""},
+		{"SUBSTRING", []interface{}{"héllo", int64(2), int64(2)}, "él"},
+		{"SUBSTRING", []interface{}{"", int64(1), int64(1)}, ""},
+		{"REPLACE", []interface{}{"a-b-c", "-", "+"}, "a+b+c"},
+		{"REPLACE", []interface{}{"aaa", "a", ""}, ""},
+		{"REPLACE", []interface{}{"abc", "x", "y"}, "abc"},
+	}
+	for _, tt := range tests {
+		got, err := callScalar(t, tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("%s%v: %v", tt.name, tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s%v = %#v, want %#v", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestStringFunctionsPropagateNull(t *testing.T) {
+	calls := map[string][]interface{}{
+		"UPPER":     {nil},
+		"LOWER":     {nil},
+		"TRIM":      {nil},
+		"LTRIM":     {nil},
+		"RTRIM":     {nil},
+		"LENGTH":    {nil},
+		"CONCAT":    {"a", nil},
+		"SUBSTRING": {nil, int64(1), int64(2)},
+		"REPLACE":   {"abc", nil, "x"},
+	}
+	for name, args := range calls {
+		got, err := callScalar(t, name, args...)
+		if err != nil || got != nil {
+			t.Errorf("%s%v = %#v, %v, want NULL", name, args, got, err)
+		}
+	}
+}
+
+func TestStringFunctionErrors(t *testing.T) {
+	calls := []struct {
+		name string
+		args []interface{}
+	}{
+		{"UPPER", []interface{}{int64(1)}},
+		{"CONCAT", []interface{}{"a"}},
+		{"SUBSTRING", []interface{}{"abc", 1.5, int64(1)}},
+		{"SUBSTRING", []interface{}{"abc", int64(1), int64(-1)}},
+		{"REPLACE", []interface{}{"abc", "a"}},
+	}
+	for _, c := range calls {
+		if _, err := callScalar(t, c.name, c.args...); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s%v = %v, want ErrInvalidQuery", c.name, c.args, err)
+		}
+	}
+}
+
+func TestStringFunctionsInQuery(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "people", []Column{{Name: "name", DataType: String, Nullable: true}}, nil)
+	mustInsert(t, db, "people", "1", map[string]interface{}{"name": "alice"})
+	mustInsert(t, db, "people", "2", map[string]interface{}{"name": " Bob "})
+	mustInsert(t, db, "people", "3", map[string]interface{}{"name": nil})
+
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: "UPPER(name) = 'ALICE'"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"1"}) {
+		t.Errorf("UPPER(name) = 'ALICE' matched %v, want [1]", ids)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "people", Where: "LENGTH(TRIM(name)) = 3"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"2"}) {
+		t.Errorf("LENGTH(TRIM(name)) = 3 matched %v, want [2]", ids)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id", "CONCAT(SUBSTRING(name, 1, 1), '.')"}, From: "people", OrderBy: "id"})
+	column := result.Columns[1]
+	var got []interface{}
+	for _, row := range result.Rows {
+		got = append(got, row.Columns[column])
+	}
+	if want := []interface{}{"a.", " .", nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CONCAT(SUBSTRING(name, 1, 1), '.') = %#v, want %#v", got, want)
+	}
+}
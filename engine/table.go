@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type kvStore struct {
+	rows map[string]Row
+
+	mu     sync.Mutex
+	sorted []Row
+}
+
+func newKVStore(rows []Row) *kvStore {
+	s := &kvStore{rows: make(map[string]Row, len(rows))}
+	for _, row := range rows {
+		s.rows[rowID(row)] = row
+	}
+	return s
+}
+
+// ordered materializes the rows sorted by id. The result is cached until the
+// next write, and may be built concurrently by readers holding the
+// database's read lock.
+func (s *kvStore) ordered() []Row {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sorted == nil {
+		s.sorted = make([]Row, 0, len(s.rows))
+		for _, row := range s.rows {
+			s.sorted = append(s.sorted, row)
+		}
+		sort.Slice(s.sorted, func(i, j int) bool {
+			return rowID(s.sorted[i]) < rowID(s.sorted[j])
+		})
+	}
+	return s.sorted
+}
+
+func (s *kvStore) invalidate() {
+	s.mu.Lock()
+	s.sorted = nil
+	s.mu.Unlock()
+}
+
+// writeSeq numbers table changes across all tables and databases, so that
+// a table's writes stamp identifies its contents even across a drop and
+// re-create.
+var writeSeq atomic.Uint64
+
+// touch records that the table's rows, or how they are read, changed.
+func (t *Table) touch() {
+	t.writes = writeSeq.Add(1)
+}
+
+// touchSchema records that the table's columns or indexes changed, so
+// prepared plans reading it must be rebuilt.
+func (t *Table) touchSchema() {
+	t.schema = writeSeq.Add(1)
+	t.touch()
+}
+
+func (t *Table) getRow(id string) (Row, bool) {
+	if t.kv != nil {
+		row, ok := t.kv.rows[id]
+		return row, ok
+	}
+
+	if t.ids != nil {
+		if i, ok := t.ids[id]; ok {
+			return t.Rows[i], true
+		}
+		return Row{}, false
+	}
+
+	for _, row := range t.Rows {
+		if rowID(row) == id {
+			return row, true
+		}
+	}
+	return Row{}, false
+}
+
+func (t *Table) allRows() []Row {
+	if t.kv != nil {
+		return t.kv.ordered()
+	}
+	return t.Rows
+}
+
+func (t *Table) rowCount() int {
+	if t.kv != nil {
+		return len(t.kv.rows)
+	}
+	return len(t.Rows)
+}
+
+// putRow inserts row, or replaces the stored row with the same id, keeping
+// the indexes in step, and returns the row as stored: with Version one past
+// the replaced row's, or 1. Callers must have called ensureIndexes.
+func (t *Table) putRow(row Row) Row {
+	id := rowID(row)
+	if row.Columns[expiresAtColumn] != nil {
+		t.HasExpiry = true
+	}
+	row.Version = 1
+	if old, ok := t.getRow(id); ok {
+		t.unindexRow(old)
+		t.sizeBytes -= rowSize(old)
+		row.Version = old.Version + 1
+	}
+	t.indexRow(row)
+	t.sizeBytes += rowSize(row)
+	t.touch()
+
+	if t.kv != nil {
+		t.kv.rows[id] = row
+		t.kv.invalidate()
+		return row
+	}
+
+	if i, ok := t.ids[id]; ok {
+		t.Rows[i] = row
+		return row
+	}
+	t.Rows = append(t.Rows, row)
+	t.ids[id] = len(t.Rows) - 1
+	return row
+}
+
+func (t *Table) deleteRow(id string) {
+	old, ok := t.getRow(id)
+	if !ok {
+		return
+	}
+	t.unindexRow(old)
+	t.sizeBytes -= rowSize(old)
+	t.garbageBytes += rowSize(old)
+	t.deletedRows++
+	t.touch()
+
+	if t.kv != nil {
+		delete(t.kv.rows, id)
+		t.kv.invalidate()
+		return
+	}
+
+	pos := t.ids[id]
+	delete(t.ids, id)
+	t.Rows = append(t.Rows[:pos], t.Rows[pos+1:]...)
+	for i := pos; i < len(t.Rows); i++ {
+		t.ids[rowID(t.Rows[i])] = i
+	}
+}
+
+// deleteRows deletes every row for which remove returns true, in one pass
+// over the rows, and rebuilds the indexes once rather than per row. It
+// returns the deleted rows in scan order. Callers must have called
+// ensureIndexes.
+func (t *Table) deleteRows(remove func(Row) bool) []Row {
+	var removed []Row
+	if t.kv != nil {
+		for _, row := range t.kv.ordered() {
+			if remove(row) {
+				removed = append(removed, row)
+			}
+		}
+		for _, row := range removed {
+			delete(t.kv.rows, rowID(row))
+		}
+		t.kv.invalidate()
+	} else {
+		kept := t.Rows[:0]
+		for _, row := range t.Rows {
+			if remove(row) {
+				removed = append(removed, row)
+			} else {
+				kept = append(kept, row)
+			}
+		}
+		t.Rows = kept
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	for _, row := range removed {
+		t.garbageBytes += rowSize(row)
+	}
+	t.deletedRows += len(removed)
+	t.rebuildIndexes()
+	return removed
+}
+
+// cloneStorage returns a copy of the table whose row storage can be modified
+// without affecting t. Indexes are not copied; call rebuildIndexes.
+func (t Table) cloneStorage() Table {
+	clone := t
+	if t.kv != nil {
+		clone.kv = newKVStore(t.kv.ordered())
+		return clone
+	}
+	clone.Rows = append([]Row(nil), t.Rows...)
+	return clone
+}
+
+func (t *Table) appendRows(rows []Row) {
+	for _, row := range rows {
+		if row.Columns[expiresAtColumn] != nil {
+			t.HasExpiry = true
+		}
+		t.sizeBytes += rowSize(row)
+	}
+	t.touch()
+
+	if t.kv != nil {
+		for _, row := range rows {
+			t.kv.rows[rowID(row)] = row
+		}
+		t.kv.invalidate()
+		return
+	}
+	t.Rows = append(t.Rows, rows...)
+}
+
+// getLiveRow is getRow for rows visible to reads: soft-deleted and expired
+// rows are not.
+func (t *Table) getLiveRow(id string) (Row, bool) {
+	row, ok := t.getRow(id)
+	if !ok || !t.visible(row, time.Now(), false) {
+		return Row{}, false
+	}
+	return row, true
+}
+
+// scanRows returns the rows a query sees, in scan order (see Query).
+// Expired rows are never returned; soft-deleted rows only with
+// includeDeleted.
+func (t *Table) scanRows(includeDeleted bool) []Row {
+	if (!t.SoftDelete || includeDeleted) && !t.HasExpiry {
+		return t.allRows()
+	}
+
+	now := time.Now()
+	var rows []Row
+	for _, row := range t.allRows() {
+		if t.visible(row, now, includeDeleted) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func (t *Table) liveCount() int {
+	if !t.SoftDelete && !t.HasExpiry {
+		return t.rowCount()
+	}
+	return len(t.scanRows(false))
+}
+
+func (t *Table) visible(row Row, now time.Time, includeDeleted bool) bool {
+	if t.SoftDelete && !includeDeleted && isDeleted(row) {
+		return false
+	}
+	return !t.HasExpiry || !isExpired(row, now)
+}
+
+// revivable reports whether an insert may replace existing.
+func (t *Table) revivable(existing Row) bool {
+	if t.HasExpiry && isExpired(existing, time.Now()) {
+		return true
+	}
+	return t.SoftDelete && t.ReviveDeleted && isDeleted(existing)
+}
+
+func rowID(row Row) string {
+	id, _ := row.Columns["id"].(string)
+	return id
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newStorageDBs returns two databases holding the same "items" table, one
+// kept in SliceStorage and one in KeyValueStorage.
+func newStorageDBs(t testing.TB, rows int) (slice, kv *NewDatabase) {
+	t.Helper()
+	columns := []Column{
+		{Name: "name", DataType: String},
+		{Name: "n", DataType: Int},
+	}
+	indexes := []Index{{Name: "by_n", Columns: []string{"n"}}}
+
+	slice, kv = newTestDB(t), newTestDB(t)
+	if err := slice.CreateTableWithOptions("items", columns, indexes, TableOptions{Storage: SliceStorage}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.CreateTableWithOptions("items", columns, indexes, TableOptions{Storage: KeyValueStorage}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < rows; i++ {
+		data := map[string]interface{}{"name": fmt.Sprintf("item-%d", i%7), "n": i % 10}
+		id := fmt.Sprintf("r%05d", i)
+		mustInsert(t, slice, "items", id, data)
+		mustInsert(t, kv, "items", id, data)
+	}
+	return slice, kv
+}
+
+func TestKeyValueStorageMatchesSlice(t *testing.T) {
+	slice, kv := newStorageDBs(t, 200)
+
+	for _, db := range []*NewDatabase{slice, kv} {
+		if err := db.UpdateRow("items", "r00003", map[string]interface{}{"n": 42}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.DeleteRow("items", "r00010"); err != nil {
+			t.Fatal(err)
+		}
+		mustInsert(t, db, "items", "r99999", map[string]interface{}{"name": "late", "n": 5})
+	}
+
+	queries := []Query{
+		{Select: []string{"id", "name", "n"}, From: "items", OrderBy: "id"},
+		{Select: []string{"id", "n"}, From: "items", Where: "n = 5", OrderBy: "id"},
+		{Select: []string{"id"}, From: "items", Where: "n > 7 AND name != 'item-1'", OrderBy: "n DESC, id"},
+		{Select: []string{"id", "name"}, From: "items", OrderBy: "name, id", Limit: 10, Offset: 5},
+		{Select: []string{"COUNT(*)"}, From: "items", Where: "n = 42"},
+	}
+	for _, query := range queries {
+		want := mustQuery(t, slice, query)
+		got := mustQuery(t, kv, query)
+		if !reflect.DeepEqual(got.Rows, want.Rows) {
+			t.Errorf("%+v:\nKeyValueStorage %v\nSliceStorage    %v", query, got.Rows, want.Rows)
+		}
+	}
+}
+
+func TestKeyValueStoragePointOperations(t *testing.T) {
+	_, kv := newStorageDBs(t, 10)
+
+	row, err := kv.GetRowByID("items", "r00004")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toInt64(row.Columns["n"]) != 4 {
+		t.Errorf("GetRowByID(r00004) n = %v, want 4", row.Columns["n"])
+	}
+
+	if err := kv.InsertRow("items", "r00004", map[string]interface{}{"name": "dup", "n": 1}); err == nil {
+		t.Error("inserting a duplicate id succeeded")
+	}
+	if err := kv.DeleteRow("items", "r00004"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.GetRowByID("items", "r00004"); err == nil {
+		t.Error("GetRowByID found a deleted row")
+	}
+
+	rows, err := kv.GetAllRows("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.Columns["id"].(string)
+	}
+	if len(ids) != 9 || !sort.StringsAreSorted(ids) {
+		t.Errorf("GetAllRows ids = %v, want 9 ids in order", ids)
+	}
+}
+
+func benchmarkPointLookup(b *testing.B, storage StorageEngine) {
+	const rows = 10000
+	db := newTestDB(b)
+	if err := db.CreateTableWithOptions("items", []Column{{Name: "n", DataType: Int}}, nil, TableOptions{Storage: storage}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		mustInsert(b, db, "items", fmt.Sprintf("r%05d", i), map[string]interface{}{"n": i})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.GetRowByID("items", fmt.Sprintf("r%05d", i%rows)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPointLookupSlice(b *testing.B)    { benchmarkPointLookup(b, SliceStorage) }
+func BenchmarkPointLookupKeyValue(b *testing.B) { benchmarkPointLookup(b, KeyValueStorage) }
+
+// TestScanOrderIsStable checks that a query without ORDER BY returns rows
+// in the documented scan order, the same every time it is run.
+func TestScanOrderIsStable(t *testing.T) {
+	ids := []string{"m", "c", "x", "a", "q", "f"}
+	for _, storage := range []StorageEngine{SliceStorage, KeyValueStorage} {
+		db := newTestDB(t)
+		if err := db.CreateTableWithOptions("items", []Column{{Name: "n", DataType: Int}}, nil, TableOptions{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+		for i, id := range ids {
+			mustInsert(t, db, "items", id, map[string]interface{}{"n": i})
+		}
+		if err := db.UpdateRow("items", "c", map[string]interface{}{"n": 100}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := ids
+		if storage == KeyValueStorage {
+			want = append([]string(nil), ids...)
+			sort.Strings(want)
+		}
+
+		query := Query{Select: []string{"id"}, From: "items", Where: "n >= 0", NoCache: true}
+		for i := 0; i < 20; i++ {
+			if got := resultIDs(mustQuery(t, db, query)); !reflect.DeepEqual(got, want) {
+				t.Fatalf("storage %d, run %d: scan order %v, want %v", storage, i, got, want)
+			}
+		}
+	}
+}
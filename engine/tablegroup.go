@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CreateTableGroup makes the existing tables a table group called name,
+// whose schema changes AlterTableGroup and DropTableGroup apply to all of
+// them or none. A table belongs to at most one group, and leaves it when
+// it is dropped. Like views, table groups are not saved to disk.
+func (db *NewDatabase) CreateTableGroup(name string, tables []string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if name == "" || len(tables) == 0 {
+		return fmt.Errorf("%w: a table group needs a name and at least one table", ErrInvalidSchema)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.tableGroups[name] != nil {
+		return fmt.Errorf("%w: %s", ErrTableGroupExists, name)
+	}
+
+	members := make([]string, 0, len(tables))
+	seen := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		if _, ok := db.Tables[table]; !ok {
+			return fmt.Errorf("%w: %s", ErrTableNotFound, table)
+		}
+		if group := db.tableGroupOf(table); group != "" {
+			return fmt.Errorf("%w: table %s is already in table group %s", ErrInvalidSchema, table, group)
+		}
+		if !seen[table] {
+			seen[table] = true
+			members = append(members, table)
+		}
+	}
+	sort.Strings(members)
+
+	if db.tableGroups == nil {
+		db.tableGroups = make(map[string][]string)
+	}
+	db.tableGroups[name] = members
+	return nil
+}
+
+// AlterTableGroup applies ops, one AlterOp per member table of the group
+// groupName, under a single write lock. Each is applied as AlterColumn
+// would, in order of table name, and sees the tables altered before it.
+// If any fails, every table is left unchanged.
+func (db *NewDatabase) AlterTableGroup(groupName string, ops map[string]AlterOp) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	members := db.tableGroups[groupName]
+
+	if members == nil {
+		return fmt.Errorf("%w: %s", ErrTableGroupNotFound, groupName)
+	}
+
+	tables := make([]string, 0, len(ops))
+	for table := range ops {
+		if !groupHas(members, table) {
+			return fmt.Errorf("%w: table %s is not in table group %s", ErrInvalidSchema, table, groupName)
+		}
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	originals := make(map[string]Table, len(tables))
+	for _, table := range tables {
+		altered, err := db.alteredTable(table, ops[table])
+
+		if err != nil {
+			for name, original := range originals {
+				db.Tables[name] = original
+			}
+			return fmt.Errorf("table group %s: %w", groupName, err)
+		}
+		originals[table] = db.Tables[table]
+		db.Tables[table] = altered
+	}
+
+	for _, table := range tables {
+		db.replicateTable(table)
+	}
+	return nil
+}
+
+// DropTableGroup drops every member table of the group name, and the
+// group. It drops none of them if DropTable would refuse to drop one: if a
+// table outside the group has a foreign key that references a member, or
+// a view reads one.
+func (db *NewDatabase) DropTableGroup(name string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	members := db.tableGroups[name]
+
+	if members == nil {
+		return fmt.Errorf("%w: %s", ErrTableGroupNotFound, name)
+	}
+
+	for _, table := range members {
+		for _, ref := range db.referencesTo(table) {
+			if owner, _, _ := strings.Cut(ref, "."); !groupHas(members, owner) {
+				return fmt.Errorf("%w: table %s is referenced by %s", ErrForeignKey, table, ref)
+			}
+		}
+		if views := db.viewsOn(table); len(views) > 0 {
+			return fmt.Errorf("%w: table %s is read by views %s", ErrViewDependency, table, strings.Join(views, ", "))
+		}
+	}
+
+	for _, table := range members {
+		db.dropTableLocked(table)
+	}
+	delete(db.tableGroups, name)
+	return nil
+}
+
+// tableGroupOf returns the name of the table group tableName is in, or ""
+// if it is in none. The caller must hold db.mu.
+func (db *NewDatabase) tableGroupOf(tableName string) string {
+	for name, members := range db.tableGroups {
+		if groupHas(members, tableName) {
+			return name
+		}
+	}
+	return ""
+}
+
+// leaveTableGroup removes tableName from its table group, dropping the
+// group if it was the last member. The caller must hold db.mu for writing.
+func (db *NewDatabase) leaveTableGroup(tableName string) {
+	name := db.tableGroupOf(tableName)
+	if name == "" {
+		return
+	}
+
+	var members []string
+	for _, member := range db.tableGroups[name] {
+		if member != tableName {
+			members = append(members, member)
+		}
+	}
+	if len(members) == 0 {
+		delete(db.tableGroups, name)
+		return
+	}
+	db.tableGroups[name] = members
+}
+
+func groupHas(members []string, tableName string) bool {
+	i := sort.SearchStrings(members, tableName)
+	return i < len(members) && members[i] == tableName
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// tableGroupTestDB returns usersOrdersTestDB's tables, with a row each, as
+// the table group shop.
+func tableGroupTestDB(t *testing.T) *NewDatabase {
+	t.Helper()
+	db := usersOrdersTestDB(t, false)
+	mustInsert(t, db, "users", "u1", map[string]interface{}{"name": "Ann", "age": 30})
+	mustInsert(t, db, "orders", "o1", map[string]interface{}{"user_id": "u1", "total": 10})
+	if err := db.CreateTableGroup("shop", []string{"users", "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAlterTableGroup(t *testing.T) {
+	db := tableGroupTestDB(t)
+
+	err := db.AlterTableGroup("shop", map[string]AlterOp{
+		"orders": {Column: "total", NewType: Float},
+		"users":  {Column: "age", NewType: Float},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for table, column := range map[string]string{"orders": "total", "users": "age"} {
+		schema, err := db.DescribeTable(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, col := range schema.Columns {
+			if col.Name == column && col.DataType != Float {
+				t.Errorf("%s.%s is %v, want Float", table, column, col.DataType)
+			}
+		}
+	}
+
+	if err := db.AlterTableGroup("nope", nil); !errors.Is(err, ErrTableGroupNotFound) {
+		t.Errorf("AlterTableGroup(nope) = %v, want ErrTableGroupNotFound", err)
+	}
+}
+
+func TestAlterTableGroupRollsBack(t *testing.T) {
+	db := tableGroupTestDB(t)
+
+	// orders is altered first and succeeds; users then fails.
+	err := db.AlterTableGroup("shop", map[string]AlterOp{
+		"orders": {Column: "total", NewType: String},
+		"users": {Column: "age", NewType: String, Migrate: func(interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("no")
+		}},
+	})
+	if err == nil {
+		t.Fatal("AlterTableGroup with a failing migration succeeded")
+	}
+
+	schema, err := db.DescribeTable("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range schema.Columns {
+		if col.Name == "total" && col.DataType != Int {
+			t.Fatalf("orders.total is %v after a failed AlterTableGroup, want Int", col.DataType)
+		}
+	}
+	row, err := db.GetRowByID("orders", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total, ok := row.Columns["total"].(int); !ok || total != 10 {
+		t.Errorf("orders.total of o1 = %#v, want 10", row.Columns["total"])
+	}
+	mustInsert(t, db, "orders", "o2", map[string]interface{}{"user_id": "u1", "total": 20})
+}
+
+func TestDropTableGroup(t *testing.T) {
+	t.Run("foreign key within the group", func(t *testing.T) {
+		db := fkTestDB(t)
+		if err := db.CreateTableGroup("shop", []string{"customers", "orders"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.DropTableGroup("shop"); err != nil {
+			t.Fatal(err)
+		}
+		if db.TableExists("customers") || db.TableExists("orders") {
+			t.Fatal("DropTableGroup left a member table")
+		}
+		if err := db.DropTableGroup("shop"); !errors.Is(err, ErrTableGroupNotFound) {
+			t.Errorf("second DropTableGroup = %v, want ErrTableGroupNotFound", err)
+		}
+	})
+
+	t.Run("foreign key from outside the group", func(t *testing.T) {
+		db := fkTestDB(t)
+		mustCreateTable(t, db, "notes", []Column{{Name: "text", DataType: String}}, nil)
+		if err := db.CreateTableGroup("shop", []string{"customers", "notes"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.DropTableGroup("shop"); !errors.Is(err, ErrForeignKey) {
+			t.Fatalf("DropTableGroup = %v, want ErrForeignKey", err)
+		}
+		if !db.TableExists("customers") || !db.TableExists("notes") {
+			t.Fatal("a refused DropTableGroup dropped a member table")
+		}
+	})
+
+	t.Run("view on a member", func(t *testing.T) {
+		db := tableGroupTestDB(t)
+		if err := db.CreateView("big", Query{Select: []string{"id"}, From: "orders", Where: "total > 5"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.DropTableGroup("shop"); !errors.Is(err, ErrViewDependency) {
+			t.Fatalf("DropTableGroup = %v, want ErrViewDependency", err)
+		}
+		if !db.TableExists("users") || !db.TableExists("orders") {
+			t.Fatal("a refused DropTableGroup dropped a member table")
+		}
+		mustQuery(t, db, Query{Select: []string{"id"}, From: "big"})
+	})
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithTableLock runs fn with the database write lock held, so that what fn
+// reads through its TableHandle cannot change before it writes: a check
+// then insert, say, is atomic. The database has a single lock, so every
+// other table is locked too and fn must not call methods of db, which
+// would deadlock; it should be quick.
+//
+// Writes through the handle run hooks, constraint checks and auditing as
+// UpdateRow and the rest do, are applied at once even on a buffered table,
+// and fail with ErrLockTimeout rather than wait for a row another caller
+// has locked. A write that fails leaves the table as it was, but writes
+// made before it are kept whatever fn returns.
+func (db *NewDatabase) WithTableLock(tableName string, fn func(tx TableHandle) error) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok || db.matViews[tableName] != nil {
+		return db.notWritable(tableName)
+	}
+	table.ensureIndexes()
+	db.Tables[tableName] = table
+
+	return fn(TableHandle{db: db, table: tableName})
+}
+
+// Get returns the row with the given id, as GetRowByID does.
+func (h TableHandle) Get(id string) (Row, error) {
+	table := h.db.Tables[h.table]
+
+	if row, ok := table.getLiveRow(id); ok {
+		row, err := h.db.openRow(&table, row)
+
+		if err != nil {
+			return Row{}, err
+		}
+		return transformRows(h.db.readTransform(context.Background(), &table), []Row{row})[0], nil
+	}
+	return Row{}, fmt.Errorf("%w: %s in table %s", ErrIDNotFound, id, h.table)
+}
+
+// Exists reports whether the table has a row with the given id.
+func (h TableHandle) Exists(id string) bool {
+	table := h.db.Tables[h.table]
+	_, ok := table.getLiveRow(id)
+	return ok
+}
+
+// Rows returns every row of the table, as GetAllRows does.
+func (h TableHandle) Rows() []Row {
+	table := h.db.Tables[h.table]
+	return transformRows(h.db.readTransform(context.Background(), &table), table.scanRows(false))
+}
+
+// Count returns the number of rows in the table.
+func (h TableHandle) Count() int {
+	table := h.db.Tables[h.table]
+	return table.liveCount()
+}
+
+func (h TableHandle) Insert(id string, data map[string]interface{}) error {
+	return h.write(PendingOperation{Op: ChangeInsert, TableName: h.table, RowID: id, Data: data})
+}
+
+func (h TableHandle) Update(id string, newData map[string]interface{}) error {
+	return h.write(PendingOperation{Op: ChangeUpdate, TableName: h.table, RowID: id, Data: newData})
+}
+
+func (h TableHandle) Delete(id string) error {
+	return h.write(PendingOperation{Op: ChangeDelete, TableName: h.table, RowID: id})
+}
+
+func (h TableHandle) write(op PendingOperation) error {
+	db := h.db
+
+	if op.Op != ChangeInsert {
+		unlock, ok := db.tryAcquireRowLock(op.TableName, op.RowID)
+		if !ok {
+			return queryError(CodeWriteConflict, ErrLockTimeout, op.RowID, "row %s in table %s", op.RowID, op.TableName)
+		}
+		defer unlock()
+	}
+
+	table := db.Tables[op.TableName]
+	change, err := db.applyOp(&table, op, true, true, map[string]*Table{op.TableName: &table})
+
+	if err != nil {
+		return err
+	}
+
+	db.Tables[op.TableName] = table
+	db.publishApplied(change)
+	db.compactIfNeeded(op.TableName)
+
+	return db.runHooks(HookAfter, change.hookContext())
+}
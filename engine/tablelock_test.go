@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestWithTableLockCheckThenInsert(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "seats", []Column{{Name: "holder", DataType: String}}, nil)
+
+	// 50 callers each take a seat if fewer than 10 are taken. Without the
+	// lock held from the check to the insert, more than 10 would.
+	const seats = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- db.WithTableLock("seats", func(tx TableHandle) error {
+				if tx.Count() >= seats {
+					return nil
+				}
+				return tx.Insert(fmt.Sprintf("seat%d", tx.Count()), map[string]interface{}{"holder": fmt.Sprint(i)})
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := db.GetAllRows("seats")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != seats {
+		t.Errorf("%d seats taken, want %d", len(rows), seats)
+	}
+}
+
+func TestWithTableLockHandle(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "n", DataType: Int}}, nil)
+	mustInsert(t, db, "items", "a", map[string]interface{}{"n": 1})
+
+	err := db.WithTableLock("items", func(tx TableHandle) error {
+		row, err := tx.Get("a")
+
+		if err != nil {
+			return err
+		}
+		if err := tx.Update("a", map[string]interface{}{"n": toInt64(row.Columns["n"]) + 1}); err != nil {
+			return err
+		}
+		if err := tx.Insert("b", map[string]interface{}{"n": 5}); err != nil {
+			return err
+		}
+		if err := tx.Insert("b", map[string]interface{}{"n": 6}); !errors.Is(err, ErrIDExists) {
+			t.Errorf("duplicate Insert = %v, want ErrIDExists", err)
+		}
+		if err := tx.Delete("a"); err != nil {
+			return err
+		}
+		if tx.Exists("a") || !tx.Exists("b") || tx.Count() != 1 || len(tx.Rows()) != 1 {
+			t.Error("handle does not see its own writes")
+		}
+		if _, err := tx.Get("a"); !errors.Is(err, ErrIDNotFound) {
+			t.Errorf("Get of a deleted row = %v, want ErrIDNotFound", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := resultIDs(mustQuery(t, db, Query{Select: []string{"id"}, From: "items"})); len(got) != 1 || got[0] != "b" {
+		t.Errorf("after WithTableLock rows are %v, want [b]", got)
+	}
+
+	// fn's error is returned, but the writes made before it are kept.
+	errStop := errors.New("stop")
+	err = db.WithTableLock("items", func(tx TableHandle) error {
+		if err := tx.Insert("c", map[string]interface{}{"n": 3}); err != nil {
+			return err
+		}
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("WithTableLock = %v, want fn's error", err)
+	}
+	if exists, _ := db.RowExists("items", "c"); !exists {
+		t.Error("write before fn's error was undone")
+	}
+
+	if err := db.WithTableLock("missing", func(TableHandle) error { return nil }); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("WithTableLock(missing) = %v, want ErrTableNotFound", err)
+	}
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// checkpointRows is how many rows a query stage processes between checks
+// for cancellation.
+const checkpointRows = 1024
+
+// SetQueryTimeout limits how long ExecuteQuery and ExecuteQueryContext may
+// run; queries that take longer fail with ErrQueryTimeout. Zero, the
+// default, means no limit.
+func (db *NewDatabase) SetQueryTimeout(d time.Duration) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.queryTimeout = d
+}
+
+func (db *NewDatabase) QueryTimeout() time.Duration {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.queryTimeout
+}
+
+// queryCheckpoint reports whether the query running under ctx must stop.
+// Stages call it with the index of each row they process; it only looks
+// at ctx every checkpointRows rows.
+func queryCheckpoint(ctx context.Context, i int) error {
+	if i%checkpointRows != 0 {
+		return nil
+	}
+
+	switch err := ctx.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return queryError(CodeQueryTimeout, ErrQueryTimeout, "", "%v", err)
+	default:
+		return err
+	}
+}
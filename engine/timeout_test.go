@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "big", []Column{{Name: "n", DataType: Int}}, nil)
+	rows := make([]Row, 100000)
+	for i := range rows {
+		rows[i] = Row{Columns: map[string]interface{}{"id": fmt.Sprint(i), "n": i}}
+	}
+	if err := db.BulkLoad("big", rows); err != nil {
+		t.Fatal(err)
+	}
+	query := Query{Select: []string{"id"}, From: "big", Where: "n % 7 = 3", NoCache: true}
+
+	db.SetQueryTimeout(time.Nanosecond)
+	_, err := db.ExecuteQuery(query)
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("ExecuteQuery with a 1ns timeout = %v, want ErrQueryTimeout", err)
+	}
+	var qe *QueryError
+	if !errors.As(err, &qe) || qe.Code != CodeQueryTimeout {
+		t.Errorf("error %v is not a QueryError with CodeQueryTimeout", err)
+	}
+
+	db.SetQueryTimeout(0)
+	result, err := db.ExecuteQuery(query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery without a timeout: %v", err)
+	}
+	if len(result.Rows) != 14286 {
+		t.Fatalf("got %d rows, want 14286", len(result.Rows))
+	}
+}
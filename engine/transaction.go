@@ -0,0 +1,733 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultOpCost estimates the cost of one pending operation at commit before
+// any transaction has been committed.
+const defaultOpCost = 5 * time.Microsecond
+
+type appliedChange struct {
+	op        ChangeOp
+	tableName string
+	id        string
+	oldRow    Row
+	newRow    Row
+	txID      int64
+}
+
+func (db *NewDatabase) InsertRowTx(tx *Transaction, tableName, id string, data map[string]interface{}) error {
+	return db.bufferOp(tx, PendingOperation{Op: ChangeInsert, TableName: tableName, RowID: id, Data: data})
+}
+
+func (db *NewDatabase) UpdateRowTx(tx *Transaction, tableName, id string, newData map[string]interface{}) error {
+	return db.bufferOp(tx, PendingOperation{Op: ChangeUpdate, TableName: tableName, RowID: id, Data: newData})
+}
+
+func (db *NewDatabase) DeleteRowTx(tx *Transaction, tableName, id string) error {
+	return db.bufferOp(tx, PendingOperation{Op: ChangeDelete, TableName: tableName, RowID: id})
+}
+
+// bufferOp queues op on the transaction. Unless constraints are deferred,
+// op is first checked by checkBuffered so that it is rejected immediately
+// if it would fail at commit.
+func (db *NewDatabase) bufferOp(tx *Transaction, op PendingOperation) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if tx.Status != Pending {
+		return ErrTransactionFailed
+	}
+
+	data := make(map[string]interface{}, len(op.Data))
+	for key, value := range op.Data {
+		data[key] = value
+	}
+	op.Data = data
+	op.Actor = tx.Options.Actor
+	op.txID = int64(tx.ID)
+
+	if tx.Options.DeferConstraints {
+		db.txMu.Lock()
+		tx.PendingOps = append(tx.PendingOps, op)
+		db.txMu.Unlock()
+		return nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	if err := db.checkBuffered(tx, op); err != nil {
+		return err
+	}
+	tx.PendingOps = append(tx.PendingOps, op)
+	return nil
+}
+
+// checkBuffered checks op, about to be buffered on tx, against the tables
+// as tx's earlier writes leave them, and records in tx.pending the row op
+// leaves. Only the rows op reads are looked at and no table is copied, so
+// the check does not grow with the tables; commit replays the writes in
+// full. Before hooks are left to the commit, and so are memory limits but
+// for the growth of op itself. The caller must hold db.mu and db.txMu.
+func (db *NewDatabase) checkBuffered(tx *Transaction, op PendingOperation) error {
+	stored, ok := db.Tables[op.TableName]
+	if !ok || db.matViews[op.TableName] != nil {
+		return db.notWritable(op.TableName)
+	}
+	stored.ensureIndexes()
+	db.Tables[op.TableName] = stored
+	table := &stored
+
+	if tx.pending == nil {
+		tx.pending = make(map[string]map[string]Row)
+	}
+	own := tx.pending[op.TableName]
+	if own == nil {
+		own = make(map[string]Row)
+		tx.pending[op.TableName] = own
+	}
+	prev, replaced := own[op.RowID]
+
+	current, exists := prev, replaced && prev.Columns != nil
+	if !replaced {
+		if current, exists = table.getLiveRow(op.RowID); exists {
+			var err error
+			if current, err = db.openRow(table, current); err != nil {
+				return err
+			}
+		}
+	}
+
+	change := appliedChange{op: op.Op, tableName: op.TableName, id: op.RowID, txID: op.txID}
+	switch op.Op {
+	case ChangeInsert:
+		if replaced {
+			exists = exists || (table.SoftDelete && !table.ReviveDeleted)
+		} else if existing, found := table.getRow(op.RowID); found {
+			exists = !table.revivable(existing)
+		}
+		if exists {
+			return fmt.Errorf("%w: %s in table %s", ErrIDExists, op.RowID, op.TableName)
+		}
+		change.newRow = Row{Columns: make(map[string]interface{}, len(op.Data)+1)}
+		for key, value := range op.Data {
+			change.newRow.Columns[key] = value
+		}
+		change.newRow.Columns["id"] = op.RowID
+		if err := table.applyDefaults(change.newRow); err != nil {
+			return err
+		}
+	case ChangeUpdate:
+		if !exists {
+			return fmt.Errorf("%w: %s in table %s", ErrIDNotFound, op.RowID, op.TableName)
+		}
+		if newID, ok := op.Data["id"]; ok && newID != op.RowID {
+			return fmt.Errorf("%w: cannot change id of row %s", ErrInvalidQuery, op.RowID)
+		}
+		change.oldRow = current
+		change.newRow = copyRow(current)
+		for key, value := range op.Data {
+			change.newRow.Columns[key] = value
+		}
+	case ChangeDelete:
+		if !exists {
+			return fmt.Errorf("%w: %s in table %s", ErrIDNotFound, op.RowID, op.TableName)
+		}
+		change.oldRow = current
+	default:
+		return fmt.Errorf("%w: unknown operation %d", ErrInvalidQuery, op.Op)
+	}
+
+	if change.newRow.Columns != nil {
+		if err := db.coerceRow(table, change.newRow); err != nil {
+			return err
+		}
+	}
+
+	own[op.RowID] = change.newRow
+	if err := db.checkBufferedChange(table, change, tx.pending, op.triggerNow); err != nil {
+		if replaced {
+			own[op.RowID] = prev
+		} else {
+			delete(own, op.RowID)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkBufferedChange runs the checks applyOp runs for change, with the
+// rows in pending, which already holds change, read in place of those
+// stored.
+func (db *NewDatabase) checkBufferedChange(table *Table, change appliedChange, pending map[string]map[string]Row, selected func(TriggerTiming) bool) error {
+	if change.op != ChangeDelete {
+		if err := table.validateRow(change.newRow); err != nil {
+			return err
+		}
+		if err := table.checkUniqueWith(change.newRow, change.id, pending[table.Name]); err != nil {
+			return err
+		}
+		if err := db.checkForeignKeys(table, change.newRow, nil, pending); err != nil {
+			return err
+		}
+		if db.memoryLimit > 0 && db.memoryUsage(nil)+rowSize(change.newRow)-rowSize(change.oldRow) > db.memoryLimit {
+			return fmt.Errorf("%w: writing row %s to table %s", ErrMemoryLimitExceeded, change.id, change.tableName)
+		}
+	}
+	if change.op != ChangeInsert {
+		if err := db.checkReferences(table, []Row{change.oldRow}, nil, pending); err != nil {
+			return err
+		}
+	}
+	return db.checkTriggers(table, change, pending, nil, selected)
+}
+
+// lockPendingRows takes, for tx, the exclusive lock on every row its
+// pending operations write, in order of table and id, and returns a func
+// releasing them. If one cannot be taken, those already taken are
+// released.
+func (db *NewDatabase) lockPendingRows(tx *Transaction) (UnlockFunc, error) {
+	db.txMu.Lock()
+	rows := make([][2]string, 0, len(tx.PendingOps))
+	seen := make(map[string]bool, len(tx.PendingOps))
+	for _, op := range tx.PendingOps {
+		if key := rowLockKey(op.TableName, op.RowID); !seen[key] {
+			seen[key] = true
+			rows = append(rows, [2]string{op.TableName, op.RowID})
+		}
+	}
+	db.txMu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+		return rows[i][1] < rows[j][1]
+	})
+
+	unlocks := make([]UnlockFunc, 0, len(rows))
+	release := func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+
+	for _, row := range rows {
+		unlock, err := db.acquireRowLock(tx, row[0], row[1], true)
+
+		if err != nil {
+			release()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
+
+// endTransaction moves tx to status, discards its pending operations and
+// releases its row locks. elapsed is the time spent committing, used to
+// estimate commit times; it is ignored for rollbacks. The caller must hold
+// db.mu.
+func (db *NewDatabase) endTransaction(tx *Transaction, status TransactionStatus, elapsed time.Duration) {
+	db.txMu.Lock()
+	if status == Committed && len(tx.PendingOps) > 0 {
+		cost := elapsed / time.Duration(len(tx.PendingOps))
+		if db.opCost == 0 {
+			db.opCost = cost
+		} else {
+			db.opCost = (db.opCost*7 + cost) / 8
+		}
+	}
+	tx.Status = status
+	tx.PendingOps = nil
+	tx.pending = nil
+	delete(db.transactions, tx)
+	db.txMu.Unlock()
+
+	tx.releaseLocks()
+
+	if status == Committed {
+		db.metrics.transaction(MetricCommit)
+	} else {
+		db.metrics.transaction(MetricRollback)
+	}
+}
+
+// ExplainTransaction describes what committing tx would do: each pending
+// operation, the rows it touches grouped by table, an estimated commit time
+// and the rows that other pending transactions also write. The estimate is a
+// moving average of the per-operation cost of earlier commits times the
+// number of pending operations.
+func (db *NewDatabase) ExplainTransaction(tx *Transaction) (TransactionPlan, error) {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	if tx.Status != Pending {
+		return TransactionPlan{}, ErrTransactionFailed
+	}
+
+	plan := TransactionPlan{
+		TxID: tx.ID,
+		Rows: make(map[string][]string),
+	}
+
+	touched := make(map[string]bool)
+	for _, op := range tx.PendingOps {
+		plan.Operations = append(plan.Operations, op.String())
+
+		key := rowLockKey(op.TableName, op.RowID)
+		if touched[key] {
+			continue
+		}
+		touched[key] = true
+
+		if _, ok := plan.Rows[op.TableName]; !ok {
+			plan.Tables = append(plan.Tables, op.TableName)
+		}
+		plan.Rows[op.TableName] = append(plan.Rows[op.TableName], op.RowID)
+	}
+	sort.Strings(plan.Tables)
+
+	cost := db.opCost
+	if cost == 0 {
+		cost = defaultOpCost
+	}
+	plan.EstimatedCommit = cost * time.Duration(len(tx.PendingOps))
+
+	for other := range db.transactions {
+		if other == tx {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, op := range other.PendingOps {
+			key := rowLockKey(op.TableName, op.RowID)
+			if !touched[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			plan.Conflicts = append(plan.Conflicts, TransactionConflict{TxID: other.ID, TableName: op.TableName, RowID: op.RowID})
+		}
+	}
+	sort.Slice(plan.Conflicts, func(i, j int) bool {
+		a, b := plan.Conflicts[i], plan.Conflicts[j]
+		if a.TableName != b.TableName {
+			return a.TableName < b.TableName
+		}
+		if a.RowID != b.RowID {
+			return a.RowID < b.RowID
+		}
+		return a.TxID < b.TxID
+	})
+
+	return plan, nil
+}
+
+func (op PendingOperation) String() string {
+	var verb string
+	switch op.Op {
+	case ChangeInsert:
+		verb = "INSERT"
+	case ChangeUpdate:
+		verb = "UPDATE"
+	case ChangeDelete:
+		return fmt.Sprintf("DELETE %s id=%s", op.TableName, op.RowID)
+	default:
+		verb = fmt.Sprintf("OP(%d)", op.Op)
+	}
+
+	keys := make([]string, 0, len(op.Data))
+	for key := range op.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = fmt.Sprintf("%s=%v", key, op.Data[key])
+	}
+
+	return fmt.Sprintf("%s %s id=%s {%s}", verb, op.TableName, op.RowID, strings.Join(fields, ", "))
+}
+
+// stagePending applies ops in order to private copies of the tables they
+// touch and returns those copies; db.Tables is not modified. With
+// deferChecks, constraints are checked once against the final state instead
+// of after each operation. Before hooks run only when runHooks is set, so
+// that they see each write once, at commit. The caller must hold db.mu.
+func (db *NewDatabase) stagePending(ops []PendingOperation, deferChecks, runHooks bool) (map[string]*Table, []appliedChange, error) {
+	staged := make(map[string]*Table)
+	applied := make([]appliedChange, 0, len(ops))
+
+	for i, op := range ops {
+		table, ok := staged[op.TableName]
+		if !ok {
+			current, exists := db.Tables[op.TableName]
+			if !exists || db.matViews[op.TableName] != nil {
+				return nil, nil, fmt.Errorf("operation %d: %w", i, db.notWritable(op.TableName))
+			}
+			clone := current.cloneStorage()
+			clone.ensureIndexes()
+			clone.rebuildIndexes()
+			table = &clone
+			staged[op.TableName] = table
+		}
+
+		change, err := db.applyOp(table, op, !deferChecks, runHooks, staged)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		applied = append(applied, change)
+	}
+
+	if deferChecks {
+		for _, change := range applied {
+			table := staged[change.tableName]
+			if change.oldRow.Columns != nil {
+				if err := db.checkReferences(table, []Row{change.oldRow}, staged, nil); err != nil {
+					return nil, nil, err
+				}
+			}
+
+			row, ok := table.getLiveRow(change.id)
+			if !ok {
+				continue
+			}
+
+			row, err := db.openRow(table, row)
+
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := db.checkRow(table, row, staged); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Once every op is applied, a commit runs the constraint triggers
+	// applyOp left: all of them if checks are deferred, and otherwise the
+	// deferred ones. bufferOp's trial runs, which do not run hooks, leave
+	// deferred triggers to the commit.
+	if deferChecks || runHooks {
+		atCommit := func(timing TriggerTiming) bool {
+			return deferChecks || timing == TriggerDeferred
+		}
+		for _, change := range applied {
+			if err := db.checkTriggers(staged[change.tableName], change, nil, staged, atCommit); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return staged, applied, nil
+}
+
+// applyOp applies op to table, checking it first if check is set and
+// running Before hooks if runHooks is. If it fails, table is left as it
+// was.
+func (db *NewDatabase) applyOp(table *Table, op PendingOperation, check, runHooks bool, staged map[string]*Table) (appliedChange, error) {
+	change := appliedChange{op: op.Op, tableName: op.TableName, id: op.RowID, txID: op.txID}
+	current, exists := table.getLiveRow(op.RowID)
+
+	switch op.Op {
+	case ChangeInsert:
+		if existing, found := table.getRow(op.RowID); found && !table.revivable(existing) {
+			return change, fmt.Errorf("%w: %s in table %s", ErrIDExists, op.RowID, op.TableName)
+		}
+		change.newRow = Row{Columns: make(map[string]interface{}, len(op.Data)+1)}
+		for key, value := range op.Data {
+			change.newRow.Columns[key] = value
+		}
+		change.newRow.Columns["id"] = op.RowID
+		if err := table.applyDefaults(change.newRow); err != nil {
+			return change, err
+		}
+		if err := db.coerceRow(table, change.newRow); err != nil {
+			return change, err
+		}
+	case ChangeUpdate:
+		if !exists {
+			return change, fmt.Errorf("%w: %s in table %s", ErrIDNotFound, op.RowID, op.TableName)
+		}
+		if newID, ok := op.Data["id"]; ok && newID != op.RowID {
+			return change, fmt.Errorf("%w: cannot change id of row %s", ErrInvalidQuery, op.RowID)
+		}
+		plain, err := db.openRow(table, current)
+
+		if err != nil {
+			return change, err
+		}
+		change.oldRow = current
+		change.newRow = copyRow(plain)
+		for key, value := range op.Data {
+			change.newRow.Columns[key] = value
+		}
+		if err := db.coerceRow(table, change.newRow); err != nil {
+			return change, err
+		}
+	case ChangeDelete:
+		if !exists {
+			return change, fmt.Errorf("%w: %s in table %s", ErrIDNotFound, op.RowID, op.TableName)
+		}
+		change.oldRow = current
+		if runHooks {
+			if err := db.runHooks(HookBefore, change.hookContext()); err != nil {
+				return change, err
+			}
+		}
+		if check {
+			pending := map[string]map[string]Row{op.TableName: {op.RowID: {}}}
+			if err := db.checkTriggers(table, change, pending, staged, op.triggerNow); err != nil {
+				return change, err
+			}
+			if err := db.checkReferences(table, []Row{current}, staged, pending); err != nil {
+				return change, err
+			}
+		}
+		table.audit(AuditDelete, current, table.removeRow(current), op.origin())
+		return change, nil
+	default:
+		return change, fmt.Errorf("%w: unknown operation %d", ErrInvalidQuery, op.Op)
+	}
+
+	if runHooks {
+		if err := db.runBeforeHooks(op.TableName, change.hookContext().Op, op.RowID, change.oldRow, change.newRow); err != nil {
+			return change, err
+		}
+	}
+
+	if check {
+		if err := db.checkRow(table, change.newRow, staged); err != nil {
+			return change, err
+		}
+		if op.Op == ChangeUpdate {
+			pending := map[string]map[string]Row{op.TableName: {op.RowID: change.newRow}}
+			if err := db.checkReferences(table, []Row{current}, staged, pending); err != nil {
+				return change, err
+			}
+		}
+	}
+
+	if !check && table.hasEncrypted() {
+		// validateRow normalizes values, which it cannot do once they are
+		// encrypted, so it runs now rather than with the deferred checks.
+		if err := table.validateRow(change.newRow); err != nil {
+			return change, err
+		}
+	}
+
+	sealed, err := db.sealRow(table, change.newRow)
+
+	if err != nil {
+		return change, err
+	}
+	change.newRow = sealed
+
+	if db.memoryLimit > 0 && db.memoryUsage(staged)+rowSize(change.newRow)-rowSize(current) > db.memoryLimit {
+		return change, fmt.Errorf("%w: writing row %s to table %s", ErrMemoryLimitExceeded, op.RowID, op.TableName)
+	}
+
+	// Triggers run before the write, seeing it through pending, so that
+	// a veto leaves table as it was.
+	if check {
+		pending := map[string]map[string]Row{op.TableName: {op.RowID: change.newRow}}
+		if err := db.checkTriggers(table, change, pending, staged, op.triggerNow); err != nil {
+			return change, err
+		}
+	}
+
+	change.newRow = table.putRow(change.newRow)
+	if op.Op == ChangeInsert {
+		table.audit(AuditInsert, Row{}, change.newRow, op.origin())
+	} else {
+		table.audit(AuditUpdate, current, change.newRow, op.origin())
+	}
+
+	return change, nil
+}
+
+func (op PendingOperation) origin() writeOrigin {
+	return writeOrigin{actor: op.Actor, txID: op.txID}
+}
+
+// triggerNow reports whether applyOp runs constraint triggers with timing
+// as it applies op: all of them outside transactions, and only immediate
+// ones inside.
+func (op PendingOperation) triggerNow(timing TriggerTiming) bool {
+	return op.txID == 0 || timing == TriggerImmediate
+}
+
+func (c appliedChange) hookContext() HookContext {
+	ctx := HookContext{TableName: c.tableName, RowID: c.id, OldRow: c.oldRow, NewRow: c.newRow}
+	switch c.op {
+	case ChangeInsert:
+		ctx.Op = HookInsert
+	case ChangeUpdate:
+		ctx.Op = HookUpdate
+	case ChangeDelete:
+		ctx.Op = HookDelete
+	}
+	return ctx
+}
+
+func (db *NewDatabase) checkRow(table *Table, row Row, staged map[string]*Table) error {
+	if err := table.validateRow(row); err != nil {
+		return err
+	}
+	if err := table.checkUnique(row, rowID(row)); err != nil {
+		return err
+	}
+	return db.checkForeignKeys(table, row, staged, nil)
+}
+
+// checkForeignKeys verifies that every foreign key value in row exists in the
+// referenced table. Referenced tables are looked up in staged first, then in
+// db.Tables, and read with the rows pending holds for them, by id, in place
+// of those stored; table itself satisfies self-references.
+func (db *NewDatabase) checkForeignKeys(table *Table, row Row, staged map[string]*Table, pending map[string]map[string]Row) error {
+	for _, col := range table.Columns {
+		fk := col.ForeignKey
+		if fk == nil {
+			continue
+		}
+
+		val, ok := row.Columns[col.Name]
+		if !ok || val == nil {
+			continue
+		}
+
+		ref, err := db.stagedTable(fk.Table, table, staged)
+
+		if err != nil {
+			return fmt.Errorf("%w: %s.%s references missing table %s", ErrForeignKey, table.Name, col.Name, fk.Table)
+		}
+
+		for _, refCol := range ref.Columns {
+			if refCol.Name == fk.column() && refCol.Encrypted {
+				return fmt.Errorf("%w: %s.%s references encrypted column %s.%s", ErrForeignKey, table.Name, col.Name, fk.Table, refCol.Name)
+			}
+		}
+		if !ref.hasValue(fk.column(), val, pending[fk.Table]) {
+			return fmt.Errorf("%w: %s.%s = %v has no match in %s.%s", ErrForeignKey, table.Name, col.Name, val, fk.Table, fk.column())
+		}
+	}
+
+	return nil
+}
+
+// checkReferences refuses, with ErrForeignKey, a write to table that
+// deletes or replaces oldRows while rows of some table, table itself
+// included, still reference a value only they held: foreign keys restrict
+// the deletion of what they reference. Tables are read as checkForeignKeys
+// reads them, so pending must hold the write itself unless it has already
+// been made to table.
+func (db *NewDatabase) checkReferences(table *Table, oldRows []Row, staged map[string]*Table, pending map[string]map[string]Row) error {
+	for name, stored := range db.Tables {
+		for _, col := range stored.Columns {
+			fk := col.ForeignKey
+			if fk == nil || fk.Table != table.Name {
+				continue
+			}
+
+			referencing, err := db.stagedTable(name, table, staged)
+
+			if err != nil {
+				return err
+			}
+
+			for _, old := range oldRows {
+				val := old.Columns[fk.column()]
+				if val == nil || table.hasValue(fk.column(), val, pending[table.Name]) {
+					continue
+				}
+				if referencing.hasValue(col.Name, val, pending[name]) {
+					return fmt.Errorf("%w: %s.%s = %v is referenced by %s.%s", ErrForeignKey, table.Name, fk.column(), val, name, col.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// stagedTable returns the table named name: table itself if that is its
+// name, else the one in staged, else the one in db.Tables.
+func (db *NewDatabase) stagedTable(name string, table *Table, staged map[string]*Table) (*Table, error) {
+	switch {
+	case name == table.Name:
+		return table, nil
+	case staged[name] != nil:
+		return staged[name], nil
+	}
+	current, ok := db.Tables[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, name)
+	}
+	return &current, nil
+}
+
+func (fk ForeignKey) column() string {
+	if fk.Column == "" {
+		return "id"
+	}
+	return fk.Column
+}
+
+// hasValue reports whether a row visible to reads holds val in column,
+// with the rows in pending, by id, read in place of those stored, an empty
+// row standing for a deleted one.
+func (t *Table) hasValue(column string, val interface{}, pending map[string]Row) bool {
+	if column == "id" {
+		id, ok := val.(string)
+		if !ok {
+			return false
+		}
+		if row, ok := pending[id]; ok {
+			return row.Columns != nil
+		}
+		_, exists := t.getLiveRow(id)
+		return exists
+	}
+
+	collation := t.collation(column)
+	key := collation.key(val)
+	matches := func(row Row) bool {
+		other := collation.key(row.Columns[column])
+		return other != nil && valueKind(other) == valueKind(key) && compareOrdered(other, key) == 0
+	}
+	for _, row := range pending {
+		if row.Columns != nil && matches(row) {
+			return true
+		}
+	}
+
+	for _, idx := range t.Indexes {
+		if len(idx.Columns) == 1 && idx.Columns[0] == column && !idx.Inverted && !idx.FullText && t.indexData != nil && !t.SoftDelete {
+			indexKey, _ := t.indexKey(Row{Columns: map[string]interface{}{column: val}}, idx.Columns)
+			for _, id := range t.indexData[idx.Name][indexKey] {
+				if _, replaced := pending[id]; !replaced {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for _, row := range t.scanRows(false) {
+		if _, replaced := pending[rowID(row)]; !replaced && matches(row) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// peopleTestDB returns a database whose people table has a partner column
+// referencing another row of the table.
+func peopleTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "people", []Column{
+		{Name: "partner", DataType: String, ForeignKey: &ForeignKey{Table: "people", Column: "id"}},
+	}, nil)
+	return db
+}
+
+func TestDeferredConstraintsAllowMutualReferences(t *testing.T) {
+	db := peopleTestDB(t)
+
+	tx, err := db.BeginTransactionWithOptions(TransactionOptions{DeferConstraints: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(tx, "people", "x", map[string]interface{}{"partner": "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(tx, "people", "y", map[string]interface{}{"partner": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatalf("CommitTransaction: %v", err)
+	}
+
+	rows, err := db.GetAllRows("people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("people has %d rows, want 2", len(rows))
+	}
+}
+
+func TestImmediateConstraintsRejectMutualReferences(t *testing.T) {
+	db := peopleTestDB(t)
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.InsertRowTx(tx, "people", "x", map[string]interface{}{"partner": "y"})
+	if err == nil {
+		err = db.InsertRowTx(tx, "people", "y", map[string]interface{}{"partner": "x"})
+	}
+	if err == nil {
+		err = db.CommitTransaction(tx)
+	}
+	if !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("mutual references without deferred constraints = %v, want ErrForeignKey", err)
+	}
+}
+
+func TestDeferredConstraintViolationRollsBack(t *testing.T) {
+	db := peopleTestDB(t)
+
+	tx, err := db.BeginTransactionWithOptions(TransactionOptions{DeferConstraints: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(tx, "people", "x", map[string]interface{}{"partner": "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(tx, "people", "y", map[string]interface{}{"partner": "nobody"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CommitTransaction(tx); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("CommitTransaction = %v, want ErrForeignKey", err)
+	}
+	if tx.Status != RolledBack {
+		t.Fatalf("status = %v, want RolledBack", tx.Status)
+	}
+	if rows, _ := db.GetAllRows("people"); len(rows) != 0 {
+		t.Fatalf("people has %d rows after the failed commit, want none", len(rows))
+	}
+}
+
+func TestDeleteRestrictedByReferences(t *testing.T) {
+	db := fkTestDB(t)
+
+	if err := db.DeleteRow("customers", "c1"); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("DeleteRow of a referenced row = %v, want ErrForeignKey", err)
+	}
+	if _, err := db.DeleteWhere("customers", "name = 'Ann'"); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("DeleteWhere of a referenced row = %v, want ErrForeignKey", err)
+	}
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRowTx(tx, "customers", "c1"); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("DeleteRowTx of a referenced row = %v, want ErrForeignKey", err)
+	}
+	if err := db.DeleteRowTx(tx, "orders", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRowTx(tx, "customers", "c1"); err != nil {
+		t.Fatalf("DeleteRowTx once the reference is deleted: %v", err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := db.RowExists("customers", "c1"); exists {
+		t.Fatal("customer c1 was not deleted")
+	}
+}
+
+func TestDeferredDeleteRestrictedAtCommit(t *testing.T) {
+	db := fkTestDB(t)
+
+	tx, err := db.BeginTransactionWithOptions(TransactionOptions{DeferConstraints: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRowTx(tx, "customers", "c1"); err != nil {
+		t.Fatalf("DeleteRowTx with deferred constraints: %v", err)
+	}
+	if err := db.CommitTransaction(tx); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("CommitTransaction = %v, want ErrForeignKey", err)
+	}
+	if exists, _ := db.RowExists("customers", "c1"); !exists {
+		t.Fatal("the failed commit deleted customer c1")
+	}
+
+	tx, err = db.BeginTransactionWithOptions(TransactionOptions{DeferConstraints: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRowTx(tx, "customers", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRowTx(tx, "orders", "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatalf("CommitTransaction deleting the reference too: %v", err)
+	}
+}
+
+func TestBufferedWritesSeeEarlierWrites(t *testing.T) {
+	db := fkTestDB(t)
+
+	tx, err := db.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(tx, "customers", "c2", map[string]interface{}{"name": "Bo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRowTx(tx, "orders", "o2", map[string]interface{}{"customer": "c2"}); err != nil {
+		t.Fatalf("InsertRowTx referencing a row inserted earlier: %v", err)
+	}
+	if err := db.InsertRowTx(tx, "customers", "c2", nil); !errors.Is(err, ErrIDExists) {
+		t.Fatalf("second InsertRowTx of c2 = %v, want ErrIDExists", err)
+	}
+	if err := db.UpdateRowTx(tx, "orders", "o3", map[string]interface{}{"customer": "c1"}); !errors.Is(err, ErrIDNotFound) {
+		t.Fatalf("UpdateRowTx of a missing row = %v, want ErrIDNotFound", err)
+	}
+	if err := db.CommitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := db.RowExists("orders", "o2"); !exists {
+		t.Fatal("order o2 was not inserted")
+	}
+}
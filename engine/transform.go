@@ -0,0 +1,78 @@
+package engine
+
+import "context"
+
+// SetRowTransformer makes reads of tableName return fn(row) in place of
+// each stored row: GetRowByID, GetAllRows and queries, including joins.
+// In queries the transformer runs as rows are read, after any index
+// lookup, so filters, sorting and projections see the transformed rows.
+// fn is given a copy of each row, which it may modify and return; stored
+// rows are never changed. Writes, hooks, audit records and change events
+// see the stored rows. A nil fn removes the transformer. fn is called with
+// the database's read lock held and must not call back into the database.
+func (db *NewDatabase) SetRowTransformer(tableName string, fn func(Row) Row) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if fn == nil {
+		delete(db.transformers, tableName)
+		return
+	}
+	if db.transformers == nil {
+		db.transformers = make(map[string]func(Row) Row)
+	}
+	db.transformers[tableName] = fn
+}
+
+// readTransform returns the function a batch of t's rows passes through as
+// it is read: encrypted columns are decrypted, rows the principal of ctx
+// may not see are dropped, and t's transformer is applied. It returns nil
+// if there is nothing to do. A value that cannot be decrypted is left
+// encrypted; callers check the keys first with checkKeys. The caller must
+// hold db.mu.
+func (db *NewDatabase) readTransform(ctx context.Context, t *Table) func([]Row) []Row {
+	var steps []func([]Row) []Row
+
+	if t.hasEncrypted() {
+		steps = append(steps, func(rows []Row) []Row {
+			opened := make([]Row, len(rows))
+			for i, row := range rows {
+				opened[i] = row
+				if plain, err := db.openRow(t, row); err == nil {
+					opened[i] = plain
+				}
+			}
+			return opened
+		})
+	}
+	if visible := policyFilter(ctx, t); visible != nil {
+		steps = append(steps, visible)
+	}
+	if fn, ok := db.transformers[t.Name]; ok {
+		steps = append(steps, func(rows []Row) []Row {
+			transformed := make([]Row, len(rows))
+			for i, row := range rows {
+				transformed[i] = fn(copyRow(row))
+			}
+			return transformed
+		})
+	}
+
+	if len(steps) == 0 {
+		return nil
+	}
+	return func(rows []Row) []Row {
+		for _, step := range steps {
+			rows = step(rows)
+		}
+		return rows
+	}
+}
+
+// transformRows passes rows through transform, if it is not nil.
+func transformRows(transform func([]Row) []Row, rows []Row) []Row {
+	if transform == nil {
+		return rows
+	}
+	return transform(rows)
+}
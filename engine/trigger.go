@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var countQueryPattern = regexp.MustCompile(`(?is)^\s*SELECT\s+COUNT\s*\(\s*\*\s*\)\s+FROM\s+([A-Za-z_][A-Za-z0-9_]*)(?:\s+WHERE\s+(.*?))?\s*;?\s*$`)
+
+// countQuery is a compiled SELECT COUNT(*) FROM table [WHERE where].
+type countQuery struct {
+	table string
+	where expr
+}
+
+func parseCountQuery(sql string) (countQuery, error) {
+	m := countQueryPattern.FindStringSubmatch(sql)
+	if m == nil {
+		return countQuery{}, fmt.Errorf("%w: expected SELECT COUNT(*) FROM table [WHERE condition], got %q", ErrInvalidQuery, sql)
+	}
+
+	query := countQuery{table: m[1]}
+	if m[2] != "" {
+		where, err := parseExpr(m[2])
+
+		if err != nil {
+			return countQuery{}, err
+		}
+		query.where = where
+	}
+	return query, nil
+}
+
+// CreateConstraintTrigger adds a constraint trigger to tableName. After
+// every insert, update or delete of one of its rows, checkSQL, a query of
+// the form
+//
+//	SELECT COUNT(*) FROM table [WHERE condition]
+//
+// is run with NEW.column and OLD.column in condition standing for the
+// columns of the row as written and as it was; NEW is all NULL for
+// deletes and OLD for inserts. If it counts any rows the write fails with
+// ErrConstraintViolation and, in a transaction, the transaction is rolled
+// back. The query sees the write and, for a TriggerDeferred trigger, the
+// rest of its transaction; timing is as described at TriggerTiming.
+//
+// Rows already in the tables are not checked. BulkLoad and writes that
+// skip foreign key checks, such as those to CRDT columns, do not run
+// constraint triggers.
+func (db *NewDatabase) CreateConstraintTrigger(tableName, name, checkSQL string, timing TriggerTiming) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if name == "" {
+		return fmt.Errorf("%w: constraint trigger needs a name", ErrInvalidQuery)
+	}
+	if timing != TriggerImmediate && timing != TriggerDeferred {
+		return fmt.Errorf("%w: constraint trigger %s has unknown timing %s", ErrInvalidQuery, name, timing)
+	}
+
+	query, err := parseCountQuery(checkSQL)
+
+	if err != nil {
+		return fmt.Errorf("constraint trigger %s: %w", name, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	if _, ok := db.Tables[query.table]; !ok {
+		return fmt.Errorf("constraint trigger %s: %w: %s", name, ErrTableNotFound, query.table)
+	}
+	for _, trigger := range table.ConstraintTriggers {
+		if trigger.Name == name {
+			return fmt.Errorf("%w: %s on %s", ErrTriggerExists, name, tableName)
+		}
+	}
+
+	trigger := ConstraintTrigger{Name: name, Check: checkSQL, Timing: timing}
+	table.ConstraintTriggers = append(append([]ConstraintTrigger(nil), table.ConstraintTriggers...), trigger)
+	db.Tables[tableName] = table
+	db.replicateTable(tableName)
+	return nil
+}
+
+// anyTiming selects every constraint trigger for checkTriggers.
+func anyTiming(TriggerTiming) bool {
+	return true
+}
+
+// checkTriggers runs the constraint triggers of t that selected accepts
+// for change, a write to t. Tables other than t are read from staged, then
+// db.Tables. pending holds rows, by table and id, that the queries see in
+// place of those stored, an empty row standing for a deleted one; it is
+// nil if the writes have already been made to the tables.
+func (db *NewDatabase) checkTriggers(t *Table, change appliedChange, pending map[string]map[string]Row, staged map[string]*Table, selected func(TriggerTiming) bool) error {
+	if len(t.ConstraintTriggers) == 0 {
+		return nil
+	}
+
+	oldRow, err := db.openRow(t, change.oldRow)
+
+	if err != nil {
+		return err
+	}
+
+	newRow, err := db.openRow(t, change.newRow)
+
+	if err != nil {
+		return err
+	}
+
+	for _, trigger := range t.ConstraintTriggers {
+		if !selected(trigger.Timing) {
+			continue
+		}
+
+		count, err := db.runTrigger(t, trigger, oldRow, newRow, pending, staged)
+
+		if err != nil {
+			return fmt.Errorf("constraint trigger %s: %w", trigger.Name, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s on table %s for row %s", ErrConstraintViolation, trigger.Name, t.Name, change.id)
+		}
+	}
+	return nil
+}
+
+// runTrigger returns the count trigger's query gives for a write of
+// newRow over oldRow to t.
+func (db *NewDatabase) runTrigger(t *Table, trigger ConstraintTrigger, oldRow, newRow Row, pending map[string]map[string]Row, staged map[string]*Table) (int, error) {
+	query, err := parseCountQuery(trigger.Check)
+
+	if err != nil {
+		return 0, err
+	}
+
+	filter := query.where
+	if filter != nil {
+		if filter, err = bindRowRefs(filter, oldRow, newRow); err != nil {
+			return 0, err
+		}
+	}
+
+	source := t
+	switch {
+	case query.table == t.Name:
+	case staged[query.table] != nil:
+		source = staged[query.table]
+	default:
+		current, ok := db.Tables[query.table]
+		if !ok {
+			return 0, fmt.Errorf("%w: %s", ErrTableNotFound, query.table)
+		}
+		source = &current
+	}
+
+	rows := source.scanRows(false)
+	if own := pending[source.Name]; own != nil {
+		kept := make([]Row, 0, len(rows)+len(own))
+		for _, row := range rows {
+			if _, replaced := own[rowID(row)]; !replaced {
+				kept = append(kept, row)
+			}
+		}
+		for _, row := range own {
+			if row.Columns != nil {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+
+	count := 0
+	for _, row := range rows {
+		row, err := db.openRow(source, row)
+
+		if err != nil {
+			return 0, err
+		}
+		if filter != nil {
+			match, err := evaluateFilter(row, filter)
+
+			if err != nil {
+				return 0, err
+			}
+			if !match {
+				continue
+			}
+		}
+		count++
+	}
+	return count, nil
+}
+
+// bindRowRefs returns e with NEW.column and OLD.column replaced by the
+// values of column in newRow and oldRow.
+func bindRowRefs(e expr, oldRow, newRow Row) (expr, error) {
+	return rewriteExpr(e, func(e expr) (expr, error) {
+		col, ok := e.(columnExpr)
+		if !ok {
+			return e, nil
+		}
+
+		prefix, name, found := strings.Cut(col.name, ".")
+		switch {
+		case !found:
+			return e, nil
+		case strings.EqualFold(prefix, "NEW"):
+			return literalExpr{newRow.Columns[name]}, nil
+		case strings.EqualFold(prefix, "OLD"):
+			return literalExpr{oldRow.Columns[name]}, nil
+		}
+		return e, nil
+	})
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func triggerTestDB(t *testing.T) *NewDatabase {
+	db := usersOrdersTestDB(t, false)
+	mustInsertRows(t, db, "users", map[string]map[string]interface{}{
+		"u1": {"name": "ann"},
+		"u2": {"name": "bob"},
+	})
+	mustInsert(t, db, "orders", "o1", map[string]interface{}{"user_id": "u1"})
+	return db
+}
+
+func TestConstraintTriggerVeto(t *testing.T) {
+	db := triggerTestDB(t)
+	if err := db.CreateConstraintTrigger("users", "no_orphans", "SELECT COUNT(*) FROM orders WHERE user_id = OLD.id", TriggerImmediate); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateConstraintTrigger("users", "unique_name", "SELECT COUNT(*) FROM users WHERE name = NEW.name AND id <> NEW.id", TriggerImmediate); err != nil {
+		t.Fatal(err)
+	}
+	before, err := db.GetAllRows("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteRow("users", "u1")
+	if !errors.Is(err, ErrConstraintViolation) || !strings.Contains(err.Error(), "no_orphans") {
+		t.Errorf("DeleteRow of a user with orders = %v, want ErrConstraintViolation naming no_orphans", err)
+	}
+	err = db.UpdateRow("users", "u2", map[string]interface{}{"name": "ann"})
+	if !errors.Is(err, ErrConstraintViolation) || !strings.Contains(err.Error(), "unique_name") {
+		t.Errorf("UpdateRow to a taken name = %v, want ErrConstraintViolation naming unique_name", err)
+	}
+	if err := db.InsertRow("users", "u3", map[string]interface{}{"name": "bob"}); !errors.Is(err, ErrConstraintViolation) {
+		t.Errorf("InsertRow of a taken name = %v, want ErrConstraintViolation", err)
+	}
+
+	after, err := db.GetAllRows("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("vetoed writes changed users: %v", after)
+	}
+
+	// Writes the triggers allow go through.
+	if err := db.DeleteRow("users", "u2"); err != nil {
+		t.Errorf("DeleteRow of a user without orders: %v", err)
+	}
+	if err := db.InsertRow("users", "u3", map[string]interface{}{"name": "cy"}); err != nil {
+		t.Errorf("InsertRow of a new name: %v", err)
+	}
+}
+
+func TestConstraintTriggerTiming(t *testing.T) {
+	for _, timing := range []TriggerTiming{TriggerImmediate, TriggerDeferred} {
+		db := triggerTestDB(t)
+		if err := db.CreateConstraintTrigger("users", "unique_name", "SELECT COUNT(*) FROM users WHERE name = NEW.name AND id <> NEW.id", timing); err != nil {
+			t.Fatal(err)
+		}
+
+		// Swap the two names through a clash that the transaction
+		// resolves before it commits.
+		tx, err := db.BeginTransaction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := []error{
+			db.UpdateRowTx(tx, "users", "u1", map[string]interface{}{"name": "bob"}),
+			db.UpdateRowTx(tx, "users", "u2", map[string]interface{}{"name": "ann"}),
+		}
+		if err := errors.Join(errs...); err != nil {
+			if timing == TriggerDeferred {
+				t.Fatalf("deferred: %v", err)
+			}
+			// The failed write has rolled the transaction back.
+			if !errors.Is(err, ErrConstraintViolation) {
+				t.Errorf("immediate: swap = %v, want ErrConstraintViolation", err)
+			}
+		} else if err := db.CommitTransaction(tx); err != nil {
+			t.Errorf("%s: CommitTransaction: %v", timing, err)
+		}
+
+		row, err := db.GetRowByID("users", "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[TriggerTiming]string{TriggerImmediate: "ann", TriggerDeferred: "bob"}[timing]
+		if row.Columns["name"] != want {
+			t.Errorf("%s: u1 is %v, want %s", timing, row.Columns["name"], want)
+		}
+
+		// A clash left at commit is rejected and rolls the transaction back.
+		tx, err = db.BeginTransaction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.InsertRowTx(tx, "users", "u3", map[string]interface{}{"name": "ann"})
+		if err == nil {
+			err = db.CommitTransaction(tx)
+		}
+		if !errors.Is(err, ErrConstraintViolation) {
+			t.Errorf("%s: clash = %v, want ErrConstraintViolation", timing, err)
+		}
+		if exists, _ := db.RowExists("users", "u3"); exists {
+			t.Errorf("%s: vetoed insert was kept", timing)
+		}
+	}
+}
+
+func TestCreateConstraintTriggerErrors(t *testing.T) {
+	db := triggerTestDB(t)
+	const check = "SELECT COUNT(*) FROM orders WHERE user_id = OLD.id"
+
+	tests := []struct {
+		table, name, sql string
+		timing           TriggerTiming
+		want             error
+	}{
+		{"users", "", check, TriggerImmediate, ErrInvalidQuery},
+		{"users", "t", check, TriggerTiming(7), ErrInvalidQuery},
+		{"users", "t", "SELECT * FROM orders", TriggerImmediate, ErrInvalidQuery},
+		{"missing", "t", check, TriggerImmediate, ErrTableNotFound},
+		{"users", "t", "SELECT COUNT(*) FROM missing", TriggerImmediate, ErrTableNotFound},
+	}
+	for _, tt := range tests {
+		if err := db.CreateConstraintTrigger(tt.table, tt.name, tt.sql, tt.timing); !errors.Is(err, tt.want) {
+			t.Errorf("CreateConstraintTrigger(%q, %q, %q) = %v, want %v", tt.table, tt.name, tt.sql, err, tt.want)
+		}
+	}
+
+	if err := db.CreateConstraintTrigger("users", "t", check, TriggerImmediate); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateConstraintTrigger("users", "t", check, TriggerDeferred); !errors.Is(err, ErrTriggerExists) {
+		t.Errorf("second trigger t = %v, want ErrTriggerExists", err)
+	}
+}
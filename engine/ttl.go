@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// expiresAtColumn is reserved: a row whose expires_at holds a time at or
+// before now is treated as absent by every read.
+const expiresAtColumn = "expires_at"
+
+// InsertRowWithTTL inserts a row that expires ttl from now. From then on it
+// is invisible to GetRowByID, GetAllRows, CountRows and queries, and its id
+// may be inserted again, even before the janitor removes it. Rows may also
+// be given an expiry by setting the expires_at column directly.
+func (db *NewDatabase) InsertRowWithTTL(tableName, id string, data map[string]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: TTL must be positive", ErrInvalidQuery)
+	}
+
+	withExpiry := make(map[string]interface{}, len(data)+1)
+	for key, value := range data {
+		withExpiry[key] = value
+	}
+	withExpiry[expiresAtColumn] = time.Now().Add(ttl)
+
+	return db.InsertRow(tableName, id, withExpiry)
+}
+
+// StartJanitor starts a goroutine that removes expired rows every interval
+// and publishes a delete event for each. The audit log records its deletes
+// as made by the actor JanitorActor. Close stops it.
+func (db *NewDatabase) StartJanitor(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("%w: janitor interval must be positive", ErrInvalidQuery)
+	}
+
+	db.janitorMu.Lock()
+	defer db.janitorMu.Unlock()
+
+	if db.janitorStop != nil {
+		return fmt.Errorf("%w: janitor already running", ErrInvalidQuery)
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	db.janitorStop, db.janitorDone = stop, done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				db.PurgeExpiredWithOptions(WriteOptions{Actor: JanitorActor})
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// StopJanitor stops the janitor, if running, and waits for it to exit.
+func (db *NewDatabase) StopJanitor() {
+	db.janitorMu.Lock()
+	defer db.janitorMu.Unlock()
+
+	if db.janitorStop == nil {
+		return
+	}
+
+	close(db.janitorStop)
+	<-db.janitorDone
+	db.janitorStop, db.janitorDone = nil, nil
+}
+
+// JanitorActor is the actor the audit log records for the janitor's
+// deletes; see StartJanitor.
+const JanitorActor = "janitor"
+
+// PurgeExpired removes every expired row now, publishing a delete event for
+// each, and returns how many were removed.
+func (db *NewDatabase) PurgeExpired() int {
+	return db.PurgeExpiredWithOptions(WriteOptions{})
+}
+
+// PurgeExpiredWithOptions is PurgeExpired with the deletes audited as made
+// by opts.Actor.
+func (db *NewDatabase) PurgeExpiredWithOptions(opts WriteOptions) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	purged := 0
+
+	for name, table := range db.Tables {
+		if !table.HasExpiry {
+			continue
+		}
+
+		table.ensureIndexes()
+		expired := table.deleteRows(func(row Row) bool { return isExpired(row, now) })
+		if len(expired) == 0 {
+			continue
+		}
+
+		for _, row := range expired {
+			table.audit(AuditDelete, row, Row{}, writeOrigin{actor: opts.Actor})
+		}
+		db.Tables[name] = table
+
+		for _, row := range expired {
+			db.publishChange(ChangeDelete, name, rowID(row), row, Row{})
+		}
+		db.compactIfNeeded(name)
+		purged += len(expired)
+	}
+
+	return purged
+}
+
+// Close stops the janitor, the rollup goroutines and every write buffer,
+// flushing what the buffers hold. It does not save to disk.
+func (db *NewDatabase) Close() error {
+	db.StopJanitor()
+	db.stopRollups()
+	db.stopReplicas()
+
+	db.bufferMu.Lock()
+	names := make([]string, 0, len(db.buffers))
+	for name := range db.buffers {
+		names = append(names, name)
+	}
+	db.bufferMu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		if err := db.RemoveEventualConsistencyBuffer(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isExpired(row Row, now time.Time) bool {
+	expiresAt, ok := row.Columns[expiresAtColumn].(time.Time)
+	return ok && !expiresAt.After(now)
+}
@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPurgeExpired(t *testing.T) {
+	slice, kv := newStorageDBs(t, 20)
+
+	for name, db := range map[string]*NewDatabase{"slice": slice, "kv": kv} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 5; i++ {
+				data := map[string]interface{}{"name": "temp", "n": 3}
+				if err := db.InsertRowWithTTL("items", fmt.Sprintf("t%d", i), data, time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			if purged := db.PurgeExpired(); purged != 5 {
+				t.Fatalf("PurgeExpired = %d, want 5", purged)
+			}
+			if n, _ := db.CountRows("items"); n != 20 {
+				t.Fatalf("%d rows left, want 20", n)
+			}
+
+			// The index on n must no longer name the purged rows.
+			result := mustQuery(t, db, Query{Select: []string{"id"}, From: "items", Where: "n = 3", OrderBy: "id"})
+			if got := resultIDs(result); !reflect.DeepEqual(got, []string{"r00003", "r00013"}) {
+				t.Fatalf("rows with n = 3 = %v, want [r00003 r00013]", got)
+			}
+			mustInsert(t, db, "items", "t0", map[string]interface{}{"name": "again", "n": 3})
+			if purged := db.PurgeExpired(); purged != 0 {
+				t.Fatalf("second PurgeExpired = %d, want 0", purged)
+			}
+		})
+	}
+}
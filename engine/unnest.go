@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const defaultUnnestAlias = "unnest"
+
+// unnestSource is a Query.From of the form unnest(table.column) [AS alias].
+type unnestSource struct {
+	table  string
+	column string
+	alias  string
+}
+
+// parseUnnestSource recognises an unnest source in from. It returns nil if
+// from is not one.
+func parseUnnestSource(from string) (*unnestSource, error) {
+	tokens, err := tokenize(from)
+
+	if err != nil || len(tokens) < 2 || tokens[0].kind != tokIdent || !strings.EqualFold(tokens[0].text, defaultUnnestAlias) {
+		return nil, nil
+	}
+
+	p := &exprParser{src: from, tokens: tokens, pos: 1}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	tok := p.next()
+	table, column, ok := strings.Cut(tok.text, ".")
+	if tok.kind != tokIdent || !ok || table == "" || column == "" || strings.Contains(column, ".") {
+		return nil, p.errorf(tok, "unnest needs a table.column argument, found %q", tok.text)
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	source := &unnestSource{table: table, column: column, alias: defaultUnnestAlias}
+	if p.acceptKeyword("AS") {
+		tok := p.next()
+		if tok.kind != tokIdent || strings.Contains(tok.text, ".") {
+			return nil, p.errorf(tok, "expected a column name after AS, found %q", tok.text)
+		}
+		source.alias = tok.text
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return source, nil
+}
+
+func (s unnestSource) String() string {
+	return fmt.Sprintf("unnest(%s.%s) AS %s", s.table, s.column, s.alias)
+}
+
+// unnestRows replaces each row by one row per element of its array in the
+// source column, each holding the row's columns plus the element under the
+// alias. Rows whose array is NULL or empty produce no rows.
+func unnestRows(ctx context.Context, rows []Row, source *unnestSource) ([]Row, error) {
+	var unnested []Row
+
+	for i, row := range rows {
+		if err := queryCheckpoint(ctx, i); err != nil {
+			return nil, err
+		}
+
+		val := row.Columns[source.column]
+		if val == nil {
+			continue
+		}
+
+		array := reflect.ValueOf(val)
+		if array.Kind() != reflect.Slice && array.Kind() != reflect.Array {
+			return nil, fmt.Errorf("%w: unnest of %s.%s in row %s: %T is not an array", ErrInvalidQuery, source.table, source.column, rowID(row), val)
+		}
+
+		for j := 0; j < array.Len(); j++ {
+			elem := Row{Columns: make(map[string]interface{}, len(row.Columns)+1)}
+			for key, v := range row.Columns {
+				elem.Columns[key] = v
+			}
+			elem.Columns[source.alias] = array.Index(j).Interface()
+			unnested = append(unnested, elem)
+		}
+	}
+
+	return unnested, nil
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func unnestTestDB(t *testing.T) *NewDatabase {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "posts", []Column{
+		{Name: "title", DataType: String},
+		{Name: "tags", DataType: Array, ElementType: String, Nullable: true},
+	}, nil)
+	mustInsertRows(t, db, "posts", map[string]map[string]interface{}{
+		"p1": {"title": "go", "tags": []interface{}{"lang", "fast", "simple"}},
+		"p2": {"title": "none", "tags": nil},
+		"p3": {"title": "empty", "tags": []interface{}{}},
+		"p4": {"title": "db", "tags": []interface{}{"fast"}},
+	})
+	return db
+}
+
+func TestUnnest(t *testing.T) {
+	db := unnestTestDB(t)
+
+	result := mustQuery(t, db, Query{Select: []string{"id", "title", "tag"}, From: "unnest(posts.tags) AS tag", Where: "id = 'p1'"})
+	if len(result.Rows) != 3 {
+		t.Fatalf("a 3-element array produced %d rows, want 3", len(result.Rows))
+	}
+	var tags []interface{}
+	for _, row := range result.Rows {
+		if row.Columns["id"] != "p1" || row.Columns["title"] != "go" {
+			t.Errorf("row %v lost the post's columns", row.Columns)
+		}
+		tags = append(tags, row.Columns["tag"])
+	}
+	if want := []interface{}{"lang", "fast", "simple"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %v, want %v", tags, want)
+	}
+
+	for _, id := range []string{"p2", "p3"} {
+		result := mustQuery(t, db, Query{Select: []string{"id"}, From: "unnest(posts.tags) AS tag", Where: "id = '" + id + "'"})
+		if len(result.Rows) != 0 {
+			t.Errorf("post %s produced %d rows, want none", id, len(result.Rows))
+		}
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "unnest(posts.tags) AS tag", Where: "tag = 'fast'", OrderBy: "id"})
+	if ids := resultIDs(result); !reflect.DeepEqual(ids, []string{"p1", "p4"}) {
+		t.Errorf("posts tagged fast = %v, want [p1 p4]", ids)
+	}
+}
+
+func TestUnnestJoin(t *testing.T) {
+	db := unnestTestDB(t)
+	mustCreateTable(t, db, "tag_info", []Column{{Name: "label", DataType: String}}, nil)
+	mustInsert(t, db, "tag_info", "fast", map[string]interface{}{"label": "Fast"})
+	mustInsert(t, db, "tag_info", "lang", map[string]interface{}{"label": "Language"})
+
+	result := mustQuery(t, db, Query{
+		Select:  []string{"posts.id", "tag_info.label"},
+		From:    "unnest(posts.tags) AS tag",
+		Joins:   []Join{{Table: "tag_info", On: "tag_info.id = posts.tag"}},
+		OrderBy: "posts.id, tag_info.label",
+	})
+	var got [][2]interface{}
+	for _, row := range result.Rows {
+		got = append(got, [2]interface{}{row.Columns["posts.id"], row.Columns["tag_info.label"]})
+	}
+	want := [][2]interface{}{{"p1", "Fast"}, {"p1", "Language"}, {"p4", "Fast"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("join = %v, want %v", got, want)
+	}
+}
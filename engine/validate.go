@@ -0,0 +1,179 @@
+package engine
+
+import "strings"
+
+// ValidateQuery checks query without reading any rows, returning the first
+// problem as a *QueryError. Besides the syntax, clause and aggregate checks
+// ExecuteQuery makes, it rejects:
+//
+//   - a table or view that does not exist;
+//   - a column, in any clause, that no table the query reads declares, so
+//     that a column rows carry without it being in the schema is unknown;
+//   - a comparison between values that can never compare equal, such as
+//     an Int column and a string (CodeTypeMismatch);
+//   - Args that do not match the query's parameters.
+//
+// The query has no GROUP BY: its SELECT items are all aggregates or none
+// are.
+func (db *NewDatabase) ValidateQuery(query Query) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	query, err = db.expandViews(query)
+
+	if err != nil {
+		return asQueryError(err)
+	}
+
+	plan, err := db.planQuery(query)
+
+	if err != nil {
+		return asQueryError(err)
+	}
+	if _, err := plan.bind(query.Args); err != nil {
+		return asQueryError(err)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, op := range plan.Operations {
+		if op.Type == Scan {
+			if _, err := db.sourceTable(op); err != nil {
+				return err
+			}
+		}
+	}
+
+	var names joinNames
+	if plan.hasJoins() {
+		if names, err = db.joinNames(plan); err != nil {
+			return err
+		}
+	}
+	types := db.columnTypes(plan, names)
+	known := db.knownColumns(plan, types)
+
+	for _, op := range plan.Operations {
+		clause, text := op.clause(query)
+		for _, e := range op.exprs() {
+			if err := checkExpr(e, known, types); err != nil {
+				return positioned(err, clause, text)
+			}
+		}
+
+		for _, key := range op.orderKeys {
+			if !known(key.Column) && !selected(query.Select, key.Column) {
+				return positioned(unknownColumn(key.Column), "OrderBy", query.OrderBy)
+			}
+		}
+	}
+	return nil
+}
+
+// knownColumns returns a function that reports whether a query planned as
+// plan can read name: a column of types or the match score, bare or
+// qualified by its table, or a path into one. The caller must hold db.mu.
+func (db *NewDatabase) knownColumns(plan ExecutionPlan, types map[string]DataType) func(string) bool {
+	tables := make(map[string]bool)
+	for _, op := range plan.Operations {
+		if op.Type == Scan || op.Type == JoinOp {
+			tables[op.Table] = true
+			if op.unnest != nil {
+				types[op.unnest.alias] = Array
+			}
+		}
+	}
+
+	return func(name string) bool {
+		if prefix, rest, ok := strings.Cut(name, "."); ok && tables[prefix] {
+			if _, ok := types[name]; ok {
+				return true
+			}
+			name = rest
+		}
+		if end := strings.IndexAny(name, ".["); end >= 0 {
+			name = name[:end]
+		}
+		_, ok := types[name]
+		return ok || name == matchScoreColumn
+	}
+}
+
+// checkExpr rejects the unknown columns in e and the comparisons between
+// values of types that never compare equal.
+func checkExpr(e expr, known func(string) bool, types map[string]DataType) error {
+	_, err := rewriteExpr(e, func(e expr) (expr, error) {
+		switch e := e.(type) {
+		case columnExpr:
+			if !known(e.name) {
+				return nil, unknownColumn(e.name)
+			}
+		case binaryExpr:
+			if !isComparison(e.op) {
+				break
+			}
+			left, lok := exprType(e.left, types)
+			right, rok := exprType(e.right, types)
+			if lok && rok && !comparableTypes(left, right) {
+				return nil, queryError(CodeTypeMismatch, ErrInvalidCast, e.op, "cannot compare %s (%s) with %s (%s)", e.left, left, e.right, right)
+			}
+		}
+		return e, nil
+	})
+	return err
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// comparableTypes reports whether values of types a and b can compare
+// equal: numbers with numbers, and strings, enum values and date-times
+// with each other. JSON values can hold anything.
+func comparableTypes(a, b DataType) bool {
+	family := func(t DataType) DataType {
+		switch t {
+		case Float, Decimal:
+			return Int
+		case Enum, DateTime:
+			return String
+		}
+		return t
+	}
+	return a == JSON || b == JSON || family(a) == family(b)
+}
+
+func unknownColumn(name string) *QueryError {
+	return queryError(CodeUnknownColumn, ErrInvalidQuery, name, "unknown column %s: no table the query reads declares it", name)
+}
+
+// selected reports whether name is one of the query's SELECT items.
+func selected(items []string, name string) bool {
+	for _, item := range items {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// positioned records clause, and the position of the error's token in
+// text, on err if it is a QueryError without them.
+func positioned(err error, clause, text string) error {
+	if qe, ok := err.(*QueryError); ok && qe.Clause == "" {
+		qe.Clause = clause
+		if text != "" && qe.Token != "" {
+			qe.Position = strings.Index(text, qe.Token)
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func validateTestDB(t *testing.T) *NewDatabase {
+	db := usersOrdersTestDB(t, false)
+	mustInsert(t, db, "users", "u1", map[string]interface{}{"name": "x1", "age": 30})
+	return db
+}
+
+func TestValidateQueryAccepts(t *testing.T) {
+	db := validateTestDB(t)
+
+	for _, query := range []Query{
+		{Select: []string{"id", "name"}, From: "users", Where: "age > 30 AND name LIKE 'a%'", OrderBy: "age DESC"},
+		{Select: []string{"COUNT(*)", "AVG(age)"}, From: "users"},
+		{Select: []string{"users.name", "orders.total"}, From: "users", Joins: []Join{{Table: "orders", On: "orders.user_id = users.id"}}, Where: "orders.total > $1", Args: []interface{}{10}},
+		{Select: []string{"UPPER(name)"}, From: "users", OrderBy: "name"},
+		// Validation reads no rows, so a cast that fails on the data passes.
+		{Select: []string{"id"}, From: "users", Where: "CAST(name AS INT) > 0"},
+	} {
+		if err := db.ValidateQuery(query); err != nil {
+			t.Errorf("ValidateQuery(%+v) = %v", query, err)
+		}
+	}
+}
+
+func TestValidateQueryRejects(t *testing.T) {
+	db := validateTestDB(t)
+
+	tests := []struct {
+		name   string
+		query  Query
+		code   ErrorCode
+		clause string
+	}{
+		{"unknown table", Query{Select: []string{"id"}, From: "missing"}, CodeUnknownTable, ""},
+		{"unknown column in SELECT", Query{Select: []string{"email"}, From: "users"}, CodeUnknownColumn, "Select"},
+		{"unknown column in WHERE", Query{Select: []string{"id"}, From: "users", Where: "agee > 3"}, CodeUnknownColumn, "Where"},
+		{"unknown column in ORDER BY", Query{Select: []string{"id"}, From: "users", OrderBy: "email"}, CodeUnknownColumn, "OrderBy"},
+		{"unknown column in ON", Query{Select: []string{"users.id"}, From: "users", Joins: []Join{{Table: "orders", On: "orders.uid = users.id"}}}, CodeUnknownColumn, "Join"},
+		{"bad filter", Query{Select: []string{"id"}, From: "users", Where: "age >"}, CodeSyntaxError, "Where"},
+		{"unknown function", Query{Select: []string{"id"}, From: "users", Where: "FROB(age) = 1"}, CodeUnknownFunction, "Where"},
+		{"aggregate mixed with a column", Query{Select: []string{"name", "COUNT(*)"}, From: "users"}, CodeInvalidArgument, "Select"},
+		{"type mismatch", Query{Select: []string{"id"}, From: "users", Where: "age = 'thirty'"}, CodeTypeMismatch, "Where"},
+		{"missing argument", Query{Select: []string{"id"}, From: "users", Where: "age > $2", Args: []interface{}{1}}, CodeInvalidArgument, ""},
+	}
+	for _, tt := range tests {
+		err := db.ValidateQuery(tt.query)
+
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("%s: ValidateQuery = %v, want a QueryError", tt.name, err)
+			continue
+		}
+		if qe.Code != tt.code {
+			t.Errorf("%s: code %s, want %s (%v)", tt.name, qe.Code, tt.code, err)
+		}
+		if tt.clause != "" && qe.Clause != tt.clause {
+			t.Errorf("%s: clause %q, want %q (%v)", tt.name, qe.Clause, tt.clause, err)
+		}
+	}
+}
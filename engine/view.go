@@ -0,0 +1,414 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CreateView stores query as the view name, which queries can then read
+// as if it were a table. A query from a view is expanded into one from the
+// table the view reads: the view's WHERE is ANDed with the query's, and
+// the query's expressions are evaluated over the view's SELECT items.
+//
+// A view reads a single table or view: it cannot have Joins, Limit,
+// Offset, Args or parameters, aggregate SELECT items or a table function
+// as its From. Its columns are its SELECT items; a query from it may name
+// those that are plain columns, bare or qualified by the view's name, and
+// may select the others by repeating them as written. A qualified column
+// is named in results as the table's column is. The view's OrderBy applies
+// when the query has none. A view cannot be joined, and writes to
+// one fail with ErrViewReadOnly. Like sequences, views are not saved to
+// disk.
+func (db *NewDatabase) CreateView(name string, query Query) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := validateView(name, query); err != nil {
+		return err
+	}
+	if _, err := db.planQuery(query); err != nil {
+		return fmt.Errorf("view %s: %w", name, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.Tables[name]; exists || db.metaTables[name] != nil || db.views[name] != nil {
+		return fmt.Errorf("%w: %s", ErrTableExists, name)
+	}
+	if _, ok := db.Tables[query.From]; !ok && db.views[query.From] == nil && db.metaTables[query.From] == nil {
+		return fmt.Errorf("view %s: %w: %s", name, ErrTableNotFound, query.From)
+	}
+
+	query.Select = append([]string(nil), query.Select...)
+	if db.views == nil {
+		db.views = make(map[string]*Query)
+	}
+	db.views[name] = &query
+	return nil
+}
+
+// DropView removes the view name. It fails with ErrViewDependency if
+// another view reads it.
+func (db *NewDatabase) DropView(name string) error {
+	done, err := db.startOp()
+
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.views[name] == nil {
+		return fmt.Errorf("%w: view %s", ErrTableNotFound, name)
+	}
+	if dependents := db.viewsOn(name); len(dependents) > 0 {
+		return fmt.Errorf("%w: view %s is read by %s", ErrViewDependency, name, strings.Join(dependents, ", "))
+	}
+
+	delete(db.views, name)
+	return nil
+}
+
+func validateView(name string, query Query) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: view needs a name", ErrInvalidQuery)
+	case len(query.Select) == 0:
+		return fmt.Errorf("%w: view %s has no SELECT items", ErrInvalidQuery, name)
+	case len(query.Joins) > 0, query.Limit != 0, query.Offset != 0, len(query.Args) > 0, query.GenerateSeries != nil:
+		return fmt.Errorf("%w: view %s must read one table, without Joins, Limit, Offset or Args", ErrInvalidQuery, name)
+	}
+
+	series, unnest, err := parseSource(query.From)
+
+	if err != nil {
+		return fmt.Errorf("view %s: %w", name, err)
+	}
+	if series != nil || unnest != nil {
+		return fmt.Errorf("%w: view %s must read a table or view, not %s", ErrInvalidQuery, name, query.From)
+	}
+
+	projections, aggregate, err := parseProjections(query.Select)
+
+	if err != nil {
+		return fmt.Errorf("view %s: %w", name, err)
+	}
+	if aggregate {
+		return fmt.Errorf("%w: view %s cannot have aggregate SELECT items", ErrInvalidQuery, name)
+	}
+
+	exprs := make([]expr, 0, len(projections)+1)
+	for _, p := range projections {
+		exprs = append(exprs, p.expr)
+	}
+	if query.Where != "" {
+		where, err := parseExpr(query.Where)
+
+		if err != nil {
+			return fmt.Errorf("view %s: %w", name, err)
+		}
+		exprs = append(exprs, where)
+	}
+	for _, e := range exprs {
+		if _, err := rewriteExpr(e, func(e expr) (expr, error) {
+			if _, ok := e.(paramExpr); ok {
+				return nil, fmt.Errorf("%w: view %s cannot have parameters", ErrInvalidQuery, name)
+			}
+			return e, nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// viewsOn returns the names of the views that read name, sorted. The
+// caller must hold db.mu.
+func (db *NewDatabase) viewsOn(name string) []string {
+	var names []string
+	for view, query := range db.views {
+		if query.From == name {
+			names = append(names, view)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dropViewsOn drops the views that read name, and those that read them,
+// returning their names. The caller must hold db.mu for writing.
+func (db *NewDatabase) dropViewsOn(name string) []string {
+	var dropped []string
+	for _, view := range db.viewsOn(name) {
+		dropped = append(dropped, db.dropViewsOn(view)...)
+		delete(db.views, view)
+		dropped = append(dropped, view)
+	}
+	return dropped
+}
+
+// notWritable returns the error for a write to tableName, which is not a
+// table or is a materialized view: ErrViewReadOnly if it is a view of
+// either kind and ErrTableNotFound otherwise. The caller must hold db.mu.
+func (db *NewDatabase) notWritable(tableName string) error {
+	if db.views[tableName] != nil || db.matViews[tableName] != nil {
+		return fmt.Errorf("%w: %s", ErrViewReadOnly, tableName)
+	}
+	return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+}
+
+// describeView returns the schema of the view name: its SELECT items as
+// columns, typed where the table it reads says how. The caller must hold
+// db.mu.
+func (db *NewDatabase) describeView(name string) TableSchema {
+	view := db.views[name]
+	schema := TableSchema{Name: name, View: view}
+
+	var source TableSchema
+	if db.views[view.From] != nil {
+		source = db.describeView(view.From)
+	} else if table, ok := db.queryTable(view.From); ok {
+		source = TableSchema{Columns: table.Columns}
+	}
+
+	types := map[string]DataType{"id": String}
+	columns := map[string]Column{"id": {Name: "id", DataType: String}}
+	for _, col := range source.Columns {
+		types[col.Name] = col.DataType
+		columns[col.Name] = col
+	}
+
+	for _, item := range view.Select {
+		if col, ok := columns[item]; ok {
+			schema.Columns = append(schema.Columns, col)
+			continue
+		}
+		col := Column{Name: item, DataType: String, Nullable: true}
+		if e, err := parseExpr(item); err == nil {
+			if dataType, ok := exprType(e, types); ok {
+				col.DataType = dataType
+			}
+		}
+		schema.Columns = append(schema.Columns, col)
+	}
+	return schema
+}
+
+// expandViews returns query with every view it reads from replaced by the
+// query the view stands for, as CreateView describes.
+func (db *NewDatabase) expandViews(query Query) (Query, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(db.views) == 0 {
+		return query, nil
+	}
+	for _, join := range query.Joins {
+		if db.views[join.Table] != nil {
+			return Query{}, inClause("Join", queryError(CodeInvalidArgument, ErrInvalidQuery, join.Table, "view %s cannot be joined", join.Table))
+		}
+	}
+
+	for query.GenerateSeries == nil && db.views[query.From] != nil {
+		expanded, err := mergeView(query.From, *db.views[query.From], query)
+
+		if err != nil {
+			return Query{}, err
+		}
+		query = expanded
+	}
+	return query, nil
+}
+
+// mergeView returns outer, a query from the view name, as a query from the
+// table view reads.
+func mergeView(name string, view, outer Query) (Query, error) {
+	joined := len(outer.Joins) > 0
+	visible := make(map[string]bool, len(view.Select))
+	items := make(map[string]bool, len(view.Select))
+	for _, item := range view.Select {
+		items[canonicalExpr(item)] = true
+		if e, err := parseExpr(item); err == nil {
+			if col, ok := e.(columnExpr); ok {
+				visible[col.name] = true
+			}
+		}
+	}
+
+	// base reads a column of the view from the table it reads, which in
+	// a join query is qualified by that table's name.
+	base := func(column string) string {
+		if joined {
+			return view.From + "." + column
+		}
+		return column
+	}
+
+	// rename rewrites the view's columns in src, an outer expression, to
+	// the table's. It returns src unchanged if no name changes, so that
+	// SELECT items keep their names.
+	rename := func(clause, src string) (string, error) {
+		e, err := parseExpr(src)
+
+		if err != nil {
+			return "", inClause(clause, err)
+		}
+
+		changed := false
+		e, err = rewriteExpr(e, func(e expr) (expr, error) {
+			col, ok := e.(columnExpr)
+			if !ok {
+				return e, nil
+			}
+
+			column, qualified := strings.CutPrefix(col.name, name+".")
+			if !qualified && joined {
+				// A bare name in a join may be another table's column.
+				return e, nil
+			}
+			root := column
+			if end := strings.IndexAny(column, ".["); end >= 0 {
+				root = column[:end]
+			}
+			if !visible[column] && !visible[root] {
+				return nil, inClause(clause, queryError(CodeUnknownColumn, ErrInvalidQuery, col.name, "unknown column %s: view %s has no column %s", col.name, name, root))
+			}
+			if column = base(column); column != col.name {
+				changed = true
+			}
+			return newColumnExpr(column), nil
+		})
+
+		if err != nil || !changed {
+			return src, err
+		}
+		return e.String(), nil
+	}
+
+	merged := Query{
+		From:           view.From,
+		Limit:          outer.Limit,
+		Offset:         outer.Offset,
+		IncludeDeleted: view.IncludeDeleted || outer.IncludeDeleted,
+		NoCache:        outer.NoCache,
+		Args:           outer.Args,
+	}
+
+	for _, item := range outer.Select {
+		if items[canonicalExpr(item)] && !joined {
+			merged.Select = append(merged.Select, item)
+			continue
+		}
+
+		renamed, err := rename("Select", item)
+
+		if err != nil {
+			return Query{}, err
+		}
+		merged.Select = append(merged.Select, renamed)
+	}
+
+	for _, join := range outer.Joins {
+		on, err := rename("Join", join.On)
+
+		if err != nil {
+			return Query{}, err
+		}
+		merged.Joins = append(merged.Joins, Join{Table: join.Table, On: on})
+	}
+
+	where := view.Where
+	if where != "" && joined {
+		qualified, err := qualifyColumns(where, view.From)
+
+		if err != nil {
+			return Query{}, inClause("Where", err)
+		}
+		where = qualified
+	}
+	if strings.TrimSpace(outer.Where) != "" {
+		outerWhere, err := rename("Where", outer.Where)
+
+		if err != nil {
+			return Query{}, err
+		}
+		if where == "" {
+			where = outerWhere
+		} else {
+			where = "(" + where + ") AND (" + outerWhere + ")"
+		}
+	}
+	merged.Where = where
+
+	order, err := renameOrderBy(outer.OrderBy, func(column string) (string, error) {
+		return rename("OrderBy", column)
+	})
+
+	if err != nil {
+		return Query{}, err
+	}
+	if order == "" && view.OrderBy != "" {
+		order, err = renameOrderBy(view.OrderBy, func(column string) (string, error) {
+			return base(column), nil
+		})
+
+		if err != nil {
+			return Query{}, err
+		}
+	}
+	merged.OrderBy = order
+	return merged, nil
+}
+
+// qualifyColumns returns src, an expression over table's columns, with
+// every column qualified by table.
+func qualifyColumns(src, table string) (string, error) {
+	e, err := parseExpr(src)
+
+	if err != nil {
+		return "", err
+	}
+	e, err = rewriteExpr(e, func(e expr) (expr, error) {
+		if col, ok := e.(columnExpr); ok {
+			return newColumnExpr(table + "." + col.name), nil
+		}
+		return e, nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return e.String(), nil
+}
+
+// renameOrderBy returns orderBy with the column of each term replaced by
+// fn's result for it.
+func renameOrderBy(orderBy string, fn func(string) (string, error)) (string, error) {
+	if strings.TrimSpace(orderBy) == "" {
+		return "", nil
+	}
+
+	terms := strings.Split(orderBy, ",")
+	for i, term := range terms {
+		fields := strings.Fields(term)
+		if len(fields) == 0 {
+			return orderBy, nil
+		}
+
+		column, err := fn(fields[0])
+
+		if err != nil {
+			return "", err
+		}
+		terms[i] = strings.Join(append([]string{column}, fields[1:]...), " ")
+	}
+	return strings.Join(terms, ", "), nil
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// viewTestDB returns usersOrdersTestDB's tables, filled, with the view
+// adults over users. Bob is a minor and Dee's age is unknown, so adults
+// holds Ann and Cy, oldest first.
+func viewTestDB(t *testing.T) *NewDatabase {
+	t.Helper()
+	db := usersOrdersTestDB(t, false)
+	mustInsertRows(t, db, "users", map[string]map[string]interface{}{
+		"u1": {"name": "Ann", "age": 30},
+		"u2": {"name": "Bob", "age": 17},
+		"u3": {"name": "Cy", "age": 45},
+		"u4": {"name": "Dee", "age": nil},
+	})
+	mustInsertRows(t, db, "orders", map[string]map[string]interface{}{
+		"o1": {"user_id": "u1", "total": 10},
+		"o2": {"user_id": "u2", "total": 20},
+		"o3": {"user_id": "u3", "total": 30},
+	})
+
+	view := Query{Select: []string{"id", "name", "age", "age * 2"}, From: "users", Where: "age >= 18", OrderBy: "age DESC"}
+	if err := db.CreateView("adults", view); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestViewColumnNames(t *testing.T) {
+	db := viewTestDB(t)
+
+	for _, column := range []string{"name", "adults.name"} {
+		result := mustQuery(t, db, Query{Select: []string{"id", column}, From: "adults", Where: column + " = 'Ann'"})
+		if got := resultIDs(result); !reflect.DeepEqual(got, []string{"u1"}) {
+			t.Fatalf("%s = 'Ann' matched %v, want [u1]", column, got)
+		}
+		if got := result.Rows[0].Columns["name"]; got != "Ann" {
+			t.Errorf("selecting %s: name = %v, want Ann", column, got)
+		}
+	}
+
+	result := mustQuery(t, db, Query{Select: []string{"id", "age * 2"}, From: "adults", OrderBy: "adults.age"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"u1", "u3"}) {
+		t.Fatalf("ordered by adults.age = %v, want [u1 u3]", got)
+	}
+	if got := toFloat(result.Rows[0].Columns["age * 2"]); got != 60 {
+		t.Errorf("age * 2 = %v, want 60", got)
+	}
+
+	for _, query := range []Query{
+		{Select: []string{"id"}, From: "adults", Where: "nope = 1"},
+		{Select: []string{"adults.nope"}, From: "adults"},
+		{Select: []string{"id"}, From: "adults", OrderBy: "nope"},
+	} {
+		if _, err := db.ExecuteQuery(query); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("ExecuteQuery(%+v) = %v, want ErrInvalidQuery", query, err)
+		}
+	}
+}
+
+func TestViewWhereAndOrderBy(t *testing.T) {
+	db := viewTestDB(t)
+
+	// The view's WHERE still applies, and so does its OrderBy when the
+	// query has none.
+	result := mustQuery(t, db, Query{Select: []string{"id"}, From: "adults"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"u3", "u1"}) {
+		t.Fatalf("adults = %v, want [u3 u1]", got)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "adults", Where: "name != 'Cy' OR age < 18"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"u1"}) {
+		t.Fatalf("adults filtered = %v, want [u1]", got)
+	}
+
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "adults", OrderBy: "name DESC"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"u3", "u1"}) {
+		t.Fatalf("adults by name DESC = %v, want [u3 u1]", got)
+	}
+	result = mustQuery(t, db, Query{Select: []string{"id"}, From: "adults", OrderBy: "name"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"u1", "u3"}) {
+		t.Fatalf("adults by name = %v, want [u1 u3]", got)
+	}
+}
+
+func TestNestedViews(t *testing.T) {
+	db := viewTestDB(t)
+	mustInsert(t, db, "users", "u5", map[string]interface{}{"name": "Eve", "age": 60})
+
+	if err := db.CreateView("seniors", Query{Select: []string{"id", "name"}, From: "adults", Where: "age > 40"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The inner view's OrderBy applies through the outer one.
+	result := mustQuery(t, db, Query{Select: []string{"id", "seniors.name"}, From: "seniors"})
+	if got := resultIDs(result); !reflect.DeepEqual(got, []string{"u5", "u3"}) {
+		t.Fatalf("seniors = %v, want [u5 u3]", got)
+	}
+
+	// age is a column of adults but not of seniors.
+	if _, err := db.ExecuteQuery(Query{Select: []string{"id"}, From: "seniors", Where: "age > 50"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("filtering seniors on age = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestViewInJoin(t *testing.T) {
+	db := viewTestDB(t)
+
+	result := mustQuery(t, db, Query{
+		Select:  []string{"adults.name", "orders.total"},
+		From:    "adults",
+		Joins:   []Join{{Table: "orders", On: "adults.id = orders.user_id"}},
+		Where:   "total > 15",
+		OrderBy: "adults.name",
+	})
+	if len(result.Rows) != 1 {
+		t.Fatalf("join returned %d rows, want 1: %+v", len(result.Rows), result.Rows)
+	}
+	if name := result.Rows[0].Columns["users.name"]; name != "Cy" {
+		t.Errorf("joined row = %v, want Cy's order", result.Rows[0].Columns)
+	}
+
+	_, err := db.ExecuteQuery(Query{
+		Select: []string{"orders.id"},
+		From:   "orders",
+		Joins:  []Join{{Table: "adults", On: "adults.id = orders.user_id"}},
+	})
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("joining a view = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestDropViewDependencies(t *testing.T) {
+	db := viewTestDB(t)
+	if err := db.CreateView("seniors", Query{Select: []string{"id"}, From: "adults", Where: "age > 40"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DropTable("users"); !errors.Is(err, ErrViewDependency) {
+		t.Fatalf("DropTable(users) = %v, want ErrViewDependency", err)
+	}
+	if err := db.DropView("adults"); !errors.Is(err, ErrViewDependency) {
+		t.Fatalf("DropView(adults) = %v, want ErrViewDependency", err)
+	}
+	mustQuery(t, db, Query{Select: []string{"id"}, From: "seniors"})
+
+	if err := db.DropView("seniors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropView("adults"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropView("adults"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("second DropView(adults) = %v, want ErrTableNotFound", err)
+	}
+	if err := db.DropTable("users"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestViewWritesReadOnly(t *testing.T) {
+	db := viewTestDB(t)
+
+	writes := map[string]error{
+		"InsertRow":   db.InsertRow("adults", "u9", map[string]interface{}{"name": "Zed", "age": 20}),
+		"UpdateRow":   db.UpdateRow("adults", "u1", map[string]interface{}{"age": 31}),
+		"DeleteRow":   db.DeleteRow("adults", "u1"),
+		"BulkLoad":    db.BulkLoad("adults", []Row{{Columns: map[string]interface{}{"id": "u9", "name": "Zed"}}}),
+		"DeleteWhere": func() error { _, err := db.DeleteWhere("adults", "age > 0"); return err }(),
+	}
+	for name, err := range writes {
+		if !errors.Is(err, ErrViewReadOnly) {
+			t.Errorf("%s on a view = %v, want ErrViewReadOnly", name, err)
+		}
+	}
+	if n, _ := db.CountRows("users"); n != 4 {
+		t.Errorf("users has %d rows, want 4 unchanged", n)
+	}
+}
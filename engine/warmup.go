@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// SetLogger sets where the database reports maintenance work such as
+// WarmUp. A nil logger, the default, discards the reports.
+func (db *NewDatabase) SetLogger(l *log.Logger) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.logger = l
+}
+
+// WarmUp builds the id map, every secondary index and, for key-value
+// storage, the ordered row cache of tableName, so the first query against
+// it does not pay for them.
+func (db *NewDatabase) WarmUp(tableName string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.warmUpLocked(tableName)
+}
+
+func (db *NewDatabase) WarmUpAll() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	names := make([]string, 0, len(db.Tables))
+	for name := range db.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := db.warmUpLocked(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *NewDatabase) warmUpLocked(tableName string) error {
+	table, ok := db.Tables[tableName]
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	start := time.Now()
+	table.ensureIndexes()
+	rows := len(table.allRows())
+	db.Tables[tableName] = table
+
+	entries := 0
+	for _, keys := range table.indexData {
+		for _, ids := range keys {
+			entries += len(ids)
+		}
+	}
+
+	db.logf("warmed up table %s: %d rows, %d index entries in %s", tableName, rows, entries, time.Since(start))
+	return nil
+}
+
+// logf reports to the logger set with SetLogger. The caller must hold db.mu.
+func (db *NewDatabase) logf(format string, args ...interface{}) {
+	if db.logger != nil {
+		db.logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultWatchBuffer = 64
+
+type watcher struct {
+	ch         chan ChangeEvent
+	overflowed bool
+	lastSeq    uint64
+	closed     bool
+
+	// markOverflow makes send follow dropped events with a ChangeOverflow
+	// event, as Watch promises. dropped counts the dropped events, and is
+	// read without db.watchMu by TableWatcher.DroppedEvents. stopped is
+	// closed along with ch.
+	markOverflow bool
+	dropped      atomic.Uint64
+	stopped      chan struct{}
+}
+
+// Watch subscribes to committed mutations of tableName. Events are delivered
+// in commit order through a channel buffered to opts.BufferSize. Writers
+// never block on a slow subscriber: when the buffer is full events are
+// dropped, and a ChangeOverflow event carrying the sequence number of the
+// last dropped event is delivered once there is room again. The returned
+// func unsubscribes and closes the channel.
+func (db *NewDatabase) Watch(tableName string, opts WatchOptions) (<-chan ChangeEvent, func(), error) {
+	w, cancel, err := db.addWatcher(tableName, opts, true)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.ch, cancel, nil
+}
+
+// WatchTable subscribes to committed mutations of tableName until ctx is
+// done, when the watcher's channel is closed. Every subscriber receives
+// every event, in commit order, through a channel of the default buffer
+// size.
+func (db *NewDatabase) WatchTable(ctx context.Context, tableName string) (*TableWatcher, error) {
+	return db.WatchTableWithOptions(ctx, tableName, WatchOptions{})
+}
+
+// WatchTableWithOptions is WatchTable with the channel buffered to
+// opts.BufferSize. An event that finds the buffer full is dropped and
+// counted in DroppedEvents; unlike with Watch, no ChangeOverflow event
+// follows.
+func (db *NewDatabase) WatchTableWithOptions(ctx context.Context, tableName string, opts WatchOptions) (*TableWatcher, error) {
+	w, cancel, err := db.addWatcher(tableName, opts, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-w.stopped:
+		}
+	}()
+	return &TableWatcher{C: w.ch, w: w}, nil
+}
+
+// DroppedEvents returns how many events tw has dropped because its buffer
+// was full. The count stays readable after the subscription has ended.
+func (tw *TableWatcher) DroppedEvents() uint64 {
+	return tw.w.dropped.Load()
+}
+
+func (db *NewDatabase) addWatcher(tableName string, opts WatchOptions, markOverflow bool) (*watcher, func(), error) {
+	db.mu.RLock()
+	_, ok := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	size := opts.BufferSize
+	if size <= 0 {
+		size = defaultWatchBuffer
+	}
+	w := &watcher{ch: make(chan ChangeEvent, size), markOverflow: markOverflow, stopped: make(chan struct{})}
+
+	db.watchMu.Lock()
+	if db.watchers == nil {
+		db.watchers = make(map[string][]*watcher)
+	}
+	db.watchers[tableName] = append(db.watchers[tableName], w)
+	db.watchMu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			db.watchMu.Lock()
+			defer db.watchMu.Unlock()
+
+			list := db.watchers[tableName]
+			for i, other := range list {
+				if other == w {
+					db.watchers[tableName] = append(list[:i], list[i+1:]...)
+					break
+				}
+			}
+			w.close()
+		})
+	}
+
+	return w, cancel, nil
+}
+
+// closeWatchers closes the channel of every subscriber, as if each had
+// unsubscribed.
+func (db *NewDatabase) closeWatchers() {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for _, list := range db.watchers {
+		for _, w := range list {
+			w.close()
+		}
+	}
+	db.watchers = nil
+}
+
+// close closes w's channel unless it is already closed. The caller must
+// hold db.watchMu.
+func (w *watcher) close() {
+	if !w.closed {
+		w.closed = true
+		close(w.ch)
+		close(w.stopped)
+	}
+}
+
+// publishChange must be called with db.mu held for writing, after the
+// mutation has been applied, so that sequence numbers follow commit order.
+func (db *NewDatabase) publishChange(op ChangeOp, tableName, id string, oldRow, newRow Row) {
+	db.publishEvent(ChangeEvent{Op: op, TableName: tableName, RowID: id, OldRow: oldRow, NewRow: newRow})
+}
+
+// publishApplied publishes change as publishChange would, with the ID of
+// the transaction that made it.
+func (db *NewDatabase) publishApplied(change appliedChange) {
+	db.publishEvent(ChangeEvent{
+		Op:        change.op,
+		TableName: change.tableName,
+		RowID:     change.id,
+		OldRow:    change.oldRow,
+		NewRow:    change.newRow,
+		TxID:      change.txID,
+	})
+}
+
+// publishEvent numbers and timestamps event and sends it to the watchers
+// of its table and to the replicas.
+func (db *NewDatabase) publishEvent(event ChangeEvent) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	db.changeSeq++
+	event.Seq = db.changeSeq
+	event.Timestamp = time.Now()
+
+	for _, w := range db.watchers[event.TableName] {
+		w.send(event)
+	}
+	db.replicateChange(event)
+}
+
+func (w *watcher) send(event ChangeEvent) {
+	if w.closed {
+		return
+	}
+
+	if w.overflowed {
+		select {
+		case w.ch <- ChangeEvent{Seq: w.lastSeq, Op: ChangeOverflow, TableName: event.TableName, Timestamp: event.Timestamp}:
+			w.overflowed = false
+		default:
+			w.dropped.Add(1)
+			w.lastSeq = event.Seq
+			return
+		}
+	}
+
+	select {
+	case w.ch <- event:
+	default:
+		w.dropped.Add(1)
+		w.overflowed = w.markOverflow
+		w.lastSeq = event.Seq
+	}
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitClosed fails t unless ch is drained and closed within a second.
+func waitClosed(t *testing.T, ch <-chan ChangeEvent) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel not closed")
+		}
+	}
+}
+
+func TestWatchTableDeliversToEveryWatcher(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "name", DataType: String}}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, err := db.WatchTable(ctx, "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.WatchTable(ctx, "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustInsert(t, db, "items", "i1", map[string]interface{}{"name": "a"})
+	for _, tw := range []*TableWatcher{first, second} {
+		select {
+		case event := <-tw.C:
+			if event.Op != ChangeInsert || event.RowID != "i1" {
+				t.Fatalf("event = %+v, want insert of i1", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no event delivered")
+		}
+	}
+
+	if _, err := db.WatchTable(ctx, "nope"); err == nil {
+		t.Fatal("watching a missing table succeeded")
+	}
+}
+
+func TestWatchTableClosesOnCancel(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "name", DataType: String}}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tw, err := db.WatchTable(ctx, "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitClosed(t, tw.C)
+
+	db.watchMu.Lock()
+	left := len(db.watchers["items"])
+	db.watchMu.Unlock()
+	if left != 0 {
+		t.Fatalf("%d watchers still registered after cancel", left)
+	}
+
+	// Writes after the watcher is gone must not block or panic.
+	mustInsert(t, db, "items", "i1", map[string]interface{}{"name": "a"})
+}
+
+func TestWatchTableCountsDroppedEvents(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateTable(t, db, "items", []Column{{Name: "name", DataType: String}}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tw, err := db.WatchTableWithOptions(ctx, "items", WatchOptions{BufferSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"i1", "i2", "i3", "i4", "i5"} {
+		mustInsert(t, db, "items", id, map[string]interface{}{"name": id})
+	}
+	if got := tw.DroppedEvents(); got != 3 {
+		t.Fatalf("DroppedEvents = %d, want 3", got)
+	}
+
+	cancel()
+	var ops []ChangeOp
+	for event := range tw.C {
+		ops = append(ops, event.Op)
+	}
+	for _, op := range ops {
+		if op == ChangeOverflow {
+			t.Fatalf("events = %v, want no overflow marker", ops)
+		}
+	}
+	if got := tw.DroppedEvents(); got != 3 {
+		t.Fatalf("DroppedEvents after cancel = %d, want 3", got)
+	}
+}
@@ -0,0 +1,388 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of a YAML document with its comment and indentation
+// removed.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlParser reads the subset of YAML that fixtures use: block mappings
+// and sequences, flow mappings and sequences on a single line, and plain,
+// single-quoted and double-quoted scalars.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseFixtureYAML reads a document of the form tables: {name: [rows]}.
+func parseFixtureYAML(data []byte) (map[string][]map[string]interface{}, error) {
+	p := &yamlParser{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" {
+			continue
+		}
+		if text[0] == '\t' {
+			return nil, fmt.Errorf("line %d: tab in indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+
+	var doc interface{}
+	if len(p.lines) > 0 {
+		var err error
+		if doc, err = p.node(0); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.lines) {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+		}
+	}
+
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("fixture is not a mapping with a tables key")
+	}
+	tables, ok := top["tables"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("fixture's tables is not a mapping of table names")
+	}
+
+	fixture := make(map[string][]map[string]interface{}, len(tables))
+	for name, val := range tables {
+		items, ok := val.([]interface{})
+		if val != nil && !ok {
+			return nil, fmt.Errorf("table %s is not a list of rows", name)
+		}
+		rows := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			if rows[i], ok = item.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("row %d of table %s is not a mapping", i+1, name)
+			}
+		}
+		fixture[name] = rows
+	}
+	return fixture, nil
+}
+
+// node parses the node starting at the current line, which must be
+// indented by at least indent; if it is not, the node is null.
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent < indent {
+		return nil, nil
+	}
+
+	line := p.lines[p.pos]
+	switch {
+	case line.text == "-" || strings.HasPrefix(line.text, "- "):
+		return p.sequence(line.indent)
+	case isYAMLKey(line.text):
+		return p.mapping(line.indent)
+	}
+
+	p.pos++
+	val, rest, err := parseYAMLFlow(line.text, false)
+
+	if err == nil && strings.TrimSpace(rest) != "" {
+		err = fmt.Errorf("unexpected %q", rest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", line.num, err)
+	}
+	return val, nil
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !(line.text == "-" || strings.HasPrefix(line.text, "- ")) {
+			break
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if rest == "" {
+			p.pos++
+		} else {
+			// Read the rest of the line as if it began a line of its own,
+			// so that "- key: value" starts a mapping at its key.
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+		}
+
+		item, err := p.node(indent + 1)
+
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent {
+			break
+		}
+
+		key, rest, err := splitYAMLKey(line.text)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.num, err)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %s", line.num, key)
+		}
+		p.pos++
+
+		var val interface{}
+		switch {
+		case rest != "":
+			var after string
+			val, after, err = parseYAMLFlow(rest, false)
+			if err == nil && strings.TrimSpace(after) != "" {
+				err = fmt.Errorf("unexpected %q", after)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.num, err)
+			}
+		case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && strings.HasPrefix(p.lines[p.pos].text, "-"):
+			// A sequence may sit at the same indentation as its key.
+			val, err = p.sequence(indent)
+		default:
+			val, err = p.node(indent + 1)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		m[key] = val
+	}
+	return m, nil
+}
+
+// isYAMLKey reports whether text starts with a mapping key.
+func isYAMLKey(text string) bool {
+	if text[0] == '{' || text[0] == '[' {
+		return false
+	}
+	_, _, err := splitYAMLKey(text)
+	return err == nil
+}
+
+// splitYAMLKey splits "key: value" into its key and value text.
+func splitYAMLKey(text string) (string, string, error) {
+	if text[0] == '"' || text[0] == '\'' {
+		key, rest, err := parseYAMLQuoted(text)
+
+		if err != nil {
+			return "", "", err
+		}
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", fmt.Errorf("expected : after key %q", key)
+		}
+		return key, strings.TrimSpace(rest[1:]), nil
+	}
+
+	if strings.HasSuffix(text, ":") && !strings.Contains(text, ": ") {
+		return strings.TrimSpace(text[:len(text)-1]), "", nil
+	}
+	i := strings.Index(text, ": ")
+	if i <= 0 {
+		return "", "", fmt.Errorf("expected key: value, got %q", text)
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), nil
+}
+
+// parseYAMLFlow parses one value from the start of s, which may be a flow
+// collection, and returns it with the text after it. Inside a collection,
+// a plain scalar ends at a comma or closing bracket.
+func parseYAMLFlow(s string, inFlow bool) (interface{}, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return nil, "", nil
+	}
+
+	switch s[0] {
+	case '"', '\'':
+		text, rest, err := parseYAMLQuoted(s)
+		return text, rest, err
+	case '[':
+		items := []interface{}{}
+		s = strings.TrimLeft(s[1:], " ")
+		for {
+			if s == "" {
+				return nil, "", fmt.Errorf("unterminated [")
+			}
+			if s[0] == ']' {
+				return items, s[1:], nil
+			}
+
+			item, rest, err := parseYAMLFlow(s, true)
+
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			if s, err = yamlFlowNext(rest, ']'); err != nil {
+				return nil, "", err
+			}
+		}
+	case '{':
+		m := make(map[string]interface{})
+		s = strings.TrimLeft(s[1:], " ")
+		for {
+			if s == "" {
+				return nil, "", fmt.Errorf("unterminated {")
+			}
+			if s[0] == '}' {
+				return m, s[1:], nil
+			}
+
+			var key string
+			if s[0] == '"' || s[0] == '\'' {
+				var err error
+				if key, s, err = parseYAMLQuoted(s); err != nil {
+					return nil, "", err
+				}
+				s = strings.TrimLeft(s, " ")
+				if !strings.HasPrefix(s, ":") {
+					return nil, "", fmt.Errorf("expected : after key %q", key)
+				}
+				s = s[1:]
+			} else {
+				i := strings.IndexByte(s, ':')
+				if i <= 0 {
+					return nil, "", fmt.Errorf("expected key: value in {")
+				}
+				key, s = strings.TrimSpace(s[:i]), s[i+1:]
+			}
+
+			val, rest, err := parseYAMLFlow(s, true)
+
+			if err != nil {
+				return nil, "", err
+			}
+			m[key] = val
+			if s, err = yamlFlowNext(rest, '}'); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	end := len(s)
+	if inFlow {
+		end = strings.IndexAny(s, ",]}")
+		if end < 0 {
+			end = len(s)
+		}
+	}
+	return yamlScalar(strings.TrimSpace(s[:end])), s[end:], nil
+}
+
+// yamlFlowNext skips the comma after an item of a flow collection, leaving
+// the closing bracket if there is no comma.
+func yamlFlowNext(s string, closing byte) (string, error) {
+	s = strings.TrimLeft(s, " ")
+	switch {
+	case strings.HasPrefix(s, ","):
+		return strings.TrimLeft(s[1:], " "), nil
+	case s != "" && s[0] == closing:
+		return s, nil
+	}
+	return "", fmt.Errorf("expected , or %c", closing)
+}
+
+// parseYAMLQuoted parses the quoted scalar at the start of s.
+func parseYAMLQuoted(s string) (string, string, error) {
+	if s[0] == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), s[i+1:], nil
+		}
+		return "", "", fmt.Errorf("unterminated '")
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			text, err := strconv.Unquote(s[:i+1])
+
+			if err != nil {
+				return "", "", fmt.Errorf("bad string %s: %w", s[:i+1], err)
+			}
+			return text, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated \"")
+}
+
+// yamlScalar resolves a plain scalar: null, a boolean, an integer, a float,
+// an RFC 3339 date-time or date, or else a string.
+func yamlScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+
+	if c := s[0]; c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && strings.ContainsAny(s, "0123456789") {
+			return f
+		}
+		if t, ok := parseDateTime(s); ok {
+			return t
+		}
+	}
+	return s
+}
+
+// stripYAMLComment removes a # comment, one at the start of the line or
+// after a space, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/veltahq/kiv/engine"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+type Server struct {
+	db  *engine.NewDatabase
+	mux *http.ServeMux
+}
+
+type createTableRequest struct {
+	Name    string          `json:"name"`
+	Columns []engine.Column `json:"columns"`
+	Indexes []engine.Index  `json:"indexes"`
+}
+
+type queryResponse struct {
+	Columns []string                 `json:"columns"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+type errorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Clause    string `json:"clause,omitempty"`
+	Position  *int   `json:"position,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+func New(db *engine.NewDatabase) *Server {
+	s := &Server{
+		db:  db,
+		mux: http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /tables", s.handleListTables)
+	s.mux.HandleFunc("POST /tables", s.handleCreateTable)
+	s.mux.HandleFunc("POST /tables/{table}/rows", s.handleInsertRow)
+	s.mux.HandleFunc("GET /tables/{table}/rows/{id}", s.handleGetRow)
+	s.mux.HandleFunc("PATCH /tables/{table}/rows/{id}", s.handleUpdateRow)
+	s.mux.HandleFunc("DELETE /tables/{table}/rows/{id}", s.handleDeleteRow)
+	s.mux.HandleFunc("POST /query", s.handleQuery)
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, ln)
+}
+
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	httpServer := &http.Server{Handler: s}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// handleHealthz answers health probes with Healthz, as 503 Service
+// Unavailable once the database is shutting down.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	health := s.db.Healthz()
+
+	status := http.StatusOK
+	if health["status"] == "unavailable" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, health)
+}
+
+func (s *Server) handleListTables(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.db.ListTables())
+}
+
+func (s *Server) handleCreateTable(w http.ResponseWriter, r *http.Request) {
+	var req createTableRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.db.CreateTable(req.Name, req.Columns, req.Indexes); err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) handleInsertRow(w http.ResponseWriter, r *http.Request) {
+	var data map[string]interface{}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, ok := data["id"].(string)
+	if !ok || id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("row must have a string id"))
+		return
+	}
+	delete(data, "id")
+
+	row, err := s.db.InsertRowReturning(r.PathValue("table"), id, data)
+
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, row.Columns)
+}
+
+func (s *Server) handleGetRow(w http.ResponseWriter, r *http.Request) {
+	row, err := s.db.GetRowByID(r.PathValue("table"), r.PathValue("id"))
+
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, row.Columns)
+}
+
+func (s *Server) handleUpdateRow(w http.ResponseWriter, r *http.Request) {
+	var data map[string]interface{}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	delete(data, "id")
+
+	row, err := s.db.UpdateRowReturning(r.PathValue("table"), r.PathValue("id"), data)
+
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, row.Columns)
+}
+
+func (s *Server) handleDeleteRow(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DeleteRow(r.PathValue("table"), r.PathValue("id")); err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var query engine.Query
+
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := s.db.ExecuteQueryContext(r.Context(), query)
+
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	resp := queryResponse{
+		Columns: result.Columns,
+		Rows:    make([]map[string]interface{}, 0, len(result.Rows)),
+	}
+	for _, row := range result.Rows {
+		resp.Rows = append(resp.Rows, row.Columns)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// codeStatus maps QueryError codes to HTTP statuses. Codes missing from it,
+// such as CodeInternal, fall back to the sentinel the error wraps.
+var codeStatus = map[engine.ErrorCode]int{
+	engine.CodeSyntaxError:       http.StatusBadRequest,
+	engine.CodeUnknownTable:      http.StatusNotFound,
+	engine.CodeUnknownColumn:     http.StatusBadRequest,
+	engine.CodeUnknownFunction:   http.StatusBadRequest,
+	engine.CodeTypeMismatch:      http.StatusBadRequest,
+	engine.CodeDivisionByZero:    http.StatusBadRequest,
+	engine.CodeInvalidArgument:   http.StatusBadRequest,
+	engine.CodeQueryTimeout:      http.StatusGatewayTimeout,
+	engine.CodeWriteConflict:     http.StatusConflict,
+	engine.CodeResourceExhausted: http.StatusInsufficientStorage,
+}
+
+func statusFor(err error) int {
+	var qe *engine.QueryError
+	if errors.As(err, &qe) {
+		if status, ok := codeStatus[qe.Code]; ok {
+			return status
+		}
+	}
+
+	switch {
+	case errors.Is(err, engine.ErrTableNotFound), errors.Is(err, engine.ErrIDNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, engine.ErrIDExists), errors.Is(err, engine.ErrTableExists),
+		errors.Is(err, engine.ErrVersionConflict), errors.Is(err, engine.ErrUniqueViolation),
+		errors.Is(err, engine.ErrForeignKey), errors.Is(err, engine.ErrConstraintViolation):
+		return http.StatusConflict
+	case errors.Is(err, engine.ErrInvalidQuery), errors.Is(err, engine.ErrInvalidSchema),
+		errors.Is(err, engine.ErrInvalidCast), errors.Is(err, engine.ErrDivisionByZero),
+		errors.Is(err, engine.ErrSchemaViolation), errors.Is(err, engine.ErrCheckViolation),
+		errors.Is(err, engine.ErrViewReadOnly):
+		return http.StatusBadRequest
+	case errors.Is(err, engine.ErrQueryTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, engine.ErrMemoryLimitExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, engine.ErrDatabaseClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeEngineError(w http.ResponseWriter, err error) {
+	resp := errorResponse{Error: err.Error()}
+
+	var qe *engine.QueryError
+	if errors.As(err, &qe) {
+		resp.Code = qe.Code.String()
+		resp.Token = qe.Token
+		resp.Clause = qe.Clause
+		resp.Retryable = qe.Retryable()
+		if qe.Position >= 0 {
+			resp.Position = &qe.Position
+		}
+	}
+
+	writeJSON(w, statusFor(err), resp)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/veltahq/kiv/engine"
+)
+
+// newTestServer returns a server over a database whose users table has a
+// unique email and a name.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	db := &engine.NewDatabase{Name: "test", Tables: make(map[string]engine.Table)}
+	columns := []engine.Column{
+		{Name: "email", DataType: engine.String},
+		{Name: "name", DataType: engine.String, Nullable: true},
+	}
+	indexes := []engine.Index{{Name: "users_email", Columns: []string{"email"}, Unique: true}}
+	if err := db.CreateTable("users", columns, indexes); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateView("named", engine.Query{Select: []string{"id", "name"}, From: "users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(New(db))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do sends body, if not nil, as JSON and decodes the JSON response into
+// out, if not nil. It returns the response status.
+func do(t *testing.T, ts *httptest.Server, method, path string, body, out interface{}) int {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, ts.URL+path, &reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestRowRoutes(t *testing.T) {
+	ts := newTestServer(t)
+
+	var row map[string]interface{}
+	status := do(t, ts, "POST", "/tables/users/rows", map[string]interface{}{"id": "u1", "email": "ann@example.com", "name": "Ann"}, &row)
+	if status != http.StatusCreated {
+		t.Fatalf("insert status = %d, want 201", status)
+	}
+	if row["id"] != "u1" || row["email"] != "ann@example.com" {
+		t.Fatalf("insert returned %v", row)
+	}
+
+	row = nil
+	if status := do(t, ts, "GET", "/tables/users/rows/u1", nil, &row); status != http.StatusOK || row["name"] != "Ann" {
+		t.Fatalf("get = %d %v, want 200 with name Ann", status, row)
+	}
+
+	row = nil
+	if status := do(t, ts, "PATCH", "/tables/users/rows/u1", map[string]interface{}{"name": "Anna"}, &row); status != http.StatusOK {
+		t.Fatalf("update status = %d, want 200", status)
+	}
+	if row["name"] != "Anna" || row["email"] != "ann@example.com" {
+		t.Fatalf("update returned %v, want the merged row", row)
+	}
+
+	var result queryResponse
+	if status := do(t, ts, "POST", "/query", engine.Query{Select: []string{"id", "name"}, From: "users"}, &result); status != http.StatusOK {
+		t.Fatalf("query status = %d, want 200", status)
+	}
+	if len(result.Rows) != 1 || result.Rows[0]["name"] != "Anna" {
+		t.Fatalf("query returned %v", result.Rows)
+	}
+
+	if status := do(t, ts, "DELETE", "/tables/users/rows/u1", nil, nil); status != http.StatusNoContent {
+		t.Fatalf("delete status = %d, want 204", status)
+	}
+	if status := do(t, ts, "GET", "/tables/users/rows/u1", nil, nil); status != http.StatusNotFound {
+		t.Fatalf("get after delete status = %d, want 404", status)
+	}
+}
+
+func TestTableRoutes(t *testing.T) {
+	ts := newTestServer(t)
+
+	req := createTableRequest{Name: "tags", Columns: []engine.Column{{Name: "label", DataType: engine.String}}}
+	if status := do(t, ts, "POST", "/tables", req, nil); status != http.StatusCreated {
+		t.Fatalf("create status = %d, want 201", status)
+	}
+	if status := do(t, ts, "POST", "/tables", req, nil); status != http.StatusConflict {
+		t.Fatalf("second create status = %d, want 409", status)
+	}
+
+	var tables []string
+	if status := do(t, ts, "GET", "/tables", nil, &tables); status != http.StatusOK {
+		t.Fatalf("list status = %d, want 200", status)
+	}
+	found := false
+	for _, name := range tables {
+		found = found || name == "tags"
+	}
+	if !found {
+		t.Fatalf("tables = %v, want tags among them", tables)
+	}
+
+	var health map[string]interface{}
+	if status := do(t, ts, "GET", "/healthz", nil, &health); status != http.StatusOK {
+		t.Fatalf("healthz status = %d, want 200", status)
+	}
+}
+
+func TestErrorStatuses(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, "POST", "/tables/users/rows", map[string]interface{}{"id": "u1", "email": "ann@example.com"}, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"missing id", "POST", "/tables/users/rows", map[string]interface{}{"email": "x@example.com"}, http.StatusBadRequest},
+		{"duplicate id", "POST", "/tables/users/rows", map[string]interface{}{"id": "u1", "email": "x@example.com"}, http.StatusConflict},
+		{"unique violation", "POST", "/tables/users/rows", map[string]interface{}{"id": "u2", "email": "ann@example.com"}, http.StatusConflict},
+		{"schema violation", "POST", "/tables/users/rows", map[string]interface{}{"id": "u3", "email": nil}, http.StatusBadRequest},
+		{"write to view", "POST", "/tables/named/rows", map[string]interface{}{"id": "u4", "email": "v@example.com"}, http.StatusBadRequest},
+		{"missing table", "GET", "/tables/nope/rows/u1", nil, http.StatusNotFound},
+		{"missing row", "PATCH", "/tables/users/rows/u9", map[string]interface{}{"name": "x"}, http.StatusNotFound},
+		{"bad query", "POST", "/query", engine.Query{Select: []string{"id"}, From: "users", Where: "id ="}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp errorResponse
+			if status := do(t, ts, tt.method, tt.path, tt.body, &resp); status != tt.want {
+				t.Fatalf("status = %d (%s), want %d", status, resp.Error, tt.want)
+			}
+			if resp.Error == "" {
+				t.Fatal("response has no error message")
+			}
+		})
+	}
+}
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{engine.ErrSchemaViolation, http.StatusBadRequest},
+		{engine.ErrCheckViolation, http.StatusBadRequest},
+		{engine.ErrViewReadOnly, http.StatusBadRequest},
+		{engine.ErrUniqueViolation, http.StatusConflict},
+		{engine.ErrForeignKey, http.StatusConflict},
+		{engine.ErrConstraintViolation, http.StatusConflict},
+		{engine.ErrIDExists, http.StatusConflict},
+		{engine.ErrTableNotFound, http.StatusNotFound},
+		{engine.ErrQueryTimeout, http.StatusGatewayTimeout},
+		{engine.ErrDatabaseClosed, http.StatusServiceUnavailable},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		wrapped := fmt.Errorf("%w: detail", tt.err)
+		if got := statusFor(wrapped); got != tt.want {
+			t.Errorf("statusFor(%v) = %d, want %d", wrapped, got, tt.want)
+		}
+	}
+}
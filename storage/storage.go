@@ -1 +1,53 @@
 package storage
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func init() {
+	gob.Register(time.Time{})
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+// WriteFile gob-encodes v to path. The data is written to a temporary file
+// in the same directory and renamed into place, so readers never observe a
+// partially written file.
+func WriteFile(path string, v interface{}) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func ReadFile(path string, v interface{}) error {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gob.NewDecoder(f).Decode(v)
+}